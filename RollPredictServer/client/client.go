@@ -0,0 +1,388 @@
+// Package client 实现一个无界面的帧同步客户端（headless client）。
+//
+// 它与 Unity 客户端使用相同的线路格式（len + messageType + protobuf），
+// 支持 TCP、UDP 和 KCP 三种传输方式，供压测工具和集成测试使用。
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/WjcHome/gohello/codec"
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/xtaci/kcp-go/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// 支持的传输协议
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+	ProtocolKCP = "kcp"
+)
+
+const (
+	udpBufferSize    = 64 * 1024 // UDP数据报接收缓冲区
+	messageQueueSize = 256       // 接收消息队列长度
+	connectTimeout   = 5 * time.Second
+	disconnectLinger = 100 * time.Millisecond // KCP关闭前等待断开消息发出
+)
+
+// ErrClosed 表示客户端已关闭
+var ErrClosed = errors.New("client: closed")
+
+// Message 是从服务器收到的一条消息
+type Message struct {
+	Type     myproto.MessageType
+	Body     proto.Message // 已知类型解码后的消息；未知类型为nil
+	Raw      []byte        // 原始protobuf数据
+	Received time.Time     // 接收时间
+}
+
+// Client 是一个无界面的帧同步客户端
+type Client struct {
+	Protocol string
+	PlayerID int32
+
+	conn     net.Conn
+	messages chan *Message
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closed     chan struct{}
+	readErr    error
+
+	clock clockState // 时钟同步和帧时钟
+}
+
+// Dial 连接服务器并等待服务器返回的连接消息（分配的玩家ID）
+func Dial(protocol, addr string) (*Client, error) {
+	var conn net.Conn
+	var err error
+
+	switch protocol {
+	case ProtocolTCP:
+		conn, err = net.DialTimeout("tcp", addr, connectTimeout)
+		if err == nil {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.SetNoDelay(true)
+			}
+		}
+	case ProtocolUDP:
+		conn, err = net.Dial("udp", addr)
+	case ProtocolKCP:
+		conn, err = kcp.DialWithOptions(addr, nil, 0, 0)
+	default:
+		return nil, fmt.Errorf("client: unknown protocol %q", protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Connect(protocol, conn)
+}
+
+// Connect 在已经建立的连接上完成连接握手，等待服务器分配的玩家ID。
+// 测试可以传入包装过的连接（例如 netsim.Conn，或者建立在 netsim.PacketConn 上的KCP会话）来模拟网络；
+// KCP会话会被设置成和服务器相同的快速模式
+func Connect(protocol string, conn net.Conn) (*Client, error) {
+	if protocol != ProtocolTCP && protocol != ProtocolUDP && protocol != ProtocolKCP {
+		return nil, fmt.Errorf("client: unknown protocol %q", protocol)
+	}
+	if session, ok := conn.(*kcp.UDPSession); ok {
+		// 与服务器相同的快速模式配置
+		session.SetNoDelay(1, 10, 2, 1)
+		session.SetWindowSize(128, 128)
+		session.SetMtu(1400)
+		session.SetACKNoDelay(true)
+		session.SetStreamMode(false)
+	}
+
+	c := &Client{
+		Protocol: protocol,
+		conn:     conn,
+		messages: make(chan *Message, messageQueueSize),
+		closed:   make(chan struct{}),
+	}
+
+	// UDP和KCP需要客户端先发送一个数据包，服务器才知道有新客户端
+	if protocol != ProtocolTCP {
+		if err := c.Send(myproto.MessageType_MESSAGE_CONNECT, &myproto.ConnectMessage{}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	go c.readLoop()
+
+	// 等待服务器分配玩家ID
+	timer := time.NewTimer(connectTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.Close()
+				return nil, fmt.Errorf("client: connection closed before connect message: %v", c.readErr)
+			}
+			if connectMsg, ok := msg.Body.(*myproto.ConnectMessage); ok {
+				c.PlayerID = connectMsg.PlayerId
+				return c, nil
+			}
+		case <-timer.C:
+			c.Close()
+			return nil, fmt.Errorf("client: timed out waiting for connect message from %s", conn.RemoteAddr())
+		}
+	}
+}
+
+// Messages 返回接收消息的通道，连接断开后通道关闭
+func (c *Client) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Err 返回导致读取循环退出的错误（在Messages通道关闭后有效）
+func (c *Client) Err() error {
+	return c.readErr
+}
+
+// LocalAddr 返回本地地址
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Send 发送消息（格式：len + messageType + byte[]）
+func (c *Client) Send(messageType myproto.MessageType, msg proto.Message) error {
+	message, err := codec.Encode(messageType, msg)
+	if err != nil {
+		return err
+	}
+
+	// 一次性写入完整消息，避免并发写入时消息交错
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	_, err = c.conn.Write(message)
+	return err
+}
+
+// SendInput 发送一帧输入
+func (c *Client) SendInput(frameData *myproto.FrameData) error {
+	return c.Send(myproto.MessageType_MESSAGE_FRAME_DATA, frameData)
+}
+
+// RequestFrames 请求补发 lastFrameNumber 之后的所有帧
+func (c *Client) RequestFrames(lastFrameNumber int64) error {
+	return c.Send(myproto.MessageType_MESSAGE_FRAME_LOSS, &myproto.GetLossFrame{
+		LastFrameNumber: lastFrameNumber,
+	})
+}
+
+// Heartbeat 发送心跳
+func (c *Client) Heartbeat() error {
+	return c.Send(myproto.MessageType_MESSAGE_HEARTBEAT, &myproto.Heartbeat{})
+}
+
+// SetTimeScale 请求改变房间的时间缩放（只有房主的请求会生效）
+func (c *Client) SetTimeScale(timeScale float64) error {
+	return c.Send(myproto.MessageType_MESSAGE_TIME_SCALE, &myproto.TimeScaleChange{
+		TimeScale: timeScale,
+	})
+}
+
+// Pause 请求暂停（true）或继续（false）
+func (c *Client) Pause(paused bool) error {
+	return c.Send(myproto.MessageType_MESSAGE_PAUSE, &myproto.PauseMessage{
+		Paused: paused,
+	})
+}
+
+// EndMatch 请求结束比赛（只有房主的请求会生效）
+func (c *Client) EndMatch(result *myproto.MatchEnd) error {
+	return c.Send(myproto.MessageType_MESSAGE_MATCH_END, result)
+}
+
+// PostMatch 赛后选择再来一局（true）或返回大厅（false）
+func (c *Client) PostMatch(rematch bool) error {
+	return c.Send(myproto.MessageType_MESSAGE_POST_MATCH, &myproto.PostMatchChoice{
+		Rematch: rematch,
+	})
+}
+
+// SubmitResult 比赛结束后提交自己计算的比赛结果
+func (c *Client) SubmitResult(result *myproto.MatchResult) error {
+	return c.Send(myproto.MessageType_MESSAGE_MATCH_RESULT, result)
+}
+
+// Login 登录账号：token 为空时创建新账号，name 不为空时更新显示名称（两者不能都为空）。
+// 服务器回复一条带账号ID和令牌的 ConnectMessage
+func (c *Client) Login(name, token string) error {
+	return c.Send(myproto.MessageType_MESSAGE_CONNECT, &myproto.ConnectMessage{
+		PlayerId:   c.PlayerID,
+		PlayerName: name,
+		Token:      token,
+	})
+}
+
+// JoinQueue 加入匹配队列（mode 为 versus 或 coop）
+func (c *Client) JoinQueue(mode string, teamSize int32) error {
+	return c.Send(myproto.MessageType_MESSAGE_QUEUE, &myproto.MatchQueue{
+		Mode:     mode,
+		TeamSize: teamSize,
+		Queued:   true,
+	})
+}
+
+// LeaveQueue 离开匹配队列
+func (c *Client) LeaveQueue() error {
+	return c.Send(myproto.MessageType_MESSAGE_QUEUE, &myproto.MatchQueue{})
+}
+
+// ConfirmMatch 确认（accept 为true）或拒绝匹配到的对局
+func (c *Client) ConfirmMatch(proposalID uint64, accept bool) error {
+	return c.Send(myproto.MessageType_MESSAGE_MATCH_FOUND, &myproto.MatchFound{
+		ProposalId: proposalID,
+		Accept:     accept,
+	})
+}
+
+// AssignTeams 设置玩家的队伍和槽位（只有房主在游戏开始前的请求会生效）
+func (c *Client) AssignTeams(roster ...*myproto.RosterEntry) error {
+	return c.Send(myproto.MessageType_MESSAGE_TEAM_ASSIGN, &myproto.TeamAssignment{Roster: roster})
+}
+
+// ChangeSettings 选择房间的游戏设置（只有房主在游戏开始前的请求会生效），
+// 服务器广播补全后的设置，请求不合法时只回复房主错误原因
+func (c *Client) ChangeSettings(settings *myproto.GameSettings) error {
+	return c.Send(myproto.MessageType_MESSAGE_ROOM_SETTINGS, &myproto.RoomSettings{Settings: settings})
+}
+
+// CreateRoom 创建房间并成为房主，服务器回复 RoomInfo（失败时带 error）
+func (c *Client) CreateRoom(request *myproto.CreateRoomRequest) error {
+	return c.Send(myproto.MessageType_MESSAGE_CREATE_ROOM, request)
+}
+
+// JoinRoom 用邀请码加入房间，服务器回复 RoomInfo（失败时带 error）
+func (c *Client) JoinRoom(roomID, password string) error {
+	return c.Send(myproto.MessageType_MESSAGE_JOIN_ROOM, &myproto.JoinRoomRequest{RoomId: roomID, Password: password})
+}
+
+// HostCommand 执行房主命令（踢人、转让房主、锁定房间、修改人数上限），
+// 成功时服务器向房间内所有玩家广播命令和新的 RoomInfo，失败时只回复房主 error
+func (c *Client) HostCommand(action myproto.HostAction, targetID, maxPlayers int32) error {
+	return c.Send(myproto.MessageType_MESSAGE_HOST_COMMAND, &myproto.HostCommand{
+		Action: action, TargetId: targetID, MaxPlayers: maxPlayers,
+	})
+}
+
+// QueryMatchHistory 查询账号的比赛历史（accountID 为0时查询自己）
+func (c *Client) QueryMatchHistory(accountID int64, limit int32) error {
+	return c.Send(myproto.MessageType_MESSAGE_MATCH_HISTORY, &myproto.MatchHistory{
+		AccountId: accountID,
+		Limit:     limit,
+	})
+}
+
+// Disconnect 通知服务器断开并关闭连接
+func (c *Client) Disconnect() error {
+	err := c.Send(myproto.MessageType_MESSAGE_DISCONNECT, &myproto.DisconnectMessage{
+		PlayerId: c.PlayerID,
+	})
+	// KCP关闭会话时会丢弃尚未确认的数据，稍等一下让断开消息送达
+	if err == nil && c.Protocol == ProtocolKCP {
+		time.Sleep(disconnectLinger)
+	}
+	c.Close()
+	return err
+}
+
+// Close 关闭连接（不通知服务器）
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// 读取循环：解析服务器消息并投递到消息通道
+func (c *Client) readLoop() {
+	defer close(c.messages)
+
+	var err error
+	if c.Protocol == ProtocolUDP {
+		err = c.readDatagrams()
+	} else {
+		err = c.readStream()
+	}
+
+	select {
+	case <-c.closed:
+		c.readErr = ErrClosed
+	default:
+		c.readErr = err
+	}
+}
+
+// 流式读取（TCP/KCP）：按 len + messageType + data 拆包
+func (c *Client) readStream() error {
+	reader := bufio.NewReader(c.conn)
+	for {
+		messageType, data, err := codec.ReadMessage(reader, codec.ServerToClient)
+		if err != nil {
+			return err
+		}
+		if !c.deliver(messageType, data) {
+			return ErrClosed
+		}
+	}
+}
+
+// 数据报读取（UDP）：每个数据报是一条完整消息
+func (c *Client) readDatagrams() error {
+	buffer := make([]byte, udpBufferSize)
+	for {
+		n, err := c.conn.Read(buffer)
+		if err != nil {
+			return err
+		}
+		// 非法数据报直接丢弃
+		messageType, payload, err := codec.DecodeDatagram(buffer[:n], codec.ServerToClient)
+		if err != nil {
+			continue
+		}
+		data := make([]byte, len(payload))
+		copy(data, payload)
+		if !c.deliver(messageType, data) {
+			return ErrClosed
+		}
+	}
+}
+
+// 解码并投递消息，客户端关闭时返回false
+func (c *Client) deliver(messageType myproto.MessageType, data []byte) bool {
+	msg := &Message{
+		Type:     messageType,
+		Raw:      data,
+		Received: time.Now(),
+	}
+	if body, err := codec.DecodeBody(messageType, data); err == nil {
+		msg.Body = body
+		c.observeClock(body, msg.Received)
+	}
+
+	select {
+	case c.messages <- msg:
+		return true
+	case <-c.closed:
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 时钟偏差每次向新样本移动 1/offsetSmoothing
+const offsetSmoothing = 8
+
+// ClockSync 是客户端测得的延迟和时钟偏差
+type ClockSync struct {
+	RTT     time.Duration // 最近一次Ping的往返时间（已扣除服务器处理时间）
+	Offset  time.Duration // 时钟偏差：服务器时钟 - 本地时钟（平滑）
+	Samples int           // 收到的Pong数
+}
+
+// 时钟同步状态（读取协程写入，调用方读取）
+type clockState struct {
+	mutex sync.Mutex
+	sync  ClockSync
+
+	sequence           int64
+	lastServerSendTime int64     // 上一个Pong的 server_send_time，下一个Ping回显给服务器
+	lastPongReceived   time.Time // 收到上一个Pong的本地时间
+
+	// 帧时钟（本地时钟），第N帧的计划时间 = frameAnchor + (N - frameAnchorNumber) * frameInterval
+	frameAnchor       time.Time
+	frameAnchorNumber int64
+	frameInterval     time.Duration
+}
+
+// Ping 发送一个测时请求，服务器回复Pong后 Clock() 和 ExpectedFrame() 会更新
+func (c *Client) Ping() error {
+	now := time.Now()
+
+	c.clock.mutex.Lock()
+	c.clock.sequence++
+	ping := &myproto.Ping{
+		Sequence:       c.clock.sequence,
+		ClientSendTime: now.UnixNano(),
+	}
+	if c.clock.lastServerSendTime != 0 {
+		ping.EchoServerSendTime = c.clock.lastServerSendTime
+		ping.EchoHoldNs = int64(now.Sub(c.clock.lastPongReceived))
+	}
+	c.clock.mutex.Unlock()
+
+	return c.Send(myproto.MessageType_MESSAGE_PING, ping)
+}
+
+// Clock 返回测得的延迟和时钟偏差，Samples 为0表示还没有收到Pong
+func (c *Client) Clock() ClockSync {
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	return c.clock.sync
+}
+
+// ExpectedFrame 返回按服务器帧时钟在本地时间 now 时应当已经发出的帧号，
+// 游戏开始前返回 false
+func (c *Client) ExpectedFrame(now time.Time) (int64, bool) {
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	if c.clock.frameInterval <= 0 {
+		return 0, false
+	}
+	if now.Before(c.clock.frameAnchor) {
+		return c.clock.frameAnchorNumber, true
+	}
+	return c.clock.frameAnchorNumber + int64(now.Sub(c.clock.frameAnchor)/c.clock.frameInterval), true
+}
+
+// 根据收到的消息更新时钟同步状态
+func (c *Client) observeClock(body proto.Message, received time.Time) {
+	switch body := body.(type) {
+	case *myproto.Pong:
+		c.observePong(body, received)
+	case *myproto.GameStart:
+		if body.StartTime == 0 || body.FrameRate <= 0 || body.TimeScale <= 0 {
+			return
+		}
+		interval := time.Duration(float64(time.Second) / (float64(body.FrameRate) * body.TimeScale))
+		c.clock.mutex.Lock()
+		c.setFrameClock(body.StartTime, 0, interval)
+		c.clock.mutex.Unlock()
+	}
+}
+
+// NTP式计算：t1 客户端发送，t2 服务器接收，t3 服务器发送，t4 客户端接收
+func (c *Client) observePong(pong *myproto.Pong, received time.Time) {
+	t1, t2, t3, t4 := pong.ClientSendTime, pong.ServerReceiveTime, pong.ServerSendTime, received.UnixNano()
+
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+
+	c.clock.lastServerSendTime = t3
+	c.clock.lastPongReceived = received
+
+	rtt := time.Duration((t4 - t1) - (t3 - t2))
+	offset := time.Duration(((t2 - t1) + (t3 - t4)) / 2)
+	current := &c.clock.sync
+	if current.Samples == 0 {
+		current.Offset = offset
+	} else {
+		current.Offset += (offset - current.Offset) / offsetSmoothing
+	}
+	current.RTT = rtt
+	current.Samples++
+
+	if pong.FrameIntervalNs > 0 {
+		c.setFrameClock(pong.FrameAnchorTime, pong.FrameAnchorNumber, time.Duration(pong.FrameIntervalNs))
+	}
+}
+
+// 设置帧时钟，服务器时间按时钟偏差换算为本地时间（调用方持有锁）
+func (c *Client) setFrameClock(serverAnchor, anchorNumber int64, interval time.Duration) {
+	c.clock.frameAnchor = time.Unix(0, serverAnchor).Add(-c.clock.sync.Offset)
+	c.clock.frameAnchorNumber = anchorNumber
+	c.clock.frameInterval = interval
+}
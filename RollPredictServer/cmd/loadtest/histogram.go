@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	histogramResolution = 100 * time.Microsecond // 桶宽度
+	histogramBuckets    = 20000                  // 覆盖 0 ~ 2s，超出部分计入最后一个桶
+)
+
+// histogram 是一个并发安全的定宽直方图，用于统计延迟和抖动分布
+type histogram struct {
+	buckets [histogramBuckets]atomic.Int64
+	count   atomic.Int64
+	sum     atomic.Int64
+	max     atomic.Int64
+}
+
+// 记录一个样本
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = -d
+	}
+	index := int(d / histogramResolution)
+	if index >= histogramBuckets {
+		index = histogramBuckets - 1
+	}
+	h.buckets[index].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+	for {
+		current := h.max.Load()
+		if int64(d) <= current || h.max.CompareAndSwap(current, int64(d)) {
+			break
+		}
+	}
+}
+
+// 计算分位数（q 取值 0~1），返回所在桶的上界
+func (h *histogram) quantile(q float64) time.Duration {
+	total := h.count.Load()
+	if total == 0 {
+		return 0
+	}
+	target := int64(float64(total) * q)
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i := range h.buckets {
+		seen += h.buckets[i].Load()
+		if seen >= target {
+			return time.Duration(i+1) * histogramResolution
+		}
+	}
+	return time.Duration(h.max.Load())
+}
+
+// 格式化统计摘要
+func (h *histogram) summary() string {
+	total := h.count.Load()
+	if total == 0 {
+		return "n=0"
+	}
+	mean := time.Duration(h.sum.Load() / total)
+	return fmt.Sprintf("n=%d mean=%v p50=%v p95=%v p99=%v max=%v",
+		total, mean.Round(10*time.Microsecond), h.quantile(0.50), h.quantile(0.95), h.quantile(0.99),
+		time.Duration(h.max.Load()).Round(10*time.Microsecond))
+}
@@ -0,0 +1,399 @@
+// loadtest 是帧同步服务器的压测工具。
+//
+// 它基于无界面客户端（client 包）模拟大量玩家，按协议轮流分配到 TCP/UDP/KCP，
+// 以帧率发送输入，随机注入断线重连和补帧请求，并周期性输出：
+//   - 服务器帧间隔抖动（ServerFrame.Timestamp）和客户端收帧抖动
+//   - 端到端输入延迟（发送输入 -> 在服务器帧中收到自己的输入）
+//   - 服务器进程CPU和内存占用（需指定 -server-pid，仅Linux）
+//
+// 示例：
+//
+//	go run ./cmd/loadtest -players=2000 -protocols=tcp,udp,kcp -duration=2m -server-pid=$(pgrep frame_sync_server)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+var (
+	players        = flag.Int("players", 100, "模拟玩家数量")
+	protocols      = flag.String("protocols", "tcp,udp,kcp", "使用的协议（逗号分隔，玩家按顺序轮流分配）")
+	tcpAddr        = flag.String("tcp", "127.0.0.1:8887", "服务器TCP地址")
+	udpAddr        = flag.String("udp", "127.0.0.1:8888", "服务器UDP地址")
+	kcpAddr        = flag.String("kcp", "127.0.0.1:8889", "服务器KCP地址")
+	duration       = flag.Duration("duration", time.Minute, "压测持续时间")
+	rampUp         = flag.Duration("ramp", 10*time.Second, "所有玩家在此时间内均匀接入")
+	frameInterval  = flag.Duration("frame-interval", 50*time.Millisecond, "收到GameStart之前假定的帧间隔，之后按GameStart中的帧率和时间缩放")
+	disconnectRate = flag.Float64("disconnect-rate", 0, "每个玩家每秒断线的概率（断线后自动重连）")
+	lossRate       = flag.Float64("loss-rate", 0, "每个玩家每秒发送补帧请求的概率")
+	reportInterval = flag.Duration("report", 5*time.Second, "统计输出间隔")
+	serverPID      = flag.Int("server-pid", 0, "服务器进程ID，用于采样CPU和内存（0表示不采样）")
+	seed           = flag.Int64("seed", 1, "随机种子（相同种子产生相同的输入和故障注入序列）")
+)
+
+// 输入超过此时间仍未在服务器帧中出现则视为丢失
+const inputTimeout = 5 * time.Second
+
+// loadStats 汇总所有玩家的统计数据
+type loadStats struct {
+	connected      atomic.Int64 // 当前在线玩家
+	connects       atomic.Int64 // 成功连接次数
+	connectErrors  atomic.Int64 // 连接失败次数
+	disconnects    atomic.Int64 // 注入的断线次数
+	framesReceived atomic.Int64 // 收到的服务器帧
+	frameGaps      atomic.Int64 // 帧号不连续次数
+	inputsSent     atomic.Int64 // 发送的输入
+	inputsAcked    atomic.Int64 // 在服务器帧中确认的输入
+	inputsLost     atomic.Int64 // 超时未确认的输入
+	lossRequests   atomic.Int64 // 发送的补帧请求
+	lossReplies    atomic.Int64 // 收到的补帧回复
+	lossFrames     atomic.Int64 // 补帧回复中的帧数
+	lossMismatches atomic.Int64 // 补帧回复范围与请求不符
+
+	gameStarts   atomic.Int64 // 收到的游戏开始消息（每个入局玩家一次）
+	roomsStarted atomic.Int64 // 开局的房间数（按房主统计）
+
+	serverTickJitter  histogram // 服务器帧时间戳间隔与帧间隔的偏差
+	arrivalJitter     histogram // 客户端收帧间隔与帧间隔的偏差
+	inputLatency      histogram // 端到端输入延迟
+	protocolConnected map[string]*atomic.Int64
+}
+
+func main() {
+	flag.Parse()
+
+	protocolList := strings.Split(*protocols, ",")
+	addrs := map[string]string{
+		client.ProtocolTCP: *tcpAddr,
+		client.ProtocolUDP: *udpAddr,
+		client.ProtocolKCP: *kcpAddr,
+	}
+	stats := &loadStats{
+		protocolConnected: make(map[string]*atomic.Int64),
+	}
+	for i, protocol := range protocolList {
+		protocol = strings.TrimSpace(protocol)
+		if _, ok := addrs[protocol]; !ok {
+			log.Fatalf("未知协议: %q", protocol)
+		}
+		protocolList[i] = protocol
+		stats.protocolConnected[protocol] = &atomic.Int64{}
+	}
+
+	monitor, err := newProcessMonitor(*serverPID)
+	if err != nil {
+		log.Fatalf("无法采样服务器进程 %d: %v", *serverPID, err)
+	}
+
+	fmt.Printf("========================================\n")
+	fmt.Printf("帧同步服务器压测\n")
+	fmt.Printf("========================================\n")
+	fmt.Printf("玩家数: %d  协议: %s  持续: %v  接入时间: %v\n", *players, strings.Join(protocolList, ","), *duration, *rampUp)
+	fmt.Printf("帧间隔: %v  断线率: %.3f/s  补帧请求率: %.3f/s  种子: %d\n", *frameInterval, *disconnectRate, *lossRate, *seed)
+	fmt.Printf("========================================\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *players; i++ {
+		protocol := protocolList[i%len(protocolList)]
+		p := &player{
+			index:    i,
+			protocol: protocol,
+			addr:     addrs[protocol],
+			rng:      rand.New(rand.NewSource(*seed + int64(i))),
+			stats:    stats,
+		}
+		// 在接入时间内均匀分布每个玩家的启动时间
+		startDelay := time.Duration(0)
+		if *players > 1 {
+			startDelay = *rampUp * time.Duration(i) / time.Duration(*players)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-time.After(startDelay):
+				p.run(ctx)
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(*reportInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			stats.report(time.Since(start), monitor)
+		case <-ctx.Done():
+			done = true
+		}
+	}
+
+	wg.Wait()
+	fmt.Printf("\n============== 最终结果 ==============\n")
+	stats.report(time.Since(start), monitor)
+}
+
+// player 是一个模拟玩家，断线后会自动重连
+type player struct {
+	index    int
+	protocol string
+	addr     string
+	rng      *rand.Rand
+	stats    *loadStats
+}
+
+// 运行玩家直到压测结束
+func (p *player) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if !p.session(ctx) {
+			// 连接失败，稍后重试
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// 一次连接会话，返回是否成功建立连接
+func (p *player) session(ctx context.Context) bool {
+	c, err := client.Dial(p.protocol, p.addr)
+	if err != nil {
+		p.stats.connectErrors.Add(1)
+		if p.stats.connectErrors.Load() <= 10 {
+			log.Printf("玩家 %d (%s) 连接失败: %v", p.index, p.protocol, err)
+		}
+		return false
+	}
+	p.stats.connects.Add(1)
+	p.stats.connected.Add(1)
+	p.stats.protocolConnected[p.protocol].Add(1)
+	defer func() {
+		p.stats.connected.Add(-1)
+		p.stats.protocolConnected[p.protocol].Add(-1)
+	}()
+
+	// 客户端按服务器的帧间隔发送输入
+	interval := *frameInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		started         bool
+		lastFrame       int64
+		lastArrival     time.Time
+		lastTimestamp   int64
+		inputSeq        int64
+		pendingInputs   = make(map[int64]time.Time) // 输入序号 -> 发送时间
+		pendingLossFrom = int64(-1)                 // 等待中的补帧请求（-1表示无）
+	)
+	// 每帧触发事件的概率
+	disconnectChance := *disconnectRate * interval.Seconds()
+	lossChance := *lossRate * interval.Seconds()
+	setInterval := func(newInterval time.Duration) {
+		if newInterval <= 0 {
+			return
+		}
+		interval = newInterval
+		ticker.Reset(interval)
+		disconnectChance = *disconnectRate * interval.Seconds()
+		lossChance = *lossRate * interval.Seconds()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.Disconnect()
+			return true
+
+		case msg, ok := <-c.Messages():
+			if !ok {
+				// 服务器断开
+				return true
+			}
+			switch body := msg.Body.(type) {
+			case *myproto.GameStart:
+				started = true
+				p.stats.gameStarts.Add(1)
+				// 房间ID在服务器上可能被复用，用玩家列表中的最小ID来对每局只计数一次
+				if len(body.PlayerIds) > 0 && c.PlayerID == minPlayerID(body.PlayerIds) {
+					p.stats.roomsStarted.Add(1)
+				}
+				if body.FrameRate > 0 && body.TimeScale > 0 {
+					setInterval(time.Duration(float64(time.Second) / (float64(body.FrameRate) * body.TimeScale)))
+				}
+
+			case *myproto.TimeScaleChange:
+				setInterval(time.Duration(body.FrameIntervalNs))
+
+			case *myproto.ServerFrame:
+				p.stats.framesReceived.Add(1)
+				if lastFrame > 0 && body.FrameNumber == lastFrame+1 {
+					p.stats.arrivalJitter.record(msg.Received.Sub(lastArrival) - interval)
+					p.stats.serverTickJitter.record(time.Duration(body.Timestamp-lastTimestamp) - interval)
+				} else if lastFrame > 0 && body.FrameNumber > lastFrame+1 {
+					p.stats.frameGaps.Add(1)
+				}
+				if body.FrameNumber > lastFrame {
+					lastFrame = body.FrameNumber
+					lastArrival = msg.Received
+					lastTimestamp = body.Timestamp
+				}
+				for _, frameData := range body.FrameDatas {
+					if frameData.PlayerId != c.PlayerID {
+						continue
+					}
+					if sentAt, ok := pendingInputs[frameData.FrameNumber]; ok {
+						p.stats.inputLatency.record(msg.Received.Sub(sentAt))
+						p.stats.inputsAcked.Add(1)
+						delete(pendingInputs, frameData.FrameNumber)
+					}
+				}
+
+			case *myproto.SendAllFrame:
+				p.stats.lossReplies.Add(1)
+				p.stats.lossFrames.Add(int64(len(body.AllNeedFrame)))
+				if pendingLossFrom >= 0 && !isConsecutiveFrom(body.AllNeedFrame, pendingLossFrom+1) {
+					p.stats.lossMismatches.Add(1)
+				}
+				pendingLossFrom = -1
+			}
+
+		case now := <-ticker.C:
+			if !started {
+				continue
+			}
+
+			// 注入断线：一半正常断开，一半直接关闭连接
+			if p.rng.Float64() < disconnectChance {
+				p.stats.disconnects.Add(1)
+				if p.rng.Intn(2) == 0 {
+					c.Disconnect()
+				} else {
+					c.Close()
+				}
+				return true
+			}
+
+			// 注入补帧请求：请求最近若干帧
+			if pendingLossFrom < 0 && lastFrame > 1 && p.rng.Float64() < lossChance {
+				from := lastFrame - 1 - int64(p.rng.Intn(20))
+				if from < 0 {
+					from = 0
+				}
+				if c.RequestFrames(from) == nil {
+					pendingLossFrom = from
+					p.stats.lossRequests.Add(1)
+				}
+			}
+
+			// 发送一帧输入，用 frame_number 作为输入序号来匹配回显
+			inputSeq++
+			frameData := p.randomInput(c.PlayerID, inputSeq)
+			if err := c.SendInput(frameData); err != nil {
+				return true
+			}
+			pendingInputs[inputSeq] = now
+			p.stats.inputsSent.Add(1)
+
+			for seq, sentAt := range pendingInputs {
+				if now.Sub(sentAt) > inputTimeout {
+					delete(pendingInputs, seq)
+					p.stats.inputsLost.Add(1)
+				}
+			}
+		}
+	}
+}
+
+// 生成随机输入
+func (p *player) randomInput(playerID int32, seq int64) *myproto.FrameData {
+	frameData := &myproto.FrameData{
+		PlayerId:    playerID,
+		Direction:   myproto.InputDirection(p.rng.Intn(9)),
+		FrameNumber: seq,
+	}
+	if p.rng.Intn(10) == 0 {
+		frameData.IsFire = true
+		fireX := p.rng.Int63n(20000) - 10000
+		fireY := p.rng.Int63n(20000) - 10000
+		frameData.FireX = &fireX
+		frameData.FireY = &fireY
+	}
+	return frameData
+}
+
+// 检查补发的帧是否从 first 开始连续
+func isConsecutiveFrom(frames []*myproto.ServerFrame, first int64) bool {
+	for i, frame := range frames {
+		if frame.FrameNumber != first+int64(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// 返回最小的玩家ID
+func minPlayerID(playerIDs []int32) int32 {
+	result := playerIDs[0]
+	for _, id := range playerIDs[1:] {
+		if id < result {
+			result = id
+		}
+	}
+	return result
+}
+
+// 输出统计
+func (s *loadStats) report(elapsed time.Duration, monitor *processMonitor) {
+	byProtocol := make([]string, 0, len(s.protocolConnected))
+	for protocol, count := range s.protocolConnected {
+		byProtocol = append(byProtocol, fmt.Sprintf("%s=%d", protocol, count.Load()))
+	}
+
+	fmt.Printf("[%v] 在线: %d (%s)  连接: %d  失败: %d  断线注入: %d\n",
+		elapsed.Round(time.Second), s.connected.Load(), strings.Join(byProtocol, " "),
+		s.connects.Load(), s.connectErrors.Load(), s.disconnects.Load())
+	fmt.Printf("  房间: %d (累计入局玩家 %d)  收帧: %d (%.0f/s)  帧号跳变: %d\n",
+		s.roomsStarted.Load(), s.gameStarts.Load(), s.framesReceived.Load(),
+		float64(s.framesReceived.Load())/elapsed.Seconds(), s.frameGaps.Load())
+	fmt.Printf("  输入: 发送 %d  确认 %d  丢失 %d\n", s.inputsSent.Load(), s.inputsAcked.Load(), s.inputsLost.Load())
+	fmt.Printf("  补帧: 请求 %d  回复 %d  帧数 %d  范围不符 %d\n",
+		s.lossRequests.Load(), s.lossReplies.Load(), s.lossFrames.Load(), s.lossMismatches.Load())
+	fmt.Printf("  输入延迟:     %s\n", s.inputLatency.summary())
+	fmt.Printf("  服务器帧抖动: %s\n", s.serverTickJitter.summary())
+	fmt.Printf("  客户端收帧抖动: %s\n", s.arrivalJitter.summary())
+
+	if monitor != nil {
+		cpuPercent, rssBytes, err := monitor.sample()
+		if err != nil {
+			fmt.Printf("  服务器进程: 采样失败: %v\n", err)
+		} else {
+			fmt.Printf("  服务器进程: CPU %.1f%%  内存 %.1f MB\n", cpuPercent, float64(rssBytes)/(1024*1024))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Linux 下 /proc/<pid>/stat 中 utime/stime 的单位（USER_HZ），绝大多数发行版为100
+const clockTicksPerSecond = 100
+
+// processSample 是一次进程资源采样
+type processSample struct {
+	at       time.Time
+	cpuTicks int64 // utime + stime
+	rssBytes int64 // 常驻内存
+}
+
+// processMonitor 通过 /proc 采样服务器进程的CPU和内存占用
+type processMonitor struct {
+	pid  int
+	last processSample
+}
+
+// 创建进程监视器，pid 为0时返回nil（不采样）
+func newProcessMonitor(pid int) (*processMonitor, error) {
+	if pid <= 0 {
+		return nil, nil
+	}
+	m := &processMonitor{pid: pid}
+	sample, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	m.last = sample
+	return m, nil
+}
+
+// 采样一次，返回上次采样以来的CPU占用率（100% = 一个核）和当前常驻内存
+func (m *processMonitor) sample() (cpuPercent float64, rssBytes int64, err error) {
+	current, err := m.read()
+	if err != nil {
+		return 0, 0, err
+	}
+	elapsed := current.at.Sub(m.last.at).Seconds()
+	if elapsed > 0 {
+		cpuSeconds := float64(current.cpuTicks-m.last.cpuTicks) / clockTicksPerSecond
+		cpuPercent = cpuSeconds / elapsed * 100
+	}
+	m.last = current
+	return cpuPercent, current.rssBytes, nil
+}
+
+// 读取 /proc/<pid>/stat 和 /proc/<pid>/status
+func (m *processMonitor) read() (processSample, error) {
+	sample := processSample{at: time.Now()}
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", m.pid))
+	if err != nil {
+		return sample, err
+	}
+	// 第2个字段（进程名）可能包含空格，从最后一个')'之后开始解析
+	text := string(stat)
+	end := strings.LastIndexByte(text, ')')
+	if end < 0 {
+		return sample, fmt.Errorf("unexpected /proc/%d/stat format", m.pid)
+	}
+	fields := strings.Fields(text[end+1:])
+	// 去掉pid和进程名后，utime和stime分别是第12和第13个字段
+	if len(fields) < 13 {
+		return sample, fmt.Errorf("unexpected /proc/%d/stat format", m.pid)
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	sample.cpuTicks = utime + stime
+
+	status, err := os.Open(fmt.Sprintf("/proc/%d/status", m.pid))
+	if err != nil {
+		return sample, err
+	}
+	defer status.Close()
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "VmRSS:") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				kb, _ := strconv.ParseInt(fields[1], 10, 64)
+				sample.rssBytes = kb * 1024
+			}
+			break
+		}
+	}
+	return sample, scanner.Err()
+}
@@ -0,0 +1,279 @@
+// Package codec 实现帧同步协议的消息编解码。
+//
+// 线路格式：len(4 bytes, big endian) + messageType(1 byte) + protobuf数据，
+// 其中 len = 1 + protobuf数据长度。TCP/KCP 按此格式拆包，UDP 每个数据报恰好一条消息。
+//
+// 解码时先校验长度和消息类型，再按类型的长度上限分配缓冲区，
+// 未知类型、零长度、长度不一致的消息都会被拒绝，不会panic或超额分配内存。
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Direction 表示消息的传输方向，可按位组合
+type Direction uint8
+
+const (
+	ClientToServer Direction = 1 << iota // 客户端 -> 服务器
+	ServerToClient                       // 服务器 -> 客户端
+)
+
+const (
+	LengthSize     = 4              // 长度字段字节数
+	HeaderSize     = LengthSize + 1 // 长度 + 消息类型
+	MaxMessageSize = 1024 * 1024    // len 字段允许的最大值（1MB）
+	maxPayloadSize = MaxMessageSize - 1
+	readChunkSize  = 64 * 1024 // 大消息按块读取，避免按声明长度一次性分配
+)
+
+// 各类消息protobuf数据的长度上限
+const (
+	tinyMaxSize   = 128            // 只有几个整数字段的消息
+	smallMaxSize  = 1024           // 带字符串的小消息
+	mediumMaxSize = 64 * 1024      // 游戏开始等中等消息
+	largeMaxSize  = maxPayloadSize // 服务器帧、补帧等大消息
+)
+
+var (
+	ErrEmptyMessage    = errors.New("codec: zero-length message")
+	ErrUnknownType     = errors.New("codec: unknown message type")
+	ErrMessageTooLarge = errors.New("codec: message too large")
+	ErrLengthMismatch  = errors.New("codec: length does not match datagram size")
+	ErrTruncated       = errors.New("codec: truncated message")
+)
+
+// messageSpec 描述一种消息类型的方向、长度上限和protobuf类型
+type messageSpec struct {
+	directions Direction
+	maxSize    int
+	newBody    func() proto.Message
+}
+
+// 所有已知消息类型，新增消息类型时需要在这里登记
+var messageSpecs = map[myproto.MessageType]messageSpec{
+	myproto.MessageType_MESSAGE_CONNECT: {
+		ClientToServer | ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.ConnectMessage{} },
+	},
+	myproto.MessageType_MESSAGE_FRAME_DATA: {
+		ClientToServer, tinyMaxSize,
+		func() proto.Message { return &myproto.FrameData{} },
+	},
+	myproto.MessageType_MESSAGE_SERVER_FRAME: {
+		ServerToClient, largeMaxSize,
+		func() proto.Message { return &myproto.ServerFrame{} },
+	},
+	myproto.MessageType_MESSAGE_DISCONNECT: {
+		ClientToServer | ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.DisconnectMessage{} },
+	},
+	myproto.MessageType_MESSAGE_GAME_START: {
+		ServerToClient, mediumMaxSize,
+		func() proto.Message { return &myproto.GameStart{} },
+	},
+	myproto.MessageType_MESSAGE_FRAME_LOSS: {
+		ClientToServer, tinyMaxSize,
+		func() proto.Message { return &myproto.GetLossFrame{} },
+	},
+	myproto.MessageType_MESSAGE_FRAME_NEED: {
+		ServerToClient, largeMaxSize,
+		func() proto.Message { return &myproto.SendAllFrame{} },
+	},
+	myproto.MessageType_MESSAGE_HEARTBEAT: {
+		ClientToServer, tinyMaxSize,
+		func() proto.Message { return &myproto.Heartbeat{} },
+	},
+	myproto.MessageType_MESSAGE_TIME_SCALE: {
+		ClientToServer | ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.TimeScaleChange{} },
+	},
+	myproto.MessageType_MESSAGE_PING: {
+		ClientToServer, tinyMaxSize,
+		func() proto.Message { return &myproto.Ping{} },
+	},
+	myproto.MessageType_MESSAGE_PONG: {
+		ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.Pong{} },
+	},
+	myproto.MessageType_MESSAGE_INPUT_DELAY: {
+		ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.InputDelayChange{} },
+	},
+	myproto.MessageType_MESSAGE_PAUSE: {
+		ClientToServer | ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.PauseMessage{} },
+	},
+	myproto.MessageType_MESSAGE_MATCH_END: {
+		ClientToServer | ServerToClient, mediumMaxSize,
+		func() proto.Message { return &myproto.MatchEnd{} },
+	},
+	myproto.MessageType_MESSAGE_POST_MATCH: {
+		ClientToServer | ServerToClient, tinyMaxSize,
+		func() proto.Message { return &myproto.PostMatchChoice{} },
+	},
+	myproto.MessageType_MESSAGE_MATCH_RESULT: {
+		ClientToServer | ServerToClient, mediumMaxSize,
+		func() proto.Message { return &myproto.MatchResult{} },
+	},
+	myproto.MessageType_MESSAGE_MATCH_HISTORY: {
+		ClientToServer | ServerToClient, mediumMaxSize,
+		func() proto.Message { return &myproto.MatchHistory{} },
+	},
+	myproto.MessageType_MESSAGE_QUEUE: {
+		ClientToServer | ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.MatchQueue{} },
+	},
+	myproto.MessageType_MESSAGE_MATCH_FOUND: {
+		ClientToServer | ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.MatchFound{} },
+	},
+	myproto.MessageType_MESSAGE_TEAM_ASSIGN: {
+		ClientToServer | ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.TeamAssignment{} },
+	},
+	myproto.MessageType_MESSAGE_ROOM_SETTINGS: {
+		ClientToServer | ServerToClient, mediumMaxSize,
+		func() proto.Message { return &myproto.RoomSettings{} },
+	},
+	myproto.MessageType_MESSAGE_CREATE_ROOM: {
+		ClientToServer, mediumMaxSize,
+		func() proto.Message { return &myproto.CreateRoomRequest{} },
+	},
+	myproto.MessageType_MESSAGE_JOIN_ROOM: {
+		ClientToServer, smallMaxSize,
+		func() proto.Message { return &myproto.JoinRoomRequest{} },
+	},
+	myproto.MessageType_MESSAGE_ROOM_INFO: {
+		ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.RoomInfo{} },
+	},
+	myproto.MessageType_MESSAGE_HOST_COMMAND: {
+		ClientToServer | ServerToClient, smallMaxSize,
+		func() proto.Message { return &myproto.HostCommand{} },
+	},
+}
+
+// Encode 编码一条消息（len + messageType + data）
+func Encode(messageType myproto.MessageType, msg proto.Message) ([]byte, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPayloadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(data))
+	}
+
+	message := make([]byte, HeaderSize+len(data))
+	binary.BigEndian.PutUint32(message[0:LengthSize], uint32(1+len(data)))
+	message[LengthSize] = byte(messageType)
+	copy(message[HeaderSize:], data)
+	return message, nil
+}
+
+// ParseHeader 校验消息头，返回消息类型和protobuf数据长度
+func ParseHeader(header []byte, direction Direction) (myproto.MessageType, int, error) {
+	if len(header) < HeaderSize {
+		return 0, 0, ErrTruncated
+	}
+	length := binary.BigEndian.Uint32(header[0:LengthSize])
+	messageType := myproto.MessageType(header[LengthSize])
+
+	if length == 0 {
+		return messageType, 0, ErrEmptyMessage
+	}
+	if length > MaxMessageSize {
+		return messageType, 0, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, length)
+	}
+	spec, ok := messageSpecs[messageType]
+	if !ok || spec.directions&direction == 0 {
+		return messageType, 0, fmt.Errorf("%w: %d", ErrUnknownType, messageType)
+	}
+	payloadLength := int(length) - 1
+	if payloadLength > spec.maxSize {
+		return messageType, 0, fmt.Errorf("%w: %v with %d bytes (max %d)", ErrMessageTooLarge, messageType, payloadLength, spec.maxSize)
+	}
+	return messageType, payloadLength, nil
+}
+
+// ReadMessage 从流（TCP/KCP）中读取一条消息。
+//
+// 如果在读到任何字节之前出错（例如读取超时），原样返回该错误，调用方可以继续读取；
+// 读到部分数据后出错会返回 ErrTruncated，此时流已经无法对齐，应当断开连接。
+func ReadMessage(r io.Reader, direction Direction) (myproto.MessageType, []byte, error) {
+	var header [HeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if n > 0 {
+			return 0, nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+		}
+		return 0, nil, err
+	}
+
+	messageType, payloadLength, err := ParseHeader(header[:], direction)
+	if err != nil {
+		return messageType, nil, err
+	}
+
+	data, err := readPayload(r, payloadLength)
+	if err != nil {
+		return messageType, nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return messageType, data, nil
+}
+
+// 读取protobuf数据：小消息直接分配，大消息按实际到达的数据逐块增长
+func readPayload(r io.Reader, length int) ([]byte, error) {
+	if length <= readChunkSize {
+		data := make([]byte, length)
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+
+	var buffer bytes.Buffer
+	buffer.Grow(readChunkSize)
+	if _, err := io.CopyN(&buffer, r, int64(length)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecodeDatagram 解析一个UDP数据报，返回的数据切片引用 datagram 的内存
+func DecodeDatagram(datagram []byte, direction Direction) (myproto.MessageType, []byte, error) {
+	messageType, payloadLength, err := ParseHeader(datagram, direction)
+	if err != nil {
+		return messageType, nil, err
+	}
+	if len(datagram) != HeaderSize+payloadLength {
+		return messageType, nil, fmt.Errorf("%w: header says %d, datagram has %d",
+			ErrLengthMismatch, HeaderSize+payloadLength, len(datagram))
+	}
+	return messageType, datagram[HeaderSize:], nil
+}
+
+// NewBody 创建消息类型对应的protobuf消息，未知类型返回nil
+func NewBody(messageType myproto.MessageType) proto.Message {
+	spec, ok := messageSpecs[messageType]
+	if !ok {
+		return nil
+	}
+	return spec.newBody()
+}
+
+// DecodeBody 把protobuf数据解码为消息类型对应的消息
+func DecodeBody(messageType myproto.MessageType, data []byte) (proto.Message, error) {
+	body := NewBody(messageType)
+	if body == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownType, messageType)
+	}
+	if err := proto.Unmarshal(data, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,287 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 每种消息类型的一个样例，作为模糊测试的种子
+func sampleMessages() map[myproto.MessageType]proto.Message {
+	fireX, fireY := int64(-1200), int64(3400)
+	winnerID := int32(7)
+	return map[myproto.MessageType]proto.Message{
+		myproto.MessageType_MESSAGE_CONNECT: &myproto.ConnectMessage{PlayerId: 7, PlayerName: "player", Token: "0123456789abcdef", AccountId: 3},
+		myproto.MessageType_MESSAGE_FRAME_DATA: &myproto.FrameData{
+			PlayerId: 7, Direction: myproto.InputDirection_DIRECTION_UP_LEFT, FrameNumber: 42,
+			IsFire: true, FireX: &fireX, FireY: &fireY,
+		},
+		myproto.MessageType_MESSAGE_SERVER_FRAME: &myproto.ServerFrame{
+			FrameNumber: 42, Timestamp: 1700000000, FrameDatas: []*myproto.FrameData{{PlayerId: 7}},
+		},
+		myproto.MessageType_MESSAGE_DISCONNECT: &myproto.DisconnectMessage{PlayerId: 7},
+		myproto.MessageType_MESSAGE_GAME_START: &myproto.GameStart{
+			RoomId: "1", RandomSeed: 99, PlayerIds: []int32{7, 8}, FrameRate: 60, TimeScale: 1, StartTime: 1700000000000000000,
+			InputDelay: 2, TeamCount: 2,
+			Roster:   []*myproto.RosterEntry{{PlayerId: 7, Team: 1, Slot: 0}, {PlayerId: 8, Team: 2, Slot: 0}},
+			Settings: &myproto.GameSettings{MapId: "default", Preset: "standard", Tunables: map[string]int64{"zombie_hp": 100}},
+		},
+		myproto.MessageType_MESSAGE_FRAME_LOSS: &myproto.GetLossFrame{LastFrameNumber: 40},
+		myproto.MessageType_MESSAGE_FRAME_NEED: &myproto.SendAllFrame{
+			AllNeedFrame: []*myproto.ServerFrame{{FrameNumber: 41}, {FrameNumber: 42}},
+		},
+		myproto.MessageType_MESSAGE_HEARTBEAT: &myproto.Heartbeat{},
+		myproto.MessageType_MESSAGE_TIME_SCALE: &myproto.TimeScaleChange{
+			TimeScale: 0.5, FrameNumber: 120, FrameIntervalNs: int64(100 * 1000 * 1000),
+		},
+		myproto.MessageType_MESSAGE_PING: &myproto.Ping{
+			Sequence: 3, ClientSendTime: 1700000000000000000, EchoServerSendTime: 1700000000000000001, EchoHoldNs: 5000,
+		},
+		myproto.MessageType_MESSAGE_PONG: &myproto.Pong{
+			Sequence: 3, ClientSendTime: 1700000000000000000, ServerReceiveTime: 1700000000000000002,
+			ServerSendTime: 1700000000000000003, RttNs: 30000000, FrameAnchorTime: 1699999999000000000,
+			FrameAnchorNumber: 20, FrameIntervalNs: 50000000,
+		},
+		myproto.MessageType_MESSAGE_INPUT_DELAY: &myproto.InputDelayChange{InputDelay: 3, FrameNumber: 250},
+		myproto.MessageType_MESSAGE_PAUSE: &myproto.PauseMessage{
+			Paused: true, FrameNumber: 300, PlayerId: 7, Votes: 1, VotesNeeded: 2,
+		},
+		myproto.MessageType_MESSAGE_MATCH_END: &myproto.MatchEnd{
+			FrameNumber: 1200, WinnerId: &winnerID, Reason: "host",
+			Results: []*myproto.PlayerResult{{PlayerId: 7, Score: 10}, {PlayerId: 8, Score: 3}},
+		},
+		myproto.MessageType_MESSAGE_POST_MATCH: &myproto.PostMatchChoice{Rematch: true, PlayerId: 7},
+		myproto.MessageType_MESSAGE_MATCH_RESULT: &myproto.MatchResult{
+			FinalFrame: 1200, WinnerId: &winnerID, StateHash: []byte{0xde, 0xad, 0xbe, 0xef},
+			Results: []*myproto.PlayerResult{{PlayerId: 7, Score: 10}},
+			Agreed:  true, DisagreeingIds: []int32{8}, MissingIds: []int32{9}, MatchId: "20250101-120000-room1-1",
+		},
+		myproto.MessageType_MESSAGE_MATCH_HISTORY: &myproto.MatchHistory{
+			AccountId: 3, Limit: 20,
+			Matches: []*myproto.MatchSummary{{
+				MatchId: "20250101-120000-room1-1", RoomId: "1", StartTime: 1, EndTime: 2, DurationMs: 60000, FinalFrame: 1200,
+				Participants: []*myproto.MatchParticipant{{AccountId: 3, PlayerId: 7, Name: "player", Score: 10, Winner: true}},
+				Agreed:       true, Reason: "host",
+			}},
+		},
+		myproto.MessageType_MESSAGE_QUEUE: &myproto.MatchQueue{
+			Mode: "versus", TeamSize: 2, Queued: true, Rating: 1500, RatingRange: 150, PlayersWaiting: 3,
+		},
+		myproto.MessageType_MESSAGE_MATCH_FOUND: &myproto.MatchFound{
+			ProposalId: 1, Mode: "versus", TeamSize: 1, PlayerIds: []int32{7, 8}, Deadline: 1,
+			Accept: true, AcceptedIds: []int32{7},
+		},
+		myproto.MessageType_MESSAGE_TEAM_ASSIGN: &myproto.TeamAssignment{
+			Roster: []*myproto.RosterEntry{{PlayerId: 7, Team: 1, Slot: 0, Name: "player", AccountId: 3}, {PlayerId: 8, Team: 2, Slot: 0}},
+		},
+		myproto.MessageType_MESSAGE_ROOM_SETTINGS: &myproto.RoomSettings{
+			Settings: &myproto.GameSettings{MapId: "default", Tunables: map[string]int64{"wall_hp": 50, "zombie_spawn_count": 2}},
+			Error:    "unknown tunable",
+		},
+		myproto.MessageType_MESSAGE_CREATE_ROOM: &myproto.CreateRoomRequest{
+			Name: "friends", MaxPlayers: 4, FrameRate: 30, TeamCount: 2, Private: true, Password: "secret",
+			Settings: &myproto.GameSettings{Preset: "hardcore"},
+		},
+		myproto.MessageType_MESSAGE_JOIN_ROOM: &myproto.JoinRoomRequest{RoomId: "K7M2QX", Password: "secret"},
+		myproto.MessageType_MESSAGE_ROOM_INFO: &myproto.RoomInfo{
+			RoomId: "K7M2QX", Name: "friends", HostId: 7, PlayerIds: []int32{7, 8}, MaxPlayers: 4, Private: true, HasPassword: true,
+			Locked: true,
+		},
+		myproto.MessageType_MESSAGE_HOST_COMMAND: &myproto.HostCommand{
+			Action: myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS, TargetId: 8, MaxPlayers: 3, HostId: 7, Error: "room is full",
+		},
+	}
+}
+
+// 构造一个消息头
+func header(length uint32, messageType byte) []byte {
+	h := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint32(h, length)
+	h[LengthSize] = messageType
+	return h
+}
+
+func TestSpecsCoverAllMessageTypes(t *testing.T) {
+	for number, name := range myproto.MessageType_name {
+		messageType := myproto.MessageType(number)
+		if messageType == myproto.MessageType_MESSAGE_UNKNOWN {
+			continue
+		}
+		if NewBody(messageType) == nil {
+			t.Errorf("%s has no codec spec", name)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for messageType, msg := range sampleMessages() {
+		encoded, err := Encode(messageType, msg)
+		if err != nil {
+			t.Fatalf("encode %v: %v", messageType, err)
+		}
+
+		direction := messageSpecs[messageType].directions
+		gotType, data, err := ReadMessage(bytes.NewReader(encoded), direction)
+		if err != nil {
+			t.Fatalf("read %v: %v", messageType, err)
+		}
+		if gotType != messageType {
+			t.Fatalf("read type %v, want %v", gotType, messageType)
+		}
+		body, err := DecodeBody(gotType, data)
+		if err != nil {
+			t.Fatalf("decode %v: %v", messageType, err)
+		}
+		if !proto.Equal(body, msg) {
+			t.Fatalf("decoded %v, want %v", body, msg)
+		}
+
+		gotType, data, err = DecodeDatagram(encoded, direction)
+		if err != nil || gotType != messageType || !bytes.Equal(data, encoded[HeaderSize:]) {
+			t.Fatalf("datagram %v: type %v, err %v", messageType, gotType, err)
+		}
+	}
+}
+
+func TestReadMessageRejectsInvalidFrames(t *testing.T) {
+	frameData := byte(myproto.MessageType_MESSAGE_FRAME_DATA)
+
+	cases := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"zero length", header(0, frameData), ErrEmptyMessage},
+		{"over 1MB", header(MaxMessageSize+1, frameData), ErrMessageTooLarge},
+		{"over type limit", header(tinyMaxSize+2, frameData), ErrMessageTooLarge},
+		{"unknown type", header(1, 200), ErrUnknownType},
+		{"MESSAGE_UNKNOWN", header(1, 0), ErrUnknownType},
+		{"server-only type", header(1, byte(myproto.MessageType_MESSAGE_SERVER_FRAME)), ErrUnknownType},
+		{"partial header", []byte{0, 0}, ErrTruncated},
+		{"partial payload", append(header(10, frameData), 1, 2, 3), ErrTruncated},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := ReadMessage(bytes.NewReader(tc.input), ClientToServer)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	// 在读到任何字节之前出错，原样返回，调用方可以继续等待
+	if _, _, err := ReadMessage(bytes.NewReader(nil), ClientToServer); err != io.EOF {
+		t.Fatalf("empty stream err = %v, want io.EOF", err)
+	}
+}
+
+func TestDecodeDatagramRejectsInconsistentLength(t *testing.T) {
+	heartbeat := byte(myproto.MessageType_MESSAGE_HEARTBEAT)
+
+	cases := []struct {
+		name     string
+		datagram []byte
+		want     error
+	}{
+		{"too short", []byte{0, 0, 0, 1}, ErrTruncated},
+		{"zero length", header(0, heartbeat), ErrEmptyMessage},
+		{"length exceeds datagram", header(5, heartbeat), ErrLengthMismatch},
+		{"trailing bytes", append(header(1, heartbeat), 0xff), ErrLengthMismatch},
+		{"huge length", header(0xffffffff, heartbeat), ErrMessageTooLarge},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := DecodeDatagram(tc.datagram, ClientToServer)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+// 添加所有样例消息作为种子
+func addSeeds(f *testing.F) {
+	for messageType, msg := range sampleMessages() {
+		encoded, err := Encode(messageType, msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+	}
+	f.Add(header(0, 2))
+	f.Add(header(MaxMessageSize, byte(myproto.MessageType_MESSAGE_SERVER_FRAME)))
+	f.Add(header(0xffffffff, 3))
+}
+
+func FuzzReadMessage(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, input []byte) {
+		for _, direction := range []Direction{ClientToServer, ServerToClient} {
+			messageType, data, err := ReadMessage(bytes.NewReader(input), direction)
+			if err != nil {
+				continue
+			}
+			// 成功读取的消息不会超出输入，也不会超出该类型的长度上限
+			if HeaderSize+len(data) > len(input) {
+				t.Fatalf("read %d payload bytes from %d byte input", len(data), len(input))
+			}
+			spec := messageSpecs[messageType]
+			if spec.directions&direction == 0 || len(data) > spec.maxSize {
+				t.Fatalf("accepted %v with %d bytes in direction %d", messageType, len(data), direction)
+			}
+		}
+	})
+}
+
+func FuzzDecodeDatagram(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, datagram []byte) {
+		for _, direction := range []Direction{ClientToServer, ServerToClient} {
+			messageType, data, err := DecodeDatagram(datagram, direction)
+			if err != nil {
+				continue
+			}
+			if HeaderSize+len(data) != len(datagram) {
+				t.Fatalf("payload %d bytes from %d byte datagram", len(data), len(datagram))
+			}
+			if binary.BigEndian.Uint32(datagram) != uint32(1+len(data)) || messageType != myproto.MessageType(datagram[LengthSize]) {
+				t.Fatalf("decoded header does not match datagram")
+			}
+		}
+	})
+}
+
+func FuzzDecodeBody(f *testing.F) {
+	for messageType, msg := range sampleMessages() {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(byte(messageType), data)
+	}
+	f.Fuzz(func(t *testing.T, messageType byte, data []byte) {
+		body, err := DecodeBody(myproto.MessageType(messageType), data)
+		if err != nil {
+			return
+		}
+		// 解码成功的消息可以重新编码，并且再次解码得到相同的消息
+		encoded, err := proto.Marshal(body)
+		if err != nil {
+			t.Fatalf("re-marshal %v: %v", myproto.MessageType(messageType), err)
+		}
+		again, err := DecodeBody(myproto.MessageType(messageType), encoded)
+		if err != nil {
+			t.Fatalf("decode re-marshalled %v: %v", myproto.MessageType(messageType), err)
+		}
+		if !proto.Equal(body, again) {
+			t.Fatalf("round trip mismatch: %v vs %v", body, again)
+		}
+	})
+}
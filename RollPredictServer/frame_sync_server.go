@@ -2,29 +2,38 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
+	"maps"
 	"net"
-	"strconv"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/WjcHome/gohello/codec"
 	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/WjcHome/gohello/store"
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	FRAME_INTERVAL = 50 * time.Millisecond // 20帧每秒
-	TCP_PORT       = ":8887"               // TCP服务器端口
-	UDP_PORT       = ":8888"               // UDP服务器端口（与TCP共用）
-	KCP_PORT       = ":8889"               // KCP服务器端口
-	MAX_PLAYERS    = 1                     // 每个房间最大玩家数
+	DEFAULT_FRAME_RATE = 20      // 默认20帧每秒
+	TCP_PORT           = ":8887" // TCP服务器端口
+	UDP_PORT           = ":8888" // UDP服务器端口（与TCP共用）
+	KCP_PORT           = ":8889" // KCP服务器端口
+	MAX_PLAYERS        = 1       // 每个房间最大玩家数
 )
 
-// 全局客户端计数器
-var clientCounter int64 = 0
+// 全局客户端计数器（TCP/UDP/KCP连接并发分配ID，使用原子操作）
+var clientCounter atomic.Int64
+
+// 分配新的客户端ID
+func nextClientID() int32 {
+	return int32(clientCounter.Add(1) - 1)
+}
 
 // 客户端结构
 type Client struct {
@@ -35,6 +44,14 @@ type Client struct {
 	Name     string
 	IsHost   bool
 	LastSeen time.Time
+	Flagged  bool // 多次发送违规输入被标记
+	Kicked   bool // 已被服务器踢出
+
+	disconnected bool // 已断开连接（由 Server.Mutex 保护），匹配成功后创建房间前检查
+
+	input   inputState                            // 输入限流和违规统计
+	latency latencyStats                          // RTT、抖动和时钟偏差
+	account atomic.Pointer[myproto.PlayerAccount] // 登录的账号
 }
 
 // 房间结构
@@ -45,22 +62,96 @@ type Room struct {
 	Clients         map[int32]*Client
 	FrameDataBuffer []*myproto.FrameData // 帧数据缓冲区
 	FrameNumber     int64
-	Status          string // "waiting", "playing"
+	Status          string // "waiting", "playing", "paused", "finished"
 	MaxPlayers      int32
 	HistoryFrames   []*myproto.ServerFrame // 历史帧数据，用于补帧
+	FrameRate       int32                  // 帧率（每秒逻辑帧数）
+	TimeScale       float64                // 时间缩放（1为正常速度）
+	InputDelay      int32                  // 当前输入延迟（帧）
+	TeamCount       int32                  // 队伍数（0表示不分队）
+	Settings        *myproto.GameSettings  // 游戏设置（已按规则补全，修改时整体替换）
+	Private         bool                   // 私人房间不参与自动分配，只能用邀请码加入
+	Locked          bool                   // 房主锁定了房间，不能再加入
 	Mutex           sync.Mutex
+
+	clock frameClock    // 帧时钟（游戏开始后有效）
+	round int           // 第几局，每次开始游戏加1，旧的帧循环发现局数变化后退出
+	wake  chan struct{} // 时钟或房间状态改变时唤醒帧循环
+
+	createdAt    time.Time                      // 创建时间（自动分配房间时优先加入早创建的房间）
+	passwordHash []byte                         // 房间密码的SHA-256（nil表示不需要密码）
+	kicked       map[int32]bool                 // 被房主踢出的玩家，不能再加入
+	queue        *queueKey                      // 匹配队列创建的房间（nil表示普通房间）
+	roster       map[int32]*myproto.RosterEntry // 玩家ID -> 队伍和槽位（房主或匹配分配，开局时补全）
+
+	pauseVotes   map[int32]bool       // 投票模式下赞成改变暂停状态的玩家
+	rematchVotes map[int32]bool       // 赛后选择再来一局的玩家
+	LastResult   *myproto.MatchEnd    // 上一局的结果（房主宣布）
+	LastVerdict  *myproto.MatchResult // 上一局玩家提交结果的核对结论
+
+	gameStart         *myproto.GameStart             // 本局的开局信息（用于回放）
+	startedAt         time.Time                      // 本局开始时间
+	endedAt           time.Time                      // 本局结束时间
+	resultExpected    []int32                        // 比赛结束时在房间内、应当提交结果的玩家
+	resultSubmissions map[int32]*myproto.MatchResult // 已提交的结果（nil表示不在收集中）
+	resultPlayers     []*myproto.MatchParticipant    // 比赛结束时的玩家和账号（用于比赛历史）
+	resultTimer       *time.Timer                    // 收集结果超时
+
+	delayedInputs     map[int64][]*myproto.FrameData // 目标帧 -> 被输入延迟推迟的输入
+	pendingInputDelay *myproto.InputDelayChange      // 已通知、尚未生效的输入延迟变更
+	inputDelayUpdated time.Time                      // 上次计算输入延迟的时间
+}
+
+// 创建房间的参数
+type RoomOptions struct {
+	Name       string
+	MaxPlayers int32
+	FrameRate  int32                 // 0 表示使用服务器默认帧率
+	Teams      int32                 // 队伍数，0 表示不分队
+	Settings   *myproto.GameSettings // 游戏设置，nil 表示默认设置
+	Private    bool                  // 私人房间，不参与自动分配
+	Password   string                // 加入房间需要的密码，为空表示不需要
 }
 
 // 服务器结构
 type Server struct {
-	Rooms map[string]*Room
-	Mutex sync.Mutex
+	Rooms         map[string]*Room
+	Mutex         sync.Mutex
+	MaxPlayers    int32                // 自动分配的房间和没有指定人数的新房间的最大玩家数
+	AutoAssign    bool                 // 连接时自动分配房间；为 false 时玩家留在大厅，自己创建、加入房间或排队
+	InputPolicy   InputPolicy          // 输入校验和限流策略
+	FrameRate     int32                // 房间默认帧率
+	InputDelay    InputDelayPolicy     // 自动输入延迟范围
+	PausePolicy   string               // 暂停/继续的决定方式：host 或 vote
+	ResultTimeout time.Duration        // 比赛结束后等待玩家提交结果的时间
+	DataDir       string               // 比赛记录和回放的保存目录，为空时不保存
+	Store         *store.Store         // 玩家账号和比赛历史，为nil时不支持登录
+	QueueModes    map[string]QueueMode // 匹配模式
+	Matchmaking   MatchmakingPolicy    // 匹配分数范围和确认时间
+	Settings      *SettingsSchema      // 房间游戏设置的校验规则
+
+	matchmaking matchmaker // 匹配队列和等待确认的对局
+
+	udpConn net.PacketConn // UDP服务器连接，用于向UDP客户端发送消息
 }
 
 // 创建新服务器
 func NewServer() *Server {
 	return &Server{
-		Rooms: make(map[string]*Room),
+		Rooms:         make(map[string]*Room),
+		MaxPlayers:    MAX_PLAYERS,
+		InputPolicy:   DefaultInputPolicy(),
+		FrameRate:     DEFAULT_FRAME_RATE,
+		InputDelay:    DefaultInputDelayPolicy(),
+		PausePolicy:   PausePolicyHost,
+		ResultTimeout: DEFAULT_RESULT_TIMEOUT,
+		QueueModes:    DefaultQueueModes(),
+		Matchmaking:   DefaultMatchmakingPolicy(),
+		Settings:      DefaultSettingsSchema(),
+		matchmaking: matchmaker{
+			tickets:   make(map[int32]*queueTicket),
+			proposals: make(map[uint64]*matchProposal),
+		},
 	}
 }
 
@@ -79,10 +170,18 @@ func (s *Server) Start() {
 
 	fmt.Printf("TCP Frame Sync Server started on %s\n", TCP_PORT)
 
+	s.ServeTCP(ln)
+}
+
+// 在已有的监听器上接受TCP连接，监听器关闭后返回
+func (s *Server) ServeTCP(ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			log.Println("Accept error:", err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("TCP Accept error:", err)
 			continue
 		}
 		go s.handleClient(conn)
@@ -107,8 +206,7 @@ func (s *Server) handleClient(conn net.Conn) {
 		tcpConn.SetKeepAlivePeriod(30 * time.Second)
 	}
 
-	clientID := int32(clientCounter)
-	clientCounter++
+	clientID := nextClientID()
 	client := &Client{
 		ID:       clientID,
 		Conn:     conn,
@@ -124,7 +222,9 @@ func (s *Server) handleClient(conn net.Conn) {
 	}
 	s.sendMessage(conn, myproto.MessageType_MESSAGE_CONNECT, connectMsg)
 
-	s.autoAssignRoom(client)
+	if s.AutoAssign {
+		s.autoAssignRoom(client)
+	}
 
 	// 设置读取超时（30秒，避免长时间阻塞）
 	// 注意：超时后不会断开连接，只是跳过本次读取
@@ -140,9 +240,8 @@ func (s *Server) handleClient(conn net.Conn) {
 			tcpConn.SetReadDeadline(time.Now().Add(30 * time.Second))
 		}
 
-		// 读取消息长度 (4 bytes)
-		lengthBytes := make([]byte, 4)
-		_, err := reader.Read(lengthBytes)
+		// 读取一条完整消息（len + messageType + data），长度和类型在分配缓冲区前校验
+		messageType, data, err := codec.ReadMessage(reader, codec.ClientToServer)
 		if err != nil {
 			// 检查是否是超时错误（可以继续等待）
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -150,70 +249,67 @@ func (s *Server) handleClient(conn net.Conn) {
 				log.Printf("Client %d: Read timeout, continuing...\n", client.ID)
 				continue
 			}
-			// 其他错误（如EOF、连接关闭）才断开
-			log.Printf("Client %d: Read length error: %v\n", client.ID, err)
-			break
-		}
-		length := binary.BigEndian.Uint32(lengthBytes)
-
-		// 验证消息长度（防止恶意或错误数据）
-		if length > 1024*1024 { // 最大1MB
-			log.Printf("Client %d: Message too large: %d bytes\n", client.ID, length)
-			break
-		}
-
-		// 读取消息类型 (1 byte)
-		messageTypeBytes := make([]byte, 1)
-		_, err = reader.Read(messageTypeBytes)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				log.Printf("Client %d: Read message type timeout, continuing...\n", client.ID)
-				continue
-			}
-			log.Printf("Client %d: Read message type error: %v\n", client.ID, err)
-			break
-		}
-		messageType := myproto.MessageType(messageTypeBytes[0])
-
-		// 读取数据部分 (length - 1 byte for messageType)
-		dataLength := int(length) - 1
-		if dataLength < 0 {
-			log.Printf("Client %d: Invalid message length: %d\n", client.ID, length)
-			break
-		}
-		data := make([]byte, dataLength)
-		_, err = reader.Read(data)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				log.Printf("Client %d: Read data timeout, continuing...\n", client.ID)
-				continue
-			}
-			log.Printf("Client %d: Read data error: %v\n", client.ID, err)
+			// 其他错误（如EOF、连接关闭、非法消息）才断开，非法消息之后的数据流已经无法对齐
+			log.Printf("Client %d: Read message error: %v\n", client.ID, err)
 			break
 		}
 
 		// 更新最后活跃时间（任何消息都会更新心跳时间，包括帧数据、心跳、丢帧请求等）
 		client.LastSeen = time.Now()
 
-		// 根据消息类型处理
-		switch messageType {
-		case myproto.MessageType_MESSAGE_FRAME_DATA:
-			s.handleFrameData(client, data)
-		case myproto.MessageType_MESSAGE_DISCONNECT:
-			s.handleDisconnect(client, data)
-		case myproto.MessageType_MESSAGE_FRAME_LOSS:
-			s.handleFrameLoss(client, data)
-		case myproto.MessageType_MESSAGE_HEARTBEAT:
-			// 心跳消息，LastSeen 已经在上面更新，这里不需要额外操作
-		default:
-			log.Printf("Client %d: Unknown message type: %d\n", client.ID, messageType)
-		}
+		s.handleMessage(client, messageType, data)
 	}
 
 	// 客户端断开连接
 	s.handleClientDisconnect(client)
 }
 
+// 根据消息类型处理客户端消息（TCP/UDP/KCP共用）
+func (s *Server) handleMessage(client *Client, messageType myproto.MessageType, data []byte) {
+	switch messageType {
+	case myproto.MessageType_MESSAGE_CONNECT:
+		s.handleLogin(client, data)
+	case myproto.MessageType_MESSAGE_FRAME_DATA:
+		s.handleFrameData(client, data)
+	case myproto.MessageType_MESSAGE_DISCONNECT:
+		s.handleDisconnect(client, data)
+	case myproto.MessageType_MESSAGE_FRAME_LOSS:
+		s.handleFrameLoss(client, data)
+	case myproto.MessageType_MESSAGE_HEARTBEAT:
+		// 心跳消息，LastSeen 已经在读取时更新，这里不需要额外操作
+	case myproto.MessageType_MESSAGE_TIME_SCALE:
+		s.handleTimeScale(client, data)
+	case myproto.MessageType_MESSAGE_PING:
+		s.handlePing(client, data)
+	case myproto.MessageType_MESSAGE_PAUSE:
+		s.handlePause(client, data)
+	case myproto.MessageType_MESSAGE_MATCH_END:
+		s.handleMatchEnd(client, data)
+	case myproto.MessageType_MESSAGE_POST_MATCH:
+		s.handlePostMatch(client, data)
+	case myproto.MessageType_MESSAGE_MATCH_RESULT:
+		s.handleMatchResult(client, data)
+	case myproto.MessageType_MESSAGE_MATCH_HISTORY:
+		s.handleMatchHistory(client, data)
+	case myproto.MessageType_MESSAGE_QUEUE:
+		s.handleQueue(client, data)
+	case myproto.MessageType_MESSAGE_MATCH_FOUND:
+		s.handleMatchFound(client, data)
+	case myproto.MessageType_MESSAGE_TEAM_ASSIGN:
+		s.handleTeamAssignment(client, data)
+	case myproto.MessageType_MESSAGE_ROOM_SETTINGS:
+		s.handleRoomSettings(client, data)
+	case myproto.MessageType_MESSAGE_CREATE_ROOM:
+		s.handleCreateRoom(client, data)
+	case myproto.MessageType_MESSAGE_JOIN_ROOM:
+		s.handleJoinRoom(client, data)
+	case myproto.MessageType_MESSAGE_HOST_COMMAND:
+		s.handleHostCommand(client, data)
+	default:
+		log.Printf("Client %d: Unexpected message type: %v\n", client.ID, messageType)
+	}
+}
+
 // 处理帧数据
 func (s *Server) handleFrameData(client *Client, data []byte) {
 	if client.RoomID == "" {
@@ -245,12 +341,28 @@ func (s *Server) handleFrameData(client *Client, data []byte) {
 		return
 	}
 
-	// 确保player_id正确
-	if frameData.PlayerId == 0 {
-		frameData.PlayerId = client.ID
+	// 校验输入内容（player_id、方向、射击坐标）
+	if err := s.InputPolicy.validateInput(client, &frameData); err != nil {
+		s.recordInputViolation(client, err)
+		return
 	}
 
+	// 确保player_id正确
+	frameData.PlayerId = client.ID
+
 	room.Mutex.Lock()
+	// 两次加锁之间玩家可能已经离开房间（被踢出、断开）
+	if room.Clients[client.ID] != client {
+		room.Mutex.Unlock()
+		return
+	}
+	// 限制每个客户端每帧的输入数，防止刷爆缓冲区
+	if err := s.InputPolicy.countInput(client, room.FrameNumber); err != nil {
+		room.Mutex.Unlock()
+		s.recordInputViolation(client, err)
+		return
+	}
+
 	// 将客户端的帧数据添加到房间的缓冲区
 	// 记录帧数据信息（包括切换指令）
 	if frameData.IsToggle {
@@ -260,7 +372,8 @@ func (s *Server) handleFrameData(client *Client, data []byte) {
 			client.ID, frameData.Direction, frameData.IsFire)
 	}
 
-	room.FrameDataBuffer = append(room.FrameDataBuffer, &frameData)
+	// 按房间的输入延迟放入目标帧
+	room.bufferInput(client, &frameData)
 	room.Mutex.Unlock()
 }
 
@@ -345,7 +458,15 @@ func (s *Server) handleFrameLoss(client *Client, data []byte) {
 // 处理客户端断开
 func (s *Server) handleClientDisconnect(client *Client) {
 	fmt.Printf("Client %d disconnected\n", client.ID)
+	s.Mutex.Lock()
+	client.disconnected = true
+	s.Mutex.Unlock()
+	s.leaveQueue(client)
+	s.leaveRoom(client, "disconnect")
+}
 
+// 客户端离开所在房间（断开连接或赛后返回大厅）
+func (s *Server) leaveRoom(client *Client, reason string) {
 	if client.RoomID == "" {
 		return
 	}
@@ -360,16 +481,22 @@ func (s *Server) handleClientDisconnect(client *Client) {
 
 	room.Mutex.Lock()
 	delete(room.Clients, client.ID)
+	delete(room.pauseVotes, client.ID)
+	delete(room.rematchVotes, client.ID)
+	delete(room.roster, client.ID)
 	client.RoomID = ""
-
-	// 如果房主离开，选择新的房主
+	client.IsHost = false
+	// 下一个房间的帧号从0开始
+	client.input.resetFrames()
+	// 帧循环可能在暂停中等待，唤醒它检查房间状态
+	room.wakeFrameLoop()
+
+	// 如果房主离开，最早连接的玩家（ID最小）成为新的房主，并通知房间内的玩家
+	var hostChanged *myproto.RoomInfo
 	if room.HostID == client.ID && len(room.Clients) > 0 {
-		for _, c := range room.Clients {
-			c.IsHost = true
-			room.HostID = c.ID
-			fmt.Printf("New host selected: %d in room %s\n", c.ID, room.ID)
-			break
-		}
+		room.transferHost(room.Clients[slices.Min(slices.Collect(maps.Keys(room.Clients)))])
+		fmt.Printf("New host selected: %d in room %s\n", room.HostID, room.ID)
+		hostChanged = room.info()
 	}
 
 	// 如果房间空了，删除房间
@@ -378,64 +505,116 @@ func (s *Server) handleClientDisconnect(client *Client) {
 		s.Mutex.Lock()
 		delete(s.Rooms, room.ID)
 		s.Mutex.Unlock()
-		fmt.Printf("Room %s deleted (empty after disconnect)\n", room.ID)
+		fmt.Printf("Room %s deleted (empty after %s)\n", room.ID, reason)
 		return
 	}
 
+	remaining := len(room.Clients)
+	finished := room.Status == "finished"
+	clients := room.clientList()
 	room.Mutex.Unlock()
-	fmt.Printf("Client %d disconnected from room %s, %d players remaining\n", client.ID, room.ID, len(room.Clients))
+	fmt.Printf("Client %d left room %s (%s), %d players remaining\n", client.ID, room.ID, reason, remaining)
+	if hostChanged != nil {
+		s.broadcast(clients, myproto.MessageType_MESSAGE_ROOM_INFO, hostChanged)
+	}
+
+	// 赛后有人返回大厅，剩下的玩家可能都已经选择再来一局
+	if finished {
+		s.checkRematch(room)
+	}
 }
 
-// 创建房间
-func (s *Server) CreateRoom(client *Client, roomName string, maxPlayers int32) string {
-	roomID := strconv.FormatInt(int64(len(s.Rooms)+1), 10)
-	if roomName == "" {
-		roomName = fmt.Sprintf("Room %s", roomID)
+// 创建房间对象（未加入服务器的房间表）
+func (s *Server) newRoom(roomID string, hostID int32, options RoomOptions) *Room {
+	if options.Name == "" {
+		options.Name = fmt.Sprintf("Room %s", roomID)
+	}
+	if options.FrameRate == 0 {
+		options.FrameRate = s.FrameRate
+	}
+	if options.Settings == nil {
+		options.Settings = s.Settings.Default()
 	}
 
-	room := &Room{
+	return &Room{
 		ID:              roomID,
-		Name:            roomName,
-		HostID:          client.ID,
+		Name:            options.Name,
+		HostID:          hostID,
 		Clients:         make(map[int32]*Client),
 		FrameDataBuffer: make([]*myproto.FrameData, 0),
 		Status:          "waiting",
-		MaxPlayers:      maxPlayers,
+		MaxPlayers:      options.MaxPlayers,
 		HistoryFrames:   make([]*myproto.ServerFrame, 0),
+		FrameRate:       options.FrameRate,
+		TeamCount:       options.Teams,
+		Settings:        options.Settings,
+		Private:         options.Private,
+		passwordHash:    hashRoomPassword(options.Password),
+		TimeScale:       1,
+		wake:            make(chan struct{}, 1),
+		createdAt:       time.Now(),
 	}
+}
 
-	s.Mutex.Lock()
-	s.Rooms[roomID] = room
-	s.Mutex.Unlock()
+// 校验创建房间的参数，返回补全后的游戏设置
+func (s *Server) checkRoomOptions(options RoomOptions) (RoomOptions, error) {
+	if options.FrameRate != 0 {
+		if err := validateFrameRate(options.FrameRate); err != nil {
+			return options, err
+		}
+	}
+	if err := validateRoomOptions(options); err != nil {
+		return options, err
+	}
+	if err := validateTeamCount(options.Teams, options.MaxPlayers); err != nil {
+		return options, err
+	}
+	if options.Settings != nil {
+		settings, err := s.Settings.Resolve(options.Settings)
+		if err != nil {
+			return options, err
+		}
+		options.Settings = settings
+	}
+	return options, nil
+}
 
-	// 将客户端加入房间
+// 创建房间
+func (s *Server) CreateRoom(client *Client, options RoomOptions) (string, error) {
+	options, err := s.checkRoomOptions(options)
+	if err != nil {
+		return "", err
+	}
+
+	// 房主在房间放进房间表之前加入，其他玩家看到房间时房主已经在里面
+	s.Mutex.Lock()
+	roomID := s.newRoomID()
+	room := s.newRoom(roomID, client.ID, options)
 	client.RoomID = roomID
 	client.IsHost = true
 	room.Clients[client.ID] = client
+	s.Rooms[roomID] = room
+	s.Mutex.Unlock()
 
-	fmt.Printf("Client %d created room %s (%s)\n", client.ID, roomID, roomName)
-	return roomID
+	fmt.Printf("Client %d created room %s (%s, %d fps, private: %v)\n", client.ID, roomID, room.Name, room.FrameRate, room.Private)
+	return roomID, nil
 }
 
-// 加入房间
-func (s *Server) JoinRoom(client *Client, roomID string) bool {
+// 加入房间（房间有密码时需要提供正确的密码）
+func (s *Server) JoinRoom(client *Client, roomID, password string) error {
 	s.Mutex.Lock()
 	room, exists := s.Rooms[roomID]
 	s.Mutex.Unlock()
 
 	if !exists {
-		return false
+		return ErrRoomNotFound
 	}
 
 	room.Mutex.Lock()
 	defer room.Mutex.Unlock()
 
-	if room.Status != "waiting" {
-		return false
-	}
-
-	if int32(len(room.Clients)) >= room.MaxPlayers {
-		return false
+	if err := room.checkJoin(client.ID, password); err != nil {
+		return err
 	}
 
 	// 加入房间
@@ -453,21 +632,29 @@ func (s *Server) JoinRoom(client *Client, roomID string) bool {
 		}()
 	}
 
-	return true
+	return nil
 }
 
 // 自动分配房间：查找等待中的房间或创建新房间
 func (s *Server) autoAssignRoom(client *Client) {
 	var targetRoomID string
 
-	// 第一步：查找等待中的房间（需要先获取锁）
+	// 第一步：查找等待中的房间（需要先获取锁）。
+	// 优先加入人数最多的房间，尽快凑满开局；人数相同时加入最早创建的房间
 	s.Mutex.Lock()
+	var targetPlayers int
+	var targetCreated time.Time
 	for _, room := range s.Rooms {
 		room.Mutex.Lock()
-		if room.Status == "waiting" && int32(len(room.Clients)) < room.MaxPlayers {
-			targetRoomID = room.ID
-			room.Mutex.Unlock()
-			break
+		players := len(room.Clients)
+		// 私人房间和有密码的房间只能用邀请码加入
+		if !room.Private && room.checkJoin(client.ID, "") == nil {
+			better := targetRoomID == "" || players > targetPlayers ||
+				(players == targetPlayers && (room.createdAt.Before(targetCreated) ||
+					(room.createdAt.Equal(targetCreated) && room.ID < targetRoomID)))
+			if better {
+				targetRoomID, targetPlayers, targetCreated = room.ID, players, room.createdAt
+			}
 		}
 		room.Mutex.Unlock()
 	}
@@ -475,36 +662,22 @@ func (s *Server) autoAssignRoom(client *Client) {
 
 	// 如果找到可用房间，尝试加入（此时已经释放了s.Mutex，可以安全调用JoinRoom）
 	if targetRoomID != "" {
-		if s.JoinRoom(client, targetRoomID) {
+		if s.JoinRoom(client, targetRoomID, "") == nil {
 			return
 		}
 	}
 
 	// 第二步：没有找到可用房间，创建新房间
+	// 和 CreateRoom 一样，房主先加入再放进房间表
 	s.Mutex.Lock()
-	roomID := strconv.FormatInt(int64(len(s.Rooms)+1), 10)
-	roomName := fmt.Sprintf("Room %s", roomID)
-
-	room := &Room{
-		ID:              roomID,
-		Name:            roomName,
-		HostID:          client.ID,
-		Clients:         make(map[int32]*Client),
-		FrameDataBuffer: make([]*myproto.FrameData, 0),
-		Status:          "waiting",
-		MaxPlayers:      MAX_PLAYERS,
-		HistoryFrames:   make([]*myproto.ServerFrame, 0),
-	}
-
-	s.Rooms[roomID] = room
-	s.Mutex.Unlock()
-
-	// 将客户端加入房间
-	room.Mutex.Lock()
+	roomID := s.newRoomID()
+	room := s.newRoom(roomID, client.ID, RoomOptions{MaxPlayers: s.MaxPlayers})
+	roomName := room.Name
 	client.RoomID = roomID
 	client.IsHost = true
 	room.Clients[client.ID] = client
-	room.Mutex.Unlock()
+	s.Rooms[roomID] = room
+	s.Mutex.Unlock()
 
 	fmt.Printf("Client %d created room %s (%s) (%d/%d players)\n", client.ID, roomID, roomName, 1, room.MaxPlayers)
 
@@ -514,7 +687,7 @@ func (s *Server) autoAssignRoom(client *Client) {
 	room.Mutex.Unlock()
 
 	if shouldStart {
-		fmt.Printf("Room %s reached max players (%d/%d), starting game...\n", roomID, MAX_PLAYERS, room.MaxPlayers)
+		fmt.Printf("Room %s reached max players (%d/%d), starting game...\n", roomID, room.MaxPlayers, room.MaxPlayers)
 		go func() {
 			time.Sleep(100 * time.Millisecond) // 稍微延迟，确保客户端收到加入消息
 			s.startGame(roomID)
@@ -539,11 +712,23 @@ func (s *Server) startGame(roomID string) {
 	}
 
 	room.Status = "playing"
-
-	// 收集玩家ID列表
-	playerIDs := make([]int32, 0, len(room.Clients))
-	for _, c := range room.Clients {
-		playerIDs = append(playerIDs, c.ID)
+	room.round++
+	round := room.round
+
+	// 第0帧的时间：留出时间让客户端收到游戏开始消息，之后按帧时钟发帧
+	startTime := time.Now().Add(gameStartDelay)
+	room.clock = newFrameClock(frameIntervalOf(room.FrameRate, room.TimeScale), startTime, room.FrameNumber)
+
+	// 根据大厅中已经测得的延迟确定初始输入延迟
+	room.InputDelay, _ = s.InputDelay.targetDelay(room.latencies(), room.clock.interval)
+	room.inputDelayUpdated = time.Now()
+
+	// 补全名单，玩家ID列表与名单顺序相同
+	clients := room.clientList()
+	roster := room.completeRoster()
+	playerIDs := make([]int32, len(roster))
+	for i, e := range roster {
+		playerIDs[i] = e.PlayerId
 	}
 
 	// 生成随机种子
@@ -554,45 +739,39 @@ func (s *Server) startGame(roomID string) {
 		RoomId:     roomID,
 		RandomSeed: randomSeed,
 		PlayerIds:  playerIDs,
+		FrameRate:  room.FrameRate,
+		TimeScale:  room.TimeScale,
+		StartTime:  startTime.UnixNano(),
+		InputDelay: room.InputDelay,
+		Roster:     roster,
+		TeamCount:  room.TeamCount,
+		Settings:   room.Settings,
 	}
+	room.gameStart = gameStart
+	room.startedAt = time.Now()
 
 	room.Mutex.Unlock()
 
 	// 发送游戏开始消息给所有客户端
-	for _, client := range room.Clients {
+	for _, client := range clients {
 		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_GAME_START, gameStart)
 	}
 
-	fmt.Printf("Game started in room %s with %d players (seed: %d)\n", roomID, len(playerIDs), randomSeed)
+	fmt.Printf("Game started in room %s with %d players (seed: %d, %d fps)\n", roomID, len(playerIDs), randomSeed, gameStart.FrameRate)
 
-	// 延迟启动房间帧循环
-	go func() {
-		time.Sleep(200 * time.Millisecond) // 等待客户端收到游戏开始消息
-		room.frameLoop(s)
-	}()
+	// 启动房间帧循环（第1帧在 startTime 之后一个帧间隔发出）
+	go room.frameLoop(s, round)
 }
 
 // 发送消息（格式：len + messageType + byte[]）
 func (s *Server) sendMessage(conn net.Conn, messageType myproto.MessageType, msg proto.Message) {
-	data, err := proto.Marshal(msg)
+	// 组合完整消息到一个缓冲区（虽然TCP是流式协议，但合并写入更高效且一致）
+	message, err := codec.Encode(messageType, msg)
 	if err != nil {
 		log.Printf("Marshal error: %v\n", err)
 		return
 	}
 
-	// 计算总长度：1 byte (messageType) + data length
-	totalLength := uint32(1 + len(data))
-
-	// 写入长度 (4 bytes, big endian)
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, totalLength)
-
-	// 组合完整消息到一个缓冲区（虽然TCP是流式协议，但合并写入更高效且一致）
-	message := make([]byte, 4+1+len(data))
-	copy(message[0:4], lengthBytes)
-	message[4] = byte(messageType)
-	copy(message[5:], data)
-
 	// 一次性写入完整消息
 	_, err = conn.Write(message)
 	if err != nil {
@@ -601,79 +780,14 @@ func (s *Server) sendMessage(conn net.Conn, messageType myproto.MessageType, msg
 	}
 }
 
-// UDP连接管理器（全局变量，用于UDP消息发送）
-var udpConn *net.UDPConn
-
-// 设置UDP连接（在StartUDP中调用）
-func setUDPConn(conn *net.UDPConn) {
-	udpConn = conn
-}
-
 // 发送消息给客户端（自动判断TCP还是UDP）
 func (s *Server) sendMessageToClient(client *Client, messageType myproto.MessageType, msg proto.Message) {
 	if client.Conn != nil {
 		// TCP/KCP客户端
 		s.sendMessage(client.Conn, messageType, msg)
-	} else if client.Addr != nil && udpConn != nil {
+	} else if client.Addr != nil && s.udpConn != nil {
 		// UDP客户端
-		if udpAddr, ok := client.Addr.(*net.UDPAddr); ok {
-			rand.Seed(time.Now().UnixNano())
-
-			// 生成 0.0 ~ 1.0 之间的随机浮点数（包含0，不包含1）
-			randomValue := rand.Float64()
-
-			// 5% 的概率阈值：0.05
-			probability := 0.9 // 5%
-			if randomValue < probability {
-				//s.sendUDPMessage(udpConn, udpAddr, messageType, msg)
-			}
-			s.sendUDPMessage(udpConn, udpAddr, messageType, msg)
-
-		}
-	}
-}
-
-// 房间帧循环
-func (room *Room) frameLoop(server *Server) {
-	ticker := time.NewTicker(FRAME_INTERVAL)
-	defer ticker.Stop()
-
-	fmt.Printf("Frame loop started for room %s\n", room.ID)
-
-	for range ticker.C {
-		room.Mutex.Lock()
-		frameDatas := room.FrameDataBuffer
-		room.FrameDataBuffer = make([]*myproto.FrameData, 0)
-		room.FrameNumber++
-		clients := make([]*Client, 0, len(room.Clients))
-		for _, c := range room.Clients {
-			clients = append(clients, c)
-		}
-		clientCount := len(clients)
-		room.Mutex.Unlock()
-
-		// 如果房间没有客户端，停止帧循环
-		if clientCount == 0 {
-			fmt.Printf("Room %s has no clients, stopping frame loop\n", room.ID)
-			return
-		}
-
-		// 构建服务器帧数据
-		serverFrame := &myproto.ServerFrame{
-			FrameNumber: room.FrameNumber,
-			Timestamp:   time.Now().UnixNano(),
-			FrameDatas:  frameDatas,
-		}
-
-		// 保存到历史记录
-		room.Mutex.Lock()
-		room.HistoryFrames = append(room.HistoryFrames, serverFrame)
-		room.Mutex.Unlock()
-
-		// 发送给所有客户端
-		for _, client := range clients {
-			server.sendMessageToClient(client, myproto.MessageType_MESSAGE_SERVER_FRAME, serverFrame)
-		}
+		s.sendUDPMessage(s.udpConn, client.Addr, messageType, msg)
 	}
 }
 
@@ -748,30 +862,44 @@ func (s *Server) StartUDP() {
 	}
 	defer conn.Close()
 
-	// 设置全局UDP连接，用于发送消息
-	setUDPConn(conn)
-
 	fmt.Printf("UDP Frame Sync Server started on %s\n", UDP_PORT)
 
+	s.ServeUDP(conn)
+}
+
+// 在已有的UDP连接上处理数据报，连接关闭后返回（测试中可以传入 netsim.PacketConn 模拟网络）
+func (s *Server) ServeUDP(conn net.PacketConn) {
+	// 设置UDP连接，用于发送消息
+	s.udpConn = conn
+
 	// UDP客户端管理（地址 -> 客户端ID映射）
 	udpClients := make(map[string]*Client)
 
 	buffer := make([]byte, 2048) // UDP数据报缓冲区
 
 	for {
-		n, remoteAddr, err := conn.ReadFromUDP(buffer)
+		n, remoteAddr, err := conn.ReadFrom(buffer)
 		if err != nil {
-			log.Println("UDP ReadFromUDP error:", err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("UDP ReadFrom error:", err)
 			continue
 		}
 
-		// 获取或创建UDP客户端
+		// 先校验数据报，非法数据报直接丢弃，不会为其创建客户端
 		addrStr := remoteAddr.String()
+		messageType, data, err := codec.DecodeDatagram(buffer[:n], codec.ClientToServer)
+		if err != nil {
+			log.Printf("UDP %s: Invalid datagram (%d bytes): %v\n", addrStr, n, err)
+			continue
+		}
+
+		// 获取或创建UDP客户端
 		client, exists := udpClients[addrStr]
 		if !exists {
 			// 新UDP客户端
-			clientID := int32(clientCounter)
-			clientCounter++
+			clientID := nextClientID()
 			client = &Client{
 				ID:       clientID,
 				Conn:     nil, // UDP无连接
@@ -789,100 +917,133 @@ func (s *Server) StartUDP() {
 			}
 			s.sendUDPMessage(conn, remoteAddr, myproto.MessageType_MESSAGE_CONNECT, connectMsg)
 
-			s.autoAssignRoom(client)
+			if s.AutoAssign {
+				s.autoAssignRoom(client)
+			}
 		} else {
 			client.LastSeen = time.Now()
 		}
 
 		// 处理UDP消息
-		if n > 0 {
-			s.handleUDPMessage(conn, remoteAddr, client, buffer[:n])
+		s.handleMessage(client, messageType, data)
+		if messageType == myproto.MessageType_MESSAGE_DISCONNECT {
+			// UDP客户端断开时清理
+			conn.WriteTo([]byte{}, remoteAddr) // 简单的断开确认
+		}
+		if client.Kicked {
+			// 被踢出的客户端从客户端表中移除，之后的数据报视为新连接
+			delete(udpClients, addrStr)
 		}
-	}
-}
-
-// 处理UDP消息
-func (s *Server) handleUDPMessage(conn *net.UDPConn, remoteAddr *net.UDPAddr, client *Client, data []byte) {
-	if len(data) < 5 { // 至少需要4字节长度 + 1字节类型
-		log.Printf("UDP Client %d: Message too short: %d bytes\n", client.ID, len(data))
-		return
-	}
-
-	// 解析消息格式：len(4 bytes) + messageType(1 byte) + data
-	offset := 0
-
-	// 读取长度 (4 bytes)
-	length := binary.BigEndian.Uint32(data[offset : offset+4])
-	offset += 4
-
-	// 验证消息长度
-	totalExpected := uint32(4) + length // 4字节长度字段 + 消息内容
-	if uint32(len(data)) != totalExpected {
-		log.Printf("UDP Client %d: Message length mismatch: expected %d, got %d\n", client.ID, totalExpected, len(data))
-		return
-	}
-
-	// 读取消息类型 (1 byte)
-	messageType := myproto.MessageType(data[offset])
-	offset += 1
-
-	// 读取数据部分
-	dataLength := int(length) - 1
-	if dataLength < 0 {
-		log.Printf("UDP Client %d: Invalid message length: %d\n", client.ID, length)
-		return
-	}
-
-	messageData := data[offset : offset+dataLength]
-
-	// 根据消息类型处理
-	switch messageType {
-	case myproto.MessageType_MESSAGE_FRAME_DATA:
-		s.handleFrameData(client, messageData)
-	case myproto.MessageType_MESSAGE_DISCONNECT:
-		s.handleDisconnect(client, messageData)
-		// UDP客户端断开时清理
-		conn.WriteToUDP([]byte{}, remoteAddr) // 简单的断开确认
-	case myproto.MessageType_MESSAGE_FRAME_LOSS:
-		s.handleFrameLoss(client, messageData)
-	case myproto.MessageType_MESSAGE_HEARTBEAT:
-		// 心跳消息，LastSeen 已经在上面更新
-	default:
-		log.Printf("UDP Client %d: Unknown message type: %d\n", client.ID, messageType)
 	}
 }
 
 // 发送UDP消息
-func (s *Server) sendUDPMessage(conn *net.UDPConn, remoteAddr *net.UDPAddr, messageType myproto.MessageType, msg proto.Message) {
-	data, err := proto.Marshal(msg)
+func (s *Server) sendUDPMessage(conn net.PacketConn, remoteAddr net.Addr, messageType myproto.MessageType, msg proto.Message) {
+	// 组合完整消息
+	message, err := codec.Encode(messageType, msg)
 	if err != nil {
 		log.Printf("UDP Marshal error: %v\n", err)
 		return
 	}
 
-	// 计算总长度：1 byte (messageType) + data length
-	totalLength := uint32(1 + len(data))
-
-	// 写入长度 (4 bytes, big endian)
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, totalLength)
-
-	// 组合完整消息
-	message := make([]byte, 4+1+len(data))
-	copy(message[0:4], lengthBytes)
-	message[4] = byte(messageType)
-	copy(message[5:], data)
-
 	// 发送UDP数据报
-	_, err = conn.WriteToUDP(message, remoteAddr)
+	_, err = conn.WriteTo(message, remoteAddr)
 	if err != nil {
-		log.Printf("UDP WriteToUDP error: %v\n", err)
+		log.Printf("UDP WriteTo error: %v\n", err)
 		return
 	}
 }
 
 func main() {
 	server := NewServer()
+
+	// 输入校验策略
+	flag.IntVar(&server.InputPolicy.MaxInputsPerFrame, "max-inputs-per-frame", server.InputPolicy.MaxInputsPerFrame, "每个客户端每帧最多接收的输入数")
+	flag.Int64Var(&server.InputPolicy.MaxFireCoordinate, "max-fire-coord", server.InputPolicy.MaxFireCoordinate, "射击坐标绝对值上限（Fix64原始值）")
+	flag.IntVar(&server.InputPolicy.ViolationThreshold, "violation-threshold", server.InputPolicy.ViolationThreshold, "统计窗口内违规输入达到此次数后执行处理")
+	flag.DurationVar(&server.InputPolicy.ViolationWindow, "violation-window", server.InputPolicy.ViolationWindow, "违规输入统计窗口")
+	flag.StringVar(&server.InputPolicy.ViolationAction, "violation-action", server.InputPolicy.ViolationAction, "违规达到阈值后的处理方式：log、flag 或 kick")
+	// 房间分配
+	flag.BoolVar(&server.AutoAssign, "auto-assign", server.AutoAssign, "连接时自动分配房间（只会等待开局的客户端需要，如Unity客户端和压测工具），否则玩家留在大厅")
+	maxPlayers := flag.Int("max-players", int(server.MaxPlayers), "自动分配的房间和没有指定人数的新房间的最大玩家数")
+
+	// 房间帧率
+	var frameRate int
+	flag.IntVar(&frameRate, "frame-rate", DEFAULT_FRAME_RATE, "房间默认帧率（每秒逻辑帧数，如15、20、30、60）")
+
+	// 自动输入延迟范围
+	minInputDelay := flag.Int("min-input-delay", int(server.InputDelay.MinFrames), "最小输入延迟（帧）")
+	maxInputDelay := flag.Int("max-input-delay", int(server.InputDelay.MaxFrames), "最大输入延迟（帧），0表示不使用输入延迟")
+
+	// 暂停策略
+	flag.StringVar(&server.PausePolicy, "pause-policy", server.PausePolicy, "暂停/继续的决定方式：host（房主决定）或 vote（过半玩家投票）")
+
+	// 比赛结果
+	flag.DurationVar(&server.ResultTimeout, "result-timeout", server.ResultTimeout, "比赛结束后等待玩家提交结果的时间")
+	flag.StringVar(&server.DataDir, "data-dir", DEFAULT_DATA_DIR, "比赛记录和回放的保存目录（为空时不保存）")
+
+	// 匹配
+	matchInitialRange := flag.Int("match-initial-range", int(server.Matchmaking.InitialRange), "开始排队时接受的分数差")
+	matchRangeGrowth := flag.Int("match-range-growth", int(server.Matchmaking.RangeGrowth), "每等待1秒增加的分数差")
+	matchMaxRange := flag.Int("match-max-range", int(server.Matchmaking.MaxRange), "接受的分数差上限")
+	flag.DurationVar(&server.Matchmaking.ConfirmTimeout, "match-confirm-timeout", server.Matchmaking.ConfirmTimeout, "匹配成功后等待所有玩家确认的时间")
+
+	// 玩家数据库和管理接口
+	playerDB := flag.String("player-db", DEFAULT_PLAYER_DB, "玩家账号和比赛历史数据库文件（为空时不支持登录）")
+	settingsSchema := flag.String("settings-schema", "", "房间游戏设置规则（JSON文件，为空时使用内置规则）")
+	adminAddr := flag.String("admin-addr", "", "管理接口（HTTP）监听地址，如 127.0.0.1:8890，为空时不启动")
+	flag.Parse()
+
+	if err := server.InputPolicy.Validate(); err != nil {
+		log.Fatal("Invalid input policy: ", err)
+	}
+	if frameRate < minFrameRate || frameRate > maxFrameRate {
+		log.Fatalf("Invalid frame rate: must be between %d and %d, got %d", minFrameRate, maxFrameRate, frameRate)
+	}
+	server.FrameRate = int32(frameRate)
+	server.MaxPlayers = int32(*maxPlayers)
+	if err := validateRoomOptions(RoomOptions{MaxPlayers: server.MaxPlayers}); err != nil {
+		log.Fatal("Invalid max players: ", err)
+	}
+	server.InputDelay = InputDelayPolicy{MinFrames: int32(*minInputDelay), MaxFrames: int32(*maxInputDelay)}
+	if err := server.InputDelay.Validate(); err != nil {
+		log.Fatal("Invalid input delay policy: ", err)
+	}
+	if err := validatePausePolicy(server.PausePolicy); err != nil {
+		log.Fatal("Invalid pause policy: ", err)
+	}
+	server.Matchmaking.InitialRange = int32(*matchInitialRange)
+	server.Matchmaking.RangeGrowth = int32(*matchRangeGrowth)
+	server.Matchmaking.MaxRange = int32(*matchMaxRange)
+	if err := server.Matchmaking.Validate(); err != nil {
+		log.Fatal("Invalid matchmaking policy: ", err)
+	}
+
+	if *settingsSchema != "" {
+		schema, err := LoadSettingsSchema(*settingsSchema)
+		if err != nil {
+			log.Fatal("Invalid settings schema: ", err)
+		}
+		server.Settings = schema
+	}
+
+	if *playerDB != "" {
+		st, err := store.Open(*playerDB)
+		if err != nil {
+			log.Fatal("Open player store: ", err)
+		}
+		defer st.Close()
+		server.Store = st
+	}
+	if *adminAddr != "" {
+		ln, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			log.Fatal("Admin listen error: ", err)
+		}
+		fmt.Printf("Admin API started on %s\n", ln.Addr())
+		go server.ServeAdmin(ln)
+	}
+
 	// 同时启动TCP、UDP和KCP服务器
 	server.StartAll()
 }
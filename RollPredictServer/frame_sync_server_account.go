@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DEFAULT_PLAYER_DB   = DEFAULT_DATA_DIR + "/players.db" // 玩家数据库的默认路径
+	defaultHistoryLimit = 20                               // 查询比赛历史时默认返回的记录数
+	maxHistoryLimit     = 50                               // 一次最多返回的记录数
+)
+
+// 客户端登录的账号（未登录时为nil）
+func (c *Client) Account() *myproto.PlayerAccount {
+	return c.account.Load()
+}
+
+// 处理客户端发送的连接消息：带名称或令牌时为登录请求
+func (s *Server) handleLogin(client *Client, data []byte) {
+	var request myproto.ConnectMessage
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal connect message error: %v\n", client.ID, err)
+		return
+	}
+	// UDP/KCP客户端发送的空ConnectMessage用于建立连接，服务器已经回复过ConnectMessage，这里忽略
+	if request.Token == "" && request.PlayerName == "" {
+		return
+	}
+
+	reply := &myproto.ConnectMessage{PlayerId: client.ID}
+	switch {
+	case s.Store == nil:
+		log.Printf("Client %d: Login ignored, no player store\n", client.ID)
+	case client.Account() != nil:
+		// 同一个连接只能登录一次，回复当前的账号
+		account := client.Account()
+		reply.AccountId = account.AccountId
+		reply.PlayerName = account.Name
+		log.Printf("Client %d: Already logged in as account %d\n", client.ID, account.AccountId)
+	default:
+		account, token, err := s.Store.Login(request.Token, request.PlayerName)
+		if err != nil {
+			log.Printf("Client %d: Login error: %v\n", client.ID, err)
+			break
+		}
+		client.account.Store(account)
+		client.Name = account.Name
+		reply.AccountId = account.AccountId
+		reply.PlayerName = account.Name
+		reply.Token = token
+		fmt.Printf("Client %d logged in as account %d (%s)\n", client.ID, account.AccountId, account.Name)
+	}
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_CONNECT, reply)
+}
+
+// 处理比赛历史查询
+func (s *Server) handleMatchHistory(client *Client, data []byte) {
+	var request myproto.MatchHistory
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal match history request error: %v\n", client.ID, err)
+		return
+	}
+
+	reply := &myproto.MatchHistory{AccountId: request.AccountId}
+	if reply.AccountId == 0 {
+		if account := client.Account(); account != nil {
+			reply.AccountId = account.AccountId
+		}
+	}
+	limit := int(request.Limit)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+	reply.Limit = int32(limit)
+
+	if s.Store != nil && reply.AccountId != 0 {
+		matches, err := s.Store.MatchHistory(reply.AccountId, limit)
+		if err != nil {
+			log.Printf("Client %d: Query match history of account %d error: %v\n", client.ID, reply.AccountId, err)
+		}
+		reply.Matches = matches
+	}
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_MATCH_HISTORY, reply)
+}
+
+// 比赛结束时房间内的玩家（调用方持有房间锁）
+func (room *Room) participants() []*myproto.MatchParticipant {
+	participants := make([]*myproto.MatchParticipant, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		p := &myproto.MatchParticipant{PlayerId: c.ID}
+		if account := c.Account(); account != nil {
+			p.AccountId = account.AccountId
+			p.Name = account.Name
+		}
+		participants = append(participants, p)
+	}
+	slices.SortFunc(participants, func(a, b *myproto.MatchParticipant) int {
+		return int(a.PlayerId) - int(b.PlayerId)
+	})
+	return participants
+}
+
+// 比赛历史中的一条记录：有共识时使用核对一致的结果，否则使用房主宣布的结果
+func matchSummary(record *myproto.MatchRecord, announced *myproto.MatchEnd, participants []*myproto.MatchParticipant) *myproto.MatchSummary {
+	verdict := record.Verdict
+	summary := &myproto.MatchSummary{
+		MatchId:    record.MatchId,
+		RoomId:     record.RoomId,
+		StartTime:  record.StartTime,
+		EndTime:    record.EndTime,
+		DurationMs: (record.EndTime - record.StartTime) / 1e6,
+		FinalFrame: verdict.FinalFrame,
+		Agreed:     verdict.Agreed,
+		Reason:     announced.GetReason(),
+	}
+
+	winnerID, results := verdict.WinnerId, verdict.Results
+	if !verdict.Agreed && announced != nil {
+		winnerID, results = announced.WinnerId, announced.Results
+	}
+	scores := make(map[int32]int64, len(results))
+	for _, r := range results {
+		scores[r.PlayerId] = r.Score
+	}
+	for _, p := range participants {
+		p = proto.Clone(p).(*myproto.MatchParticipant)
+		p.Score = scores[p.PlayerId]
+		p.Winner = winnerID != nil && *winnerID == p.PlayerId
+		summary.Participants = append(summary.Participants, p)
+	}
+	return summary
+}
+
+// 把比赛写入比赛历史，没有玩家数据库时不记录
+func (s *Server) recordMatchHistory(summary *myproto.MatchSummary) {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.RecordMatch(summary); err != nil {
+		log.Printf("Room %s: Record match %s in history error: %v\n", summary.RoomId, summary.MatchId, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/WjcHome/gohello/store"
+)
+
+// 打开一个测试用的玩家数据库
+func openTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "players.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// 登录并等待服务器回复
+func loginTestClient(t *testing.T, c *client.Client, name, token string) *myproto.ConnectMessage {
+	t.Helper()
+	if err := c.Login(name, token); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	reply := waitForMessage(t, c, myproto.MessageType_MESSAGE_CONNECT).Body.(*myproto.ConnectMessage)
+	if reply.PlayerId != c.PlayerID {
+		t.Fatalf("login reply for player %d, want %d", reply.PlayerId, c.PlayerID)
+	}
+	return reply
+}
+
+func TestLoginAndMatchHistory(t *testing.T) {
+	st := openTestStore(t)
+	s, addrs := startTestServer(t, 2, func(s *Server) { s.Store = st })
+	host := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	other := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	clients := []*client.Client{host, other}
+	roomID := waitForMessage(t, host, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart).RoomId
+
+	alice := loginTestClient(t, host, "alice", "")
+	if alice.AccountId == 0 || alice.PlayerName != "alice" || alice.Token == "" {
+		t.Fatalf("login reply %v", alice)
+	}
+	bob := loginTestClient(t, other, "bob", "")
+	if bob.AccountId == 0 || bob.AccountId == alice.AccountId {
+		t.Fatalf("login reply %v", bob)
+	}
+	// 同一个连接再次登录时回复当前账号，不会切换账号
+	if again := loginTestClient(t, host, "", "bad-token"); again.AccountId != alice.AccountId || again.Token != "" {
+		t.Fatalf("second login on the same connection: %v", again)
+	}
+
+	// 房主宣布自己获胜，双方提交相同的结果
+	collectFrames(t, host, 3)
+	winner := host.PlayerID
+	if err := host.EndMatch(&myproto.MatchEnd{WinnerId: &winner}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	finalFrame := waitForMessage(t, host, myproto.MessageType_MESSAGE_MATCH_END).Body.(*myproto.MatchEnd).FrameNumber
+	for _, c := range clients {
+		if err := c.SubmitResult(&myproto.MatchResult{
+			FinalFrame: finalFrame,
+			WinnerId:   &winner,
+			Results:    []*myproto.PlayerResult{{PlayerId: host.PlayerID, Score: 7}},
+		}); err != nil {
+			t.Fatalf("submit result: %v", err)
+		}
+	}
+	verdict := waitForMessage(t, other, myproto.MessageType_MESSAGE_MATCH_RESULT).Body.(*myproto.MatchResult)
+
+	// 比赛历史按账号查询，0表示查询自己
+	if err := other.QueryMatchHistory(0, 0); err != nil {
+		t.Fatalf("query history: %v", err)
+	}
+	history := waitForMessage(t, other, myproto.MessageType_MESSAGE_MATCH_HISTORY).Body.(*myproto.MatchHistory)
+	if history.AccountId != bob.AccountId || len(history.Matches) != 1 {
+		t.Fatalf("history %v", history)
+	}
+	match := history.Matches[0]
+	if match.MatchId != verdict.MatchId || match.RoomId != roomID || !match.Agreed || match.FinalFrame != finalFrame ||
+		match.EndTime <= match.StartTime || len(match.Participants) != 2 {
+		t.Fatalf("match summary %v", match)
+	}
+	for _, p := range match.Participants {
+		switch p.PlayerId {
+		case host.PlayerID:
+			if p.AccountId != alice.AccountId || p.Name != "alice" || !p.Winner || p.Score != 7 {
+				t.Fatalf("host participant %v", p)
+			}
+		case other.PlayerID:
+			if p.AccountId != bob.AccountId || p.Name != "bob" || p.Winner {
+				t.Fatalf("other participant %v", p)
+			}
+		default:
+			t.Fatalf("unexpected participant %v", p)
+		}
+	}
+
+	// 新连接用令牌登录得到同一个账号
+	reconnected := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	if reply := loginTestClient(t, reconnected, "", alice.Token); reply.AccountId != alice.AccountId || reply.PlayerName != "alice" {
+		t.Fatalf("token login %v", reply)
+	}
+
+	// 管理接口
+	admin := httptest.NewServer(s.AdminHandler())
+	defer admin.Close()
+	var players struct{ Players []json.RawMessage }
+	getJSON(t, admin.URL+"/players", &players)
+	if len(players.Players) != 2 {
+		t.Fatalf("admin players %s", players.Players)
+	}
+	var matches struct{ Matches []json.RawMessage }
+	getJSON(t, admin.URL+"/players/"+strconv.FormatInt(alice.AccountId, 10)+"/matches?limit=5", &matches)
+	if len(matches.Matches) != 1 {
+		t.Fatalf("admin matches %s", matches.Matches)
+	}
+	if resp, err := http.Get(admin.URL + "/players/999"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown player: %v %v", resp, err)
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: decode: %v", url, err)
+	}
+}
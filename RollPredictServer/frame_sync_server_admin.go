@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/WjcHome/gohello/store"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// 管理接口（HTTP，返回JSON）：
+//
+//	GET /players                    所有账号
+//	GET /players/{id}               一个账号
+//	GET /players/{id}/matches       账号的比赛历史（?limit=，默认20）
+//	GET /matches                    最近的比赛（?limit=，默认20）
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /players", s.adminPlayers)
+	mux.HandleFunc("GET /players/{id}", s.adminPlayer)
+	mux.HandleFunc("GET /players/{id}/matches", s.adminPlayerMatches)
+	mux.HandleFunc("GET /matches", s.adminMatches)
+	return mux
+}
+
+// 在已有的监听器上提供管理接口，监听器关闭后返回
+func (s *Server) ServeAdmin(ln net.Listener) {
+	if err := http.Serve(ln, s.AdminHandler()); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Println("Admin API error:", err)
+	}
+}
+
+func (s *Server) adminPlayers(w http.ResponseWriter, r *http.Request) {
+	if !s.requireStore(w) {
+		return
+	}
+	accounts, err := s.Store.Accounts()
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeProtoList(w, "players", accounts)
+}
+
+func (s *Server) adminPlayer(w http.ResponseWriter, r *http.Request) {
+	id, ok := accountIDParam(w, r)
+	if !ok || !s.requireStore(w) {
+		return
+	}
+	account, err := s.Store.Account(id)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeProto(w, account)
+}
+
+func (s *Server) adminPlayerMatches(w http.ResponseWriter, r *http.Request) {
+	id, ok := accountIDParam(w, r)
+	if !ok || !s.requireStore(w) {
+		return
+	}
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.Store.Account(id); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	matches, err := s.Store.MatchHistory(id, limit)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeProtoList(w, "matches", matches)
+}
+
+func (s *Server) adminMatches(w http.ResponseWriter, r *http.Request) {
+	if !s.requireStore(w) {
+		return
+	}
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	matches, err := s.Store.RecentMatches(limit)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeProtoList(w, "matches", matches)
+}
+
+// 没有玩家数据库时返回503
+func (s *Server) requireStore(w http.ResponseWriter) bool {
+	if s.Store == nil {
+		http.Error(w, "player store disabled", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func accountIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid account id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func limitParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultHistoryLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return limit, true
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Println("Admin API error:", err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func writeProto(w http.ResponseWriter, msg proto.Message) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// 列表输出为 {"<key>": [...]}，每个元素使用protobuf的JSON格式
+func writeProtoList[T proto.Message](w http.ResponseWriter, key string, items []T) {
+	list := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		data, err := protojson.Marshal(item)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		list = append(list, data)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]json.RawMessage{key: list})
+}
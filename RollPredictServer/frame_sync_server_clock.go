@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 帧率和时间缩放的范围
+const (
+	minFrameRate = 1
+	maxFrameRate = 120
+	minTimeScale = 0.1 // 最慢十分之一速度
+	maxTimeScale = 4.0 // 最快四倍速度
+
+	// 帧循环落后时一次最多补发的帧数，落后更多时丢弃多余的帧并重新对齐时钟，
+	// 避免进程被挂起后瞬间发出大量帧
+	maxCatchUpFrames = 5
+
+	// 游戏开始消息发出后，等待客户端收到再开始计时
+	gameStartDelay = 200 * time.Millisecond
+)
+
+// 校验帧率
+func validateFrameRate(frameRate int32) error {
+	if frameRate < minFrameRate || frameRate > maxFrameRate {
+		return fmt.Errorf("frame rate must be between %d and %d, got %d", minFrameRate, maxFrameRate, frameRate)
+	}
+	return nil
+}
+
+// 校验时间缩放（NaN 也会被拒绝）
+func validateTimeScale(timeScale float64) error {
+	if !(timeScale >= minTimeScale && timeScale <= maxTimeScale) {
+		return fmt.Errorf("time scale must be between %g and %g, got %g", minTimeScale, maxTimeScale, timeScale)
+	}
+	return nil
+}
+
+// 实际帧间隔：时间缩放只改变发帧的快慢，每帧的逻辑步长仍然是 1/frameRate 秒
+func frameIntervalOf(frameRate int32, timeScale float64) time.Duration {
+	return time.Duration(float64(time.Second) / (float64(frameRate) * timeScale))
+}
+
+// frameClock 计算每一帧的计划发送时间。
+// 计划时间从锚点推算，而不是在上一次 tick 的基础上累加，调度延迟不会累积成漂移。
+type frameClock struct {
+	interval    time.Duration // 实际帧间隔
+	anchorTime  time.Time     // 锚点时间
+	anchorFrame int64         // 锚点时已经发出的帧数
+}
+
+func newFrameClock(interval time.Duration, anchorTime time.Time, anchorFrame int64) frameClock {
+	return frameClock{
+		interval:    interval,
+		anchorTime:  anchorTime,
+		anchorFrame: anchorFrame,
+	}
+}
+
+// 第 frame 帧的计划发送时间
+func (c frameClock) frameTime(frame int64) time.Time {
+	return c.anchorTime.Add(time.Duration(frame-c.anchorFrame) * c.interval)
+}
+
+// 到 now 为止应当发出的帧数
+func (c frameClock) dueFrames(now time.Time) int64 {
+	if now.Before(c.anchorTime) {
+		return c.anchorFrame
+	}
+	return c.anchorFrame + int64(now.Sub(c.anchorTime)/c.interval)
+}
+
+// 从 frame 之后的帧开始改用新的帧间隔，第 frame 帧的计划时间保持不变
+func (c frameClock) retime(frame int64, interval time.Duration) frameClock {
+	return newFrameClock(interval, c.frameTime(frame), frame)
+}
+
+// 房间帧循环：按房间的帧时钟（startGame 中设置）发帧，落后时补发到期的帧。
+// 暂停时停止发帧，比赛结束或开始新的一局后退出。
+func (room *Room) frameLoop(server *Server, round int) {
+	fmt.Printf("Frame loop started for room %s (%d fps, time scale %g)\n", room.ID, room.FrameRate, room.TimeScale)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		room.Mutex.Lock()
+		status := room.Status
+		clientCount := len(room.Clients)
+		next := room.clock.frameTime(room.FrameNumber + 1)
+		room.Mutex.Unlock()
+
+		switch {
+		case clientCount == 0:
+			fmt.Printf("Room %s has no clients, stopping frame loop\n", room.ID)
+			return
+		case room.currentRound() != round || (status != "playing" && status != "paused"):
+			fmt.Printf("Room %s: Frame loop for round %d stopped (%s)\n", room.ID, round, status)
+			return
+		case status == "paused":
+			// 暂停时等待状态改变
+			<-room.wake
+			continue
+		}
+
+		if wait := time.Until(next); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-room.wake:
+				// 时钟或状态改变，重新检查
+				timer.Stop()
+				continue
+			}
+		}
+
+		if !room.emitDueFrames(server, time.Now()) {
+			fmt.Printf("Room %s has no clients, stopping frame loop\n", room.ID)
+			return
+		}
+		server.updateInputDelay(room, time.Now())
+	}
+}
+
+// 当前局数
+func (room *Room) currentRound() int {
+	room.Mutex.Lock()
+	defer room.Mutex.Unlock()
+	return room.round
+}
+
+// 唤醒帧循环（不阻塞）
+func (room *Room) wakeFrameLoop() {
+	select {
+	case room.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 发出到 now 为止所有到期的帧，房间没有客户端时返回false
+func (room *Room) emitDueFrames(server *Server, now time.Time) bool {
+	room.Mutex.Lock()
+	due := room.clock.dueFrames(now) - room.FrameNumber
+	if due > maxCatchUpFrames {
+		log.Printf("Room %s: Frame loop is %d frames behind, skipping %d frames\n",
+			room.ID, due, due-maxCatchUpFrames)
+		due = maxCatchUpFrames
+		room.clock = newFrameClock(room.clock.interval, now, room.FrameNumber+due)
+	}
+	room.Mutex.Unlock()
+
+	for i := int64(0); i < due; i++ {
+		if !room.emitFrame(server) {
+			return false
+		}
+	}
+	return true
+}
+
+// 发出一帧：取出该帧的输入，保存到历史记录并发送给所有客户端。
+// 房间不在游戏中（暂停、结束）时不发帧
+func (room *Room) emitFrame(server *Server) bool {
+	room.Mutex.Lock()
+	if room.Status != "playing" {
+		room.Mutex.Unlock()
+		return true
+	}
+	clients := make([]*Client, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		clients = append(clients, c)
+	}
+	if len(clients) == 0 {
+		room.Mutex.Unlock()
+		return false
+	}
+	room.FrameNumber++
+
+	// 构建服务器帧数据并保存到历史记录
+	serverFrame := &myproto.ServerFrame{
+		FrameNumber: room.FrameNumber,
+		Timestamp:   time.Now().UnixNano(),
+		FrameDatas:  room.takeInputs(room.FrameNumber),
+	}
+	room.HistoryFrames = append(room.HistoryFrames, serverFrame)
+	room.applyPendingInputDelay()
+	room.Mutex.Unlock()
+
+	// 发送给所有客户端
+	for _, client := range clients {
+		server.sendMessageToClient(client, myproto.MessageType_MESSAGE_SERVER_FRAME, serverFrame)
+	}
+	return true
+}
+
+// 处理房主的时间缩放请求
+func (s *Server) handleTimeScale(client *Client, data []byte) {
+	var request myproto.TimeScaleChange
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal time scale error: %v\n", client.ID, err)
+		return
+	}
+	if err := validateTimeScale(request.TimeScale); err != nil {
+		log.Printf("Client %d: Rejected time scale: %v\n", client.ID, err)
+		return
+	}
+
+	s.Mutex.Lock()
+	room, exists := s.Rooms[client.RoomID]
+	s.Mutex.Unlock()
+	if !exists {
+		log.Printf("Client %d: Room not found: %s\n", client.ID, client.RoomID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.HostID != client.ID {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Only the host can change time scale\n", client.ID)
+		return
+	}
+
+	room.TimeScale = request.TimeScale
+	interval := frameIntervalOf(room.FrameRate, room.TimeScale)
+	if room.Status == "playing" {
+		// 上一帧的计划时间不变，之后的帧按新的间隔发送
+		room.clock = room.clock.retime(room.FrameNumber, interval)
+		room.wakeFrameLoop()
+	}
+	change := &myproto.TimeScaleChange{
+		TimeScale:       room.TimeScale,
+		FrameNumber:     room.FrameNumber + 1,
+		FrameIntervalNs: int64(interval),
+	}
+	clients := make([]*Client, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		clients = append(clients, c)
+	}
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Time scale set to %g by client %d (from frame %d)\n",
+		room.ID, change.TimeScale, client.ID, change.FrameNumber)
+	for _, c := range clients {
+		s.sendMessageToClient(c, myproto.MessageType_MESSAGE_TIME_SCALE, change)
+	}
+}
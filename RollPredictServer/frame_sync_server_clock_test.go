@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestFrameClockSchedulesFromAnchor(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	interval := frameIntervalOf(60, 1)
+	if want := time.Second / 60; interval != want {
+		t.Fatalf("60 fps interval = %v, want %v", interval, want)
+	}
+	clock := newFrameClock(interval, start, 0)
+
+	if got, want := clock.frameTime(1), start.Add(interval); !got.Equal(want) {
+		t.Fatalf("frame 1 at %v, want %v", got, want)
+	}
+	// 计划时间由锚点推算，600帧后仍然恰好是10秒
+	if got, want := clock.frameTime(600), start.Add(10*time.Second); got.Sub(want).Abs() > time.Microsecond {
+		t.Fatalf("frame 600 at %v, want %v", got, want)
+	}
+
+	cases := []struct {
+		elapsed time.Duration
+		want    int64
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{interval - 1, 0},
+		{interval, 1},
+		{100 * time.Millisecond, 6},
+		{time.Second, 60},
+	}
+	for _, tc := range cases {
+		if got := clock.dueFrames(start.Add(tc.elapsed)); got != tc.want {
+			t.Errorf("dueFrames after %v = %d, want %d", tc.elapsed, got, tc.want)
+		}
+	}
+
+	// 第6帧之后改为半速：第6帧的时间不变，之后每帧间隔加倍
+	slow := clock.retime(6, frameIntervalOf(60, 0.5))
+	if !slow.frameTime(6).Equal(clock.frameTime(6)) {
+		t.Fatalf("retime moved frame 6 from %v to %v", clock.frameTime(6), slow.frameTime(6))
+	}
+	if got, want := slow.frameTime(7).Sub(slow.frameTime(6)), 2*interval; (got - want).Abs() > time.Microsecond {
+		t.Fatalf("interval after slow-down = %v, want %v", got, want)
+	}
+}
+
+func TestValidateFrameRateAndTimeScale(t *testing.T) {
+	for _, rate := range []int32{15, 20, 30, 60} {
+		if err := validateFrameRate(rate); err != nil {
+			t.Errorf("frame rate %d rejected: %v", rate, err)
+		}
+	}
+	for _, rate := range []int32{-1, 0, maxFrameRate + 1} {
+		if validateFrameRate(rate) == nil {
+			t.Errorf("frame rate %d accepted", rate)
+		}
+	}
+
+	var zero float64
+	for _, scale := range []float64{0.25, 1, 2} {
+		if err := validateTimeScale(scale); err != nil {
+			t.Errorf("time scale %g rejected: %v", scale, err)
+		}
+	}
+	for _, scale := range []float64{0, -1, maxTimeScale * 2, zero / zero} {
+		if validateTimeScale(scale) == nil {
+			t.Errorf("time scale %g accepted", scale)
+		}
+	}
+}
+
+func TestEmitDueFramesCatchesUp(t *testing.T) {
+	s := NewServer()
+	_, room := newPlayingRoom(t, s)
+	interval := frameIntervalOf(20, 1)
+	now := time.Now()
+
+	// 落后3帧：一次补发3帧
+	room.clock = newFrameClock(interval, now.Add(-3*interval), 0)
+	if !room.emitDueFrames(s, now) {
+		t.Fatalf("room with clients reported empty")
+	}
+	if room.FrameNumber != 3 || len(room.HistoryFrames) != 3 {
+		t.Fatalf("emitted %d frames (history %d), want 3", room.FrameNumber, len(room.HistoryFrames))
+	}
+
+	// 落后太多：最多补发 maxCatchUpFrames 帧，然后从当前时间重新对齐
+	room.clock = newFrameClock(interval, now.Add(-100*interval), room.FrameNumber)
+	room.emitDueFrames(s, now)
+	if room.FrameNumber != 3+maxCatchUpFrames {
+		t.Fatalf("frame number = %d after falling behind, want %d", room.FrameNumber, 3+maxCatchUpFrames)
+	}
+	if due := room.clock.dueFrames(now) - room.FrameNumber; due != 0 {
+		t.Fatalf("%d frames still due after resync", due)
+	}
+	if got, want := room.clock.frameTime(room.FrameNumber+1), now.Add(interval); !got.Equal(want) {
+		t.Fatalf("next frame at %v, want %v", got, want)
+	}
+
+	for i, frame := range room.HistoryFrames {
+		if frame.FrameNumber != int64(i+1) {
+			t.Fatalf("history frame %d has number %d", i, frame.FrameNumber)
+		}
+	}
+}
+
+// 帧间隔的平均值（用服务器时间戳计算）
+func averageFrameInterval(frames []*myproto.ServerFrame) time.Duration {
+	first, last := frames[0], frames[len(frames)-1]
+	return time.Duration(last.Timestamp-first.Timestamp) / time.Duration(last.FrameNumber-first.FrameNumber)
+}
+
+func withinPercent(got, want time.Duration, percent int64) bool {
+	return (got - want).Abs() <= want*time.Duration(percent)/100
+}
+
+func TestRoomFrameRateAndTimeScale(t *testing.T) {
+	_, addrs := startTestServer(t, 2, func(s *Server) { s.FrameRate = 60 })
+
+	host := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	other := dialTestClient(t, client.ProtocolUDP, addrs[client.ProtocolUDP])
+
+	for _, c := range []*client.Client{host, other} {
+		gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+		if gameStart.FrameRate != 60 || gameStart.TimeScale != 1 {
+			t.Fatalf("GameStart frame rate %d, time scale %g; want 60, 1", gameStart.FrameRate, gameStart.TimeScale)
+		}
+	}
+
+	frames := collectFrames(t, host, 30)
+	if got, want := averageFrameInterval(frames), time.Second/60; !withinPercent(got, want, 15) {
+		t.Fatalf("average frame interval %v, want about %v", got, want)
+	}
+
+	// 非房主的请求被忽略
+	if err := other.SetTimeScale(0.5); err != nil {
+		t.Fatalf("set time scale: %v", err)
+	}
+	// 房主改为半速，所有客户端收到通知
+	if err := host.SetTimeScale(0.5); err != nil {
+		t.Fatalf("set time scale: %v", err)
+	}
+	var change *myproto.TimeScaleChange
+	for _, c := range []*client.Client{host, other} {
+		change = waitForMessage(t, c, myproto.MessageType_MESSAGE_TIME_SCALE).Body.(*myproto.TimeScaleChange)
+		if change.TimeScale != 0.5 {
+			t.Fatalf("client %d got time scale %g, want 0.5", c.PlayerID, change.TimeScale)
+		}
+	}
+	if got, want := time.Duration(change.FrameIntervalNs), time.Second/30; !withinPercent(got, want, 1) {
+		t.Fatalf("announced interval %v, want %v", got, want)
+	}
+
+	// 跳过通知之前已经发出的帧
+	var slowed []*myproto.ServerFrame
+	for len(slowed) < 15 {
+		frame := waitForMessage(t, host, myproto.MessageType_MESSAGE_SERVER_FRAME).Body.(*myproto.ServerFrame)
+		if frame.FrameNumber >= change.FrameNumber {
+			slowed = append(slowed, frame)
+		}
+	}
+	if got, want := averageFrameInterval(slowed), time.Second/30; !withinPercent(got, want, 15) {
+		t.Fatalf("average frame interval after slow-down %v, want about %v", got, want)
+	}
+	for i := 1; i < len(slowed); i++ {
+		if slowed[i].FrameNumber != slowed[i-1].FrameNumber+1 {
+			t.Fatalf("frame numbers not consecutive: %d then %d", slowed[i-1].FrameNumber, slowed[i].FrameNumber)
+		}
+	}
+}
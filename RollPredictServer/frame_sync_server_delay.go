@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+const (
+	inputDelayUpdateInterval = time.Second            // 重新计算输入延迟的间隔
+	inputDelayLeadTime       = 250 * time.Millisecond // 变更生效帧在最大RTT之外额外留出的时间
+)
+
+// InputDelayPolicy 是自动输入延迟的范围（单位：帧），两者都为0时不使用输入延迟
+type InputDelayPolicy struct {
+	MinFrames int32
+	MaxFrames int32
+}
+
+// 默认输入延迟策略
+func DefaultInputDelayPolicy() InputDelayPolicy {
+	return InputDelayPolicy{
+		MinFrames: 0,
+		MaxFrames: 8,
+	}
+}
+
+// 校验策略配置
+func (p InputDelayPolicy) Validate() error {
+	if p.MinFrames < 0 {
+		return fmt.Errorf("min input delay must not be negative, got %d", p.MinFrames)
+	}
+	if p.MaxFrames < p.MinFrames {
+		return fmt.Errorf("max input delay %d is less than min input delay %d", p.MaxFrames, p.MinFrames)
+	}
+	return nil
+}
+
+// 根据房间内客户端的延迟计算目标输入延迟，返回目标延迟和最大RTT。
+// 输入从客户端到服务器需要单程时间（RTT/2，加上两倍抖动作为余量），
+// 输入延迟要覆盖最慢的客户端，使其输入仍然能赶上目标帧。
+func (p InputDelayPolicy) targetDelay(latencies []Latency, interval time.Duration) (int32, time.Duration) {
+	var oneWay, maxRTT time.Duration
+	for _, latency := range latencies {
+		if latency.Samples == 0 {
+			continue
+		}
+		oneWay = max(oneWay, latency.RTT/2+2*latency.Jitter)
+		maxRTT = max(maxRTT, latency.RTT)
+	}
+
+	delay := int64(oneWay / interval)
+	return int32(min(max(delay, int64(p.MinFrames)), int64(p.MaxFrames))), maxRTT
+}
+
+// 房间内客户端的延迟（调用方持有房间锁）
+func (room *Room) latencies() []Latency {
+	latencies := make([]Latency, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		latencies = append(latencies, c.Latency())
+	}
+	return latencies
+}
+
+// 把输入放入按当前输入延迟计算的目标帧（调用方持有房间锁）。
+// 同一个客户端的目标帧不会后退，输入延迟减小时输入顺序保持不变。
+func (room *Room) bufferInput(client *Client, frameData *myproto.FrameData) {
+	nextFrame := room.FrameNumber + 1
+	target := max(nextFrame+int64(room.InputDelay), client.input.lastTargetFrame)
+	client.input.lastTargetFrame = target
+
+	if target == nextFrame {
+		room.FrameDataBuffer = append(room.FrameDataBuffer, frameData)
+		return
+	}
+	if room.delayedInputs == nil {
+		room.delayedInputs = make(map[int64][]*myproto.FrameData)
+	}
+	room.delayedInputs[target] = append(room.delayedInputs[target], frameData)
+}
+
+// 取出第 frame 帧的所有输入：先到的延迟输入在前（调用方持有房间锁）
+func (room *Room) takeInputs(frame int64) []*myproto.FrameData {
+	frameDatas := room.FrameDataBuffer
+	room.FrameDataBuffer = make([]*myproto.FrameData, 0)
+	if delayed, ok := room.delayedInputs[frame]; ok {
+		delete(room.delayedInputs, frame)
+		frameDatas = append(delayed, frameDatas...)
+	}
+	return frameDatas
+}
+
+// 发出第 room.FrameNumber 帧之后，到期的输入延迟变更开始生效（调用方持有房间锁）
+func (room *Room) applyPendingInputDelay() {
+	if room.pendingInputDelay != nil && room.FrameNumber+1 >= room.pendingInputDelay.FrameNumber {
+		room.InputDelay = room.pendingInputDelay.InputDelay
+		room.pendingInputDelay = nil
+	}
+}
+
+// 定期根据延迟调整房间的输入延迟，变更提前通知客户端并在未来的某一帧生效
+func (s *Server) updateInputDelay(room *Room, now time.Time) {
+	room.Mutex.Lock()
+	if now.Sub(room.inputDelayUpdated) < inputDelayUpdateInterval || room.pendingInputDelay != nil {
+		room.Mutex.Unlock()
+		return
+	}
+	room.inputDelayUpdated = now
+
+	interval := room.clock.interval
+	target, maxRTT := s.InputDelay.targetDelay(room.latencies(), interval)
+	if target < room.InputDelay {
+		// 减小时每次只减一帧，避免延迟波动时来回切换
+		target = room.InputDelay - 1
+	}
+	if target == room.InputDelay {
+		room.Mutex.Unlock()
+		return
+	}
+
+	// 生效帧要晚于所有客户端收到通知的时间
+	lead := int64((maxRTT+inputDelayLeadTime)/interval) + 1
+	change := &myproto.InputDelayChange{
+		InputDelay:  target,
+		FrameNumber: room.FrameNumber + 1 + lead,
+	}
+	room.pendingInputDelay = change
+	current := room.InputDelay
+	clients := make([]*Client, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		clients = append(clients, c)
+	}
+	room.Mutex.Unlock()
+
+	log.Printf("Room %s: Input delay %d -> %d frames from frame %d (max RTT %v)\n",
+		room.ID, current, change.InputDelay, change.FrameNumber, maxRTT)
+	for _, c := range clients {
+		s.sendMessageToClient(c, myproto.MessageType_MESSAGE_INPUT_DELAY, change)
+	}
+}
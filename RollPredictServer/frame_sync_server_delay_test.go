@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestTargetInputDelay(t *testing.T) {
+	policy := InputDelayPolicy{MinFrames: 1, MaxFrames: 6}
+	interval := 50 * time.Millisecond
+	measured := func(rtt, jitter time.Duration) Latency {
+		return Latency{RTT: rtt, Jitter: jitter, Samples: 10}
+	}
+
+	cases := []struct {
+		name      string
+		latencies []Latency
+		want      int32
+	}{
+		{"no samples", []Latency{{RTT: time.Second}}, 1},
+		{"loopback", []Latency{measured(time.Millisecond, 0)}, 1},
+		{"100ms rtt", []Latency{measured(100*time.Millisecond, 0)}, 1},
+		{"jitter counts twice", []Latency{measured(100*time.Millisecond, 25*time.Millisecond)}, 2},
+		{"slowest client wins", []Latency{measured(20*time.Millisecond, 0), measured(300*time.Millisecond, 0)}, 3},
+		{"clamped to max", []Latency{measured(2*time.Second, 0)}, 6},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, _ := policy.targetDelay(tc.latencies, interval); got != tc.want {
+				t.Fatalf("targetDelay = %d, want %d", got, tc.want)
+			}
+		})
+	}
+
+	if err := (InputDelayPolicy{MinFrames: 3, MaxFrames: 2}).Validate(); err == nil {
+		t.Fatalf("min > max accepted")
+	}
+}
+
+func TestInputDelayPlacesInputsInFutureFrames(t *testing.T) {
+	s := NewServer()
+	c, room := newPlayingRoom(t, s)
+	input := func(direction myproto.InputDirection) {
+		t.Helper()
+		s.handleFrameData(c, marshalFrameData(t, &myproto.FrameData{Direction: direction}))
+	}
+
+	// 延迟2帧：发出第0帧之后收到的输入进入第3帧
+	room.InputDelay = 2
+	input(myproto.InputDirection_DIRECTION_UP)
+	// 延迟减为0：之后的输入不会排到已经推迟的输入前面
+	room.InputDelay = 0
+	input(myproto.InputDirection_DIRECTION_DOWN)
+
+	var frames []*myproto.ServerFrame
+	for i := 0; i < 4; i++ {
+		if !room.emitFrame(s) {
+			t.Fatalf("room reported empty")
+		}
+		frames = append(frames, room.HistoryFrames[len(room.HistoryFrames)-1])
+	}
+	for i, want := range []int{0, 0, 2, 0} {
+		if got := len(frames[i].FrameDatas); got != want {
+			t.Fatalf("frame %d has %d inputs, want %d", frames[i].FrameNumber, got, want)
+		}
+	}
+	if got := frames[2].FrameDatas; got[0].Direction != myproto.InputDirection_DIRECTION_UP ||
+		got[1].Direction != myproto.InputDirection_DIRECTION_DOWN {
+		t.Fatalf("inputs reordered: %v", got)
+	}
+}
+
+func TestInputTargetFrameResetsInNextRoom(t *testing.T) {
+	s := NewServer()
+	c, room := newPlayingRoom(t, s)
+	room.FrameNumber = 5000
+	s.handleFrameData(c, marshalFrameData(t, &myproto.FrameData{Direction: myproto.InputDirection_DIRECTION_UP}))
+	s.leaveRoom(c, "test")
+
+	// 新房间的帧号从0开始，输入进入下一帧而不是第5001帧
+	next := &Room{ID: "2", Clients: map[int32]*Client{c.ID: c}, Status: "playing"}
+	c.RoomID = next.ID
+	s.Rooms[next.ID] = next
+	s.handleFrameData(c, marshalFrameData(t, &myproto.FrameData{Direction: myproto.InputDirection_DIRECTION_DOWN}))
+	if len(next.FrameDataBuffer) != 1 || len(next.delayedInputs) != 0 {
+		t.Fatalf("input buffered for the next frame: %d, delayed: %v", len(next.FrameDataBuffer), next.delayedInputs)
+	}
+}
+
+func TestInputDelayChangeTakesEffectOnAnnouncedFrame(t *testing.T) {
+	s := NewServer()
+	c, room := newPlayingRoom(t, s)
+	interval := 50 * time.Millisecond
+	room.clock = newFrameClock(interval, time.Now(), 0)
+
+	// 200ms RTT 对应 2 帧延迟
+	for i := 0; i < 10; i++ {
+		c.latency.addSample(200*time.Millisecond, 0)
+	}
+	now := time.Now()
+	s.updateInputDelay(room, now)
+	change := room.pendingInputDelay
+	if change == nil {
+		t.Fatalf("no input delay change scheduled")
+	}
+	if change.InputDelay != 2 {
+		t.Fatalf("scheduled delay %d, want 2", change.InputDelay)
+	}
+	// 生效帧留出最大RTT和额外余量
+	if minFrame := room.FrameNumber + 1 + int64((200*time.Millisecond+inputDelayLeadTime)/interval); change.FrameNumber <= minFrame {
+		t.Fatalf("change takes effect at frame %d, want after %d", change.FrameNumber, minFrame)
+	}
+
+	// 已有未生效的变更时不会重复计算
+	s.updateInputDelay(room, now.Add(time.Hour))
+	if room.pendingInputDelay != change {
+		t.Fatalf("pending change replaced before it took effect")
+	}
+
+	// 发出生效帧的前一帧之后，新的延迟开始生效
+	for room.FrameNumber+1 < change.FrameNumber {
+		if room.InputDelay != 0 {
+			t.Fatalf("delay changed early, after frame %d", room.FrameNumber)
+		}
+		room.emitFrame(s)
+	}
+	if room.InputDelay != 2 || room.pendingInputDelay != nil {
+		t.Fatalf("delay = %d after frame %d, want 2", room.InputDelay, room.FrameNumber)
+	}
+
+	// 延迟下降时每次只减一帧
+	c.latency = latencyStats{}
+	c.latency.addSample(time.Millisecond, 0)
+	s.updateInputDelay(room, now.Add(2*time.Hour))
+	if room.pendingInputDelay == nil || room.pendingInputDelay.InputDelay != 1 {
+		t.Fatalf("pending change = %v, want delay 1", room.pendingInputDelay)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 把房主转给房间内的另一个玩家（调用方持有房间锁）
+func (room *Room) transferHost(host *Client) {
+	if old, inRoom := room.Clients[room.HostID]; inRoom {
+		old.IsHost = false
+	}
+	host.IsHost = true
+	room.HostID = host.ID
+}
+
+// 处理房主命令
+func (s *Server) handleHostCommand(client *Client, data []byte) {
+	var command myproto.HostCommand
+	if err := proto.Unmarshal(data, &command); err != nil {
+		log.Printf("Client %d: Unmarshal host command error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Host command without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	kicked, start, err := s.applyHostCommand(room, client, &command)
+	if err != nil {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: %s rejected: %v\n", client.ID, command.Action, err)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_HOST_COMMAND, &myproto.HostCommand{
+			Action: command.Action, TargetId: command.TargetId, MaxPlayers: command.MaxPlayers, Error: err.Error(),
+		})
+		return
+	}
+	notice := &myproto.HostCommand{
+		Action: command.Action, TargetId: command.TargetId, MaxPlayers: room.MaxPlayers, HostId: client.ID,
+	}
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Host %d executed %s (target %d)\n", room.ID, client.ID, command.Action, command.TargetId)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_HOST_COMMAND, notice)
+
+	// 被踢出的玩家离开房间，回到大厅
+	if kicked != nil && kicked.RoomID == room.ID {
+		s.leaveRoom(kicked, "kicked by host")
+	}
+
+	room.Mutex.Lock()
+	info := room.info()
+	clients = room.clientList()
+	room.Mutex.Unlock()
+	s.broadcast(clients, myproto.MessageType_MESSAGE_ROOM_INFO, info)
+
+	if start {
+		fmt.Printf("Room %s is full, starting game...\n", room.ID)
+		go func() {
+			time.Sleep(100 * time.Millisecond) // 稍微延迟，确保所有客户端都收到房间信息
+			s.startGame(room.ID)
+		}()
+	}
+}
+
+// 校验并执行房主命令，返回被踢出的玩家和是否需要开局（调用方持有房间锁）
+func (s *Server) applyHostCommand(room *Room, host *Client, command *myproto.HostCommand) (kicked *Client, start bool, err error) {
+	if room.HostID != host.ID {
+		return nil, false, errors.New("only the host can do this")
+	}
+	target, inRoom := room.Clients[command.TargetId]
+
+	switch command.Action {
+	case myproto.HostAction_HOST_ACTION_KICK:
+		if !inRoom || target == host {
+			return nil, false, fmt.Errorf("cannot kick player %d", command.TargetId)
+		}
+		// 比赛中踢人会打断其他玩家的对局，匹配的房间由匹配系统决定成员
+		if (room.Status != "waiting" && room.Status != "finished") || room.queue != nil {
+			return nil, false, fmt.Errorf("cannot kick players in a %s room", room.Status)
+		}
+		if room.kicked == nil {
+			room.kicked = make(map[int32]bool)
+		}
+		room.kicked[target.ID] = true
+		return target, false, nil
+
+	case myproto.HostAction_HOST_ACTION_TRANSFER_HOST:
+		if !inRoom || target == host {
+			return nil, false, fmt.Errorf("cannot transfer host to player %d", command.TargetId)
+		}
+		room.transferHost(target)
+		return nil, false, nil
+
+	case myproto.HostAction_HOST_ACTION_LOCK, myproto.HostAction_HOST_ACTION_UNLOCK:
+		room.Locked = command.Action == myproto.HostAction_HOST_ACTION_LOCK
+		return nil, false, nil
+
+	case myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS:
+		if room.Status != "waiting" || room.queue != nil {
+			return nil, false, fmt.Errorf("cannot change max players in a %s room", room.Status)
+		}
+		if err := validateRoomOptions(RoomOptions{MaxPlayers: command.MaxPlayers}); err != nil {
+			return nil, false, err
+		}
+		if command.MaxPlayers < int32(len(room.Clients)) {
+			return nil, false, fmt.Errorf("room already has %d players", len(room.Clients))
+		}
+		if err := validateTeamCount(room.TeamCount, command.MaxPlayers); err != nil {
+			return nil, false, err
+		}
+		for _, e := range room.roster {
+			if e.Slot >= command.MaxPlayers {
+				return nil, false, fmt.Errorf("player %d is in slot %d", e.PlayerId, e.Slot)
+			}
+		}
+		room.MaxPlayers = command.MaxPlayers
+		return nil, int32(len(room.Clients)) >= room.MaxPlayers, nil
+	}
+	return nil, false, fmt.Errorf("unknown host action %d", command.Action)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestLeaveRoomPicksEarliestClientAsHost(t *testing.T) {
+	s := NewServer()
+	host := &Client{ID: 5}
+	roomID, err := s.CreateRoom(host, RoomOptions{MaxPlayers: 4})
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	for _, id := range []int32{9, 3, 7} {
+		if err := s.JoinRoom(&Client{ID: id}, roomID, ""); err != nil {
+			t.Fatalf("join: %v", err)
+		}
+	}
+	room := s.Rooms[roomID]
+
+	for _, want := range []int32{3, 7, 9} {
+		s.leaveRoom(room.Clients[room.HostID], "test")
+		if room.HostID != want || !room.Clients[want].IsHost {
+			t.Fatalf("host = %d, want %d", room.HostID, want)
+		}
+	}
+	if host.IsHost {
+		t.Fatalf("client still marked as host after leaving")
+	}
+}
+
+// 等待房主命令的广播或错误回复
+func waitForHostCommand(t *testing.T, c *client.Client) *myproto.HostCommand {
+	t.Helper()
+	return waitForMessage(t, c, myproto.MessageType_MESSAGE_HOST_COMMAND).Body.(*myproto.HostCommand)
+}
+
+func TestHostCommands(t *testing.T) {
+	s, addrs := startTestServer(t, 4)
+	dial := func() *client.Client {
+		return dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	}
+	command := func(c *client.Client, action myproto.HostAction, target, maxPlayers int32) {
+		t.Helper()
+		if err := c.HostCommand(action, target, maxPlayers); err != nil {
+			t.Fatalf("host command: %v", err)
+		}
+	}
+	host, bob, carol := dial(), dial(), dial()
+
+	// 只有房主能执行命令
+	command(bob, myproto.HostAction_HOST_ACTION_LOCK, 0, 0)
+	if reply := waitForHostCommand(t, bob); reply.Error == "" {
+		t.Fatalf("non-host command accepted: %v", reply)
+	}
+
+	// 锁定后新玩家不会被分配进来，也不能用邀请码加入
+	command(host, myproto.HostAction_HOST_ACTION_LOCK, 0, 0)
+	for _, c := range []*client.Client{host, bob, carol} {
+		if notice := waitForHostCommand(t, c); notice.Action != myproto.HostAction_HOST_ACTION_LOCK || notice.HostId != host.PlayerID {
+			t.Fatalf("client %d: notice %v", c.PlayerID, notice)
+		}
+	}
+	info := waitForRoomInfo(t, host)
+	if !info.Locked || len(info.PlayerIds) != 3 {
+		t.Fatalf("locked room info %v", info)
+	}
+	code := info.RoomId
+	dave := dial()
+	if err := dave.JoinRoom(code, ""); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if reply := waitForRoomInfo(t, dave); reply.Error != ErrRoomLocked.Error() {
+		t.Fatalf("joined locked room: %v", reply)
+	}
+	command(host, myproto.HostAction_HOST_ACTION_UNLOCK, 0, 0)
+	if info := waitForRoomInfo(t, host); info.Locked {
+		t.Fatalf("room still locked: %v", info)
+	}
+
+	// 踢出的玩家收到通知并回到大厅，之后不能再加入
+	command(host, myproto.HostAction_HOST_ACTION_KICK, carol.PlayerID, 0)
+	for {
+		notice := waitForHostCommand(t, carol)
+		if notice.Action == myproto.HostAction_HOST_ACTION_KICK {
+			if notice.TargetId != carol.PlayerID {
+				t.Fatalf("kick notice %v", notice)
+			}
+			break
+		}
+	}
+	for {
+		info = waitForRoomInfo(t, bob)
+		if !slices.Contains(info.PlayerIds, carol.PlayerID) {
+			break
+		}
+	}
+	if id := roomOf(s, carol); id != "" {
+		t.Fatalf("kicked player placed in room %s", id)
+	}
+	if err := carol.JoinRoom(code, ""); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if reply := waitForRoomInfo(t, carol); reply.Error != ErrKicked.Error() {
+		t.Fatalf("kicked player rejoined: %v", reply)
+	}
+
+	// 转让房主后原房主不能再执行命令
+	command(host, myproto.HostAction_HOST_ACTION_TRANSFER_HOST, bob.PlayerID, 0)
+	for {
+		if info = waitForRoomInfo(t, host); info.HostId == bob.PlayerID {
+			break
+		}
+	}
+	failed := func(c *client.Client) *myproto.HostCommand {
+		t.Helper()
+		for {
+			if reply := waitForHostCommand(t, c); reply.Error != "" || reply.Action == myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS {
+				return reply
+			}
+		}
+	}
+	command(host, myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS, 0, 2)
+	if reply := failed(host); reply.Error == "" {
+		t.Fatalf("old host command accepted: %v", reply)
+	}
+
+	// 人数上限不能小于当前人数；改成当前人数时开局
+	command(bob, myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS, 0, 1)
+	if reply := failed(bob); reply.Error == "" {
+		t.Fatalf("max players below player count accepted: %v", reply)
+	}
+	command(bob, myproto.HostAction_HOST_ACTION_SET_MAX_PLAYERS, 0, 2)
+	gameStart := waitForMessage(t, host, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+	if gameStart.RoomId != code || len(gameStart.PlayerIds) != 2 {
+		t.Fatalf("game start %v", gameStart)
+	}
+}
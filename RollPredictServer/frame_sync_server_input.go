@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+// 违规输入达到阈值后的处理方式
+const (
+	ViolationActionLog  = "log"  // 只丢弃违规输入并记录日志
+	ViolationActionFlag = "flag" // 标记客户端（Client.Flagged），继续游戏
+	ViolationActionKick = "kick" // 踢出客户端
+)
+
+// 射击坐标是 Fix64 原始值（Q32.32），默认允许 ±1000 个世界单位
+const defaultMaxFireCoordinate = int64(1000) << 32
+
+// InputPolicy 是输入校验和限流策略
+type InputPolicy struct {
+	MaxInputsPerFrame  int           // 每个客户端每帧最多接收的输入数
+	MaxFireCoordinate  int64         // 射击坐标绝对值上限（Fix64原始值）
+	ViolationThreshold int           // 统计窗口内违规次数达到此值后执行 ViolationAction
+	ViolationWindow    time.Duration // 违规统计窗口
+	ViolationAction    string        // log / flag / kick
+}
+
+// 默认输入策略
+func DefaultInputPolicy() InputPolicy {
+	return InputPolicy{
+		MaxInputsPerFrame:  4, // 客户端每帧发一次输入，留出网络抖动导致的合并余量
+		MaxFireCoordinate:  defaultMaxFireCoordinate,
+		ViolationThreshold: 20,
+		ViolationWindow:    10 * time.Second,
+		ViolationAction:    ViolationActionFlag,
+	}
+}
+
+// 校验策略配置
+func (p InputPolicy) Validate() error {
+	switch p.ViolationAction {
+	case ViolationActionLog, ViolationActionFlag, ViolationActionKick:
+	default:
+		return fmt.Errorf("unknown violation action %q", p.ViolationAction)
+	}
+	if p.MaxInputsPerFrame <= 0 {
+		return fmt.Errorf("max inputs per frame must be positive, got %d", p.MaxInputsPerFrame)
+	}
+	if p.MaxFireCoordinate <= 0 {
+		return fmt.Errorf("max fire coordinate must be positive, got %d", p.MaxFireCoordinate)
+	}
+	if p.ViolationThreshold <= 0 {
+		return fmt.Errorf("violation threshold must be positive, got %d", p.ViolationThreshold)
+	}
+	if p.ViolationWindow <= 0 {
+		return fmt.Errorf("violation window must be positive, got %v", p.ViolationWindow)
+	}
+	return nil
+}
+
+// 客户端的输入限流和违规统计状态。违规统计只在该客户端的读取协程中访问，
+// 按帧计数的字段由所在房间的锁保护
+type inputState struct {
+	frame                int64 // 正在计数的房间帧号
+	count                int   // 该帧已接收的输入数
+	violations           int   // 当前窗口内的违规次数
+	violationWindowStart time.Time
+	lastTargetFrame      int64 // 上一条输入放入的帧号（输入延迟减小时保持输入顺序）
+}
+
+// 清空按帧计数的状态：离开房间或再来一局后帧号从0开始（调用方持有房间锁）
+func (state *inputState) resetFrames() {
+	state.frame = 0
+	state.count = 0
+	state.lastTargetFrame = 0
+}
+
+// 校验一条输入的内容，返回违规原因
+func (p InputPolicy) validateInput(client *Client, frameData *myproto.FrameData) error {
+	// player_id 必须是自己（0 表示客户端未填写，由服务器补上）
+	if frameData.PlayerId != 0 && frameData.PlayerId != client.ID {
+		return fmt.Errorf("spoofed player_id %d", frameData.PlayerId)
+	}
+	if _, ok := myproto.InputDirection_name[int32(frameData.Direction)]; !ok {
+		return fmt.Errorf("invalid direction %d", frameData.Direction)
+	}
+	if frameData.FireX != nil && !withinBounds(*frameData.FireX, p.MaxFireCoordinate) {
+		return fmt.Errorf("fire_x %d out of range", *frameData.FireX)
+	}
+	if frameData.FireY != nil && !withinBounds(*frameData.FireY, p.MaxFireCoordinate) {
+		return fmt.Errorf("fire_y %d out of range", *frameData.FireY)
+	}
+	return nil
+}
+
+func withinBounds(value, limit int64) bool {
+	return value >= -limit && value <= limit
+}
+
+// 统计该客户端在 frameNumber 帧的输入数，超过上限返回错误（调用方持有房间锁）
+func (p InputPolicy) countInput(client *Client, frameNumber int64) error {
+	state := &client.input
+	if state.frame != frameNumber {
+		state.frame = frameNumber
+		state.count = 0
+	}
+	if state.count >= p.MaxInputsPerFrame {
+		return fmt.Errorf("more than %d inputs in frame %d", p.MaxInputsPerFrame, frameNumber+1)
+	}
+	state.count++
+	return nil
+}
+
+// 记录一次违规，达到阈值后按策略处理
+func (s *Server) recordInputViolation(client *Client, reason error) {
+	policy := s.InputPolicy
+	state := &client.input
+
+	now := time.Now()
+	if now.Sub(state.violationWindowStart) > policy.ViolationWindow {
+		state.violationWindowStart = now
+		state.violations = 0
+	}
+	state.violations++
+	log.Printf("Client %d: Rejected frame data: %v (%d violations)\n", client.ID, reason, state.violations)
+
+	if state.violations < policy.ViolationThreshold {
+		return
+	}
+
+	switch policy.ViolationAction {
+	case ViolationActionFlag:
+		if !client.Flagged {
+			client.Flagged = true
+			log.Printf("Client %d: Flagged after %d input violations\n", client.ID, state.violations)
+		}
+	case ViolationActionKick:
+		s.kickClient(client, fmt.Sprintf("%d input violations", state.violations))
+	}
+}
+
+// 踢出客户端：通知客户端后关闭连接
+func (s *Server) kickClient(client *Client, reason string) {
+	if client.Kicked {
+		return
+	}
+	client.Kicked = true
+	log.Printf("Client %d: Kicked (%s)\n", client.ID, reason)
+
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_DISCONNECT, &myproto.DisconnectMessage{
+		PlayerId: client.ID,
+	})
+	if client.Conn != nil {
+		// 关闭连接后读取循环退出，由读取循环调用 handleClientDisconnect
+		client.Conn.Close()
+	} else {
+		// UDP无连接，直接清理；ServeUDP 会把该地址从客户端表中移除
+		s.handleClientDisconnect(client)
+	}
+}
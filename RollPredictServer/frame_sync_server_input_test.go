@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 创建一个正在游戏中的房间，客户端通过 net.Pipe 连接
+func newPlayingRoom(t *testing.T, s *Server) (*Client, *Room) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	// 丢弃服务器发给客户端的消息
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			if _, err := clientConn.Read(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := &Client{ID: 5, Conn: serverConn, RoomID: "1"}
+	room := &Room{
+		ID:      "1",
+		Clients: map[int32]*Client{c.ID: c},
+		Status:  "playing",
+	}
+	s.Rooms[room.ID] = room
+	return c, room
+}
+
+func marshalFrameData(t *testing.T, frameData *myproto.FrameData) []byte {
+	t.Helper()
+	data, err := proto.Marshal(frameData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInputPolicyValidate(t *testing.T) {
+	if err := DefaultInputPolicy().Validate(); err != nil {
+		t.Fatalf("default policy: %v", err)
+	}
+	for name, modify := range map[string]func(*InputPolicy){
+		"unknown action":     func(p *InputPolicy) { p.ViolationAction = "ban" },
+		"zero inputs":        func(p *InputPolicy) { p.MaxInputsPerFrame = 0 },
+		"zero fire bound":    func(p *InputPolicy) { p.MaxFireCoordinate = 0 },
+		"zero threshold":     func(p *InputPolicy) { p.ViolationThreshold = 0 },
+		"negative threshold": func(p *InputPolicy) { p.ViolationThreshold = -1 },
+		"zero window":        func(p *InputPolicy) { p.ViolationWindow = 0 },
+	} {
+		p := DefaultInputPolicy()
+		modify(&p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: accepted %+v", name, p)
+		}
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	policy := DefaultInputPolicy()
+	c := &Client{ID: 5}
+	inRange, outOfRange := policy.MaxFireCoordinate, policy.MaxFireCoordinate+1
+
+	cases := []struct {
+		name      string
+		frameData *myproto.FrameData
+		wantErr   bool
+	}{
+		{"own player id", &myproto.FrameData{PlayerId: 5, Direction: myproto.InputDirection_DIRECTION_DOWN_RIGHT}, false},
+		{"unset player id", &myproto.FrameData{}, false},
+		{"spoofed player id", &myproto.FrameData{PlayerId: 6}, true},
+		{"invalid direction", &myproto.FrameData{PlayerId: 5, Direction: 9}, true},
+		{"negative direction", &myproto.FrameData{PlayerId: 5, Direction: -1}, true},
+		{"fire at bound", &myproto.FrameData{PlayerId: 5, IsFire: true, FireX: &inRange, FireY: &inRange}, false},
+		{"fire_x out of range", &myproto.FrameData{PlayerId: 5, IsFire: true, FireX: &outOfRange}, true},
+		{"fire_y out of range", &myproto.FrameData{PlayerId: 5, IsFire: true, FireY: &outOfRange}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.validateInput(c, tc.frameData)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateInput() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleFrameDataCapsInputsPerFrame(t *testing.T) {
+	s := NewServer()
+	c, room := newPlayingRoom(t, s)
+
+	for i := 0; i < s.InputPolicy.MaxInputsPerFrame+3; i++ {
+		s.handleFrameData(c, marshalFrameData(t, &myproto.FrameData{PlayerId: c.ID}))
+	}
+	if got := len(room.FrameDataBuffer); got != s.InputPolicy.MaxInputsPerFrame {
+		t.Fatalf("buffered %d inputs, want %d", got, s.InputPolicy.MaxInputsPerFrame)
+	}
+
+	// 进入下一帧后重新计数
+	room.FrameNumber++
+	s.handleFrameData(c, marshalFrameData(t, &myproto.FrameData{}))
+	if got := len(room.FrameDataBuffer); got != s.InputPolicy.MaxInputsPerFrame+1 {
+		t.Fatalf("buffered %d inputs after next frame, want %d", got, s.InputPolicy.MaxInputsPerFrame+1)
+	}
+	if last := room.FrameDataBuffer[len(room.FrameDataBuffer)-1]; last.PlayerId != c.ID {
+		t.Fatalf("unset player_id stamped as %d, want %d", last.PlayerId, c.ID)
+	}
+}
+
+func TestRepeatOffendersArePunishedByPolicy(t *testing.T) {
+	spoofed := &myproto.FrameData{PlayerId: 99}
+
+	for _, action := range []string{ViolationActionLog, ViolationActionFlag, ViolationActionKick} {
+		t.Run(action, func(t *testing.T) {
+			s := NewServer()
+			s.InputPolicy.ViolationThreshold = 3
+			s.InputPolicy.ViolationAction = action
+			c, room := newPlayingRoom(t, s)
+
+			for i := 0; i < s.InputPolicy.ViolationThreshold; i++ {
+				s.handleFrameData(c, marshalFrameData(t, spoofed))
+			}
+
+			if len(room.FrameDataBuffer) != 0 {
+				t.Fatalf("spoofed inputs were buffered")
+			}
+			if got, want := c.Flagged, action == ViolationActionFlag; got != want {
+				t.Fatalf("Flagged = %v, want %v", got, want)
+			}
+			if got, want := c.Kicked, action == ViolationActionKick; got != want {
+				t.Fatalf("Kicked = %v, want %v", got, want)
+			}
+			if action == ViolationActionKick {
+				if _, err := c.Conn.Write([]byte{0}); err == nil {
+					t.Fatalf("kicked client's connection is still open")
+				}
+			}
+		})
+	}
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"time"
 
+	"github.com/WjcHome/gohello/codec"
 	myproto "github.com/WjcHome/gohello/proto"
 	"github.com/xtaci/kcp-go/v5"
 	"google.golang.org/protobuf/proto"
@@ -42,9 +44,17 @@ func (s *Server) StartKCP() {
 
 	fmt.Printf("KCP Frame Sync Server started on %s\n", KCP_PORT)
 
+	s.ServeKCP(ln)
+}
+
+// 在已有的KCP监听器上接受连接，监听器关闭后返回
+func (s *Server) ServeKCP(ln *kcp.Listener) {
 	for {
 		conn, err := ln.AcceptKCP()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+				return
+			}
 			log.Println("AcceptKCP error:", err)
 			continue
 		}
@@ -65,8 +75,7 @@ func (s *Server) handleKCPClient(conn *kcp.UDPSession) {
 
 	// KCP连接不需要初始设置读取超时，在循环中动态设置
 
-	clientID := int32(clientCounter)
-	clientCounter++
+	clientID := nextClientID()
 	client := &Client{
 		ID:       clientID,
 		Conn:     conn,
@@ -82,7 +91,9 @@ func (s *Server) handleKCPClient(conn *kcp.UDPSession) {
 	}
 	s.sendKCPMessage(conn, myproto.MessageType_MESSAGE_CONNECT, connectMsg)
 
-	s.autoAssignRoom(client)
+	if s.AutoAssign {
+		s.autoAssignRoom(client)
+	}
 
 	reader := bufio.NewReader(conn)
 	for {
@@ -90,9 +101,8 @@ func (s *Server) handleKCPClient(conn *kcp.UDPSession) {
 		// 超时后不会断开连接，只是跳过本次读取，继续等待下次消息
 		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
 
-		// 读取消息长度 (4 bytes)
-		lengthBytes := make([]byte, 4)
-		_, err := reader.Read(lengthBytes)
+		// 读取一条完整消息（len + messageType + data），长度和类型在分配缓冲区前校验
+		messageType, data, err := codec.ReadMessage(reader, codec.ClientToServer)
 		if err != nil {
 			// 检查是否是超时错误（可以继续等待）
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -101,68 +111,15 @@ func (s *Server) handleKCPClient(conn *kcp.UDPSession) {
 				log.Printf("KCP Client %d: Read timeout, continuing...\n", client.ID)
 				continue
 			}
-			// 其他错误（如EOF、连接关闭）才断开
-			log.Printf("KCP Client %d: Read length error: %v\n", client.ID, err)
-			break
-		}
-		length := binary.BigEndian.Uint32(lengthBytes)
-
-		// 验证消息长度（防止恶意或错误数据）
-		if length > 1024*1024 { // 最大1MB
-			log.Printf("KCP Client %d: Message too large: %d bytes\n", client.ID, length)
-			break
-		}
-
-		// 读取消息类型 (1 byte)
-		messageTypeBytes := make([]byte, 1)
-		_, err = reader.Read(messageTypeBytes)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				log.Printf("KCP Client %d: Read message type timeout, continuing...\n", client.ID)
-				continue
-			}
-			log.Printf("KCP Client %d: Read message type error: %v\n", client.ID, err)
-			break
-		}
-		messageType := myproto.MessageType(messageTypeBytes[0])
-
-		// 读取数据部分 (length - 1 byte for messageType)
-		dataLength := int(length) - 1
-		if dataLength < 0 {
-			log.Printf("KCP Client %d: Invalid message length: %d\n", client.ID, length)
-			break
-		}
-		data := make([]byte, dataLength)
-		_, err = reader.Read(data)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				log.Printf("KCP Client %d: Read data timeout, continuing...\n", client.ID)
-				continue
-			}
-			log.Printf("KCP Client %d: Read data error: %v\n", client.ID, err)
+			// 其他错误（如EOF、连接关闭、非法消息）才断开
+			log.Printf("KCP Client %d: Read message error: %v\n", client.ID, err)
 			break
 		}
 
 		// 更新最后活跃时间（任何消息都会更新心跳时间，包括帧数据、心跳、丢帧请求等）
 		client.LastSeen = time.Now()
 
-		// 根据消息类型处理
-		switch messageType {
-		case myproto.MessageType_MESSAGE_CONNECT:
-			// 客户端发送的ConnectMessage用于触发KCP连接建立，服务器端已经发送了ConnectMessage响应
-			// 这里可以记录或忽略
-			log.Printf("KCP Client %d: Received connect message (already connected)\n", client.ID)
-		case myproto.MessageType_MESSAGE_FRAME_DATA:
-			s.handleFrameData(client, data)
-		case myproto.MessageType_MESSAGE_DISCONNECT:
-			s.handleDisconnect(client, data)
-		case myproto.MessageType_MESSAGE_FRAME_LOSS:
-			s.handleFrameLoss(client, data)
-		case myproto.MessageType_MESSAGE_HEARTBEAT:
-			// 心跳消息，LastSeen 已经在上面更新，这里不需要额外操作
-		default:
-			log.Printf("KCP Client %d: Unknown message type: %d\n", client.ID, messageType)
-		}
+		s.handleMessage(client, messageType, data)
 	}
 
 	// 客户端断开连接
@@ -171,24 +128,14 @@ func (s *Server) handleKCPClient(conn *kcp.UDPSession) {
 
 // 发送KCP消息
 func (s *Server) sendKCPMessage(conn *kcp.UDPSession, messageType myproto.MessageType, msg proto.Message) {
-	data, err := proto.Marshal(msg)
+	// 消息格式：len(4 bytes) + messageType(1 byte) + data
+	// 重要：必须一次性写入所有数据，避免KCP将消息分片
+	message, err := codec.Encode(messageType, msg)
 	if err != nil {
 		log.Printf("KCP Marshal error: %v\n", err)
 		return
 	}
 
-	// 消息格式：len(4 bytes) + messageType(1 byte) + data
-	// 重要：必须一次性写入所有数据，避免KCP将消息分片
-	totalLength := uint32(1 + len(data))
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, totalLength)
-
-	// 组合完整消息到一个缓冲区
-	message := make([]byte, 4+1+len(data))
-	copy(message[0:4], lengthBytes)
-	message[4] = byte(messageType)
-	copy(message[5:], data)
-
 	// 一次性写入完整消息
 	_, err = conn.Write(message)
 	if err != nil {
@@ -219,14 +166,7 @@ func (s *Server) StartAll() {
 		defer ln.Close()
 		fmt.Printf("TCP Frame Sync Server started on %s\n", TCP_PORT)
 
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				log.Println("TCP Accept error:", err)
-				continue
-			}
-			go s.handleClient(conn)
-		}
+		s.ServeTCP(ln)
 	}()
 
 	// 启动UDP服务器
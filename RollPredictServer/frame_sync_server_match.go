@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 暂停/继续的决定方式
+const (
+	PausePolicyHost = "host" // 只有房主可以暂停和继续
+	PausePolicyVote = "vote" // 过半玩家同意后暂停或继续
+)
+
+// 校验暂停策略
+func validatePausePolicy(policy string) error {
+	switch policy {
+	case PausePolicyHost, PausePolicyVote:
+		return nil
+	}
+	return fmt.Errorf("unknown pause policy %q", policy)
+}
+
+// 房间内的所有客户端（调用方持有房间锁）
+func (room *Room) clientList() []*Client {
+	clients := make([]*Client, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// 发送消息给一组客户端
+func (s *Server) broadcast(clients []*Client, messageType myproto.MessageType, msg proto.Message) {
+	for _, c := range clients {
+		s.sendMessageToClient(c, messageType, msg)
+	}
+}
+
+// 处理暂停/继续请求
+func (s *Server) handlePause(client *Client, data []byte) {
+	var request myproto.PauseMessage
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal pause request error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Pause request without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	paused := room.Status == "paused"
+	if (room.Status != "playing" && !paused) || request.Paused == paused {
+		status := room.Status
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Ignoring pause=%v in %s room %s\n", client.ID, request.Paused, status, room.ID)
+		return
+	}
+
+	notice := &myproto.PauseMessage{
+		Paused:      paused,
+		FrameNumber: room.FrameNumber,
+		PlayerId:    client.ID,
+	}
+	switch s.PausePolicy {
+	case PausePolicyVote:
+		// 票数只针对当前状态的反向改变，状态改变后清空
+		if room.pauseVotes == nil {
+			room.pauseVotes = make(map[int32]bool)
+		}
+		room.pauseVotes[client.ID] = true
+		needed := len(room.Clients)/2 + 1
+		notice.Votes = int32(len(room.pauseVotes))
+		notice.VotesNeeded = int32(needed)
+		if len(room.pauseVotes) < needed {
+			clients := room.clientList()
+			room.Mutex.Unlock()
+			// 票数不足，只通知投票进度
+			s.broadcast(clients, myproto.MessageType_MESSAGE_PAUSE, notice)
+			return
+		}
+	default:
+		if room.HostID != client.ID {
+			room.Mutex.Unlock()
+			log.Printf("Client %d: Only the host can pause or resume\n", client.ID)
+			return
+		}
+	}
+
+	room.setPaused(request.Paused)
+	notice.Paused = request.Paused
+	notice.FrameNumber = room.FrameNumber
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: paused=%v at frame %d (by client %d)\n", room.ID, notice.Paused, notice.FrameNumber, client.ID)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_PAUSE, notice)
+}
+
+// 改变暂停状态（调用方持有房间锁）
+func (room *Room) setPaused(paused bool) {
+	room.pauseVotes = nil
+	if paused {
+		room.Status = "paused"
+	} else {
+		room.Status = "playing"
+		// 从当前时间重新对齐时钟，暂停期间的帧不补发
+		room.clock = newFrameClock(frameIntervalOf(room.FrameRate, room.TimeScale), time.Now(), room.FrameNumber)
+	}
+	room.wakeFrameLoop()
+}
+
+// 处理房主的比赛结束请求
+func (s *Server) handleMatchEnd(client *Client, data []byte) {
+	var request myproto.MatchEnd
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal match end error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Match end without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.HostID != client.ID {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Only the host can end the match\n", client.ID)
+		return
+	}
+	if room.Status != "playing" && room.Status != "paused" {
+		status := room.Status
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Ignoring match end in %s room %s\n", client.ID, status, room.ID)
+		return
+	}
+
+	// 结果只保留房间内的玩家，每个玩家一条；帧号以服务器为准
+	result := &myproto.MatchEnd{
+		FrameNumber: room.FrameNumber,
+		Reason:      request.Reason,
+	}
+	if result.Reason == "" {
+		result.Reason = "host"
+	}
+	seen := make(map[int32]bool)
+	for _, r := range request.Results {
+		if _, inRoom := room.Clients[r.PlayerId]; inRoom && !seen[r.PlayerId] {
+			seen[r.PlayerId] = true
+			result.Results = append(result.Results, &myproto.PlayerResult{PlayerId: r.PlayerId, Score: r.Score})
+		}
+	}
+	if request.WinnerId != nil {
+		if _, inRoom := room.Clients[*request.WinnerId]; inRoom {
+			result.WinnerId = proto.Int32(*request.WinnerId)
+		}
+	}
+	clients := room.finish(result)
+	s.collectResults(room)
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Match ended at frame %d (%s)\n", room.ID, result.FrameNumber, result.Reason)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_MATCH_END, result)
+}
+
+// 结束比赛：停止发帧，等待玩家选择再来一局或返回大厅（调用方持有房间锁）
+func (room *Room) finish(result *myproto.MatchEnd) []*Client {
+	room.Status = "finished"
+	room.LastResult = result
+	room.pauseVotes = nil
+	room.rematchVotes = make(map[int32]bool)
+	room.wakeFrameLoop()
+	return room.clientList()
+}
+
+// 处理赛后选择
+func (s *Server) handlePostMatch(client *Client, data []byte) {
+	var choice myproto.PostMatchChoice
+	if err := proto.Unmarshal(data, &choice); err != nil {
+		log.Printf("Client %d: Unmarshal post match choice error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Post match choice without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.Status != "finished" {
+		status := room.Status
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Ignoring post match choice in %s room %s\n", client.ID, status, room.ID)
+		return
+	}
+	if choice.Rematch {
+		room.rematchVotes[client.ID] = true
+	}
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	s.broadcast(clients, myproto.MessageType_MESSAGE_POST_MATCH, &myproto.PostMatchChoice{
+		Rematch:  choice.Rematch,
+		PlayerId: client.ID,
+	})
+
+	if choice.Rematch {
+		s.checkRematch(room)
+	} else {
+		// 返回大厅：离开房间但保持连接
+		s.leaveRoom(client, "return to lobby")
+	}
+}
+
+// 留在房间的玩家都选择再来一局时开始新的一局
+func (s *Server) checkRematch(room *Room) {
+	ready := func() bool {
+		return room.Status == "finished" && len(room.Clients) > 0 && len(room.rematchVotes) >= len(room.Clients)
+	}
+
+	room.Mutex.Lock()
+	if !ready() {
+		room.Mutex.Unlock()
+		return
+	}
+	round := room.round
+	room.Mutex.Unlock()
+
+	// 还在收集结果时先用已收到的结果核对，再开始新的一局
+	s.finalizeResult(room, round)
+
+	room.Mutex.Lock()
+	if !ready() || room.round != round {
+		room.Mutex.Unlock()
+		return
+	}
+	room.resetForRematch()
+	players := len(room.Clients)
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Rematch with %d players\n", room.ID, players)
+	s.startGame(room.ID)
+}
+
+// 清空上一局的帧数据，回到等待状态（调用方持有房间锁）
+func (room *Room) resetForRematch() {
+	room.Status = "waiting"
+	room.FrameNumber = 0
+	room.FrameDataBuffer = make([]*myproto.FrameData, 0)
+	room.HistoryFrames = make([]*myproto.ServerFrame, 0)
+	room.delayedInputs = nil
+	room.pendingInputDelay = nil
+	room.rematchVotes = nil
+	for _, c := range room.Clients {
+		c.input.resetFrames()
+	}
+}
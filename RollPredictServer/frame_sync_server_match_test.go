@@ -0,0 +1,200 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+// 启动一局游戏，返回按连接顺序排列的客户端（第一个是房主）和房间
+func startTestMatch(t *testing.T, players int, configure ...func(*Server)) (*Server, []*client.Client, *Room) {
+	t.Helper()
+	s, addrs := startTestServer(t, int32(players), configure...)
+
+	clients := make([]*client.Client, players)
+	for i := range clients {
+		clients[i] = dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	}
+	var roomID string
+	for _, c := range clients {
+		roomID = waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart).RoomId
+	}
+
+	s.Mutex.Lock()
+	room := s.Rooms[roomID]
+	s.Mutex.Unlock()
+	return s, clients, room
+}
+
+// 在 duration 内收到的服务器帧中最大的帧号
+func lastFrameWithin(t *testing.T, c *client.Client, duration time.Duration) int64 {
+	t.Helper()
+	var last int64
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("client %d: connection closed", c.PlayerID)
+			}
+			if frame, ok := msg.Body.(*myproto.ServerFrame); ok {
+				last = max(last, frame.FrameNumber)
+			}
+		case <-timer.C:
+			return last
+		}
+	}
+}
+
+func TestPauseAndResumeByHost(t *testing.T) {
+	_, clients, room := startTestMatch(t, 2)
+	host, other := clients[0], clients[1]
+	collectFrames(t, other, 3)
+
+	if err := host.Pause(true); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	var pausedAt int64
+	for _, c := range clients {
+		notice := waitForMessage(t, c, myproto.MessageType_MESSAGE_PAUSE).Body.(*myproto.PauseMessage)
+		if !notice.Paused || notice.PlayerId != host.PlayerID {
+			t.Fatalf("client %d got pause notice %v", c.PlayerID, notice)
+		}
+		pausedAt = notice.FrameNumber
+	}
+
+	// 暂停期间不再发帧，非房主不能继续
+	if err := other.Pause(false); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if last := lastFrameWithin(t, other, 300*time.Millisecond); last > pausedAt {
+		t.Fatalf("received frame %d after pausing at frame %d", last, pausedAt)
+	}
+	room.Mutex.Lock()
+	status := room.Status
+	room.Mutex.Unlock()
+	if status != "paused" {
+		t.Fatalf("room status = %q after non-host resume, want paused", status)
+	}
+
+	// 房主继续后帧号接着暂停前的帧连续增长
+	if err := host.Pause(false); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	notice := waitForMessage(t, other, myproto.MessageType_MESSAGE_PAUSE).Body.(*myproto.PauseMessage)
+	if notice.Paused || notice.FrameNumber != pausedAt {
+		t.Fatalf("resume notice %v, want frame %d", notice, pausedAt)
+	}
+	frames := collectFrames(t, other, 3)
+	for i, frame := range frames {
+		if frame.FrameNumber != pausedAt+int64(i+1) {
+			t.Fatalf("frame %d after resume, want %d", frame.FrameNumber, pausedAt+int64(i+1))
+		}
+	}
+}
+
+func TestPauseByVote(t *testing.T) {
+	_, clients, room := startTestMatch(t, 3, func(s *Server) { s.PausePolicy = PausePolicyVote })
+
+	// 3人房间需要2票
+	if err := clients[1].Pause(true); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	notice := waitForMessage(t, clients[0], myproto.MessageType_MESSAGE_PAUSE).Body.(*myproto.PauseMessage)
+	if notice.Paused || notice.Votes != 1 || notice.VotesNeeded != 2 {
+		t.Fatalf("after one vote got %v", notice)
+	}
+
+	if err := clients[2].Pause(true); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	notice = waitForMessage(t, clients[0], myproto.MessageType_MESSAGE_PAUSE).Body.(*myproto.PauseMessage)
+	if !notice.Paused || notice.PlayerId != clients[2].PlayerID {
+		t.Fatalf("after two votes got %v", notice)
+	}
+	room.Mutex.Lock()
+	defer room.Mutex.Unlock()
+	if room.Status != "paused" || len(room.pauseVotes) != 0 {
+		t.Fatalf("room status %q with %d votes left", room.Status, len(room.pauseVotes))
+	}
+}
+
+func TestMatchEndThenRematchOrLobby(t *testing.T) {
+	s, clients, room := startTestMatch(t, 3)
+	host := clients[0]
+	collectFrames(t, host, 3)
+
+	// 非房主不能结束比赛
+	if err := clients[1].EndMatch(&myproto.MatchEnd{}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	// 房主结束比赛，未知玩家和重复的结果被丢弃
+	winner := clients[1].PlayerID
+	if err := host.EndMatch(&myproto.MatchEnd{
+		FrameNumber: 99999,
+		WinnerId:    &winner,
+		Results: []*myproto.PlayerResult{
+			{PlayerId: winner, Score: 5},
+			{PlayerId: winner, Score: 50},
+			{PlayerId: 12345, Score: 1},
+			{PlayerId: host.PlayerID, Score: 2},
+		},
+	}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	for _, c := range clients {
+		result := waitForMessage(t, c, myproto.MessageType_MESSAGE_MATCH_END).Body.(*myproto.MatchEnd)
+		if result.WinnerId == nil || *result.WinnerId != winner || len(result.Results) != 2 || result.Results[0].Score != 5 {
+			t.Fatalf("client %d got result %v", c.PlayerID, result)
+		}
+		if result.FrameNumber == 99999 || result.Reason != "host" {
+			t.Fatalf("result frame %d, reason %q", result.FrameNumber, result.Reason)
+		}
+	}
+	room.Mutex.Lock()
+	finalFrame := room.FrameNumber
+	room.Mutex.Unlock()
+	if last := lastFrameWithin(t, host, 200*time.Millisecond); last > finalFrame {
+		t.Fatalf("received frame %d after match ended at %d", last, finalFrame)
+	}
+
+	// 一人返回大厅，另外两人再来一局
+	if err := clients[2].PostMatch(false); err != nil {
+		t.Fatalf("post match: %v", err)
+	}
+	waitFor(t, "client to return to lobby", func() bool {
+		room.Mutex.Lock()
+		defer room.Mutex.Unlock()
+		_, stillThere := room.Clients[clients[2].PlayerID]
+		return !stillThere
+	})
+	for _, c := range clients[:2] {
+		if err := c.PostMatch(true); err != nil {
+			t.Fatalf("post match: %v", err)
+		}
+	}
+	for _, c := range clients[:2] {
+		gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+		if len(gameStart.PlayerIds) != 2 || gameStart.RoomId != room.ID {
+			t.Fatalf("rematch GameStart %v", gameStart)
+		}
+	}
+	// 新的一局帧号从1开始
+	if frame := waitForMessage(t, host, myproto.MessageType_MESSAGE_SERVER_FRAME).Body.(*myproto.ServerFrame); frame.FrameNumber != 1 {
+		t.Fatalf("first rematch frame is %d, want 1", frame.FrameNumber)
+	}
+
+	// 返回大厅的玩家保持连接，但不在任何房间中
+	s.Mutex.Lock()
+	rooms := len(s.Rooms)
+	s.Mutex.Unlock()
+	if rooms != 1 {
+		t.Fatalf("%d rooms, want 1", rooms)
+	}
+	if err := clients[2].Heartbeat(); err != nil {
+		t.Fatalf("lobby client disconnected: %v", err)
+	}
+}
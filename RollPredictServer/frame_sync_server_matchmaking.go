@@ -0,0 +1,599 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/WjcHome/gohello/store"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	maxTeamSize = 4  // 匹配时每队最多人数
+	eloK        = 32 // Elo 每局最大分数变化
+)
+
+// 匹配模式
+type QueueMode struct {
+	Teams int32 // 队伍数，每局人数为 队伍数 * 每队人数
+}
+
+// 默认的匹配模式
+func DefaultQueueModes() map[string]QueueMode {
+	return map[string]QueueMode{
+		"versus": {Teams: 2}, // 对战：1v1、2v2……
+		"coop":   {Teams: 1}, // 合作：所有玩家一队对抗僵尸
+	}
+}
+
+// 匹配策略：可接受的分数差从 InitialRange 开始，每等待1秒增加 RangeGrowth，不超过 MaxRange
+type MatchmakingPolicy struct {
+	InitialRange   int32
+	RangeGrowth    int32
+	MaxRange       int32
+	ConfirmTimeout time.Duration // 匹配成功后等待所有玩家确认的时间
+	Interval       time.Duration // 有人排队时重新尝试匹配的间隔
+}
+
+// 默认匹配策略
+func DefaultMatchmakingPolicy() MatchmakingPolicy {
+	return MatchmakingPolicy{
+		InitialRange:   100,
+		RangeGrowth:    50,
+		MaxRange:       1000,
+		ConfirmTimeout: 10 * time.Second,
+		Interval:       500 * time.Millisecond,
+	}
+}
+
+// 校验匹配策略
+func (p MatchmakingPolicy) Validate() error {
+	if p.InitialRange < 0 || p.RangeGrowth < 0 || p.MaxRange < p.InitialRange {
+		return errors.New("rating range must satisfy 0 <= initial <= max and growth >= 0")
+	}
+	if p.ConfirmTimeout <= 0 || p.Interval <= 0 {
+		return errors.New("confirm timeout and interval must be positive")
+	}
+	return nil
+}
+
+// 等待了 waited 之后接受的分数差
+func (p MatchmakingPolicy) ratingRange(waited time.Duration) int32 {
+	grown := float64(p.InitialRange) + float64(p.RangeGrowth)*waited.Seconds()
+	return int32(min(grown, float64(p.MaxRange)))
+}
+
+// 一个匹配队列
+type queueKey struct {
+	mode     string
+	teamSize int32
+}
+
+// 排队中的玩家
+type queueTicket struct {
+	client   *Client
+	key      queueKey
+	rating   int32
+	enqueued time.Time
+	proposal *matchProposal // 不为nil时正在等待确认，不参与匹配
+}
+
+// 等待确认的对局
+type matchProposal struct {
+	id       uint64
+	key      queueKey
+	tickets  []*queueTicket
+	teams    map[int32]int32 // 玩家ID -> 队伍（从1开始）
+	accepted map[int32]bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// 匹配器状态
+type matchmaker struct {
+	mutex        sync.Mutex
+	tickets      map[int32]*queueTicket // 客户端ID -> 排队信息
+	proposals    map[uint64]*matchProposal
+	nextProposal uint64
+	running      bool // 匹配循环是否在运行（队列为空时退出）
+}
+
+// 处理加入/离开匹配队列
+func (s *Server) handleQueue(client *Client, data []byte) {
+	var request myproto.MatchQueue
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal queue request error: %v\n", client.ID, err)
+		return
+	}
+	if !request.Queued {
+		s.leaveQueue(client)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_QUEUE, &myproto.MatchQueue{
+			Mode: request.Mode, TeamSize: request.TeamSize,
+		})
+		return
+	}
+
+	if err := s.joinQueue(client, queueKey{request.Mode, request.TeamSize}); err != nil {
+		log.Printf("Client %d: Join queue %s/%d error: %v\n", client.ID, request.Mode, request.TeamSize, err)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_QUEUE, &myproto.MatchQueue{
+			Mode: request.Mode, TeamSize: request.TeamSize, Error: err.Error(),
+		})
+		return
+	}
+	s.matchmake(time.Now())
+}
+
+// 加入匹配队列：离开等待中或已结束的房间，比赛进行中不能排队
+func (s *Server) joinQueue(client *Client, key queueKey) error {
+	if _, ok := s.QueueModes[key.mode]; !ok {
+		return fmt.Errorf("unknown mode %q", key.mode)
+	}
+	if key.teamSize < 1 || key.teamSize > maxTeamSize {
+		return fmt.Errorf("team size must be between 1 and %d", maxTeamSize)
+	}
+	if room := s.clientRoom(client); room != nil {
+		room.Mutex.Lock()
+		status := room.Status
+		room.Mutex.Unlock()
+		if status == "playing" || status == "paused" {
+			return errors.New("already in a match")
+		}
+		s.leaveRoom(client, "matchmaking")
+	}
+
+	// 使用数据库中最新的分数，未登录的玩家使用默认分数
+	rating := store.Rating(nil)
+	if account := client.Account(); account != nil && s.Store != nil {
+		if latest, err := s.Store.Account(account.AccountId); err == nil {
+			rating = store.Rating(latest)
+		}
+	}
+
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	if ticket, queued := mm.tickets[client.ID]; queued {
+		mm.mutex.Unlock()
+		return fmt.Errorf("already queued for %s/%d", ticket.key.mode, ticket.key.teamSize)
+	}
+	ticket := &queueTicket{client: client, key: key, rating: rating, enqueued: time.Now()}
+	mm.tickets[client.ID] = ticket
+	if !mm.running {
+		mm.running = true
+		go s.matchmakingLoop()
+	}
+	status := s.queueStatus(ticket, ticket.enqueued)
+	mm.mutex.Unlock()
+
+	fmt.Printf("Client %d queued for %s/%d (rating %d)\n", client.ID, key.mode, key.teamSize, rating)
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_QUEUE, status)
+	return nil
+}
+
+// 排队状态（调用方持有匹配器锁）
+func (s *Server) queueStatus(ticket *queueTicket, now time.Time) *myproto.MatchQueue {
+	waiting := 0
+	for _, t := range s.matchmaking.tickets {
+		if t.key == ticket.key && t.proposal == nil {
+			waiting++
+		}
+	}
+	return &myproto.MatchQueue{
+		Mode:           ticket.key.mode,
+		TeamSize:       ticket.key.teamSize,
+		Queued:         true,
+		Rating:         ticket.rating,
+		RatingRange:    s.Matchmaking.ratingRange(now.Sub(ticket.enqueued)),
+		PlayersWaiting: int32(waiting),
+	}
+}
+
+// 离开匹配队列（断开连接时也会调用）；正在等待确认时视为拒绝
+func (s *Server) leaveQueue(client *Client) {
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	ticket, queued := mm.tickets[client.ID]
+	if !queued {
+		mm.mutex.Unlock()
+		return
+	}
+	if ticket.proposal != nil {
+		id := ticket.proposal.id
+		mm.mutex.Unlock()
+		s.cancelProposal(id, client.ID)
+		return
+	}
+	delete(mm.tickets, client.ID)
+	mm.mutex.Unlock()
+	fmt.Printf("Client %d left queue %s/%d\n", client.ID, ticket.key.mode, ticket.key.teamSize)
+}
+
+// 有人排队时定期重新匹配（分数范围随等待时间扩大）
+func (s *Server) matchmakingLoop() {
+	ticker := time.NewTicker(s.Matchmaking.Interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		mm := &s.matchmaking
+		mm.mutex.Lock()
+		if len(mm.tickets) == 0 {
+			mm.running = false
+			mm.mutex.Unlock()
+			return
+		}
+		mm.mutex.Unlock()
+		s.matchmake(now)
+	}
+}
+
+// 尝试匹配，并通知匹配成功的玩家确认
+func (s *Server) matchmake(now time.Time) {
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	groups := s.findMatches(now)
+	proposals := make([]*matchProposal, 0, len(groups))
+	notices := make([]*myproto.MatchFound, 0, len(groups))
+	for _, group := range groups {
+		mm.nextProposal++
+		p := &matchProposal{
+			id:       mm.nextProposal,
+			key:      group[0].key,
+			tickets:  group,
+			teams:    assignTeams(group, s.QueueModes[group[0].key.mode].Teams),
+			accepted: make(map[int32]bool),
+			deadline: now.Add(s.Matchmaking.ConfirmTimeout),
+		}
+		for _, t := range group {
+			t.proposal = p
+		}
+		id := p.id
+		p.timer = time.AfterFunc(s.Matchmaking.ConfirmTimeout, func() { s.cancelProposal(id, -1) })
+		mm.proposals[p.id] = p
+		proposals = append(proposals, p)
+		notices = append(notices, p.notice())
+	}
+	mm.mutex.Unlock()
+
+	for i, p := range proposals {
+		fmt.Printf("Match proposal %d: %s/%d with players %v\n", p.id, p.key.mode, p.key.teamSize, p.playerIDs())
+		s.broadcast(p.clients(), myproto.MessageType_MESSAGE_MATCH_FOUND, notices[i])
+	}
+}
+
+// 在每个队列中按等待时间从长到短，为每个玩家找分数最接近、且互相在对方可接受范围内的对手。
+// 结果只取决于排队顺序和分数（调用方持有匹配器锁）
+func (s *Server) findMatches(now time.Time) [][]*queueTicket {
+	queues := make(map[queueKey][]*queueTicket)
+	for _, t := range s.matchmaking.tickets {
+		if t.proposal == nil {
+			queues[t.key] = append(queues[t.key], t)
+		}
+	}
+	keys := make([]queueKey, 0, len(queues))
+	for key := range queues {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b queueKey) int {
+		return cmp.Or(cmp.Compare(a.mode, b.mode), cmp.Compare(a.teamSize, b.teamSize))
+	})
+
+	var groups [][]*queueTicket
+	for _, key := range keys {
+		tickets := queues[key]
+		slices.SortFunc(tickets, func(a, b *queueTicket) int {
+			return cmp.Or(a.enqueued.Compare(b.enqueued), cmp.Compare(a.client.ID, b.client.ID))
+		})
+		needed := int(s.QueueModes[key.mode].Teams * key.teamSize)
+		used := make(map[*queueTicket]bool)
+		for _, anchor := range tickets {
+			if used[anchor] {
+				continue
+			}
+			anchorRange := s.Matchmaking.ratingRange(now.Sub(anchor.enqueued))
+			var candidates []*queueTicket
+			for _, t := range tickets {
+				if t == anchor || used[t] {
+					continue
+				}
+				limit := min(anchorRange, s.Matchmaking.ratingRange(now.Sub(t.enqueued)))
+				if ratingGap(anchor, t) <= limit {
+					candidates = append(candidates, t)
+				}
+			}
+			if len(candidates) < needed-1 {
+				continue
+			}
+			// 分数最接近的优先，相同时等待久的优先（tickets 已按等待时间排序，稳定排序保留这个顺序）
+			slices.SortStableFunc(candidates, func(a, b *queueTicket) int {
+				return cmp.Compare(ratingGap(anchor, a), ratingGap(anchor, b))
+			})
+			group := append([]*queueTicket{anchor}, candidates[:needed-1]...)
+			for _, t := range group {
+				used[t] = true
+			}
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func ratingGap(a, b *queueTicket) int32 {
+	gap := a.rating - b.rating
+	if gap < 0 {
+		return -gap
+	}
+	return gap
+}
+
+// 按分数蛇形分队，让各队总分接近：分数从高到低依次分到 1..n, n..1, 1..n ……
+func assignTeams(group []*queueTicket, teams int32) map[int32]int32 {
+	sorted := slices.Clone(group)
+	slices.SortStableFunc(sorted, func(a, b *queueTicket) int {
+		return cmp.Or(cmp.Compare(b.rating, a.rating), cmp.Compare(a.client.ID, b.client.ID))
+	})
+	assignment := make(map[int32]int32, len(sorted))
+	for i, t := range sorted {
+		round, pos := int32(i)/teams, int32(i)%teams
+		if round%2 == 1 {
+			pos = teams - 1 - pos
+		}
+		assignment[t.client.ID] = pos + 1
+	}
+	return assignment
+}
+
+// 处理玩家对匹配结果的确认或拒绝
+func (s *Server) handleMatchFound(client *Client, data []byte) {
+	var request myproto.MatchFound
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal match confirmation error: %v\n", client.ID, err)
+		return
+	}
+
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	p := mm.proposals[request.ProposalId]
+	ticket := mm.tickets[client.ID]
+	if p == nil || ticket == nil || ticket.proposal != p {
+		mm.mutex.Unlock()
+		log.Printf("Client %d: Ignoring confirmation for match proposal %d\n", client.ID, request.ProposalId)
+		return
+	}
+	if !request.Accept {
+		mm.mutex.Unlock()
+		s.cancelProposal(p.id, client.ID)
+		return
+	}
+
+	p.accepted[client.ID] = true
+	complete := len(p.accepted) == len(p.tickets)
+	if complete {
+		p.timer.Stop()
+		delete(mm.proposals, p.id)
+		for _, t := range p.tickets {
+			delete(mm.tickets, t.client.ID)
+		}
+	}
+	notice := p.notice()
+	mm.mutex.Unlock()
+
+	s.broadcast(p.clients(), myproto.MessageType_MESSAGE_MATCH_FOUND, notice)
+	if complete {
+		s.startMatchedGame(p)
+	}
+}
+
+// 取消等待确认的对局：declined 拒绝（-1 表示超时，没有确认的玩家都视为拒绝）。
+// 拒绝的玩家离开队列，其他玩家按原来的排队时间回到队列
+func (s *Server) cancelProposal(id uint64, declined int32) {
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	p := mm.proposals[id]
+	if p == nil {
+		mm.mutex.Unlock()
+		return
+	}
+	p.timer.Stop()
+	delete(mm.proposals, id)
+
+	var removed []*Client
+	for _, t := range p.tickets {
+		if t.client.ID == declined || (declined == -1 && !p.accepted[t.client.ID]) {
+			delete(mm.tickets, t.client.ID)
+			removed = append(removed, t.client)
+		} else {
+			t.proposal = nil
+		}
+	}
+	notice := p.notice()
+	notice.Cancelled = true
+	mm.mutex.Unlock()
+
+	fmt.Printf("Match proposal %d cancelled, %d players removed from queue\n", id, len(removed))
+	s.broadcast(p.clients(), myproto.MessageType_MESSAGE_MATCH_FOUND, notice)
+	s.broadcast(removed, myproto.MessageType_MESSAGE_QUEUE, &myproto.MatchQueue{Mode: p.key.mode, TeamSize: p.key.teamSize})
+	s.matchmake(time.Now())
+}
+
+// 所有玩家确认后创建房间并开始游戏
+func (s *Server) startMatchedGame(p *matchProposal) {
+	s.Mutex.Lock()
+	// 最后一个确认到达后排队信息已经删除，这期间断开的玩家不会取消对局，在这里检查。
+	// 检查和加入房间都持有 s.Mutex：之后断开的玩家已经在房间中，由 leaveRoom 处理
+	var gone []int32
+	for _, t := range p.tickets {
+		if t.client.disconnected {
+			gone = append(gone, t.client.ID)
+		}
+	}
+	if len(gone) > 0 {
+		s.Mutex.Unlock()
+		s.abortMatchedGame(p, gone)
+		return
+	}
+	roomID := s.newRoomID()
+	host := p.tickets[0].client
+	room := s.newRoom(roomID, host.ID, RoomOptions{
+		MaxPlayers: int32(len(p.tickets)),
+		Teams:      s.QueueModes[p.key.mode].Teams,
+	})
+	room.queue = &p.key
+	// 队伍内按排队顺序分配槽位
+	room.roster = make(map[int32]*myproto.RosterEntry, len(p.tickets))
+	slots := make(map[int32]int32)
+	for _, t := range p.tickets {
+		t.client.RoomID = roomID
+		t.client.IsHost = t.client == host
+		room.Clients[t.client.ID] = t.client
+		team := p.teams[t.client.ID]
+		room.roster[t.client.ID] = &myproto.RosterEntry{PlayerId: t.client.ID, Team: team, Slot: slots[team]}
+		slots[team]++
+	}
+	s.Rooms[roomID] = room
+	s.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Matched %d players for %s/%d\n", roomID, len(p.tickets), p.key.mode, p.key.teamSize)
+	s.startGame(roomID)
+}
+
+// 确认完成后有玩家断开：把对局放回匹配器，断开的玩家视为拒绝，其他玩家回到队列
+func (s *Server) abortMatchedGame(p *matchProposal, gone []int32) {
+	fmt.Printf("Match proposal %d: players %v disconnected before the game started\n", p.id, gone)
+	mm := &s.matchmaking
+	mm.mutex.Lock()
+	mm.proposals[p.id] = p
+	for _, t := range p.tickets {
+		mm.tickets[t.client.ID] = t
+	}
+	for _, id := range gone {
+		delete(p.accepted, id)
+	}
+	mm.mutex.Unlock()
+	s.cancelProposal(p.id, -1)
+}
+
+// 对局中的玩家ID（按排队顺序）
+func (p *matchProposal) playerIDs() []int32 {
+	ids := make([]int32, len(p.tickets))
+	for i, t := range p.tickets {
+		ids[i] = t.client.ID
+	}
+	return ids
+}
+
+func (p *matchProposal) clients() []*Client {
+	clients := make([]*Client, len(p.tickets))
+	for i, t := range p.tickets {
+		clients[i] = t.client
+	}
+	return clients
+}
+
+// 对局通知（调用方持有匹配器锁）
+func (p *matchProposal) notice() *myproto.MatchFound {
+	notice := &myproto.MatchFound{
+		ProposalId: p.id,
+		Mode:       p.key.mode,
+		TeamSize:   p.key.teamSize,
+		PlayerIds:  p.playerIDs(),
+		Deadline:   p.deadline.UnixNano(),
+	}
+	for _, id := range notice.PlayerIds {
+		if p.accepted[id] {
+			notice.AcceptedIds = append(notice.AcceptedIds, id)
+		}
+	}
+	return notice
+}
+
+// 各队伍的 Elo 分数变化：每两队之间按平均分计算期望胜率，胜1分、负0分、其余为平局0.5分，
+// 对所有对手取平均。少于两队时没有分数变化
+func eloChanges(teamRatings map[int32]float64, winnerTeam int32) map[int32]int32 {
+	changes := make(map[int32]int32, len(teamRatings))
+	if len(teamRatings) < 2 {
+		return changes
+	}
+	for a, ra := range teamRatings {
+		var sum float64
+		for b, rb := range teamRatings {
+			if a == b {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (rb-ra)/400))
+			score := 0.5
+			if winnerTeam == a {
+				score = 1
+			} else if winnerTeam == b {
+				score = 0
+			}
+			sum += score - expected
+		}
+		changes[a] = int32(math.Round(eloK * sum / float64(len(teamRatings)-1)))
+	}
+	return changes
+}
+
+// 匹配房间的结果核对一致后更新参赛账号的分数，并记录到比赛历史
+func (s *Server) updateRatings(summary *myproto.MatchSummary, teams map[int32]int32) {
+	if s.Store == nil {
+		return
+	}
+
+	// 未登录的玩家按默认分数参与计算，但不更新
+	ratings := make(map[int32][]float64)
+	winnerTeam := int32(0)
+	for _, p := range summary.Participants {
+		team, ok := teams[p.PlayerId]
+		if !ok {
+			continue
+		}
+		rating := store.Rating(nil)
+		if p.AccountId != 0 {
+			account, err := s.Store.Account(p.AccountId)
+			if err != nil {
+				log.Printf("Room %s: Load rating of account %d error: %v\n", summary.RoomId, p.AccountId, err)
+				return
+			}
+			rating = store.Rating(account)
+		}
+		ratings[team] = append(ratings[team], float64(rating))
+		if p.Winner {
+			winnerTeam = team
+		}
+	}
+	teamRatings := make(map[int32]float64, len(ratings))
+	for team, members := range ratings {
+		var total float64
+		for _, r := range members {
+			total += r
+		}
+		teamRatings[team] = total / float64(len(members))
+	}
+
+	teamChanges := eloChanges(teamRatings, winnerTeam)
+	changes := make(map[int64]int32)
+	for _, p := range summary.Participants {
+		if team, ok := teams[p.PlayerId]; ok && p.AccountId != 0 {
+			changes[p.AccountId] = teamChanges[team]
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	updated, err := s.Store.UpdateRatings(changes)
+	if err != nil {
+		log.Printf("Room %s: Update ratings for match %s error: %v\n", summary.RoomId, summary.MatchId, err)
+		return
+	}
+	for _, p := range summary.Participants {
+		if change, ok := changes[p.AccountId]; ok {
+			p.RatingChange = change
+		}
+	}
+	fmt.Printf("Room %s: Ratings updated for match %s: %v\n", summary.RoomId, summary.MatchId, updated)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/WjcHome/gohello/store"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFindMatchesWidensRange(t *testing.T) {
+	s := NewServer()
+	start := time.Now()
+	versus := queueKey{"versus", 1}
+	queue := func(id int32, rating int32, waited time.Duration) {
+		s.matchmaking.tickets[id] = &queueTicket{client: &Client{ID: id}, key: versus, rating: rating, enqueued: start.Add(-waited)}
+	}
+	ids := func(groups [][]*queueTicket) [][]int32 {
+		var result [][]int32
+		for _, group := range groups {
+			var ids []int32
+			for _, t := range group {
+				ids = append(ids, t.client.ID)
+			}
+			result = append(result, ids)
+		}
+		return result
+	}
+
+	// 初始范围100：1500 和 1800 不匹配，分数最接近的 1500 和 1520 匹配
+	queue(1, 1500, 0)
+	queue(2, 1800, 0)
+	queue(3, 1520, 0)
+	if got := ids(s.findMatches(start)); len(got) != 1 || !slices.Equal(got[0], []int32{1, 3}) {
+		t.Fatalf("matches = %v, want [[1 3]]", got)
+	}
+
+	// 每秒扩大50：等待4秒后范围300，1500 和 1800 可以匹配
+	delete(s.matchmaking.tickets, 3)
+	if got := s.findMatches(start.Add(3 * time.Second)); len(got) != 0 {
+		t.Fatalf("matched after 3s: %v", ids(got))
+	}
+	if got := ids(s.findMatches(start.Add(4 * time.Second))); len(got) != 1 || !slices.Equal(got[0], []int32{1, 2}) {
+		t.Fatalf("matches after 4s = %v", got)
+	}
+	// 范围不超过上限
+	if r := s.Matchmaking.ratingRange(time.Hour); r != s.Matchmaking.MaxRange {
+		t.Fatalf("range after an hour = %d", r)
+	}
+
+	// 其他队列互不影响，2v2需要4人
+	s.matchmaking.tickets = make(map[int32]*queueTicket)
+	for i := int32(1); i <= 3; i++ {
+		s.matchmaking.tickets[i] = &queueTicket{client: &Client{ID: i}, key: queueKey{"versus", 2}, rating: 1500, enqueued: start}
+	}
+	queue(4, 1500, 0)
+	if got := s.findMatches(start); len(got) != 0 {
+		t.Fatalf("matched across queues: %v", ids(got))
+	}
+}
+
+func TestAssignTeamsAndEloChanges(t *testing.T) {
+	var group []*queueTicket
+	for i, rating := range []int32{1500, 1600, 1450, 1550} {
+		group = append(group, &queueTicket{client: &Client{ID: int32(i + 1)}, rating: rating})
+	}
+	// 蛇形分队：1600、1450 一队，1550、1500 一队
+	teams := assignTeams(group, 2)
+	if teams[2] != 1 || teams[3] != 1 || teams[4] != 2 || teams[1] != 2 {
+		t.Fatalf("teams = %v", teams)
+	}
+
+	cases := []struct {
+		name    string
+		ratings map[int32]float64
+		winner  int32
+		want    map[int32]int32
+	}{
+		{"equal, team 1 wins", map[int32]float64{1: 1500, 2: 1500}, 1, map[int32]int32{1: 16, 2: -16}},
+		{"draw", map[int32]float64{1: 1500, 2: 1500}, 0, map[int32]int32{1: 0, 2: 0}},
+		{"favourite wins", map[int32]float64{1: 1800, 2: 1500}, 1, map[int32]int32{1: 5, 2: -5}},
+		{"underdog wins", map[int32]float64{1: 1800, 2: 1500}, 2, map[int32]int32{1: -27, 2: 27}},
+		{"coop", map[int32]float64{1: 1500}, 1, map[int32]int32{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := eloChanges(tc.ratings, tc.winner)
+			if len(got) != len(tc.want) {
+				t.Fatalf("changes = %v, want %v", got, tc.want)
+			}
+			for team, want := range tc.want {
+				if got[team] != want {
+					t.Fatalf("changes = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+// 加入匹配队列并等待排队状态
+func joinTestQueue(t *testing.T, c *client.Client, mode string, teamSize int32) *myproto.MatchQueue {
+	t.Helper()
+	if err := c.JoinQueue(mode, teamSize); err != nil {
+		t.Fatalf("join queue: %v", err)
+	}
+	return waitForMessage(t, c, myproto.MessageType_MESSAGE_QUEUE).Body.(*myproto.MatchQueue)
+}
+
+func TestMatchmakingConfirmAndRatings(t *testing.T) {
+	st := openTestStore(t)
+	s, addrs := startTestServer(t, 8, func(s *Server) { s.Store = st })
+	alice := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	bob := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	aliceAccount := loginTestClient(t, alice, "alice", "").AccountId
+	bobAccount := loginTestClient(t, bob, "bob", "").AccountId
+
+	if status := joinTestQueue(t, alice, "ranked", 1); status.Queued || status.Error == "" {
+		t.Fatalf("unknown mode accepted: %v", status)
+	}
+	if status := joinTestQueue(t, alice, "versus", 1); !status.Queued || status.Rating != store.DefaultRating {
+		t.Fatalf("queue status %v", status)
+	}
+	joinTestQueue(t, bob, "versus", 1)
+
+	// 两人都确认后开始游戏，排队时离开了自动分配的房间
+	found := waitForMessage(t, alice, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+	if !slices.Equal(found.PlayerIds, []int32{alice.PlayerID, bob.PlayerID}) || found.Deadline == 0 {
+		t.Fatalf("match found %v", found)
+	}
+	waitForMessage(t, bob, myproto.MessageType_MESSAGE_MATCH_FOUND)
+	if err := alice.ConfirmMatch(found.ProposalId, true); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	progress := waitForMessage(t, bob, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+	if !slices.Equal(progress.AcceptedIds, []int32{alice.PlayerID}) {
+		t.Fatalf("confirmation progress %v", progress)
+	}
+	if err := bob.ConfirmMatch(found.ProposalId, true); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	gameStart := waitForMessage(t, alice, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+	waitForMessage(t, bob, myproto.MessageType_MESSAGE_GAME_START)
+	s.Mutex.Lock()
+	room, rooms := s.Rooms[gameStart.RoomId], len(s.Rooms)
+	s.Mutex.Unlock()
+	if rooms != 1 || room.queue == nil || room.HostID != alice.PlayerID {
+		t.Fatalf("%d rooms, matched room %+v", rooms, room)
+	}
+
+	// 结果核对一致后更新分数
+	winner := alice.PlayerID
+	if err := alice.EndMatch(&myproto.MatchEnd{WinnerId: &winner}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	finalFrame := waitForMessage(t, alice, myproto.MessageType_MESSAGE_MATCH_END).Body.(*myproto.MatchEnd).FrameNumber
+	for _, c := range []*client.Client{alice, bob} {
+		if err := c.SubmitResult(&myproto.MatchResult{FinalFrame: finalFrame, WinnerId: &winner}); err != nil {
+			t.Fatalf("submit result: %v", err)
+		}
+	}
+	waitForMessage(t, bob, myproto.MessageType_MESSAGE_MATCH_RESULT)
+
+	for account, want := range map[int64]int32{aliceAccount: store.DefaultRating + 16, bobAccount: store.DefaultRating - 16} {
+		if got, _ := st.Account(account); got.Rating != want {
+			t.Fatalf("account %d rating %d, want %d", account, got.Rating, want)
+		}
+	}
+	history, _ := st.MatchHistory(bobAccount, 1)
+	if len(history) != 1 {
+		t.Fatalf("history %v", history)
+	}
+	for _, p := range history[0].Participants {
+		if (p.PlayerId == alice.PlayerID && p.RatingChange != 16) || (p.PlayerId == bob.PlayerID && p.RatingChange != -16) {
+			t.Fatalf("participant %v", p)
+		}
+	}
+}
+
+func TestMatchmakingDeclineAndDisconnect(t *testing.T) {
+	s, addrs := startTestServer(t, 8)
+	var clients []*client.Client
+	for i := 0; i < 3; i++ {
+		clients = append(clients, dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP]))
+	}
+	a, b, c := clients[0], clients[1], clients[2]
+	queued := func(c *client.Client) bool {
+		s.matchmaking.mutex.Lock()
+		defer s.matchmaking.mutex.Unlock()
+		ticket, ok := s.matchmaking.tickets[c.PlayerID]
+		return ok && ticket.proposal == nil
+	}
+
+	// b 拒绝：b 离开队列，a 回到队列
+	joinTestQueue(t, a, "versus", 1)
+	joinTestQueue(t, b, "versus", 1)
+	found := waitForMessage(t, b, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+	if err := b.ConfirmMatch(found.ProposalId, false); err != nil {
+		t.Fatalf("decline: %v", err)
+	}
+	if status := waitForMessage(t, b, myproto.MessageType_MESSAGE_QUEUE).Body.(*myproto.MatchQueue); status.Queued {
+		t.Fatalf("declined player still queued: %v", status)
+	}
+	for {
+		notice := waitForMessage(t, a, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+		if notice.Cancelled {
+			break
+		}
+	}
+	waitFor(t, "a back in queue", func() bool { return queued(a) })
+
+	// c 加入后与 a 匹配；a 断开连接时对局取消，c 回到队列
+	joinTestQueue(t, c, "versus", 1)
+	found = waitForMessage(t, c, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+	if !slices.Equal(found.PlayerIds, []int32{a.PlayerID, c.PlayerID}) {
+		t.Fatalf("second proposal %v", found)
+	}
+	a.Close()
+	if notice := waitForMessage(t, c, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound); !notice.Cancelled {
+		t.Fatalf("proposal not cancelled: %v", notice)
+	}
+	waitFor(t, "c back in queue", func() bool { return queued(c) })
+}
+
+func TestMatchedGameSkipsDisconnectedPlayer(t *testing.T) {
+	s := NewServer()
+	a, b := &Client{ID: 1}, &Client{ID: 2}
+	for _, c := range []*Client{a, b} {
+		if err := s.joinQueue(c, queueKey{mode: "versus", teamSize: 1}); err != nil {
+			t.Fatalf("join queue: %v", err)
+		}
+	}
+	s.matchmake(time.Now())
+	s.matchmaking.mutex.Lock()
+	p := s.matchmaking.tickets[a.ID].proposal
+	s.matchmaking.mutex.Unlock()
+	if p == nil {
+		t.Fatalf("no proposal")
+	}
+	confirm := func(c *Client) {
+		data, err := proto.Marshal(&myproto.MatchFound{ProposalId: p.id, Accept: true})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		s.handleMatchFound(c, data)
+	}
+
+	// b 在最后一个确认到达之后、房间创建之前断开：不开局，a 回到队列
+	confirm(a)
+	s.Mutex.Lock()
+	b.disconnected = true
+	s.Mutex.Unlock()
+	confirm(b)
+
+	if a.RoomID != "" || b.RoomID != "" || len(s.Rooms) != 0 {
+		t.Fatalf("matched game started with a disconnected player: rooms %v", s.Rooms)
+	}
+	s.matchmaking.mutex.Lock()
+	defer s.matchmaking.mutex.Unlock()
+	if ticket := s.matchmaking.tickets[a.ID]; ticket == nil || ticket.proposal != nil {
+		t.Fatalf("a not back in queue: %+v", ticket)
+	}
+	if _, queued := s.matchmaking.tickets[b.ID]; queued || len(s.matchmaking.proposals) != 0 {
+		t.Fatalf("b still queued or proposal left over")
+	}
+}
+
+func TestAutoAssignRoomIsDeterministic(t *testing.T) {
+	s := NewServer()
+	s.MaxPlayers = 4
+	start := time.Now()
+	addRoom := func(id string, players int, age time.Duration) {
+		room := s.newRoom(id, 100, RoomOptions{MaxPlayers: 4})
+		room.createdAt = start.Add(-age)
+		for i := 0; i < players; i++ {
+			c := &Client{ID: int32(100*len(s.Rooms) + i), RoomID: id}
+			room.Clients[c.ID] = c
+		}
+		s.Rooms[id] = room
+	}
+	// 人数最多的房间优先，人数相同时最早创建的优先；匹配房间不参与自动分配
+	addRoom("1", 1, 3*time.Second)
+	addRoom("2", 2, time.Second)
+	addRoom("3", 2, 2*time.Second)
+	addRoom("4", 3, 4*time.Second)
+	s.Rooms["4"].queue = &queueKey{"versus", 2}
+
+	for i := int32(1); i <= 3; i++ {
+		c := &Client{ID: i}
+		s.autoAssignRoom(c)
+		if want := []string{"3", "3", "2"}[i-1]; c.RoomID != want {
+			t.Fatalf("client %d assigned to room %q, want %q", i, c.RoomID, want)
+		}
+	}
+}
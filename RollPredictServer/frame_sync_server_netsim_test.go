@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	"github.com/WjcHome/gohello/netsim"
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/xtaci/kcp-go/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// 通过模拟网络连接服务器：TCP和UDP包装客户端的连接，KCP会话建立在包装过的UDP socket上。
+// 返回的 Conn 用于查看链路统计，KCP 时为 nil
+func dialImpairedClient(t *testing.T, protocol, addr string, options netsim.ConnOptions) (*client.Client, *netsim.Conn) {
+	t.Helper()
+	var conn net.Conn
+	var impaired *netsim.Conn
+	if protocol == client.ProtocolKCP {
+		serverAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		socket, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		session, err := kcp.NewConn4(rand.Uint32(), serverAddr, nil, 0, 0, true, netsim.NewPacketConn(socket, options))
+		if err != nil {
+			t.Fatalf("kcp session: %v", err)
+		}
+		conn = session
+	} else {
+		raw, err := net.Dial(protocol, addr)
+		if err != nil {
+			t.Fatalf("dial %s %s: %v", protocol, addr, err)
+		}
+		impaired = netsim.NewConn(raw, options)
+		conn = impaired
+	}
+	c, err := client.Connect(protocol, conn)
+	if err != nil {
+		t.Fatalf("connect %s %s: %v", protocol, addr, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, impaired
+}
+
+// 收集前 n 个服务器帧，发现缺帧或者一段时间没有收到新帧时发送补帧请求（补帧回复也可能丢失）
+func collectFramesWithRecovery(t *testing.T, c *client.Client, n int) []*myproto.ServerFrame {
+	t.Helper()
+	const retryInterval = 100 * time.Millisecond
+	frames := make([]*myproto.ServerFrame, 0, n)
+	pending := make(map[int64]*myproto.ServerFrame) // 还不连续的帧
+	receive := func(frame *myproto.ServerFrame) {
+		if frame.FrameNumber > int64(len(frames)) {
+			pending[frame.FrameNumber] = frame
+		}
+		for len(frames) < n {
+			next, ok := pending[int64(len(frames))+1]
+			if !ok {
+				break
+			}
+			delete(pending, next.FrameNumber)
+			frames = append(frames, next)
+		}
+	}
+
+	deadline := time.After(testTimeout)
+	var lastRequest time.Time
+	for len(frames) < n {
+		idle := false
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("client %d: connection closed: %v", c.PlayerID, c.Err())
+			}
+			switch body := msg.Body.(type) {
+			case *myproto.ServerFrame:
+				receive(body)
+			case *myproto.SendAllFrame:
+				for _, frame := range body.AllNeedFrame {
+					receive(frame)
+				}
+			}
+		case <-time.After(retryInterval):
+			idle = true
+		case <-deadline:
+			t.Fatalf("client %d: timed out with %d of %d frames", c.PlayerID, len(frames), n)
+		}
+		if len(frames) < n && (idle || len(pending) > 0) && time.Since(lastRequest) > retryInterval {
+			if err := c.RequestFrames(int64(len(frames))); err != nil {
+				t.Fatalf("request frames: %v", err)
+			}
+			lastRequest = time.Now()
+		}
+	}
+	return frames
+}
+
+func TestFrameSyncOverImpairedNetwork(t *testing.T) {
+	const frameCount = 40
+	_, addrs := startTestServer(t, 3)
+
+	// 链路参数是移动网络的延迟，时钟加速4倍，实际延迟是四分之一
+	clock := netsim.NewScaledClock(4)
+	mobile := netsim.Profile{Delay: 120 * time.Millisecond, Jitter: 60 * time.Millisecond, Distribution: netsim.Pareto}
+	tcpClient, _ := dialImpairedClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP], netsim.ConnOptions{
+		Write: mobile, Read: mobile, Clock: clock, Seed: 1,
+	})
+	// UDP的连接握手、开局消息和输入都只发一次，开局后才让下行丢包、乱序和重复，靠补帧请求恢复
+	udpClient, udpConn := dialImpairedClient(t, client.ProtocolUDP, addrs[client.ProtocolUDP], netsim.ConnOptions{
+		Write: mobile, Read: mobile, Clock: clock, Seed: 2,
+	})
+	// KCP两个方向都丢包，由KCP重传
+	kcpLossy := netsim.Profile{Delay: 80 * time.Millisecond, Loss: 0.1}
+	kcpClient, _ := dialImpairedClient(t, client.ProtocolKCP, addrs[client.ProtocolKCP], netsim.ConnOptions{
+		Write: kcpLossy, Read: kcpLossy, Clock: clock, Seed: 3,
+	})
+	clients := []*client.Client{tcpClient, udpClient, kcpClient}
+
+	for i, c := range clients {
+		waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START)
+		if c == udpClient {
+			lossy := mobile
+			lossy.Loss, lossy.Reorder, lossy.Duplicate = 0.2, 0.1, 0.05
+			_, read := udpConn.Links()
+			read.SetProfile(lossy)
+		}
+		if err := c.SendInput(&myproto.FrameData{PlayerId: c.PlayerID, Direction: myproto.InputDirection(i + 1), FrameNumber: 1}); err != nil {
+			t.Fatalf("send input: %v", err)
+		}
+	}
+
+	// 所有客户端最终得到相同的连续帧序列，每条输入恰好出现一次
+	sequences := [][]*myproto.ServerFrame{
+		collectFrames(t, tcpClient, frameCount),
+		collectFramesWithRecovery(t, udpClient, frameCount),
+		collectFrames(t, kcpClient, frameCount),
+	}
+	for i, sequence := range sequences {
+		for j, frame := range sequence {
+			if frame.FrameNumber != int64(j+1) || !proto.Equal(frame, sequences[0][j]) {
+				t.Fatalf("client %d frame %d: got %v, want %v", clients[i].PlayerID, j+1, frame, sequences[0][j])
+			}
+		}
+	}
+	seen := make(map[int32]int)
+	for _, frame := range sequences[0] {
+		for _, frameData := range frame.FrameDatas {
+			seen[frameData.PlayerId]++
+		}
+	}
+	for _, c := range clients {
+		if seen[c.PlayerID] != 1 {
+			t.Errorf("input of player %d appeared %d times, want 1", c.PlayerID, seen[c.PlayerID])
+		}
+	}
+	if _, read := udpConn.Stats(); read.Dropped == 0 {
+		t.Fatalf("udp link dropped nothing: %+v", read)
+	}
+}
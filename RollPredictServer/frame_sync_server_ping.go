@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// RTT平滑参数（与TCP的RTO估计相同，RFC 6298）
+const (
+	rttSmoothing    = 8 // 平滑RTT每次向新样本移动 1/8
+	jitterSmoothing = 4 // 抖动每次向新偏差移动 1/4
+	maxRTTSample    = 10 * time.Second
+)
+
+// Latency 是服务器测得的客户端延迟
+type Latency struct {
+	RTT     time.Duration // 平滑RTT
+	Jitter  time.Duration // RTT抖动（平均偏差）
+	Offset  time.Duration // 时钟偏差：客户端时钟 - 服务器时钟
+	Samples int           // RTT样本数
+}
+
+// 客户端延迟统计（读取协程写入，房间逻辑读取，使用独立的锁）
+type latencyStats struct {
+	mutex  sync.Mutex
+	latest Latency
+}
+
+// 加入一个RTT样本和对应的时钟偏差样本
+func (l *latencyStats) addSample(rtt, offset time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current := &l.latest
+	if current.Samples == 0 {
+		current.RTT = rtt
+		current.Jitter = rtt / 2
+		current.Offset = offset
+	} else {
+		current.Jitter += ((rtt - current.RTT).Abs() - current.Jitter) / jitterSmoothing
+		current.RTT += (rtt - current.RTT) / rttSmoothing
+		current.Offset += (offset - current.Offset) / rttSmoothing
+	}
+	current.Samples++
+}
+
+func (l *latencyStats) snapshot() Latency {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.latest
+}
+
+// Latency 返回服务器测得的客户端延迟，Samples 为0表示还没有测量结果
+func (c *Client) Latency() Latency {
+	return c.latency.snapshot()
+}
+
+// 处理测时请求：回复Pong，并用Ping中回显的上一个Pong的发送时间测量RTT
+func (s *Server) handlePing(client *Client, data []byte) {
+	received := time.Now()
+
+	var ping myproto.Ping
+	if err := proto.Unmarshal(data, &ping); err != nil {
+		log.Printf("Client %d: Unmarshal ping error: %v\n", client.ID, err)
+		return
+	}
+
+	// RTT = 服务器收到本Ping的时间 - 发送上一个Pong的时间 - 客户端持有时间
+	if ping.EchoServerSendTime != 0 && ping.EchoHoldNs >= 0 {
+		rtt := time.Duration(received.UnixNano()-ping.EchoServerSendTime) - time.Duration(ping.EchoHoldNs)
+		if rtt > 0 && rtt < maxRTTSample {
+			// 假设往返对称，客户端发送时刻的服务器时间约为 received - rtt/2
+			offset := time.Duration(ping.ClientSendTime - received.UnixNano() + int64(rtt/2))
+			client.latency.addSample(rtt, offset)
+		}
+	}
+
+	pong := &myproto.Pong{
+		Sequence:          ping.Sequence,
+		ClientSendTime:    ping.ClientSendTime,
+		ServerReceiveTime: received.UnixNano(),
+		RttNs:             int64(client.Latency().RTT),
+	}
+
+	// 附带房间帧时钟，客户端用来把本地tick对齐到服务器帧号
+	if room := s.clientRoom(client); room != nil {
+		room.Mutex.Lock()
+		if room.Status == "playing" {
+			pong.FrameAnchorTime = room.clock.anchorTime.UnixNano()
+			pong.FrameAnchorNumber = room.clock.anchorFrame
+			pong.FrameIntervalNs = int64(room.clock.interval)
+		}
+		room.Mutex.Unlock()
+	}
+
+	pong.ServerSendTime = time.Now().UnixNano()
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_PONG, pong)
+}
+
+// 查找客户端所在的房间，不在房间中返回nil
+func (s *Server) clientRoom(client *Client) *Room {
+	if client.RoomID == "" {
+		return nil
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.Rooms[client.RoomID]
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestLatencyStatsSmoothing(t *testing.T) {
+	var stats latencyStats
+	if got := stats.snapshot(); got.Samples != 0 {
+		t.Fatalf("new stats have %d samples", got.Samples)
+	}
+
+	// 第一个样本直接作为初始值
+	stats.addSample(40*time.Millisecond, 5*time.Millisecond)
+	got := stats.snapshot()
+	if got.RTT != 40*time.Millisecond || got.Jitter != 20*time.Millisecond || got.Offset != 5*time.Millisecond {
+		t.Fatalf("after first sample: %+v", got)
+	}
+
+	// 稳定的样本使RTT收敛、抖动趋近于0
+	for i := 0; i < 100; i++ {
+		stats.addSample(100*time.Millisecond, -time.Millisecond)
+	}
+	got = stats.snapshot()
+	if got.Samples != 101 {
+		t.Fatalf("samples = %d, want 101", got.Samples)
+	}
+	if (got.RTT - 100*time.Millisecond).Abs() > time.Millisecond {
+		t.Fatalf("RTT = %v, want about 100ms", got.RTT)
+	}
+	if got.Jitter > time.Millisecond {
+		t.Fatalf("jitter = %v after stable samples", got.Jitter)
+	}
+	if (got.Offset + time.Millisecond).Abs() > 100*time.Microsecond {
+		t.Fatalf("offset = %v, want about -1ms", got.Offset)
+	}
+}
+
+func TestPingMeasuresLatencyAndFrameClock(t *testing.T) {
+	for _, protocol := range []string{client.ProtocolTCP, client.ProtocolUDP, client.ProtocolKCP} {
+		t.Run(protocol, func(t *testing.T) {
+			s, addrs := startTestServer(t, 1)
+			c := dialTestClient(t, protocol, addrs[protocol])
+
+			gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+			if gameStart.StartTime == 0 {
+				t.Fatalf("GameStart has no start time")
+			}
+
+			// 每个Pong回显上一个Pong，服务器从第二个Ping开始得到RTT样本
+			const pings = 5
+			var pong *myproto.Pong
+			for i := 1; i <= pings; i++ {
+				if err := c.Ping(); err != nil {
+					t.Fatalf("ping: %v", err)
+				}
+				pong = waitForMessage(t, c, myproto.MessageType_MESSAGE_PONG).Body.(*myproto.Pong)
+				if pong.Sequence != int64(i) {
+					t.Fatalf("pong sequence %d, want %d", pong.Sequence, i)
+				}
+			}
+			if pong.RttNs <= 0 || pong.FrameIntervalNs != int64(frameIntervalOf(DEFAULT_FRAME_RATE, 1)) {
+				t.Fatalf("pong rtt %d, frame interval %d", pong.RttNs, pong.FrameIntervalNs)
+			}
+
+			s.Mutex.Lock()
+			room := s.Rooms[gameStart.RoomId]
+			s.Mutex.Unlock()
+			room.Mutex.Lock()
+			serverClient := room.Clients[c.PlayerID]
+			room.Mutex.Unlock()
+
+			// 本机回环：RTT很小，时钟偏差接近0
+			latency := serverClient.Latency()
+			if latency.Samples != pings-1 {
+				t.Fatalf("server has %d RTT samples, want %d", latency.Samples, pings-1)
+			}
+			if latency.RTT <= 0 || latency.RTT > 100*time.Millisecond {
+				t.Fatalf("server RTT = %v", latency.RTT)
+			}
+			if latency.Offset.Abs() > 20*time.Millisecond {
+				t.Fatalf("server clock offset = %v on loopback", latency.Offset)
+			}
+			clock := c.Clock()
+			if clock.Samples != pings || clock.RTT <= 0 || clock.Offset.Abs() > 20*time.Millisecond {
+				t.Fatalf("client clock sync = %+v", clock)
+			}
+
+			// 按帧时钟推算的帧号与实际收到的帧号一致（允许一帧误差）
+			frame := waitForMessage(t, c, myproto.MessageType_MESSAGE_SERVER_FRAME).Body.(*myproto.ServerFrame)
+			expected, ok := c.ExpectedFrame(time.Now())
+			if !ok {
+				t.Fatalf("client has no frame clock")
+			}
+			if diff := expected - frame.FrameNumber; diff < -1 || diff > 1 {
+				t.Fatalf("expected frame %d, received frame %d", expected, frame.FrameNumber)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DEFAULT_RESULT_TIMEOUT = 10 * time.Second // 比赛结束后等待玩家提交结果的时间
+	DEFAULT_DATA_DIR       = "data"           // 比赛记录和回放的保存目录
+)
+
+// 开始收集比赛结果：房间内的每个玩家都应当提交结果，超时后用已收到的结果核对（调用方持有房间锁）
+func (s *Server) collectResults(room *Room) {
+	room.resultExpected = make([]int32, 0, len(room.Clients))
+	for id := range room.Clients {
+		room.resultExpected = append(room.resultExpected, id)
+	}
+	slices.Sort(room.resultExpected)
+	room.resultSubmissions = make(map[int32]*myproto.MatchResult)
+	room.resultPlayers = room.participants()
+	room.endedAt = time.Now()
+
+	round := room.round
+	room.resultTimer = time.AfterFunc(s.ResultTimeout, func() {
+		s.finalizeResult(room, round)
+	})
+}
+
+// 处理玩家提交的比赛结果
+func (s *Server) handleMatchResult(client *Client, data []byte) {
+	var submission myproto.MatchResult
+	if err := proto.Unmarshal(data, &submission); err != nil {
+		log.Printf("Client %d: Unmarshal match result error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Match result without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.resultSubmissions == nil || !slices.Contains(room.resultExpected, client.ID) {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Not expecting a match result in room %s\n", client.ID, room.ID)
+		return
+	}
+	if _, submitted := room.resultSubmissions[client.ID]; submitted {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Duplicate match result ignored\n", client.ID)
+		return
+	}
+	room.resultSubmissions[client.ID] = normalizeResult(&submission)
+	complete := len(room.resultSubmissions) == len(room.resultExpected)
+	round := room.round
+	room.Mutex.Unlock()
+
+	if complete {
+		s.finalizeResult(room, round)
+	}
+}
+
+// 只保留玩家计算的字段，并按玩家ID排序，相同的结果编码后完全相同
+func normalizeResult(submission *myproto.MatchResult) *myproto.MatchResult {
+	normalized := &myproto.MatchResult{
+		FinalFrame: submission.FinalFrame,
+		WinnerId:   submission.WinnerId,
+		StateHash:  submission.StateHash,
+	}
+	for _, r := range submission.Results {
+		normalized.Results = append(normalized.Results, &myproto.PlayerResult{PlayerId: r.PlayerId, Score: r.Score})
+	}
+	slices.SortStableFunc(normalized.Results, func(a, b *myproto.PlayerResult) int {
+		return int(a.PlayerId) - int(b.PlayerId)
+	})
+	return normalized
+}
+
+// 结果的比较键
+func resultKey(result *myproto.MatchResult) string {
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(result)
+	return string(data)
+}
+
+// 核对提交的结果：最后一帧与服务器一致、并且由过半的应提交玩家提交的相同结果为共识。
+// 没有共识时 Agreed 为false，原始提交保存在比赛记录中供申诉处理。
+func consensus(expected []int32, submissions map[int32]*myproto.MatchResult, finalFrame int64) *myproto.MatchResult {
+	counts := make(map[string]int)
+	for _, submission := range submissions {
+		if submission.FinalFrame == finalFrame {
+			counts[resultKey(submission)]++
+		}
+	}
+
+	verdict := &myproto.MatchResult{FinalFrame: finalFrame}
+	var agreedKey string
+	for key, count := range counts {
+		if count > len(expected)/2 {
+			agreedKey = key
+			break
+		}
+	}
+	for _, id := range expected {
+		submission, ok := submissions[id]
+		if !ok {
+			verdict.MissingIds = append(verdict.MissingIds, id)
+			continue
+		}
+		if agreedKey == "" {
+			continue
+		}
+		if resultKey(submission) == agreedKey {
+			if !verdict.Agreed {
+				verdict.Agreed = true
+				verdict.WinnerId = submission.WinnerId
+				verdict.Results = submission.Results
+				verdict.StateHash = submission.StateHash
+			}
+		} else {
+			verdict.DisagreeingIds = append(verdict.DisagreeingIds, id)
+		}
+	}
+	return verdict
+}
+
+// 收集结束（全部提交或超时）：核对结果，保存比赛记录和回放，广播结论。
+// 同一局只执行一次
+func (s *Server) finalizeResult(room *Room, round int) {
+	room.Mutex.Lock()
+	if room.round != round || room.resultSubmissions == nil {
+		room.Mutex.Unlock()
+		return
+	}
+	room.resultTimer.Stop()
+
+	verdict := consensus(room.resultExpected, room.resultSubmissions, room.FrameNumber)
+	verdict.MatchId = fmt.Sprintf("%s-room%s-%d", room.startedAt.Format("20060102-150405"), room.ID, room.round)
+	record := &myproto.MatchRecord{
+		MatchId:     verdict.MatchId,
+		RoomId:      room.ID,
+		Round:       int32(room.round),
+		StartTime:   room.startedAt.UnixNano(),
+		EndTime:     room.endedAt.UnixNano(),
+		GameStart:   room.gameStart,
+		Verdict:     verdict,
+		Submissions: room.resultSubmissions,
+	}
+	replay := &myproto.Replay{
+		MatchId:   verdict.MatchId,
+		GameStart: room.gameStart,
+		Frames:    room.HistoryFrames,
+	}
+	summary := matchSummary(record, room.LastResult, room.resultPlayers)
+	matchmade, teams := room.queue != nil, room.teamOf()
+	room.resultSubmissions = nil
+	room.resultPlayers = nil
+	room.LastVerdict = verdict
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	if verdict.Agreed {
+		fmt.Printf("Room %s: Match %s result agreed (disagreeing: %v, missing: %v)\n",
+			room.ID, verdict.MatchId, verdict.DisagreeingIds, verdict.MissingIds)
+	} else {
+		log.Printf("Room %s: Match %s has no agreed result (missing: %v)\n", room.ID, verdict.MatchId, verdict.MissingIds)
+	}
+	for _, id := range verdict.DisagreeingIds {
+		log.Printf("Client %d: Submitted a result that disagrees with match %s\n", id, verdict.MatchId)
+	}
+
+	if err := s.saveMatch(record, replay); err != nil {
+		log.Printf("Room %s: Save match %s error: %v\n", room.ID, verdict.MatchId, err)
+	}
+	// 匹配房间的结果核对一致时更新分数
+	if matchmade && verdict.Agreed {
+		s.updateRatings(summary, teams)
+	}
+	s.recordMatchHistory(summary)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_MATCH_RESULT, verdict)
+}
+
+// 保存比赛记录（JSON，便于查看）和回放（protobuf），DataDir 为空时不保存
+func (s *Server) saveMatch(record *myproto.MatchRecord, replay *myproto.Replay) error {
+	if s.DataDir == "" {
+		return nil
+	}
+	dir := filepath.Join(s.DataDir, "matches")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	record.ReplayFile = record.MatchId + ".replay"
+	replayData, err := proto.Marshal(replay)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, record.ReplayFile), replayData); err != nil {
+		return err
+	}
+
+	recordData, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, record.MatchId+".json"), recordData)
+}
+
+// 先写临时文件再改名，进程中途退出不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
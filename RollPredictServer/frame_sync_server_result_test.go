@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestConsensus(t *testing.T) {
+	const finalFrame = 100
+	winner := int32(1)
+	result := func(hash string, scores ...int64) *myproto.MatchResult {
+		r := &myproto.MatchResult{FinalFrame: finalFrame, WinnerId: &winner, StateHash: []byte(hash)}
+		for i, score := range scores {
+			r.Results = append(r.Results, &myproto.PlayerResult{PlayerId: int32(i + 1), Score: score})
+		}
+		return normalizeResult(r)
+	}
+	reversed := result("h", 5, 3)
+	slices.Reverse(reversed.Results)
+
+	cases := []struct {
+		name            string
+		expected        []int32
+		submissions     map[int32]*myproto.MatchResult
+		wantAgreed      bool
+		wantDisagreeing []int32
+		wantMissing     []int32
+	}{
+		{"all agree", []int32{1, 2}, map[int32]*myproto.MatchResult{1: result("h", 5, 3), 2: result("h", 5, 3)}, true, nil, nil},
+		{"result order does not matter", []int32{1, 2}, map[int32]*myproto.MatchResult{1: result("h", 5, 3), 2: normalizeResult(reversed)}, true, nil, nil},
+		{"minority hash differs", []int32{1, 2, 3},
+			map[int32]*myproto.MatchResult{1: result("h", 5, 3), 2: result("h", 5, 3), 3: result("x", 5, 3)}, true, []int32{3}, nil},
+		{"missing player", []int32{1, 2, 3}, map[int32]*myproto.MatchResult{1: result("h", 5, 3), 3: result("h", 5, 3)}, true, nil, []int32{2}},
+		{"split vote", []int32{1, 2}, map[int32]*myproto.MatchResult{1: result("h", 5, 3), 2: result("h", 3, 5)}, false, nil, nil},
+		{"not enough submissions", []int32{1, 2, 3}, map[int32]*myproto.MatchResult{1: result("h", 5, 3)}, false, nil, []int32{2, 3}},
+		{"wrong final frame", []int32{1, 2}, map[int32]*myproto.MatchResult{
+			1: {FinalFrame: finalFrame - 1}, 2: {FinalFrame: finalFrame - 1}}, false, nil, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict := consensus(tc.expected, tc.submissions, finalFrame)
+			if verdict.Agreed != tc.wantAgreed {
+				t.Fatalf("agreed = %v, want %v", verdict.Agreed, tc.wantAgreed)
+			}
+			if !slices.Equal(verdict.DisagreeingIds, tc.wantDisagreeing) || !slices.Equal(verdict.MissingIds, tc.wantMissing) {
+				t.Fatalf("disagreeing %v missing %v, want %v %v",
+					verdict.DisagreeingIds, verdict.MissingIds, tc.wantDisagreeing, tc.wantMissing)
+			}
+			if verdict.FinalFrame != finalFrame {
+				t.Fatalf("verdict final frame %d", verdict.FinalFrame)
+			}
+			if tc.wantAgreed && (verdict.WinnerId == nil || *verdict.WinnerId != winner || len(verdict.Results) != 2) {
+				t.Fatalf("agreed verdict lost the result: %v", verdict)
+			}
+		})
+	}
+}
+
+func TestMatchResultIsVerifiedAndPersisted(t *testing.T) {
+	dataDir := t.TempDir()
+	_, clients, room := startTestMatch(t, 3, func(s *Server) { s.DataDir = dataDir })
+	host := clients[0]
+	collectFrames(t, host, 5)
+
+	if err := host.EndMatch(&myproto.MatchEnd{}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	finalFrame := waitForMessage(t, host, myproto.MessageType_MESSAGE_MATCH_END).Body.(*myproto.MatchEnd).FrameNumber
+
+	// 两人提交相同的结果，第三人的状态哈希不同
+	winner := host.PlayerID
+	for i, c := range clients {
+		hash := []byte("agreed")
+		if i == 2 {
+			hash = []byte("desync")
+		}
+		if err := c.SubmitResult(&myproto.MatchResult{
+			FinalFrame: finalFrame,
+			WinnerId:   &winner,
+			StateHash:  hash,
+			Results:    []*myproto.PlayerResult{{PlayerId: host.PlayerID, Score: 3}},
+		}); err != nil {
+			t.Fatalf("submit result: %v", err)
+		}
+	}
+
+	var verdict *myproto.MatchResult
+	for _, c := range clients {
+		verdict = waitForMessage(t, c, myproto.MessageType_MESSAGE_MATCH_RESULT).Body.(*myproto.MatchResult)
+		if !verdict.Agreed || string(verdict.StateHash) != "agreed" || *verdict.WinnerId != winner {
+			t.Fatalf("client %d got verdict %v", c.PlayerID, verdict)
+		}
+		if !slices.Equal(verdict.DisagreeingIds, []int32{clients[2].PlayerID}) || len(verdict.MissingIds) != 0 {
+			t.Fatalf("disagreeing %v, missing %v", verdict.DisagreeingIds, verdict.MissingIds)
+		}
+	}
+
+	// 比赛记录保存了每个人的原始提交，回放包含全部帧
+	recordData, err := os.ReadFile(filepath.Join(dataDir, "matches", verdict.MatchId+".json"))
+	if err != nil {
+		t.Fatalf("read record: %v", err)
+	}
+	var record myproto.MatchRecord
+	if err := protojson.Unmarshal(recordData, &record); err != nil {
+		t.Fatalf("parse record: %v", err)
+	}
+	if record.RoomId != room.ID || len(record.Submissions) != 3 || !proto.Equal(record.Verdict, verdict) {
+		t.Fatalf("record = %v", &record)
+	}
+	if string(record.Submissions[clients[2].PlayerID].StateHash) != "desync" {
+		t.Fatalf("disagreeing submission not kept: %v", record.Submissions)
+	}
+
+	replayData, err := os.ReadFile(filepath.Join(dataDir, "matches", record.ReplayFile))
+	if err != nil {
+		t.Fatalf("read replay: %v", err)
+	}
+	var replay myproto.Replay
+	if err := proto.Unmarshal(replayData, &replay); err != nil {
+		t.Fatalf("parse replay: %v", err)
+	}
+	if int64(len(replay.Frames)) != finalFrame || replay.GameStart.GetRoomId() != room.ID {
+		t.Fatalf("replay has %d frames (want %d), game start %v", len(replay.Frames), finalFrame, replay.GameStart)
+	}
+}
+
+func TestMatchResultTimesOut(t *testing.T) {
+	_, clients, _ := startTestMatch(t, 2, func(s *Server) { s.ResultTimeout = 200 * time.Millisecond })
+	if err := clients[0].EndMatch(&myproto.MatchEnd{}); err != nil {
+		t.Fatalf("end match: %v", err)
+	}
+	finalFrame := waitForMessage(t, clients[0], myproto.MessageType_MESSAGE_MATCH_END).Body.(*myproto.MatchEnd).FrameNumber
+	if err := clients[0].SubmitResult(&myproto.MatchResult{FinalFrame: finalFrame}); err != nil {
+		t.Fatalf("submit result: %v", err)
+	}
+
+	// 2人中只有1人提交，不够过半
+	verdict := waitForMessage(t, clients[1], myproto.MessageType_MESSAGE_MATCH_RESULT).Body.(*myproto.MatchResult)
+	if verdict.Agreed || !slices.Equal(verdict.MissingIds, []int32{clients[1].PlayerID}) {
+		t.Fatalf("verdict after timeout = %v", verdict)
+	}
+}
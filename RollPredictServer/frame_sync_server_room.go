@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	roomCodeLength    = 6                                  // 邀请码长度
+	roomCodeAlphabet  = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ" // 去掉容易看错的 0、1、I、O
+	maxRoomPlayers    = 16                                 // 创建房间时允许的最大人数
+	maxPasswordLength = 64                                 // 房间密码最大长度（字节）
+)
+
+var (
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrRoomFull       = errors.New("room is full")
+	ErrRoomNotWaiting = errors.New("room is not accepting players")
+	ErrWrongPassword  = errors.New("wrong room password")
+	ErrRoomLocked     = errors.New("room is locked")
+	ErrKicked         = errors.New("kicked from this room")
+)
+
+// 分配一个未使用的随机邀请码作为房间ID（调用方持有服务器锁）
+func (s *Server) newRoomID() string {
+	code := make([]byte, roomCodeLength)
+	for {
+		// 字母表长度为32，每个字节取低5位没有偏差
+		if _, err := rand.Read(code); err != nil {
+			panic(err)
+		}
+		for i, b := range code {
+			code[i] = roomCodeAlphabet[b%byte(len(roomCodeAlphabet))]
+		}
+		if _, exists := s.Rooms[string(code)]; !exists {
+			return string(code)
+		}
+	}
+}
+
+// 校验创建房间的人数和密码
+func validateRoomOptions(options RoomOptions) error {
+	if options.MaxPlayers < 1 || options.MaxPlayers > maxRoomPlayers {
+		return fmt.Errorf("max players must be between 1 and %d, got %d", maxRoomPlayers, options.MaxPlayers)
+	}
+	if len(options.Password) > maxPasswordLength || !utf8.ValidString(options.Password) {
+		return fmt.Errorf("password must be valid UTF-8 of at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+// 房间密码的哈希，密码为空时返回nil
+func hashRoomPassword(password string) []byte {
+	if password == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(password))
+	return sum[:]
+}
+
+// 检查玩家能否加入房间（调用方持有房间锁）
+func (room *Room) checkJoin(clientID int32, password string) error {
+	if room.Status != "waiting" || room.queue != nil {
+		return ErrRoomNotWaiting
+	}
+	if room.kicked[clientID] {
+		return ErrKicked
+	}
+	if room.Locked {
+		return ErrRoomLocked
+	}
+	if int32(len(room.Clients)) >= room.MaxPlayers {
+		return ErrRoomFull
+	}
+	if room.passwordHash != nil && subtle.ConstantTimeCompare(room.passwordHash, hashRoomPassword(password)) != 1 {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// 房间信息（调用方持有房间锁）
+func (room *Room) info() *myproto.RoomInfo {
+	playerIDs := make([]int32, 0, len(room.Clients))
+	for id := range room.Clients {
+		playerIDs = append(playerIDs, id)
+	}
+	slices.Sort(playerIDs)
+	return &myproto.RoomInfo{
+		RoomId:      room.ID,
+		Name:        room.Name,
+		HostId:      room.HostID,
+		PlayerIds:   playerIDs,
+		MaxPlayers:  room.MaxPlayers,
+		Private:     room.Private,
+		HasPassword: room.passwordHash != nil,
+		Locked:      room.Locked,
+	}
+}
+
+// 离开当前房间和匹配队列，准备创建或加入其他房间；比赛进行中不能离开
+func (s *Server) leaveForRoom(client *Client, reason string) error {
+	if room := s.clientRoom(client); room != nil {
+		room.Mutex.Lock()
+		status := room.Status
+		room.Mutex.Unlock()
+		if status == "playing" || status == "paused" {
+			return errors.New("already in a match")
+		}
+	}
+	s.leaveQueue(client)
+	s.leaveRoom(client, reason)
+	return nil
+}
+
+// 处理创建房间请求
+func (s *Server) handleCreateRoom(client *Client, data []byte) {
+	var request myproto.CreateRoomRequest
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal create room error: %v\n", client.ID, err)
+		return
+	}
+	options := RoomOptions{
+		Name:       strings.TrimSpace(request.Name),
+		MaxPlayers: request.MaxPlayers,
+		FrameRate:  request.FrameRate,
+		Teams:      request.TeamCount,
+		Settings:   request.Settings,
+		Private:    request.Private,
+		Password:   request.Password,
+	}
+	if options.MaxPlayers == 0 {
+		options.MaxPlayers = s.MaxPlayers
+	}
+	// 先校验参数，不合法时玩家留在原来的房间
+	options, err := s.checkRoomOptions(options)
+	if err == nil {
+		err = s.leaveForRoom(client, "creating a room")
+	}
+	var roomID string
+	if err == nil {
+		roomID, err = s.CreateRoom(client, options)
+	}
+	if err != nil {
+		log.Printf("Client %d: Create room failed: %v\n", client.ID, err)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_ROOM_INFO, &myproto.RoomInfo{Error: err.Error()})
+		return
+	}
+
+	s.Mutex.Lock()
+	room := s.Rooms[roomID]
+	s.Mutex.Unlock()
+	room.Mutex.Lock()
+	info := room.info()
+	full := int32(len(room.Clients)) >= room.MaxPlayers
+	room.Mutex.Unlock()
+	s.sendMessageToClient(client, myproto.MessageType_MESSAGE_ROOM_INFO, info)
+
+	// 单人房间创建后直接开局
+	if full {
+		go s.startGame(roomID)
+	}
+}
+
+// 处理用邀请码加入房间的请求
+func (s *Server) handleJoinRoom(client *Client, data []byte) {
+	var request myproto.JoinRoomRequest
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal join room error: %v\n", client.ID, err)
+		return
+	}
+	roomID := strings.ToUpper(strings.TrimSpace(request.RoomId))
+
+	err := s.checkJoinRoom(client, roomID, request.Password)
+	if err == nil {
+		err = s.leaveForRoom(client, "joining another room")
+	}
+	if err == nil {
+		// 检查之后目标房间可能已经满员、锁定或开局，这时玩家已经离开原来的房间，留在大厅
+		err = s.JoinRoom(client, roomID, request.Password)
+	}
+	if err != nil {
+		log.Printf("Client %d: Join room %q failed: %v\n", client.ID, roomID, err)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_ROOM_INFO, &myproto.RoomInfo{Error: err.Error()})
+		return
+	}
+
+	// 通知房间内所有玩家（包括新加入的玩家）
+	room := s.clientRoom(client)
+	if room == nil {
+		return
+	}
+	room.Mutex.Lock()
+	info := room.info()
+	clients := room.clientList()
+	room.Mutex.Unlock()
+	s.broadcast(clients, myproto.MessageType_MESSAGE_ROOM_INFO, info)
+}
+
+// 离开当前房间之前先检查能否加入目标房间，失败时玩家留在原来的房间
+// （检查通过后加入仍然失败时，玩家留在大厅，不在任何房间）
+func (s *Server) checkJoinRoom(client *Client, roomID, password string) error {
+	if roomID == client.RoomID {
+		return errors.New("already in this room")
+	}
+	s.Mutex.Lock()
+	room, exists := s.Rooms[roomID]
+	s.Mutex.Unlock()
+	if !exists {
+		return ErrRoomNotFound
+	}
+	room.Mutex.Lock()
+	defer room.Mutex.Unlock()
+	return room.checkJoin(client.ID, password)
+}
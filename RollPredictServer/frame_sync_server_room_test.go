@@ -0,0 +1,160 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestNewRoomIDIsInviteCode(t *testing.T) {
+	s := NewServer()
+	for i := 0; i < 1000; i++ {
+		roomID := s.newRoomID()
+		if len(roomID) != roomCodeLength || strings.Trim(roomID, roomCodeAlphabet) != "" {
+			t.Fatalf("room ID %q is not an invite code", roomID)
+		}
+		if _, exists := s.Rooms[roomID]; exists {
+			t.Fatalf("room ID %q reused", roomID)
+		}
+		s.Rooms[roomID] = &Room{ID: roomID}
+	}
+}
+
+// 玩家所在房间的ID，在大厅时为空
+func roomOf(s *Server, c *client.Client) string {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for id, room := range s.Rooms {
+		room.Mutex.Lock()
+		_, inRoom := room.Clients[c.PlayerID]
+		room.Mutex.Unlock()
+		if inRoom {
+			return id
+		}
+	}
+	return ""
+}
+
+// 等待房间信息回复
+func waitForRoomInfo(t *testing.T, c *client.Client) *myproto.RoomInfo {
+	t.Helper()
+	return waitForMessage(t, c, myproto.MessageType_MESSAGE_ROOM_INFO).Body.(*myproto.RoomInfo)
+}
+
+func TestLobbyWithDefaultSettings(t *testing.T) {
+	s, addrs := startTestServer(t, 0)
+	dial := func() *client.Client {
+		return dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	}
+	alice, bob, carol, dave := dial(), dial(), dial(), dial()
+
+	// 默认不自动分配：连接后留在大厅，可以创建和加入私人房间
+	if err := alice.CreateRoom(&myproto.CreateRoomRequest{MaxPlayers: 2, Private: true}); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	created := waitForRoomInfo(t, alice)
+	if created.Error != "" || !slices.Equal(created.PlayerIds, []int32{alice.PlayerID}) {
+		t.Fatalf("created room %v", created)
+	}
+	s.Mutex.Lock()
+	rooms := len(s.Rooms)
+	s.Mutex.Unlock()
+	if rooms != 1 {
+		t.Fatalf("%d rooms, want only alice's", rooms)
+	}
+	if err := bob.JoinRoom(created.RoomId, ""); err != nil {
+		t.Fatalf("join room: %v", err)
+	}
+	for _, c := range []*client.Client{alice, bob} {
+		if gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart); gameStart.RoomId != created.RoomId {
+			t.Fatalf("client %d: game started in room %s", c.PlayerID, gameStart.RoomId)
+		}
+	}
+
+	// 大厅中的玩家可以排队匹配
+	for _, c := range []*client.Client{carol, dave} {
+		if status := joinTestQueue(t, c, "versus", 1); !status.Queued {
+			t.Fatalf("client %d not queued: %v", c.PlayerID, status)
+		}
+	}
+	found := waitForMessage(t, dave, myproto.MessageType_MESSAGE_MATCH_FOUND).Body.(*myproto.MatchFound)
+	if !slices.Equal(found.PlayerIds, []int32{carol.PlayerID, dave.PlayerID}) {
+		t.Fatalf("match %v", found)
+	}
+}
+
+func TestPrivateRoomWithPassword(t *testing.T) {
+	s, addrs := startTestServer(t, 4)
+	dial := func() *client.Client {
+		return dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	}
+	alice := dial()
+	waitFor(t, "alice auto-assigned", func() bool { return roomOf(s, alice) != "" })
+	lobby := roomOf(s, alice)
+
+	// 参数不合法时留在原来的房间
+	if err := alice.CreateRoom(&myproto.CreateRoomRequest{MaxPlayers: maxRoomPlayers + 1}); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	if info := waitForRoomInfo(t, alice); info.Error == "" || roomOf(s, alice) != lobby {
+		t.Fatalf("invalid room created: %v", info)
+	}
+
+	if err := alice.CreateRoom(&myproto.CreateRoomRequest{Name: "friends", MaxPlayers: 2, Private: true, Password: "pw"}); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	created := waitForRoomInfo(t, alice)
+	if created.Error != "" || len(created.RoomId) != roomCodeLength || !created.Private || !created.HasPassword ||
+		created.HostId != alice.PlayerID || !slices.Equal(created.PlayerIds, []int32{alice.PlayerID}) {
+		t.Fatalf("created room %v", created)
+	}
+	code := created.RoomId
+	s.Mutex.Lock()
+	_, lobbyExists := s.Rooms[lobby]
+	s.Mutex.Unlock()
+	if lobbyExists {
+		t.Fatalf("alice's empty old room %s still exists", lobby)
+	}
+
+	// 新连接的玩家不会被自动分配到私人房间
+	bob := dial()
+	waitFor(t, "bob auto-assigned", func() bool { return roomOf(s, bob) != "" })
+	if roomOf(s, bob) == code {
+		t.Fatalf("bob auto-assigned to private room")
+	}
+
+	for _, attempt := range []struct{ code, password string }{{code, "wrong"}, {"NOPE42", "pw"}} {
+		if err := bob.JoinRoom(attempt.code, attempt.password); err != nil {
+			t.Fatalf("join room: %v", err)
+		}
+		if info := waitForRoomInfo(t, bob); info.Error == "" || roomOf(s, bob) == code {
+			t.Fatalf("joined %s with password %q: %v", attempt.code, attempt.password, info)
+		}
+	}
+
+	// 邀请码不区分大小写；房间满员后开局
+	if err := bob.JoinRoom(strings.ToLower(code), "pw"); err != nil {
+		t.Fatalf("join room: %v", err)
+	}
+	for _, c := range []*client.Client{alice, bob} {
+		info := waitForRoomInfo(t, c)
+		if info.RoomId != code || len(info.PlayerIds) != 2 {
+			t.Fatalf("client %d: room info %v", c.PlayerID, info)
+		}
+		if gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart); gameStart.RoomId != code {
+			t.Fatalf("client %d: game started in room %s", c.PlayerID, gameStart.RoomId)
+		}
+	}
+
+	// 开局后不能再加入
+	carol := dial()
+	if err := carol.JoinRoom(code, "pw"); err != nil {
+		t.Fatalf("join room: %v", err)
+	}
+	if info := waitForRoomInfo(t, carol); info.Error != ErrRoomNotWaiting.Error() {
+		t.Fatalf("joined a playing room: %v", info)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 一个可调参数的默认值和取值范围
+type Tunable struct {
+	Default int64 `json:"default"`
+	Min     int64 `json:"min"`
+	Max     int64 `json:"max"`
+}
+
+// 房间游戏设置的校验规则：可选的地图、规则预设和可调参数
+type SettingsSchema struct {
+	Maps          []string                    `json:"maps"`           // 可选地图，第一个为默认地图
+	Presets       map[string]map[string]int64 `json:"presets"`        // 预设名 -> 和默认值不同的参数
+	DefaultPreset string                      `json:"default_preset"` // 没有指定预设时使用的预设
+	Tunables      map[string]Tunable          `json:"tunables"`       // 参数名 -> 默认值和范围
+}
+
+// 默认规则：和客户端当前写死的数值一致
+func DefaultSettingsSchema() *SettingsSchema {
+	return &SettingsSchema{
+		Maps: []string{"default"},
+		Presets: map[string]map[string]int64{
+			"standard": {},
+			"hardcore": {"zombie_spawn_count": 4, "zombie_hp": 150, "barrel_cooldown_ms": 4000},
+			"sandbox":  {"bullet_cooldown_ms": 0, "wall_cooldown_ms": 0, "barrel_cooldown_ms": 0},
+		},
+		DefaultPreset: "standard",
+		Tunables: map[string]Tunable{
+			"barrel_hp":                     {Default: 10, Min: 1, Max: 1000},
+			"barrel_explosion_radius_milli": {Default: 2000, Min: 100, Max: 20000},
+			"barrel_explosion_damage":       {Default: 10, Min: 0, Max: 1000},
+			"barrel_cooldown_ms":            {Default: 2000, Min: 0, Max: 60000},
+			"wall_hp":                       {Default: 50, Min: 1, Max: 1000},
+			"wall_cooldown_ms":              {Default: 2000, Min: 0, Max: 60000},
+			"bullet_cooldown_ms":            {Default: 2000, Min: 0, Max: 60000},
+			"zombie_spawn_count":            {Default: 2, Min: 0, Max: 100},
+			"zombie_hp":                     {Default: 100, Min: 1, Max: 10000},
+			"zombie_move_speed_milli":       {Default: 30, Min: 1, Max: 1000},
+		},
+	}
+}
+
+// 从JSON文件加载规则（格式见 SettingsSchema 的字段标签）
+func LoadSettingsSchema(path string) (*SettingsSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema SettingsSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// 检查规则本身是否合法：至少一个地图，默认值和预设都在取值范围内
+func (schema *SettingsSchema) Validate() error {
+	if len(schema.Maps) == 0 {
+		return fmt.Errorf("at least one map is required")
+	}
+	for name, t := range schema.Tunables {
+		if name == "" {
+			return fmt.Errorf("tunable name must not be empty")
+		}
+		if t.Min > t.Max || t.Default < t.Min || t.Default > t.Max {
+			return fmt.Errorf("tunable %s: default %d not within [%d, %d]", name, t.Default, t.Min, t.Max)
+		}
+	}
+	if _, exists := schema.Presets[schema.DefaultPreset]; !exists && (schema.DefaultPreset != "" || len(schema.Presets) > 0) {
+		return fmt.Errorf("default preset %q is not defined", schema.DefaultPreset)
+	}
+	for name, values := range schema.Presets {
+		if err := schema.checkTunables(values); err != nil {
+			return fmt.Errorf("preset %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// 按规则补全并校验设置：地图和预设为空时使用默认值，
+// 参数表从默认值开始，依次应用预设和请求中的参数
+func (schema *SettingsSchema) Resolve(request *myproto.GameSettings) (*myproto.GameSettings, error) {
+	settings := &myproto.GameSettings{
+		MapId:    request.GetMapId(),
+		Preset:   request.GetPreset(),
+		Tunables: make(map[string]int64, len(schema.Tunables)),
+	}
+	if settings.MapId == "" {
+		settings.MapId = schema.Maps[0]
+	}
+	if !slices.Contains(schema.Maps, settings.MapId) {
+		return nil, fmt.Errorf("unknown map %q", settings.MapId)
+	}
+	if settings.Preset == "" {
+		settings.Preset = schema.DefaultPreset
+	}
+	preset, exists := schema.Presets[settings.Preset]
+	if !exists && settings.Preset != "" {
+		return nil, fmt.Errorf("unknown preset %q", settings.Preset)
+	}
+	if err := schema.checkTunables(request.GetTunables()); err != nil {
+		return nil, err
+	}
+
+	for name, t := range schema.Tunables {
+		settings.Tunables[name] = t.Default
+	}
+	maps.Copy(settings.Tunables, preset)
+	maps.Copy(settings.Tunables, request.GetTunables())
+	return settings, nil
+}
+
+// 默认设置
+func (schema *SettingsSchema) Default() *myproto.GameSettings {
+	settings, err := schema.Resolve(nil)
+	if err != nil {
+		// Validate 通过的规则不会出错
+		panic(err)
+	}
+	return settings
+}
+
+// 检查参数名是否存在、值是否在范围内
+func (schema *SettingsSchema) checkTunables(values map[string]int64) error {
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		t, exists := schema.Tunables[name]
+		if !exists {
+			return fmt.Errorf("unknown tunable %q", name)
+		}
+		if v := values[name]; v < t.Min || v > t.Max {
+			return fmt.Errorf("tunable %s: %d not within [%d, %d]", name, v, t.Min, t.Max)
+		}
+	}
+	return nil
+}
+
+// 处理房主修改游戏设置的请求
+func (s *Server) handleRoomSettings(client *Client, data []byte) {
+	var request myproto.RoomSettings
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal room settings error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Room settings without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.HostID != client.ID {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Only the host can change room settings\n", client.ID)
+		return
+	}
+	if room.Status != "waiting" {
+		status := room.Status
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Ignoring room settings in %s room %s\n", client.ID, status, room.ID)
+		return
+	}
+	settings, err := s.Settings.Resolve(request.Settings)
+	if err != nil {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Invalid room settings: %v\n", client.ID, err)
+		s.sendMessageToClient(client, myproto.MessageType_MESSAGE_ROOM_SETTINGS, &myproto.RoomSettings{Error: err.Error()})
+		return
+	}
+	room.Settings = settings
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Settings changed by host %d (map %s, preset %s)\n", room.ID, client.ID, settings.MapId, settings.Preset)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_ROOM_SETTINGS, &myproto.RoomSettings{Settings: settings})
+}
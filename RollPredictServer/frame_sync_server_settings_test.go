@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestResolveSettings(t *testing.T) {
+	schema := DefaultSettingsSchema()
+	if err := schema.Validate(); err != nil {
+		t.Fatalf("default schema: %v", err)
+	}
+
+	// 默认设置：默认地图和预设，参数表完整
+	settings := schema.Default()
+	if settings.MapId != "default" || settings.Preset != "standard" || len(settings.Tunables) != len(schema.Tunables) {
+		t.Fatalf("default settings %v", settings)
+	}
+	if settings.Tunables["zombie_hp"] != 100 || settings.Tunables["barrel_explosion_radius_milli"] != 2000 {
+		t.Fatalf("default tunables %v", settings.Tunables)
+	}
+
+	// 请求的参数覆盖预设，预设覆盖默认值
+	settings, err := schema.Resolve(&myproto.GameSettings{Preset: "hardcore", Tunables: map[string]int64{"zombie_hp": 200}})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if settings.Tunables["zombie_hp"] != 200 || settings.Tunables["zombie_spawn_count"] != 4 || settings.Tunables["wall_hp"] != 50 {
+		t.Fatalf("hardcore tunables %v", settings.Tunables)
+	}
+
+	for name, request := range map[string]*myproto.GameSettings{
+		"unknown map":     {MapId: "moon"},
+		"unknown preset":  {Preset: "chaos"},
+		"unknown tunable": {Tunables: map[string]int64{"gravity": 1}},
+		"below minimum":   {Tunables: map[string]int64{"zombie_hp": 0}},
+		"above maximum":   {Tunables: map[string]int64{"bullet_cooldown_ms": 60001}},
+	} {
+		if _, err := schema.Resolve(request); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+}
+
+func TestLoadSettingsSchema(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	schema, err := LoadSettingsSchema(write("mod.json", `{
+		"maps": ["arena", "maze"],
+		"presets": {"normal": {}, "fast": {"speed": 5}},
+		"default_preset": "normal",
+		"tunables": {"speed": {"default": 1, "min": 1, "max": 10}}
+	}`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings := schema.Default(); settings.MapId != "arena" || settings.Tunables["speed"] != 1 {
+		t.Fatalf("default settings %v", settings)
+	}
+
+	for name, content := range map[string]string{
+		"no maps":              `{"tunables": {}}`,
+		"default out of range": `{"maps": ["a"], "tunables": {"speed": {"default": 0, "min": 1, "max": 10}}}`,
+		"missing preset":       `{"maps": ["a"], "presets": {"normal": {}}, "default_preset": "fast"}`,
+		"bad preset value":     `{"maps": ["a"], "presets": {"p": {"speed": 11}}, "default_preset": "p", "tunables": {"speed": {"default": 1, "min": 1, "max": 10}}}`,
+		"malformed":            `{"maps": `,
+	} {
+		if _, err := LoadSettingsSchema(write("bad.json", content)); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRoomSettingsInGameStart(t *testing.T) {
+	s, addrs := startTestServer(t, 2)
+	host := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	waitFor(t, "host in room", func() bool {
+		s.Mutex.Lock()
+		defer s.Mutex.Unlock()
+		return len(s.Rooms) == 1
+	})
+
+	// 不合法的请求只回复房主错误原因，设置不变
+	if err := host.ChangeSettings(&myproto.GameSettings{Tunables: map[string]int64{"zombie_hp": -1}}); err != nil {
+		t.Fatalf("change settings: %v", err)
+	}
+	if reply := waitForMessage(t, host, myproto.MessageType_MESSAGE_ROOM_SETTINGS).Body.(*myproto.RoomSettings); reply.Error == "" || reply.Settings != nil {
+		t.Fatalf("invalid settings reply %v", reply)
+	}
+
+	if err := host.ChangeSettings(&myproto.GameSettings{Preset: "sandbox", Tunables: map[string]int64{"zombie_spawn_count": 10}}); err != nil {
+		t.Fatalf("change settings: %v", err)
+	}
+	changed := waitForMessage(t, host, myproto.MessageType_MESSAGE_ROOM_SETTINGS).Body.(*myproto.RoomSettings).Settings
+	if changed.Preset != "sandbox" || changed.Tunables["zombie_spawn_count"] != 10 || changed.Tunables["wall_cooldown_ms"] != 0 {
+		t.Fatalf("changed settings %v", changed)
+	}
+
+	// 第二个玩家加入后开局，开局消息带上完整的设置
+	other := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	for _, c := range []*client.Client{host, other} {
+		gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+		settings := gameStart.Settings
+		if settings.GetMapId() != "default" || settings.Preset != "sandbox" || len(settings.Tunables) != len(s.Settings.Tunables) ||
+			settings.Tunables["zombie_spawn_count"] != 10 || settings.Tunables["zombie_hp"] != 100 {
+			t.Fatalf("client %d: game start settings %v", c.PlayerID, settings)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// 校验房间的队伍数（0表示不分队）
+func validateTeamCount(teams, maxPlayers int32) error {
+	if teams < 0 || teams > maxPlayers {
+		return fmt.Errorf("team count must be between 0 and max players (%d), got %d", maxPlayers, teams)
+	}
+	return nil
+}
+
+// 处理房主的分队请求
+func (s *Server) handleTeamAssignment(client *Client, data []byte) {
+	var request myproto.TeamAssignment
+	if err := proto.Unmarshal(data, &request); err != nil {
+		log.Printf("Client %d: Unmarshal team assignment error: %v\n", client.ID, err)
+		return
+	}
+	room := s.clientRoom(client)
+	if room == nil {
+		log.Printf("Client %d: Team assignment without room\n", client.ID)
+		return
+	}
+
+	room.Mutex.Lock()
+	if room.HostID != client.ID {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Only the host can assign teams\n", client.ID)
+		return
+	}
+	if room.Status != "waiting" {
+		status := room.Status
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Ignoring team assignment in %s room %s\n", client.ID, status, room.ID)
+		return
+	}
+	if err := room.assignTeams(request.Roster); err != nil {
+		room.Mutex.Unlock()
+		log.Printf("Client %d: Invalid team assignment: %v\n", client.ID, err)
+		return
+	}
+	roster := room.sortedRoster()
+	clients := room.clientList()
+	room.Mutex.Unlock()
+
+	fmt.Printf("Room %s: Teams assigned by host %d\n", room.ID, client.ID)
+	s.broadcast(clients, myproto.MessageType_MESSAGE_TEAM_ASSIGN, &myproto.TeamAssignment{Roster: roster})
+}
+
+// 修改部分玩家的队伍和槽位；同一队伍内的槽位不能重复，任何一项不合法时不做修改（调用方持有房间锁）
+func (room *Room) assignTeams(entries []*myproto.RosterEntry) error {
+	updated := maps.Clone(room.roster)
+	if updated == nil {
+		updated = make(map[int32]*myproto.RosterEntry)
+	}
+	for _, e := range entries {
+		if _, inRoom := room.Clients[e.PlayerId]; !inRoom {
+			return fmt.Errorf("player %d is not in room %s", e.PlayerId, room.ID)
+		}
+		if (room.TeamCount == 0 && e.Team != 0) || (room.TeamCount > 0 && (e.Team < 1 || e.Team > room.TeamCount)) {
+			return fmt.Errorf("player %d: team %d out of range (room has %d teams)", e.PlayerId, e.Team, room.TeamCount)
+		}
+		if e.Slot < 0 || e.Slot >= room.MaxPlayers {
+			return fmt.Errorf("player %d: slot %d out of range", e.PlayerId, e.Slot)
+		}
+		updated[e.PlayerId] = &myproto.RosterEntry{PlayerId: e.PlayerId, Team: e.Team, Slot: e.Slot}
+	}
+
+	taken := make(map[[2]int32]int32)
+	for _, id := range slices.Sorted(maps.Keys(updated)) {
+		e := updated[id]
+		key := [2]int32{e.Team, e.Slot}
+		if other, dup := taken[key]; dup {
+			return fmt.Errorf("players %d and %d both in team %d slot %d", other, id, e.Team, e.Slot)
+		}
+		taken[key] = id
+	}
+	room.roster = updated
+	return nil
+}
+
+// 开局前补全名单：去掉已经离开的玩家，没有分队的玩家按ID顺序加入人数最少的队伍，
+// 并使用队伍内最小的空闲槽位（调用方持有房间锁）
+func (room *Room) completeRoster() []*myproto.RosterEntry {
+	for id := range room.roster {
+		if _, inRoom := room.Clients[id]; !inRoom {
+			delete(room.roster, id)
+		}
+	}
+	if room.roster == nil {
+		room.roster = make(map[int32]*myproto.RosterEntry)
+	}
+
+	members := make(map[int32]int)
+	taken := make(map[[2]int32]bool)
+	for _, e := range room.roster {
+		members[e.Team]++
+		taken[[2]int32{e.Team, e.Slot}] = true
+	}
+	for _, id := range slices.Sorted(maps.Keys(room.Clients)) {
+		if _, assigned := room.roster[id]; assigned {
+			continue
+		}
+		team := int32(0)
+		if room.TeamCount > 0 {
+			team = 1
+			for t := int32(2); t <= room.TeamCount; t++ {
+				if members[t] < members[team] {
+					team = t
+				}
+			}
+		}
+		slot := int32(0)
+		for taken[[2]int32{team, slot}] {
+			slot++
+		}
+		room.roster[id] = &myproto.RosterEntry{PlayerId: id, Team: team, Slot: slot}
+		members[team]++
+		taken[[2]int32{team, slot}] = true
+	}
+	return room.sortedRoster()
+}
+
+// 按队伍、槽位、玩家ID排序的名单副本，带上玩家名称和账号（调用方持有房间锁）
+func (room *Room) sortedRoster() []*myproto.RosterEntry {
+	roster := make([]*myproto.RosterEntry, 0, len(room.roster))
+	for id, e := range room.roster {
+		entry := &myproto.RosterEntry{PlayerId: id, Team: e.Team, Slot: e.Slot}
+		if c, inRoom := room.Clients[id]; inRoom {
+			if account := c.Account(); account != nil {
+				entry.Name = account.Name
+				entry.AccountId = account.AccountId
+			}
+		}
+		roster = append(roster, entry)
+	}
+	slices.SortFunc(roster, func(a, b *myproto.RosterEntry) int {
+		return cmp.Or(cmp.Compare(a.Team, b.Team), cmp.Compare(a.Slot, b.Slot), cmp.Compare(a.PlayerId, b.PlayerId))
+	})
+	return roster
+}
+
+// 玩家ID -> 队伍（调用方持有房间锁）
+func (room *Room) teamOf() map[int32]int32 {
+	teams := make(map[int32]int32, len(room.roster))
+	for id, e := range room.roster {
+		teams[id] = e.Team
+	}
+	return teams
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/WjcHome/gohello/client"
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestAssignTeamsValidation(t *testing.T) {
+	s := NewServer()
+	room := s.newRoom("1", 1, RoomOptions{MaxPlayers: 4, Teams: 2})
+	for id := int32(1); id <= 3; id++ {
+		room.Clients[id] = &Client{ID: id}
+	}
+	entry := func(id, team, slot int32) *myproto.RosterEntry {
+		return &myproto.RosterEntry{PlayerId: id, Team: team, Slot: slot}
+	}
+
+	if err := room.assignTeams([]*myproto.RosterEntry{entry(1, 2, 0), entry(2, 1, 0)}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	// 任何一项不合法时整个请求不生效
+	for name, entries := range map[string][]*myproto.RosterEntry{
+		"not in room":    {entry(3, 1, 1), entry(9, 1, 2)},
+		"team too large": {entry(3, 3, 0)},
+		"team zero":      {entry(3, 0, 0)},
+		"slot too large": {entry(3, 1, 4)},
+		"slot taken":     {entry(3, 2, 0)},
+	} {
+		if err := room.assignTeams(entries); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+	if _, assigned := room.roster[3]; assigned || room.roster[1].Team != 2 {
+		t.Fatalf("roster changed by invalid request: %v", room.roster)
+	}
+	// 交换队伍：按整体结果检查槽位冲突
+	if err := room.assignTeams([]*myproto.RosterEntry{entry(1, 1, 0), entry(2, 2, 0)}); err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+
+	// 不分队的房间只接受队伍0
+	free := s.newRoom("2", 1, RoomOptions{MaxPlayers: 2})
+	free.Clients[1] = &Client{ID: 1}
+	if err := free.assignTeams([]*myproto.RosterEntry{entry(1, 1, 0)}); err == nil {
+		t.Fatalf("team accepted in room without teams")
+	}
+	if err := validateTeamCount(3, 2); err == nil {
+		t.Fatalf("more teams than players accepted")
+	}
+}
+
+func TestCompleteRosterBalancesTeams(t *testing.T) {
+	s := NewServer()
+	room := s.newRoom("1", 1, RoomOptions{MaxPlayers: 6, Teams: 2})
+	for id := int32(1); id <= 5; id++ {
+		room.Clients[id] = &Client{ID: id}
+	}
+	// 2、4 已在队伍1，1 在队伍2的槽位1；9 已经离开
+	room.roster = map[int32]*myproto.RosterEntry{
+		2: {PlayerId: 2, Team: 1, Slot: 0},
+		4: {PlayerId: 4, Team: 1, Slot: 2},
+		1: {PlayerId: 1, Team: 2, Slot: 1},
+		9: {PlayerId: 9, Team: 2, Slot: 0},
+	}
+
+	type placement struct{ id, team, slot int32 }
+	var got []placement
+	for _, e := range room.completeRoster() {
+		got = append(got, placement{e.PlayerId, e.Team, e.Slot})
+	}
+	// 3 加入人数少的队伍2，使用空出的槽位0；之后两队人数相同，5 加入队伍1的槽位1
+	want := []placement{{2, 1, 0}, {5, 1, 1}, {4, 1, 2}, {3, 2, 0}, {1, 2, 1}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("roster = %v, want %v", got, want)
+	}
+}
+
+func TestTeamAssignmentInGameStart(t *testing.T) {
+	s, addrs := startTestServer(t, 4)
+	var clients []*client.Client
+	for i := 0; i < 3; i++ {
+		clients = append(clients, dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP]))
+	}
+	host, other := clients[0], clients[1]
+
+	waitFor(t, "players in one room", func() bool {
+		s.Mutex.Lock()
+		defer s.Mutex.Unlock()
+		return len(s.Rooms) == 1
+	})
+	s.Mutex.Lock()
+	var room *Room
+	for _, r := range s.Rooms {
+		room = r
+	}
+	s.Mutex.Unlock()
+	room.Mutex.Lock()
+	room.TeamCount = 2
+	room.Mutex.Unlock()
+
+	// 非房主的请求被忽略
+	if err := other.AssignTeams(&myproto.RosterEntry{PlayerId: other.PlayerID, Team: 1}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if err := host.AssignTeams(
+		&myproto.RosterEntry{PlayerId: host.PlayerID, Team: 2, Slot: 0},
+		&myproto.RosterEntry{PlayerId: other.PlayerID, Team: 2, Slot: 1},
+	); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	assignment := waitForMessage(t, clients[2], myproto.MessageType_MESSAGE_TEAM_ASSIGN).Body.(*myproto.TeamAssignment)
+	if len(assignment.Roster) != 2 || assignment.Roster[0].PlayerId != host.PlayerID || assignment.Roster[1].Team != 2 {
+		t.Fatalf("assignment %v", assignment.Roster)
+	}
+
+	// 第四个玩家加入后开局，没有分队的玩家补到队伍1
+	clients = append(clients, dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP]))
+	gameStart := waitForMessage(t, host, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+	if gameStart.TeamCount != 2 || len(gameStart.Roster) != 4 {
+		t.Fatalf("game start %v", gameStart)
+	}
+	want := []int32{clients[2].PlayerID, clients[3].PlayerID, host.PlayerID, other.PlayerID}
+	for i, e := range gameStart.Roster {
+		if e.PlayerId != want[i] || e.Team != int32(1+i/2) || e.Slot != int32(i%2) {
+			t.Fatalf("roster[%d] = %v", i, e)
+		}
+	}
+	if !slices.Equal(gameStart.PlayerIds, want) {
+		t.Fatalf("player ids %v, want roster order %v", gameStart.PlayerIds, want)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WjcHome/gohello/client"
+	"github.com/WjcHome/gohello/codec"
+	myproto "github.com/WjcHome/gohello/proto"
+	"github.com/xtaci/kcp-go/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const testTimeout = 5 * time.Second
+
+// 在临时端口上同时启动TCP、UDP和KCP服务，返回服务器和各协议地址。
+// configure 在服务启动前修改服务器配置
+func startTestServer(t *testing.T, maxPlayers int32, configure ...func(*Server)) (*Server, map[string]string) {
+	t.Helper()
+
+	s := NewServer()
+	// maxPlayers 为 0 时使用默认设置：玩家连接后留在大厅
+	if maxPlayers > 0 {
+		s.MaxPlayers = maxPlayers
+		s.AutoAssign = true
+	}
+	for _, f := range configure {
+		f(s)
+	}
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	kcpListener, err := kcp.ListenWithOptions("127.0.0.1:0", nil, 0, 0)
+	if err != nil {
+		t.Fatalf("listen kcp: %v", err)
+	}
+
+	go s.ServeTCP(tcpListener)
+	go s.ServeUDP(udpConn)
+	go s.ServeKCP(kcpListener)
+
+	t.Cleanup(func() {
+		tcpListener.Close()
+		udpConn.Close()
+		kcpListener.Close()
+	})
+
+	return s, map[string]string{
+		client.ProtocolTCP: tcpListener.Addr().String(),
+		client.ProtocolUDP: udpConn.LocalAddr().String(),
+		client.ProtocolKCP: kcpListener.Addr().String(),
+	}
+}
+
+// 连接一个测试客户端，测试结束时自动关闭
+func dialTestClient(t *testing.T, protocol, addr string) *client.Client {
+	t.Helper()
+	c, err := client.Dial(protocol, addr)
+	if err != nil {
+		t.Fatalf("dial %s %s: %v", protocol, addr, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// 等待指定类型的消息，忽略其他消息
+func waitForMessage(t *testing.T, c *client.Client, messageType myproto.MessageType) *client.Message {
+	t.Helper()
+	timer := time.NewTimer(testTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("client %d: connection closed while waiting for %v: %v", c.PlayerID, messageType, c.Err())
+			}
+			if msg.Type == messageType {
+				return msg
+			}
+		case <-timer.C:
+			t.Fatalf("client %d: timed out waiting for %v", c.PlayerID, messageType)
+		}
+	}
+}
+
+// 收集前 n 个服务器帧
+func collectFrames(t *testing.T, c *client.Client, n int) []*myproto.ServerFrame {
+	t.Helper()
+	frames := make([]*myproto.ServerFrame, 0, n)
+	for len(frames) < n {
+		msg := waitForMessage(t, c, myproto.MessageType_MESSAGE_SERVER_FRAME)
+		frames = append(frames, msg.Body.(*myproto.ServerFrame))
+	}
+	return frames
+}
+
+// 轮询等待条件成立
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sortedIDs(ids []int32) []int32 {
+	result := slices.Clone(ids)
+	slices.Sort(result)
+	return result
+}
+
+func TestFrameSyncAcrossTransports(t *testing.T) {
+	const frameCount = 15
+
+	cases := map[string][]string{
+		"tcp":   {client.ProtocolTCP, client.ProtocolTCP, client.ProtocolTCP},
+		"udp":   {client.ProtocolUDP, client.ProtocolUDP, client.ProtocolUDP},
+		"kcp":   {client.ProtocolKCP, client.ProtocolKCP, client.ProtocolKCP},
+		"mixed": {client.ProtocolTCP, client.ProtocolUDP, client.ProtocolKCP},
+	}
+
+	for name, protocols := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, addrs := startTestServer(t, int32(len(protocols)))
+
+			clients := make([]*client.Client, len(protocols))
+			playerIDs := make([]int32, len(protocols))
+			for i, protocol := range protocols {
+				clients[i] = dialTestClient(t, protocol, addrs[protocol])
+				playerIDs[i] = clients[i].PlayerID
+			}
+
+			// 所有客户端收到相同的游戏开始消息
+			var first *myproto.GameStart
+			for _, c := range clients {
+				gameStart := waitForMessage(t, c, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart)
+				if first == nil {
+					first = gameStart
+					continue
+				}
+				if gameStart.RoomId != first.RoomId || gameStart.RandomSeed != first.RandomSeed {
+					t.Fatalf("client %d got GameStart %v, want %v", c.PlayerID, gameStart, first)
+				}
+			}
+			if got, want := sortedIDs(first.PlayerIds), sortedIDs(playerIDs); !slices.Equal(got, want) {
+				t.Fatalf("GameStart player ids = %v, want %v", got, want)
+			}
+
+			// 每个客户端发送一条输入
+			for i, c := range clients {
+				if err := c.SendInput(&myproto.FrameData{
+					PlayerId:    c.PlayerID,
+					Direction:   myproto.InputDirection(i + 1),
+					FrameNumber: 1,
+				}); err != nil {
+					t.Fatalf("send input: %v", err)
+				}
+			}
+
+			// 帧号从1开始连续，且所有客户端收到的帧完全相同
+			sequences := make([][]*myproto.ServerFrame, len(clients))
+			for i, c := range clients {
+				sequences[i] = collectFrames(t, c, frameCount)
+				for j, frame := range sequences[i] {
+					if frame.FrameNumber != int64(j+1) {
+						t.Fatalf("client %d frame %d has number %d, want %d", c.PlayerID, j, frame.FrameNumber, j+1)
+					}
+				}
+			}
+			for i := 1; i < len(sequences); i++ {
+				for j := range sequences[i] {
+					if !proto.Equal(sequences[i][j], sequences[0][j]) {
+						t.Fatalf("client %d frame %d differs from client %d:\n got %v\nwant %v",
+							clients[i].PlayerID, j+1, clients[0].PlayerID, sequences[i][j], sequences[0][j])
+					}
+				}
+			}
+
+			// 每条输入在帧序列中恰好出现一次
+			seen := make(map[int32]int)
+			for _, frame := range sequences[0] {
+				for _, frameData := range frame.FrameDatas {
+					seen[frameData.PlayerId]++
+				}
+			}
+			for _, id := range playerIDs {
+				if seen[id] != 1 {
+					t.Errorf("input of player %d appeared %d times, want 1", id, seen[id])
+				}
+			}
+
+			// 补帧请求返回与已收到的帧一致的连续帧
+			const lastConfirmed = 5
+			if err := clients[0].RequestFrames(lastConfirmed); err != nil {
+				t.Fatalf("request frames: %v", err)
+			}
+			resent := waitForMessage(t, clients[0], myproto.MessageType_MESSAGE_FRAME_NEED).Body.(*myproto.SendAllFrame)
+			if len(resent.AllNeedFrame) < frameCount-lastConfirmed {
+				t.Fatalf("got %d resent frames, want at least %d", len(resent.AllNeedFrame), frameCount-lastConfirmed)
+			}
+			for i, frame := range resent.AllNeedFrame {
+				want := int64(lastConfirmed + 1 + i)
+				if frame.FrameNumber != want {
+					t.Fatalf("resent frame %d has number %d, want %d", i, frame.FrameNumber, want)
+				}
+				if want <= frameCount && !proto.Equal(frame, sequences[0][want-1]) {
+					t.Fatalf("resent frame %d differs from original", want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleFrameLossReturnsRequestedRange(t *testing.T) {
+	const currentFrame = 10
+
+	cases := []struct {
+		name          string
+		lastConfirmed int64
+		wantFirst     int64 // 0 表示不应补发任何帧
+		wantLast      int64
+	}{
+		{"middle", 4, 5, 10},
+		{"from start", 0, 1, 10},
+		{"negative", -3, 1, 10},
+		{"latest missing", 9, 10, 10},
+		{"up to date", 10, 0, 0},
+		{"ahead of server", 15, 0, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer()
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			c := &Client{ID: 1, Conn: serverConn, RoomID: "1"}
+			room := &Room{
+				ID:          "1",
+				Clients:     map[int32]*Client{c.ID: c},
+				Status:      "playing",
+				FrameNumber: currentFrame,
+			}
+			for i := int64(1); i <= currentFrame; i++ {
+				room.HistoryFrames = append(room.HistoryFrames, &myproto.ServerFrame{FrameNumber: i})
+			}
+			s.Rooms[room.ID] = room
+
+			request, _ := proto.Marshal(&myproto.GetLossFrame{LastFrameNumber: tc.lastConfirmed})
+			done := make(chan struct{})
+			go func() {
+				s.handleFrameLoss(c, request)
+				close(done)
+			}()
+
+			clientConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			messageType, data, err := codec.ReadMessage(clientConn, codec.ServerToClient)
+			if tc.wantFirst == 0 {
+				if err == nil {
+					t.Fatalf("got unexpected %v reply", messageType)
+				}
+				<-done
+				return
+			}
+			if err != nil {
+				t.Fatalf("read reply: %v", err)
+			}
+			<-done
+
+			if messageType != myproto.MessageType_MESSAGE_FRAME_NEED {
+				t.Fatalf("reply type = %v, want MESSAGE_FRAME_NEED", messageType)
+			}
+			var reply myproto.SendAllFrame
+			if err := proto.Unmarshal(data, &reply); err != nil {
+				t.Fatalf("unmarshal reply: %v", err)
+			}
+			if got, want := len(reply.AllNeedFrame), int(tc.wantLast-tc.wantFirst+1); got != want {
+				t.Fatalf("got %d frames, want %d", got, want)
+			}
+			for i, frame := range reply.AllNeedFrame {
+				if frame.FrameNumber != tc.wantFirst+int64(i) {
+					t.Fatalf("frame %d has number %d, want %d", i, frame.FrameNumber, tc.wantFirst+int64(i))
+				}
+			}
+		})
+	}
+}
+
+func TestHandleClientDisconnectReassignsHost(t *testing.T) {
+	s := NewServer()
+	clients := []*Client{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	// 房间上限大于玩家数，避免自动开局
+	roomID, err := s.CreateRoom(clients[0], RoomOptions{MaxPlayers: 4})
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	for _, c := range clients[1:] {
+		if err := s.JoinRoom(c, roomID, ""); err != nil {
+			t.Fatalf("client %d failed to join room %s: %v", c.ID, roomID, err)
+		}
+	}
+	room := s.Rooms[roomID]
+
+	checkHost := func() {
+		t.Helper()
+		host, ok := room.Clients[room.HostID]
+		if !ok {
+			t.Fatalf("host %d is not in the room", room.HostID)
+		}
+		hosts := 0
+		for _, c := range room.Clients {
+			if c.IsHost {
+				hosts++
+			}
+		}
+		if !host.IsHost || hosts != 1 {
+			t.Fatalf("expected exactly one host (client %d), found %d", room.HostID, hosts)
+		}
+	}
+
+	// 非房主离开，房主不变
+	s.handleClientDisconnect(clients[2])
+	if room.HostID != clients[0].ID {
+		t.Fatalf("host changed to %d after non-host left", room.HostID)
+	}
+	if clients[2].RoomID != "" {
+		t.Fatalf("disconnected client still has room %q", clients[2].RoomID)
+	}
+	checkHost()
+
+	// 房主离开，剩下的玩家成为房主
+	s.handleClientDisconnect(clients[0])
+	if room.HostID != clients[1].ID {
+		t.Fatalf("host = %d, want %d", room.HostID, clients[1].ID)
+	}
+	if clients[0].IsHost {
+		t.Fatalf("old host still marked as host")
+	}
+	checkHost()
+
+	// 最后一个玩家离开，房间被删除
+	s.handleClientDisconnect(clients[1])
+	if _, exists := s.Rooms[roomID]; exists {
+		t.Fatalf("room %s still exists after last client left", roomID)
+	}
+}
+
+func TestClientDisconnectDuringGame(t *testing.T) {
+	s, addrs := startTestServer(t, 2)
+
+	host := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	other := dialTestClient(t, client.ProtocolKCP, addrs[client.ProtocolKCP])
+	roomID := waitForMessage(t, host, myproto.MessageType_MESSAGE_GAME_START).Body.(*myproto.GameStart).RoomId
+	waitForMessage(t, other, myproto.MessageType_MESSAGE_GAME_START)
+	collectFrames(t, other, 3)
+
+	if err := host.Disconnect(); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+
+	s.Mutex.Lock()
+	room := s.Rooms[roomID]
+	s.Mutex.Unlock()
+	waitFor(t, "host to leave the room", func() bool {
+		room.Mutex.Lock()
+		defer room.Mutex.Unlock()
+		_, stillThere := room.Clients[host.PlayerID]
+		return !stillThere && room.HostID == other.PlayerID
+	})
+
+	// 剩下的玩家继续收到连续的帧
+	frames := collectFrames(t, other, 5)
+	for i := 1; i < len(frames); i++ {
+		if frames[i].FrameNumber != frames[i-1].FrameNumber+1 {
+			t.Fatalf("frame numbers not consecutive after disconnect: %d then %d",
+				frames[i-1].FrameNumber, frames[i].FrameNumber)
+		}
+	}
+
+	// 所有玩家离开后房间被删除
+	other.Disconnect()
+	waitFor(t, "room to be deleted", func() bool {
+		s.Mutex.Lock()
+		defer s.Mutex.Unlock()
+		_, exists := s.Rooms[roomID]
+		return !exists
+	})
+}
+
+func TestMalformedMessagesAreRejected(t *testing.T) {
+	s, addrs := startTestServer(t, 2)
+
+	// 非法UDP数据报不会创建客户端或房间
+	udpConn, err := net.Dial("udp", addrs[client.ProtocolUDP])
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	defer udpConn.Close()
+	for _, datagram := range [][]byte{
+		{0, 0, 0, 0, byte(myproto.MessageType_MESSAGE_HEARTBEAT)}, // 零长度
+		{0, 0, 0, 9, byte(myproto.MessageType_MESSAGE_HEARTBEAT)}, // 长度与数据报不符
+		{0, 0, 0, 1, 200}, // 未知类型
+		{0, 0, 0, 1, byte(myproto.MessageType_MESSAGE_GAME_START)}, // 服务器专用类型
+	} {
+		udpConn.Write(datagram)
+	}
+	time.Sleep(200 * time.Millisecond)
+	s.Mutex.Lock()
+	rooms := len(s.Rooms)
+	s.Mutex.Unlock()
+	if rooms != 0 {
+		t.Fatalf("malformed datagrams created %d rooms", rooms)
+	}
+
+	// TCP客户端发送未知类型的消息后被断开
+	c := dialTestClient(t, client.ProtocolTCP, addrs[client.ProtocolTCP])
+	if err := c.Send(myproto.MessageType(200), &myproto.Heartbeat{}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	timer := time.NewTimer(testTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-c.Messages():
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			t.Fatalf("server did not close connection after unknown message type")
+		}
+	}
+}
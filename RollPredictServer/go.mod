@@ -2,14 +2,17 @@ module github.com/WjcHome/gohello
 
 go 1.24.5
 
-require google.golang.org/protobuf v1.34.1
+require (
+	github.com/xtaci/kcp-go/v5 v5.6.61
+	go.etcd.io/bbolt v1.4.3
+	google.golang.org/protobuf v1.34.1
+)
 
 require (
 	github.com/klauspost/cpuid/v2 v2.2.6 // indirect
 	github.com/klauspost/reedsolomon v1.12.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/tjfoc/gmsm v1.4.1 // indirect
-	github.com/xtaci/kcp-go/v5 v5.6.61 // indirect
 	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
@@ -0,0 +1,153 @@
+package netsim
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 是链路使用的时间。除了真实时间，还可以加速（ScaledClock）或者完全由测试控制（VirtualClock），
+// 这样测试可以使用真实的延迟参数而不用等那么久
+type Clock interface {
+	Now() time.Time
+	// NewTimer 创建在时钟经过 d 之后触发的定时器
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer 是 Clock 创建的定时器，ResetAt 和 Stop 之后不会收到旧的触发
+type Timer interface {
+	C() <-chan time.Time
+	// ResetAt 让定时器在时钟到达 at 时触发，at 已经过去时立即触发。
+	// 用绝对时间而不是时长：计算 at 之后时钟可能已经前进了（VirtualClock.Advance）
+	ResetAt(at time.Time)
+	Stop()
+}
+
+// RealClock 是真实时间
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ timer *time.Timer }
+
+func (t realTimer) C() <-chan time.Time  { return t.timer.C }
+func (t realTimer) ResetAt(at time.Time) { t.timer.Reset(time.Until(at)) }
+func (t realTimer) Stop()                { t.timer.Stop() }
+
+// ScaledClock 是加速的真实时间：真实时间每过 1 秒，时钟走 Speed 秒
+type ScaledClock struct {
+	speed  float64
+	origin time.Time
+}
+
+// NewScaledClock 创建从现在开始按 speed 倍速运行的时钟
+func NewScaledClock(speed float64) *ScaledClock {
+	return &ScaledClock{speed: speed, origin: time.Now()}
+}
+
+// Now 返回加速后的时间
+func (c *ScaledClock) Now() time.Time {
+	return c.origin.Add(time.Duration(float64(time.Since(c.origin)) * c.speed))
+}
+
+// NewTimer 创建在真实时间 d/speed 之后触发的定时器
+func (c *ScaledClock) NewTimer(d time.Duration) Timer {
+	return scaledTimer{time.NewTimer(c.real(d)), c}
+}
+
+func (c *ScaledClock) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.speed)
+}
+
+type scaledTimer struct {
+	timer *time.Timer
+	clock *ScaledClock
+}
+
+func (t scaledTimer) C() <-chan time.Time  { return t.timer.C }
+func (t scaledTimer) ResetAt(at time.Time) { t.timer.Reset(t.clock.real(at.Sub(t.clock.Now()))) }
+func (t scaledTimer) Stop()                { t.timer.Stop() }
+
+// VirtualClock 是只在调用 Advance 时前进的时钟，可以并发调用
+type VirtualClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*virtualTimer
+}
+
+// NewVirtualClock 创建从 start 开始的虚拟时钟
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now 返回当前的虚拟时间
+func (c *VirtualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance 让时钟前进 d，触发到期的定时器
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.at.After(c.now) {
+			t.active = false
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+// NewTimer 创建在虚拟时间经过 d 之后触发的定时器
+func (c *VirtualClock) NewTimer(d time.Duration) Timer {
+	t := &virtualTimer{clock: c, c: make(chan time.Time, 1)}
+	c.mutex.Lock()
+	c.timers = append(c.timers, t)
+	at := c.now.Add(d)
+	c.mutex.Unlock()
+	t.ResetAt(at)
+	return t
+}
+
+type virtualTimer struct {
+	clock  *VirtualClock
+	c      chan time.Time
+	at     time.Time
+	active bool
+}
+
+func (t *virtualTimer) C() <-chan time.Time { return t.c }
+
+func (t *virtualTimer) ResetAt(at time.Time) {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.drain()
+	t.at, t.active = at, true
+	if !at.After(t.clock.now) {
+		t.active = false
+		t.c <- t.clock.now
+	}
+}
+
+func (t *virtualTimer) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.drain()
+	t.active = false
+}
+
+// 丢掉还没有读取的触发（调用方持有时钟的锁）
+func (t *virtualTimer) drain() {
+	select {
+	case <-t.c:
+	default:
+	}
+}
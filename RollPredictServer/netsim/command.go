@@ -0,0 +1,245 @@
+package netsim
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 运行时控制命令（控制接口和场景文件使用同一种写法）：
+//
+//	[目标] set <参数> <值> [up|down]   修改参数
+//	[目标] blackout <时长> [up|down]   立即断网一段时间
+//	[目标] reset [up|down]             恢复启动时的参数
+//	[目标] drop <规则> [up|down]       添加丢包规则
+//	drop clear                         删除所有丢包规则
+//	end                                结束（只用于场景文件）
+//
+// 目标由使用者定义（网络模拟器中是端口 tcp、udp、kcp），省略时作用于全部；
+// up 是客户端->服务器方向，down 是服务器->客户端方向，省略时两个方向都修改。
+// set 支持的参数见 SetParam，规则的写法见 Rule；drop 的目标和方向记录在 Rule 中。
+type Command struct {
+	Target    string
+	Action    string // set、blackout、reset、drop 或 end
+	Param     string // set 的参数名，drop clear 时为 clear
+	Value     string // set 的值
+	Duration  time.Duration
+	Direction string // up、down，为空时两个方向
+	Rule      Rule   // drop 添加的规则
+}
+
+// 命令名称
+const (
+	ActionSet      = "set"
+	ActionBlackout = "blackout"
+	ActionReset    = "reset"
+	ActionDrop     = "drop"
+	ActionEnd      = "end"
+)
+
+// ParseCommand 解析一条命令
+func ParseCommand(s string) (Command, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Command{}, fmt.Errorf("empty command")
+	}
+	var c Command
+	if !isAction(fields[0]) {
+		if fields[0] == "up" || fields[0] == "down" {
+			return Command{}, fmt.Errorf("direction goes after the command in %q", s)
+		}
+		c.Target, fields = fields[0], fields[1:]
+		if len(fields) == 0 {
+			return Command{}, fmt.Errorf("missing action in %q", s)
+		}
+	}
+	c.Action, fields = fields[0], fields[1:]
+	if !isAction(c.Action) {
+		return Command{}, fmt.Errorf("unknown action %q in %q", c.Action, s)
+	}
+	if n := len(fields); n > 0 && (fields[n-1] == "up" || fields[n-1] == "down") {
+		c.Direction, fields = fields[n-1], fields[:n-1]
+	}
+
+	switch c.Action {
+	case ActionSet:
+		if len(fields) != 2 {
+			return Command{}, fmt.Errorf("want set <param> <value> in %q", s)
+		}
+		c.Param, c.Value = fields[0], fields[1]
+		if _, err := SetParam(Profile{}, c.Param, c.Value); err != nil {
+			return Command{}, err
+		}
+	case ActionBlackout:
+		if len(fields) != 1 {
+			return Command{}, fmt.Errorf("want blackout <duration> in %q", s)
+		}
+		d, err := parseMilliseconds(fields[0])
+		if err != nil || d <= 0 {
+			return Command{}, fmt.Errorf("invalid blackout duration %q", fields[0])
+		}
+		c.Duration = d
+	case ActionDrop:
+		if len(fields) == 1 && fields[0] == "clear" {
+			if c.Target != "" || c.Direction != "" {
+				return Command{}, fmt.Errorf("drop clear takes no target or direction")
+			}
+			c.Param = "clear"
+			break
+		}
+		rule, err := ParseRule(strings.Join(fields, " "))
+		if err != nil {
+			return Command{}, err
+		}
+		if c.Target != "" {
+			rule.Port = c.Target
+		}
+		if c.Direction != "" {
+			rule.Direction = c.Direction
+		}
+		c.Target, c.Direction, c.Rule = "", "", rule
+	case ActionReset, ActionEnd:
+		if len(fields) != 0 {
+			return Command{}, fmt.Errorf("unexpected arguments in %q", s)
+		}
+	}
+	if c.Action == ActionEnd && (c.Target != "" || c.Direction != "") {
+		return Command{}, fmt.Errorf("end takes no target or direction")
+	}
+	return c, nil
+}
+
+func isAction(s string) bool {
+	switch s {
+	case ActionSet, ActionBlackout, ActionReset, ActionDrop, ActionEnd:
+		return true
+	}
+	return false
+}
+
+// String 返回命令的文本形式
+func (c Command) String() string {
+	parts := []string{}
+	if c.Target != "" {
+		parts = append(parts, c.Target)
+	}
+	parts = append(parts, c.Action)
+	switch c.Action {
+	case ActionSet:
+		parts = append(parts, c.Param, c.Value)
+	case ActionBlackout:
+		parts = append(parts, c.Duration.String())
+	case ActionDrop:
+		if c.Param == "clear" {
+			parts = append(parts, c.Param)
+		} else {
+			parts = append(parts, c.Rule.String())
+		}
+	}
+	if c.Direction != "" {
+		parts = append(parts, c.Direction)
+	}
+	return strings.Join(parts, " ")
+}
+
+// AppliesTo 返回命令是否作用于目标的某个方向（up 为 true 表示客户端->服务器）
+func (c Command) AppliesTo(target string, up bool) bool {
+	if c.Target != "" && c.Target != target {
+		return false
+	}
+	return c.Direction == "" || (c.Direction == "up") == up
+}
+
+// SetParam 修改一个参数并校验结果。时间可以写成 100ms、1s 或毫秒数，
+// 概率写成百分比（20% 或 20），带宽是 kbps，burst 和 outage 的写法同命令行，off 表示关闭：
+//
+//	delay jitter jitter-dist loss reorder duplicate burst outage bandwidth bucket queue queue-policy
+func SetParam(p Profile, name, value string) (Profile, error) {
+	var err error
+	switch name {
+	case "delay":
+		p.Delay, err = parseMilliseconds(value)
+	case "jitter":
+		p.Jitter, err = parseMilliseconds(value)
+	case "jitter-dist":
+		p.Distribution, err = ParseDistribution(value)
+	case "loss":
+		p.Loss, err = parsePercent(value)
+	case "reorder":
+		p.Reorder, err = parsePercent(value)
+	case "duplicate":
+		p.Duplicate, err = parsePercent(value)
+	case "burst":
+		p.Burst, err = ParseGilbertElliott(offToEmpty(value))
+	case "outage":
+		p.Outage, err = ParseOutage(offToEmpty(value))
+	case "bandwidth":
+		var kbps int64
+		kbps, err = strconv.ParseInt(strings.TrimSuffix(value, "kbps"), 10, 64)
+		p.Bandwidth = kbps * 1000
+	case "bucket":
+		p.BucketSize, err = strconv.Atoi(value)
+	case "queue":
+		p.QueueLimit, err = strconv.Atoi(value)
+	case "queue-policy":
+		p.QueuePolicy, err = ParseQueuePolicy(value)
+	default:
+		return p, fmt.Errorf("unknown parameter %q", name)
+	}
+	if err != nil {
+		return p, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	return p, p.Validate()
+}
+
+// 没有单位时按毫秒
+func parseMilliseconds(s string) (time.Duration, error) {
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// 百分比换算成概率
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	return v / 100, err
+}
+
+func offToEmpty(s string) string {
+	if s == "off" {
+		return ""
+	}
+	return s
+}
+
+// String 返回参数的简短描述，例如 "delay=50ms jitter=10ms(uniform) loss=5%"
+func (p Profile) String() string {
+	parts := []string{"delay=" + p.Delay.String()}
+	if p.Jitter > 0 {
+		parts = append(parts, fmt.Sprintf("jitter=%v(%s)", p.Jitter, cmp.Or(p.Distribution, Uniform)))
+	}
+	percent := func(name string, v float64) {
+		if v > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%g%%", name, v*100))
+		}
+	}
+	percent("loss", p.Loss)
+	percent("reorder", p.Reorder)
+	percent("duplicate", p.Duplicate)
+	if b := p.Burst; b.Enabled() {
+		parts = append(parts, fmt.Sprintf("burst=%g,%g,%g,%g", b.GoodToBad*100, b.BadToGood*100, b.LossBad*100, b.LossGood*100))
+	}
+	if o := p.Outage; o.Enabled() {
+		parts = append(parts, fmt.Sprintf("outage=%v/%v", o.Duration, o.Every))
+	}
+	if p.Bandwidth > 0 {
+		parts = append(parts, fmt.Sprintf("bandwidth=%dkbps", p.Bandwidth/1000))
+	}
+	if p.Ordered {
+		parts = append(parts, "ordered")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,336 @@
+package netsim
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConnOptions 是 NewConn 和 NewPacketConn 的参数。
+// Write 是写出方向（Write、WriteTo）的链路，Read 是读入方向（Read、ReadFrom）的链路，
+// 包在客户端的连接上时分别就是上行和下行
+type ConnOptions struct {
+	Write Profile
+	Read  Profile
+	Clock Clock  // 为 nil 时使用真实时间
+	Seed  uint64 // 不为 0 时每条链路的随机数由它和链路的创建顺序决定
+}
+
+// 创建第 index 条链路
+func (o ConnOptions) newLink(profile Profile, index uint64, deliver func([]byte)) *Link {
+	clock := o.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+	l := NewLinkWithClock(profile, clock, deliver)
+	if o.Seed != 0 {
+		l.Seed(o.Seed + index*0x9e3779b97f4a7c15)
+	}
+	return l
+}
+
+// Conn 在 net.Conn 上模拟两个方向的链路：写入的数据经过写出链路后才写到底层连接，
+// 底层连接收到的数据经过读入链路后才能读到。Write 不会因为延迟阻塞，丢弃的数据也算写入成功。
+//
+// 底层是字节流（TCP）时两条链路都保持顺序（见 Profile.Ordered），这时不应该设置丢包：
+// 丢掉一部分数据会破坏后面的所有消息。底层是 UDP 时每次 Write 是一个数据报。
+// 读写截止时间只作用于 Read（真实时间）
+type Conn struct {
+	net.Conn
+	write *Link
+	read  *Link
+	inbox *inbox
+	// 字节流：Read 可以只读一个数据包的一部分
+	stream    bool
+	closeOnce sync.Once
+}
+
+// NewConn 包装连接并开始从底层连接读取
+func NewConn(conn net.Conn, options ConnOptions) *Conn {
+	_, datagram := conn.(net.PacketConn)
+	c := &Conn{Conn: conn, inbox: newInbox(), stream: !datagram}
+	if c.stream {
+		options.Write.Ordered, options.Read.Ordered = true, true
+	}
+	c.write = options.newLink(options.Write, 0, func(data []byte) {
+		conn.Write(data)
+	})
+	c.read = options.newLink(options.Read, 1, func(data []byte) {
+		c.inbox.push(packet{data: data})
+	})
+	go c.readLoop()
+	return c
+}
+
+// 读取底层连接放进读入链路；出错时等链路中的数据都读到之后再返回这个错误
+func (c *Conn) readLoop() {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := c.Conn.Read(buffer)
+		if n > 0 {
+			c.read.Send(buffer[:n])
+		}
+		if err != nil {
+			c.read.CloseWhenEmpty()
+			c.inbox.fail(err)
+			return
+		}
+	}
+}
+
+// Read 读取经过读入链路的数据
+func (c *Conn) Read(b []byte) (int, error) {
+	n, _, err := c.inbox.read(b, c.stream)
+	return n, err
+}
+
+// Write 把数据放进写出链路
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.inbox.isClosed() {
+		return 0, net.ErrClosed
+	}
+	c.write.Send(b)
+	return len(b), nil
+}
+
+// Close 关闭连接：之后的读写立即返回 net.ErrClosed，写出链路中的数据发完后再关闭底层连接
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.inbox.close()
+		go func() {
+			c.write.CloseWhenEmpty()
+			c.Conn.Close()
+			c.read.Close()
+		}()
+	})
+	return nil
+}
+
+// SetDeadline 设置 Read 的截止时间
+func (c *Conn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+// SetReadDeadline 设置 Read 的截止时间
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.inbox.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline 不做任何事：Write 不会阻塞
+func (c *Conn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Stats 返回写出和读入链路的统计
+func (c *Conn) Stats() (write, read Stats) {
+	return c.write.Stats(), c.read.Stats()
+}
+
+// Links 返回写出和读入链路，用来在运行中修改参数（SetProfile、Blackout）。
+// 字节流连接修改参数时要保留 Ordered
+func (c *Conn) Links() (write, read *Link) {
+	return c.write, c.read
+}
+
+// PacketConn 在 net.PacketConn 上模拟链路：每个对端地址有自己的写出链路和读入链路，
+// 可以包装服务器的 UDP socket，也可以给 KCP 会话使用（kcp.NewConn、kcp.ServeConn）
+type PacketConn struct {
+	net.PacketConn
+	options   ConnOptions
+	inbox     *inbox
+	closeOnce sync.Once
+
+	mutex  sync.Mutex
+	writes map[string]*Link // 对端地址 -> 写出链路
+	reads  map[string]*Link // 对端地址 -> 读入链路
+	links  uint64           // 已经创建的链路数，用来计算种子
+}
+
+// NewPacketConn 包装 PacketConn 并开始从底层读取
+func NewPacketConn(conn net.PacketConn, options ConnOptions) *PacketConn {
+	p := &PacketConn{
+		PacketConn: conn,
+		options:    options,
+		inbox:      newInbox(),
+		writes:     make(map[string]*Link),
+		reads:      make(map[string]*Link),
+	}
+	go p.readLoop()
+	return p
+}
+
+// 取得对端地址的链路，没有时创建
+func (p *PacketConn) link(links map[string]*Link, profile Profile, addr net.Addr, deliver func([]byte)) *Link {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	l, ok := links[addr.String()]
+	if !ok {
+		l = p.options.newLink(profile, p.links, deliver)
+		p.links++
+		links[addr.String()] = l
+	}
+	return l
+}
+
+func (p *PacketConn) readLoop() {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, addr, err := p.PacketConn.ReadFrom(buffer)
+		if err != nil {
+			p.inbox.fail(err)
+			return
+		}
+		p.link(p.reads, p.options.Read, addr, func(data []byte) {
+			p.inbox.push(packet{data: data, addr: addr})
+		}).Send(buffer[:n])
+	}
+}
+
+// ReadFrom 读取经过读入链路的数据报
+func (p *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return p.inbox.read(b, false)
+}
+
+// WriteTo 把数据报放进发往 addr 的写出链路
+func (p *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if p.inbox.isClosed() {
+		return 0, net.ErrClosed
+	}
+	p.link(p.writes, p.options.Write, addr, func(data []byte) {
+		p.PacketConn.WriteTo(data, addr)
+	}).Send(b)
+	return len(b), nil
+}
+
+// Close 关闭连接：之后的读写立即返回 net.ErrClosed，写出链路中的数据发完后再关闭底层连接
+func (p *PacketConn) Close() error {
+	p.closeOnce.Do(func() {
+		p.inbox.close()
+		go func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			for _, l := range p.writes {
+				l.CloseWhenEmpty()
+			}
+			p.PacketConn.Close()
+			for _, l := range p.reads {
+				l.Close()
+			}
+		}()
+	})
+	return nil
+}
+
+// SetDeadline 设置 ReadFrom 的截止时间
+func (p *PacketConn) SetDeadline(t time.Time) error { return p.SetReadDeadline(t) }
+
+// SetReadDeadline 设置 ReadFrom 的截止时间
+func (p *PacketConn) SetReadDeadline(t time.Time) error {
+	p.inbox.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline 不做任何事：WriteTo 不会阻塞
+func (p *PacketConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// 链路发出、等待读取的数据包
+type packet struct {
+	data []byte
+	addr net.Addr
+}
+
+// 读入方向的缓冲，可以并发调用
+type inbox struct {
+	mutex    sync.Mutex
+	packets  []packet
+	err      error // 数据读完之后返回的错误
+	closed   bool
+	deadline time.Time
+	changed  chan struct{} // 有新数据、出错或修改截止时间时关闭并换一个新的
+}
+
+func newInbox() *inbox {
+	return &inbox{changed: make(chan struct{})}
+}
+
+// 通知等待的 read（调用方持有锁）
+func (b *inbox) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *inbox) push(p packet) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.closed {
+		b.packets = append(b.packets, p)
+		b.notify()
+	}
+}
+
+// 底层连接出错，数据读完后返回 err
+func (b *inbox) fail(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.err == nil {
+		b.err = err
+		b.notify()
+	}
+}
+
+// 关闭：丢掉还没有读取的数据，之后返回 net.ErrClosed
+func (b *inbox) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed, b.packets, b.err = true, nil, net.ErrClosed
+	b.notify()
+}
+
+func (b *inbox) isClosed() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.closed
+}
+
+func (b *inbox) setDeadline(t time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.deadline = t
+	b.notify()
+}
+
+// 读取一个数据包；stream 为 true 时可以只读一部分，剩下的留给下次，否则超出 buf 的部分被丢弃
+func (b *inbox) read(buf []byte, stream bool) (int, net.Addr, error) {
+	for {
+		b.mutex.Lock()
+		if len(b.packets) > 0 {
+			p := &b.packets[0]
+			n, addr := copy(buf, p.data), p.addr
+			if stream && n < len(p.data) {
+				p.data = p.data[n:]
+			} else {
+				b.packets = b.packets[1:]
+			}
+			b.mutex.Unlock()
+			return n, addr, nil
+		}
+		err, deadline, changed := b.err, b.deadline, b.changed
+		b.mutex.Unlock()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if deadline.IsZero() {
+			<-changed
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
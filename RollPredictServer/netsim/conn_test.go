@@ -0,0 +1,201 @@
+package netsim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// 回显服务器，返回地址
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestConnDelaysStreamInOrder(t *testing.T) {
+	raw, err := net.Dial("tcp", startEcho(t))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	// 抖动比写入间隔大，保持顺序的链路也不会打乱字节流
+	conn := NewConn(raw, ConnOptions{
+		Write: Profile{Delay: 30 * time.Millisecond, Jitter: 20 * time.Millisecond},
+		Read:  Profile{Delay: 20 * time.Millisecond},
+		Seed:  1,
+	})
+	defer conn.Close()
+
+	start := time.Now()
+	var sent bytes.Buffer
+	for i := 0; i < 100; i++ {
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(i))
+		sent.Write(chunk)
+		if _, err := conn.Write(chunk); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	received := make([]byte, sent.Len())
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("round trip took %v, want at least 50ms", elapsed)
+	}
+	if !bytes.Equal(received, sent.Bytes()) {
+		t.Fatalf("stream corrupted")
+	}
+	if write, _ := conn.Stats(); write.Sent != 100 || write.Dropped != 0 {
+		t.Fatalf("write stats %+v", write)
+	}
+
+	// 截止时间和关闭
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := conn.Read(received); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read after deadline: %v", err)
+	}
+	conn.Close()
+	if _, err := conn.Write(received); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+}
+
+func TestPacketConnLossAndDelay(t *testing.T) {
+	listen := func() net.PacketConn {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		return conn
+	}
+	receiver := listen()
+	defer receiver.Close()
+	sender := NewPacketConn(listen(), ConnOptions{Write: Profile{Delay: 20 * time.Millisecond, Loss: 0.3}, Seed: 1})
+	defer sender.Close()
+
+	start := time.Now()
+	for i := 0; i < 200; i++ {
+		sender.WriteTo(binary.BigEndian.AppendUint32(nil, uint32(i)), receiver.LocalAddr())
+	}
+	buffer := make([]byte, 16)
+	received := 0
+	for {
+		receiver.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, addr, err := receiver.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		if received == 0 && time.Since(start) < 20*time.Millisecond {
+			t.Fatalf("first packet after %v", time.Since(start))
+		}
+		if n != 4 || addr.String() != sender.LocalAddr().String() {
+			t.Fatalf("got %d bytes from %v", n, addr)
+		}
+		received++
+	}
+	if received < 110 || received > 170 {
+		t.Fatalf("received %d of 200 with 30%% loss", received)
+	}
+
+	// 读入方向：回复经过读入链路，ReadFrom 返回对端地址
+	echo := NewPacketConn(listen(), ConnOptions{Read: Profile{Delay: 10 * time.Millisecond}})
+	defer echo.Close()
+	receiver.WriteTo([]byte("ping"), echo.LocalAddr())
+	echo.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := echo.ReadFrom(buffer)
+	if err != nil || string(buffer[:n]) != "ping" || addr.String() != receiver.LocalAddr().String() {
+		t.Fatalf("read %q from %v: %v", buffer[:n], addr, err)
+	}
+}
+
+func TestLinkWithVirtualClock(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	delivered := make(chan []byte, 10)
+	l := NewLinkWithClock(Profile{Delay: time.Second}, clock, func(data []byte) { delivered <- data })
+	defer l.Close()
+
+	l.Send([]byte("a"))
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-delivered:
+		t.Fatalf("delivered before the delay")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case data := <-delivered:
+		if string(data) != "a" {
+			t.Fatalf("delivered %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not delivered after the delay")
+	}
+}
+
+func TestVirtualTimerResetAt(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewVirtualClock(start)
+	timer := clock.NewTimer(time.Hour)
+	fired := func() bool {
+		select {
+		case <-timer.C():
+			return true
+		default:
+			return false
+		}
+	}
+
+	// 计算发出时间之后时钟又前进了：已经过去的时间立即触发，不会顺延
+	clock.Advance(time.Second)
+	timer.ResetAt(start.Add(500 * time.Millisecond))
+	if !fired() {
+		t.Fatalf("timer reset to a past time did not fire")
+	}
+	timer.ResetAt(start.Add(2 * time.Second))
+	clock.Advance(999 * time.Millisecond)
+	if fired() {
+		t.Fatalf("fired before the deadline")
+	}
+	clock.Advance(time.Millisecond)
+	if !fired() {
+		t.Fatalf("not fired at the deadline")
+	}
+}
+
+func TestLinkWithScaledClock(t *testing.T) {
+	delivered := make(chan time.Time, 1)
+	l := NewLinkWithClock(Profile{Delay: 2 * time.Second}, NewScaledClock(100), func([]byte) { delivered <- time.Now() })
+	defer l.Close()
+	start := time.Now()
+	l.Send([]byte("a"))
+	select {
+	case at := <-delivered:
+		if elapsed := at.Sub(start); elapsed < 15*time.Millisecond || elapsed > time.Second {
+			t.Fatalf("2s delay at 100x took %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not delivered")
+	}
+}
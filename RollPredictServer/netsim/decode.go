@@ -0,0 +1,201 @@
+package netsim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/WjcHome/gohello/codec"
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// 解码日志中消息摘要的最大长度
+const maxSummaryLength = 200
+
+// Message 是从链路上解码出的一条帧同步协议消息
+type Message struct {
+	Type myproto.MessageType
+	Body proto.Message // 无法解码 protobuf 时为 nil
+	Err  error         // protobuf 解码错误
+}
+
+// Decoder 解析一个方向上经过的数据，得到帧同步协议消息（线路格式见 codec 包）。
+// 数据按发送方发出的顺序放入（网络模拟器在施加损伤之前解码）：
+//
+//	udp  每个数据报是一条消息
+//	tcp  字节流，消息可以跨数据包
+//	kcp  解析 KCP 段，按会话把第一次发送的数据段（跳过重传）拼成字节流，再和 tcp 一样拆出消息
+type Decoder struct {
+	protocol  string
+	direction codec.Direction
+	stream    stream
+	kcp       map[uint32]*kcpStream
+}
+
+// 字节流的解码状态
+type stream struct {
+	buffer []byte // 还不完整的消息
+	broken bool   // 流已经无法对齐，不再解码
+}
+
+// 一个 KCP 会话的解码状态
+type kcpStream struct {
+	stream
+	next    uint32 // 下一个新数据段的序号
+	started bool
+}
+
+// NewDecoder 创建解码器，protocol 是 tcp、udp 或 kcp
+func NewDecoder(protocol string, direction codec.Direction) *Decoder {
+	return &Decoder{protocol: protocol, direction: direction, kcp: make(map[uint32]*kcpStream)}
+}
+
+// Feed 放入一个数据包，返回其中完整的消息；数据格式错误时返回已经解出的消息和错误
+func (d *Decoder) Feed(data []byte) ([]Message, error) {
+	switch d.protocol {
+	case "tcp":
+		return d.stream.feed(data, d.direction)
+	case "kcp":
+		return d.feedKCP(data)
+	}
+	messageType, payload, err := codec.DecodeDatagram(data, d.direction)
+	if err != nil {
+		return nil, err
+	}
+	body, err := codec.DecodeBody(messageType, payload)
+	return []Message{{Type: messageType, Body: body, Err: err}}, nil
+}
+
+// 拼接字节流，按长度前缀拆出消息；格式错误后不再解码
+func (s *stream) feed(data []byte, direction codec.Direction) ([]Message, error) {
+	if s.broken {
+		return nil, nil
+	}
+	s.buffer = append(s.buffer, data...)
+	var messages []Message
+	for len(s.buffer) >= codec.HeaderSize {
+		messageType, length, err := codec.ParseHeader(s.buffer, direction)
+		if err != nil {
+			s.broken = true
+			s.buffer = nil
+			return messages, fmt.Errorf("stream out of sync: %w", err)
+		}
+		if len(s.buffer) < codec.HeaderSize+length {
+			break
+		}
+		body, err := codec.DecodeBody(messageType, s.buffer[codec.HeaderSize:codec.HeaderSize+length])
+		messages = append(messages, Message{Type: messageType, Body: body, Err: err})
+		s.buffer = s.buffer[codec.HeaderSize+length:]
+	}
+	// 不再引用已经解码的数据
+	s.buffer = append([]byte(nil), s.buffer...)
+	return messages, nil
+}
+
+// KCP：按会话取出第一次发送的数据段，拼成字节流解码
+func (d *Decoder) feedKCP(data []byte) ([]Message, error) {
+	segments, err := ParseKCP(data)
+	var messages []Message
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	offset := 0
+	for _, s := range segments {
+		payload := data[offset+kcpHeaderSize : offset+kcpHeaderSize+int(s.Length)]
+		offset += kcpHeaderSize + int(s.Length)
+		if s.Cmd != KCPPush {
+			continue
+		}
+		conv := d.kcp[s.Conv]
+		if conv == nil {
+			conv = &kcpStream{}
+			d.kcp[s.Conv] = conv
+		}
+		if conv.started && s.Sn < conv.next {
+			continue // 重传
+		}
+		if conv.started && s.Sn != conv.next {
+			// 发送方按序号顺序第一次发送，跳号说明有数据段没有经过代理
+			conv.broken = true
+		}
+		conv.started, conv.next = true, s.Sn+1
+		decoded, err := conv.feed(payload, d.direction)
+		messages = append(messages, decoded...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return messages, errors.Join(errs...)
+}
+
+// Summary 返回消息的简短描述，帧数据和服务器帧列出帧号、玩家和输入
+func (m Message) Summary() string {
+	name := strings.TrimPrefix(m.Type.String(), "MESSAGE_")
+	if m.Err != nil || m.Body == nil {
+		return fmt.Sprintf("%s (无法解码: %v)", name, m.Err)
+	}
+	var detail string
+	switch body := m.Body.(type) {
+	case *myproto.FrameData:
+		detail = "frame=" + fmt.Sprint(body.FrameNumber) + " " + inputSummary(body)
+	case *myproto.ServerFrame:
+		detail = serverFrameSummary(body)
+	case *myproto.GetLossFrame:
+		detail = fmt.Sprintf("last=%d", body.LastFrameNumber)
+	case *myproto.SendAllFrame:
+		detail = fmt.Sprintf("%d frames", len(body.AllNeedFrame))
+		if n := len(body.AllNeedFrame); n > 0 {
+			detail += fmt.Sprintf(" %d..%d", body.AllNeedFrame[0].FrameNumber, body.AllNeedFrame[n-1].FrameNumber)
+		}
+	case *myproto.GameStart:
+		detail = fmt.Sprintf("room=%s players=%v seed=%d fps=%d", body.RoomId, body.PlayerIds, body.RandomSeed, body.FrameRate)
+	default:
+		detail = prototext.MarshalOptions{}.Format(body)
+	}
+	if len(detail) > maxSummaryLength {
+		detail = detail[:maxSummaryLength] + "..."
+	}
+	if detail == "" {
+		return name
+	}
+	return name + " " + detail
+}
+
+// 一个玩家的输入，例如 "p1:UP+fire(10,20)"
+func inputSummary(f *myproto.FrameData) string {
+	s := fmt.Sprintf("p%d:%s", f.PlayerId, strings.TrimPrefix(f.Direction.String(), "DIRECTION_"))
+	if f.IsFire {
+		s += "+fire"
+		if f.FireX != nil && f.FireY != nil {
+			s += fmt.Sprintf("(%d,%d)", *f.FireX, *f.FireY)
+		}
+	}
+	if f.IsToggle {
+		s += "+toggle"
+	}
+	return s
+}
+
+func serverFrameSummary(frame *myproto.ServerFrame) string {
+	inputs := make([]string, 0, len(frame.FrameDatas))
+	for _, f := range frame.FrameDatas {
+		inputs = append(inputs, inputSummary(f))
+	}
+	return fmt.Sprintf("frame=%d inputs=[%s]", frame.FrameNumber, strings.Join(inputs, " "))
+}
+
+// FrameNumber 返回消息中的帧号（帧数据、服务器帧、补帧请求），没有时返回 -1
+func (m Message) FrameNumber() int64 {
+	switch body := m.Body.(type) {
+	case *myproto.FrameData:
+		return body.FrameNumber
+	case *myproto.ServerFrame:
+		return body.FrameNumber
+	case *myproto.GetLossFrame:
+		return body.LastFrameNumber
+	}
+	return -1
+}
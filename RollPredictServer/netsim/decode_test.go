@@ -0,0 +1,126 @@
+package netsim
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/WjcHome/gohello/codec"
+	myproto "github.com/WjcHome/gohello/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func encode(t *testing.T, messageType myproto.MessageType, body proto.Message) []byte {
+	t.Helper()
+	data, err := codec.Encode(messageType, body)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return data
+}
+
+// 一个 KCP 数据段
+func kcpSegment(conv uint32, cmd uint8, fragment uint8, sn uint32, payload []byte) []byte {
+	header := make([]byte, kcpHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], conv)
+	header[4] = cmd
+	header[5] = fragment
+	binary.LittleEndian.PutUint32(header[12:], sn)
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func summaries(messages []Message) []string {
+	var s []string
+	for _, m := range messages {
+		s = append(s, m.Summary())
+	}
+	return s
+}
+
+func TestDecodeDatagram(t *testing.T) {
+	fireX, fireY := int64(10), int64(-20)
+	input := &myproto.FrameData{PlayerId: 3, FrameNumber: 42, Direction: myproto.InputDirection_DIRECTION_UP_LEFT, IsFire: true, FireX: &fireX, FireY: &fireY}
+	d := NewDecoder("udp", codec.ClientToServer)
+	messages, err := d.Feed(encode(t, myproto.MessageType_MESSAGE_FRAME_DATA, input))
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("decoded %d messages, err %v", len(messages), err)
+	}
+	if got, want := messages[0].Summary(), "FRAME_DATA frame=42 p3:UP_LEFT+fire(10,-20)"; got != want {
+		t.Fatalf("summary %q, want %q", got, want)
+	}
+	if frame := messages[0].FrameNumber(); frame != 42 {
+		t.Fatalf("frame %d", frame)
+	}
+
+	// 方向不对的消息类型和不完整的数据报都是错误
+	serverFrame := encode(t, myproto.MessageType_MESSAGE_SERVER_FRAME, &myproto.ServerFrame{FrameNumber: 1})
+	if _, err := d.Feed(serverFrame); err == nil {
+		t.Fatalf("server frame decoded as client message")
+	}
+	if _, err := d.Feed(serverFrame[:3]); err == nil {
+		t.Fatalf("truncated datagram decoded")
+	}
+}
+
+func TestDecodeStreamAcrossPackets(t *testing.T) {
+	frame := &myproto.ServerFrame{FrameNumber: 7, FrameDatas: []*myproto.FrameData{
+		{PlayerId: 1, Direction: myproto.InputDirection_DIRECTION_RIGHT},
+		{PlayerId: 2, IsToggle: true},
+	}}
+	stream := append(encode(t, myproto.MessageType_MESSAGE_SERVER_FRAME, frame),
+		encode(t, myproto.MessageType_MESSAGE_FRAME_NEED, &myproto.SendAllFrame{AllNeedFrame: []*myproto.ServerFrame{{FrameNumber: 3}, {FrameNumber: 5}}})...)
+
+	// 每次一个字节，消息在最后一个字节到达时解出
+	d := NewDecoder("tcp", codec.ServerToClient)
+	var got []string
+	for i := range stream {
+		messages, err := d.Feed(stream[i : i+1])
+		if err != nil {
+			t.Fatalf("byte %d: %v", i, err)
+		}
+		got = append(got, summaries(messages)...)
+	}
+	want := []string{"SERVER_FRAME frame=7 inputs=[p1:RIGHT p2:NONE+toggle]", "FRAME_NEED 2 frames 3..5"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// 格式错误后不再解码
+	if _, err := d.Feed([]byte{0, 0, 0, 0, 0}); err == nil {
+		t.Fatalf("empty message accepted")
+	}
+	if messages, err := d.Feed(stream); len(messages) != 0 || err != nil {
+		t.Fatalf("decoded %d messages after the stream broke, err %v", len(messages), err)
+	}
+}
+
+func TestDecodeKCPSkipsRetransmits(t *testing.T) {
+	request := encode(t, myproto.MessageType_MESSAGE_FRAME_LOSS, &myproto.GetLossFrame{LastFrameNumber: 99})
+	input := encode(t, myproto.MessageType_MESSAGE_FRAME_DATA, &myproto.FrameData{PlayerId: 4, FrameNumber: 100})
+
+	d := NewDecoder("kcp", codec.ClientToServer)
+	feed := func(segments ...[]byte) []string {
+		t.Helper()
+		messages, err := d.Feed(slices.Concat(segments...))
+		if err != nil {
+			t.Fatalf("feed: %v", err)
+		}
+		return summaries(messages)
+	}
+	// 一条消息分成两个分片，确认段不影响解码
+	if got := feed(kcpSegment(5, KCPAck, 0, 0, nil), kcpSegment(5, KCPPush, 1, 0, request[:4])); len(got) != 0 {
+		t.Fatalf("partial message decoded: %q", got)
+	}
+	if got := feed(kcpSegment(5, KCPPush, 0, 1, request[4:]), kcpSegment(5, KCPPush, 0, 2, input)); !slices.Equal(got, []string{"FRAME_LOSS last=99", "FRAME_DATA frame=100 p4:NONE"}) {
+		t.Fatalf("got %q", got)
+	}
+	// 重传不会重复解码
+	if got := feed(kcpSegment(5, KCPPush, 0, 2, input)); len(got) != 0 {
+		t.Fatalf("retransmit decoded: %q", got)
+	}
+	// 其他会话单独拼接
+	if got := feed(kcpSegment(6, KCPPush, 0, 0, input)); len(got) != 1 {
+		t.Fatalf("second conversation: %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package netsim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// KCP 段头长度；kcp-go 不加密、不使用 FEC 时（服务器和客户端都是这样配置的），
+// 一个 UDP 数据包就是若干个首尾相连的 KCP 段
+const kcpHeaderSize = 24
+
+// KCP 段的命令
+const (
+	KCPPush       = 81 // 数据
+	KCPAck        = 82 // 确认
+	KCPWindowAsk  = 83 // 询问对方窗口
+	KCPWindowTell = 84 // 告知自己的窗口
+)
+
+// KCPSegment 是 KCP 段头（小端序），不包含数据
+type KCPSegment struct {
+	Conv      uint32 // 会话号
+	Cmd       uint8
+	Fragment  uint8  // 剩余分片数
+	Window    uint16 // 接收窗口
+	Timestamp uint32
+	Sn        uint32 // 序号
+	Una       uint32 // 对方之前的段都已收到
+	Length    uint32 // 数据长度
+}
+
+// ParseKCP 解析 UDP 数据包中的 KCP 段
+func ParseKCP(data []byte) ([]KCPSegment, error) {
+	var segments []KCPSegment
+	for len(data) > 0 {
+		if len(data) < kcpHeaderSize {
+			return segments, fmt.Errorf("truncated kcp header: %d bytes", len(data))
+		}
+		s := KCPSegment{
+			Conv:      binary.LittleEndian.Uint32(data[0:]),
+			Cmd:       data[4],
+			Fragment:  data[5],
+			Window:    binary.LittleEndian.Uint16(data[6:]),
+			Timestamp: binary.LittleEndian.Uint32(data[8:]),
+			Sn:        binary.LittleEndian.Uint32(data[12:]),
+			Una:       binary.LittleEndian.Uint32(data[16:]),
+			Length:    binary.LittleEndian.Uint32(data[20:]),
+		}
+		if s.Cmd < KCPPush || s.Cmd > KCPWindowTell {
+			return segments, fmt.Errorf("unknown kcp command %d", s.Cmd)
+		}
+		if uint64(len(data)-kcpHeaderSize) < uint64(s.Length) {
+			return segments, fmt.Errorf("kcp segment %d length %d exceeds packet", s.Sn, s.Length)
+		}
+		segments = append(segments, s)
+		data = data[kcpHeaderSize+int(s.Length):]
+	}
+	return segments, nil
+}
+
+// KCPStats 是一个方向上的 KCP 段计数
+type KCPStats struct {
+	Push       int64 // 数据段（包括重传）
+	Retransmit int64 // 重传的数据段
+	Ack        int64 // 确认段
+	Window     int64 // 窗口询问和告知
+	Invalid    int64 // 无法解析的数据包
+}
+
+// KCPCounter 统计一个方向上的 KCP 段，可以并发调用
+type KCPCounter struct {
+	mutex sync.Mutex
+	next  map[uint32]uint32 // 每个会话下一个新数据段的序号
+	stats KCPStats
+}
+
+// Observe 解析发送方发出的数据包并计数，返回数据包中的段和其中重传的数据段数。
+// 发送方第一次发送的序号是递增的，所以序号小于已经见过的最大序号的数据段就是重传
+func (c *KCPCounter) Observe(data []byte) ([]KCPSegment, int, error) {
+	segments, err := ParseKCP(data)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		c.stats.Invalid++
+	}
+	if c.next == nil {
+		c.next = make(map[uint32]uint32)
+	}
+	retransmits := 0
+	for _, s := range segments {
+		switch s.Cmd {
+		case KCPPush:
+			c.stats.Push++
+			next, seen := c.next[s.Conv]
+			if seen && s.Sn < next {
+				c.stats.Retransmit++
+				retransmits++
+			} else {
+				c.next[s.Conv] = s.Sn + 1
+			}
+		case KCPAck:
+			c.stats.Ack++
+		default:
+			c.stats.Window++
+		}
+	}
+	return segments, retransmits, err
+}
+
+// Stats 返回计数的副本
+func (c *KCPCounter) Stats() KCPStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
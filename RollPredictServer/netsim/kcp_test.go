@@ -0,0 +1,68 @@
+package netsim
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+func TestParseKCPFromSession(t *testing.T) {
+	// 只收包不回复的对端：KCP 收不到确认，会重传数据段
+	sink, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer sink.Close()
+	session, err := kcp.DialWithOptions(sink.LocalAddr().String(), nil, 0, 0)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer session.Close()
+	session.SetNoDelay(1, 10, 2, 1)
+	if _, err := session.Write([]byte("hello")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var counter KCPCounter
+	buffer := make([]byte, 2048)
+	sink.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for counter.Stats().Retransmit == 0 {
+		n, _, err := sink.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("read: %v (stats %+v)", err, counter.Stats())
+		}
+		segments, _, err := counter.Observe(buffer[:n])
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		for _, s := range segments {
+			if s.Conv != session.GetConv() {
+				t.Fatalf("conv %d, want %d", s.Conv, session.GetConv())
+			}
+			if s.Cmd == KCPPush && (s.Sn != 0 || s.Length != 5) {
+				t.Fatalf("push segment %+v", s)
+			}
+		}
+	}
+	if stats := counter.Stats(); stats.Push < 2 || stats.Invalid != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestParseKCPRejectsGarbage(t *testing.T) {
+	var counter KCPCounter
+	if _, _, err := counter.Observe([]byte("not a kcp packet, definitely not")); err == nil {
+		t.Fatalf("garbage parsed")
+	}
+	header := make([]byte, kcpHeaderSize)
+	header[4] = KCPPush
+	header[20] = 10 // 数据长度超出数据包
+	if _, err := ParseKCP(header); err == nil {
+		t.Fatalf("truncated segment parsed")
+	}
+	if stats := counter.Stats(); stats.Invalid != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
@@ -0,0 +1,402 @@
+// Package netsim 实现网络模拟器的链路损伤模型。
+//
+// 一条 Link 表示一个方向上的链路：Send 放入的数据包按 Profile 计算发出时间，
+// 放进按时间排序的发送队列，由链路自己的 goroutine 到时间后交给 deliver。
+// 读取方不会因为延迟而阻塞，抖动可以让数据包乱序，也可以复制数据包。
+// 丢包除了独立的随机丢包，还有突发丢包（Gilbert-Elliott 模型）和周期性断网。
+// 设置带宽后数据包先经过令牌桶限速的瓶颈队列，离开瓶颈后再计算延迟。
+// Decoder 解析经过链路的帧同步协议消息，Trace 把数据包的去向和消息写成 JSONL，
+// Rules 按解码出的消息选择性丢包。
+// Conn 和 PacketConn 把链路包在 net.Conn、net.PacketConn 上，在 Go 测试中直接模拟网络；
+// 链路的时间来自 Clock，可以是真实时间、加速的时间或手动推进的虚拟时间。
+package netsim
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Distribution 是抖动的分布
+type Distribution string
+
+const (
+	Uniform Distribution = "uniform" // 均匀分布：Delay ± Jitter
+	Normal  Distribution = "normal"  // 正态分布：标准差为 Jitter
+	Pareto  Distribution = "pareto"  // Pareto 分布：只增加延迟，长尾，平均增加 Jitter
+)
+
+// Pareto 分布的形状参数（越小尾巴越长，2 时均值为尺度参数）
+const paretoShape = 2
+
+// ParseDistribution 解析抖动分布名称
+func ParseDistribution(name string) (Distribution, error) {
+	switch d := Distribution(name); d {
+	case Uniform, Normal, Pareto:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown jitter distribution %q (uniform, normal or pareto)", name)
+}
+
+// Profile 描述一个方向上的链路损伤，概率都是 0~1
+type Profile struct {
+	Delay        time.Duration  // 基础单向延迟
+	Jitter       time.Duration  // 抖动幅度，含义见 Distribution
+	Distribution Distribution   // 抖动分布，为空时使用均匀分布
+	Loss         float64        // 独立丢包率
+	Burst        GilbertElliott // 突发丢包，和 Loss 叠加
+	Outage       Outage         // 周期性断网
+	Reorder      float64        // 不经过延迟立即发出的概率（越过队列中的数据包）
+	Duplicate    float64        // 再发一份副本的概率（副本单独计算延迟）
+	Ordered      bool           // 保持顺序（TCP等字节流）：不丢包、不乱序、不复制，断网时推迟发出，抖动只会推迟后面的数据
+	Bandwidth    int64          // 瓶颈带宽（比特/秒），为0时不限速
+	BucketSize   int            // 令牌桶容量（字节），即可以按线速突发的数据量，为0时使用一个MTU
+	QueueLimit   int            // 瓶颈队列最多容纳的数据包数，为0时使用默认值；Ordered 链路不限
+	QueuePolicy  QueuePolicy    // 队列丢包策略，为空时使用 TailDrop
+}
+
+// Validate 检查参数范围
+func (p Profile) Validate() error {
+	if p.Delay < 0 || p.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must not be negative")
+	}
+	if p.Distribution != "" {
+		if _, err := ParseDistribution(string(p.Distribution)); err != nil {
+			return err
+		}
+	}
+	for name, v := range map[string]float64{"loss": p.Loss, "reorder": p.Reorder, "duplicate": p.Duplicate} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("%s probability must be between 0 and 1, got %v", name, v)
+		}
+	}
+	if p.Bandwidth < 0 || p.BucketSize < 0 || p.QueueLimit < 0 {
+		return fmt.Errorf("bandwidth, bucket size and queue limit must not be negative")
+	}
+	if p.QueuePolicy != "" {
+		if _, err := ParseQueuePolicy(string(p.QueuePolicy)); err != nil {
+			return err
+		}
+	}
+	if err := p.Burst.Validate(); err != nil {
+		return err
+	}
+	return p.Outage.Validate()
+}
+
+// Stats 是链路的计数
+type Stats struct {
+	Sent       int64 // Send 收到的数据包
+	Delivered  int64 // 已经交给 deliver 的数据包（包括副本）
+	Dropped    int64 // 丢弃的数据包（包括下面三项）
+	BurstLost  int64 // 突发丢包模型丢弃的数据包
+	OutageLost int64 // 断网期间（包括 Blackout）丢弃的数据包
+	OutageHeld int64 // Ordered 链路断网期间推迟到断网结束才发出的数据包
+
+	QueueDropped    int64         // 瓶颈队列丢弃的数据包
+	Queued          int64         // 经过瓶颈队列的数据包
+	QueueLength     int           // 当前瓶颈队列中的数据包数
+	QueueDelayTotal time.Duration // 在瓶颈队列中等待的总时间
+	QueueDelayMax   time.Duration // 在瓶颈队列中等待的最长时间
+	Reordered       int64         // 立即发出的数据包
+	Duplicated      int64         // 复制出的副本
+}
+
+// QueueDelayMean 返回平均排队延迟
+func (s Stats) QueueDelayMean() time.Duration {
+	if s.Queued == 0 {
+		return 0
+	}
+	return s.QueueDelayTotal / time.Duration(s.Queued)
+}
+
+// Link 是一个方向上的模拟链路，可以并发调用 Send
+type Link struct {
+	deliver func([]byte)
+	clock   Clock
+
+	mutex      sync.Mutex
+	profile    Profile
+	rng        *rand.Rand
+	queue      packetQueue
+	seq        uint64
+	last       time.Time // Ordered 时上一个数据包的发出时间
+	created    time.Time // 创建时间，断网窗口从这里开始计算
+	bad        bool      // 突发丢包模型是否处于坏状态
+	blackout   time.Time // Blackout 设置的断网结束时间
+	bottleneck bottleneck
+	stats      Stats
+	closed     bool
+	draining   bool // 发完队列中的数据包后停止
+	wake       chan struct{}
+	finished   chan struct{}
+}
+
+// NewLink 创建链路并启动发送 goroutine，deliver 在发送 goroutine 中按发出时间顺序调用
+func NewLink(profile Profile, deliver func([]byte)) *Link {
+	return NewLinkWithClock(profile, RealClock, deliver)
+}
+
+// NewLinkWithClock 创建使用指定时钟的链路，延迟、断网和带宽都按这个时钟计算
+func NewLinkWithClock(profile Profile, clock Clock, deliver func([]byte)) *Link {
+	l := &Link{
+		deliver:  deliver,
+		clock:    clock,
+		profile:  profile,
+		created:  clock.Now(),
+		rng:      rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+		wake:     make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Seed 用固定的种子重置随机数（丢包、抖动、乱序等所有随机决定都来自它），
+// 同样的种子和同样的数据包序列得到同样的结果
+func (l *Link) Seed(seed uint64) {
+	l.mutex.Lock()
+	l.rng = rand.New(rand.NewPCG(seed, 0))
+	l.mutex.Unlock()
+}
+
+// SetProfile 修改链路参数，只影响之后 Send 的数据包
+func (l *Link) SetProfile(profile Profile) {
+	l.mutex.Lock()
+	l.profile = profile
+	l.mutex.Unlock()
+}
+
+// Profile 返回当前的链路参数
+func (l *Link) Profile() Profile {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.profile
+}
+
+// Blackout 从现在开始断网到 until（链路时钟的时间），期间所有数据包都被丢弃，Ordered 链路推迟到 until 之后发出
+// （和 Profile 中的周期性断网无关）
+func (l *Link) Blackout(until time.Time) {
+	l.mutex.Lock()
+	l.blackout = until
+	l.mutex.Unlock()
+}
+
+// Stats 返回计数的副本
+func (l *Link) Stats() Stats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stats := l.stats
+	stats.QueueLength = l.bottleneck.length(l.clock.Now())
+	return stats
+}
+
+// Send 放入一个数据包（复制数据），返回是否被丢弃
+func (l *Link) Send(data []byte) bool {
+	now := l.clock.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return false
+	}
+	l.stats.Sent++
+	p := l.profile
+	// 字节流丢掉数据会破坏后面所有的消息：Ordered 链路忽略 Loss 和 Burst，
+	// 断网期间的数据像TCP重传一样等到断网结束后再发出
+	hold := now
+	if p.Ordered {
+		if hold = l.outageEnd(p, now); hold.After(now) {
+			l.stats.OutageHeld++
+		}
+	} else if l.lost(p, now) {
+		l.stats.Dropped++
+		return false
+	}
+
+	data = append([]byte(nil), data...)
+	copies := 1
+	if !p.Ordered && p.Duplicate > 0 && l.rng.Float64() < p.Duplicate {
+		l.stats.Duplicated++
+		copies = 2
+	}
+	sent := false
+	for i := 0; i < copies; i++ {
+		departure, ok := l.enqueue(p, now, len(data))
+		if !ok {
+			l.stats.Dropped++
+			continue
+		}
+		sent = true
+		if departure.Before(hold) {
+			departure = hold
+		}
+		at := departure.Add(l.delay(p))
+		if p.Ordered {
+			if at.Before(l.last) {
+				at = l.last
+			}
+			l.last = at
+		}
+		l.seq++
+		heap.Push(&l.queue, &queuedPacket{data: data, at: at, seq: l.seq})
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return sent
+}
+
+// 返回 now 所在断网窗口（周期性断网或 Blackout）的结束时间，没有断网时返回 now（调用方持有锁）
+func (l *Link) outageEnd(p Profile, now time.Time) time.Time {
+	end := now.Add(p.Outage.Remaining(now.Sub(l.created)))
+	if l.blackout.After(end) {
+		end = l.blackout
+	}
+	return end
+}
+
+// 判断数据包是否丢失（调用方持有锁）
+func (l *Link) lost(p Profile, now time.Time) bool {
+	if l.outageEnd(p, now).After(now) {
+		l.stats.OutageLost++
+		return true
+	}
+	if p.Burst.Enabled() {
+		// 先切换状态，再按当前状态的丢包率决定
+		if l.bad {
+			l.bad = l.rng.Float64() >= p.Burst.BadToGood
+		} else {
+			l.bad = l.rng.Float64() < p.Burst.GoodToBad
+		}
+		lossRate := p.Burst.LossGood
+		if l.bad {
+			lossRate = p.Burst.LossBad
+		}
+		if lossRate > 0 && l.rng.Float64() < lossRate {
+			l.stats.BurstLost++
+			return true
+		}
+	}
+	return p.Loss > 0 && l.rng.Float64() < p.Loss
+}
+
+// 计算一个数据包的延迟（调用方持有锁）
+func (l *Link) delay(p Profile) time.Duration {
+	if !p.Ordered && p.Reorder > 0 && l.rng.Float64() < p.Reorder {
+		l.stats.Reordered++
+		return 0
+	}
+	d := p.Delay
+	if p.Jitter > 0 {
+		j := float64(p.Jitter)
+		switch p.Distribution {
+		case Normal:
+			d += time.Duration(l.rng.NormFloat64() * j)
+		case Pareto:
+			// 逆变换采样：尺度为1的 Pareto 分布减去1，从0开始
+			u := 1 - l.rng.Float64() // (0, 1]
+			d += time.Duration(j * (math.Pow(u, -1.0/paretoShape) - 1))
+		default:
+			d += time.Duration((l.rng.Float64()*2 - 1) * j)
+		}
+	}
+	return max(d, 0)
+}
+
+// Close 停止链路，队列中还没有发出的数据包被丢弃
+func (l *Link) Close() {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return
+	}
+	l.closed = true
+	l.mutex.Unlock()
+	close(l.wake)
+	<-l.finished
+}
+
+// CloseWhenEmpty 不再接受新的数据包，等队列中的数据包都发出后停止（用于连接正常关闭）
+func (l *Link) CloseWhenEmpty() {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return
+	}
+	l.closed = true
+	l.draining = true
+	l.mutex.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	<-l.finished
+}
+
+// 发送循环：等到队首数据包的发出时间后交给 deliver
+func (l *Link) run() {
+	defer close(l.finished)
+	timer := l.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		l.mutex.Lock()
+		var due []*queuedPacket
+		now := l.clock.Now()
+		for l.queue.Len() > 0 && !l.queue[0].at.After(now) {
+			due = append(due, heap.Pop(&l.queue).(*queuedPacket))
+		}
+		l.stats.Delivered += int64(len(due))
+		next := now.Add(time.Hour)
+		if l.queue.Len() > 0 {
+			next = l.queue[0].at
+		}
+		drained := l.draining && l.queue.Len() == 0
+		l.mutex.Unlock()
+
+		for _, packet := range due {
+			l.deliver(packet.data)
+		}
+		if drained {
+			return
+		}
+
+		timer.ResetAt(next)
+		select {
+		case _, ok := <-l.wake:
+			if !ok {
+				return
+			}
+		case <-timer.C():
+		}
+	}
+}
+
+// 发送队列中的数据包
+type queuedPacket struct {
+	data []byte
+	at   time.Time // 发出时间
+	seq  uint64    // 发出时间相同时按放入顺序
+}
+
+// 按发出时间排序的最小堆
+type packetQueue []*queuedPacket
+
+func (q packetQueue) Len() int { return len(q) }
+func (q packetQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q packetQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *packetQueue) Push(x any)   { *q = append(*q, x.(*queuedPacket)) }
+func (q *packetQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,185 @@
+package netsim
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 创建使用固定随机种子的链路，记录收到的数据包编号
+func newTestLink(t *testing.T, profile Profile) (*Link, func() []uint32) {
+	t.Helper()
+	var mutex sync.Mutex
+	var received []uint32
+	l := NewLink(profile, func(data []byte) {
+		mutex.Lock()
+		received = append(received, binary.BigEndian.Uint32(data))
+		mutex.Unlock()
+	})
+	l.rng = rand.New(rand.NewPCG(1, 2))
+	t.Cleanup(l.Close)
+	return l, func() []uint32 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return slices.Clone(received)
+	}
+}
+
+// 依次发送编号为 0..n-1 的数据包
+func sendNumbered(l *Link, n int) {
+	for i := 0; i < n; i++ {
+		l.Send(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	}
+}
+
+func waitForPackets(t *testing.T, received func() []uint32, n int) []uint32 {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := received(); len(got) >= n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("received %d packets, want %d", len(received()), n)
+	return nil
+}
+
+func TestJitterDistributions(t *testing.T) {
+	const samples = 20000
+	delay, jitter := 100*time.Millisecond, 20*time.Millisecond
+	l := &Link{rng: rand.New(rand.NewPCG(1, 2))}
+
+	sample := func(d Distribution) (mean, std float64, sorted []time.Duration) {
+		p := Profile{Delay: delay, Jitter: jitter, Distribution: d}
+		var sum, sumSquares float64
+		for i := 0; i < samples; i++ {
+			v := l.delay(p)
+			sorted = append(sorted, v)
+			sum += float64(v)
+			sumSquares += float64(v) * float64(v)
+		}
+		slices.Sort(sorted)
+		mean = sum / samples
+		return mean, math.Sqrt(sumSquares/samples - mean*mean), sorted
+	}
+	near := func(got, want, tolerance float64) bool { return math.Abs(got-want) <= tolerance }
+
+	mean, _, sorted := sample(Uniform)
+	if sorted[0] < delay-jitter || sorted[samples-1] > delay+jitter || !near(mean, float64(delay), float64(time.Millisecond)) {
+		t.Fatalf("uniform: range [%v, %v], mean %v", sorted[0], sorted[samples-1], time.Duration(mean))
+	}
+	mean, std, _ := sample(Normal)
+	if !near(mean, float64(delay), float64(time.Millisecond)) || !near(std, float64(jitter), float64(time.Millisecond)) {
+		t.Fatalf("normal: mean %v, std %v", time.Duration(mean), time.Duration(std))
+	}
+	// Pareto 只增加延迟，中位数为 (√2-1)·Jitter
+	_, _, sorted = sample(Pareto)
+	median := sorted[samples/2] - delay
+	if sorted[0] < delay || !near(float64(median), (math.Sqrt2-1)*float64(jitter), float64(time.Millisecond)) {
+		t.Fatalf("pareto: min %v, median extra %v", sorted[0], median)
+	}
+	if sorted[samples-1] < delay+5*jitter {
+		t.Fatalf("pareto: no long tail, max %v", sorted[samples-1])
+	}
+
+	// 延迟不会小于0
+	if d := l.delay(Profile{Jitter: time.Second, Distribution: Normal}); d < 0 {
+		t.Fatalf("negative delay %v", d)
+	}
+}
+
+func TestLinkReordersAndDuplicates(t *testing.T) {
+	l, received := newTestLink(t, Profile{Delay: 20 * time.Millisecond, Reorder: 0.2, Duplicate: 0.2})
+	sendNumbered(l, 200)
+	stats := l.Stats()
+	got := waitForPackets(t, received, int(200+stats.Duplicated))
+
+	if stats.Reordered == 0 || stats.Duplicated == 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if slices.IsSorted(got) {
+		t.Fatalf("packets were not reordered")
+	}
+	seen := make(map[uint32]int)
+	for _, n := range got {
+		seen[n]++
+	}
+	if len(seen) != 200 {
+		t.Fatalf("received %d distinct packets, want 200", len(seen))
+	}
+}
+
+func TestOrderedLinkKeepsOrder(t *testing.T) {
+	profile := Profile{Delay: 5 * time.Millisecond, Jitter: 5 * time.Millisecond, Distribution: Normal, Reorder: 0.5, Duplicate: 0.5, Ordered: true}
+	l, received := newTestLink(t, profile)
+	sendNumbered(l, 200)
+	got := waitForPackets(t, received, 200)
+	time.Sleep(20 * time.Millisecond)
+	if got = received(); len(got) != 200 || !slices.IsSorted(got) {
+		t.Fatalf("ordered link delivered %d packets, sorted %v", len(got), slices.IsSorted(got))
+	}
+}
+
+func TestLinkLossAndDelay(t *testing.T) {
+	l, received := newTestLink(t, Profile{Delay: 50 * time.Millisecond, Loss: 0.3})
+	start := time.Now()
+	sendNumbered(l, 1000)
+	stats := l.Stats()
+	if stats.Dropped < 250 || stats.Dropped > 350 {
+		t.Fatalf("dropped %d of 1000 with 30%% loss", stats.Dropped)
+	}
+	if got := received(); len(got) != 0 {
+		t.Fatalf("%d packets delivered before the delay", len(got))
+	}
+	waitForPackets(t, received, int(1000-stats.Dropped))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("delivered after %v", elapsed)
+	}
+	if err := (Profile{Loss: 1.5}).Validate(); err == nil {
+		t.Fatalf("loss above 1 accepted")
+	}
+}
+
+func TestCloseWhenEmptyDeliversQueuedPackets(t *testing.T) {
+	l, received := newTestLink(t, Profile{Delay: 20 * time.Millisecond, Ordered: true})
+	sendNumbered(l, 10)
+	l.CloseWhenEmpty()
+	if got := received(); len(got) != 10 {
+		t.Fatalf("delivered %d of 10 queued packets", len(got))
+	}
+	if l.Send([]byte{0, 0, 0, 0}) {
+		t.Fatalf("closed link accepted a packet")
+	}
+}
+
+func TestSeedMakesLinkReproducible(t *testing.T) {
+	profile := Profile{Delay: 50 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 0.2, Burst: GilbertElliott{GoodToBad: 0.05, BadToGood: 0.3, LossBad: 1}, Duplicate: 0.1}
+	run := func(seed uint64) (Stats, []time.Duration) {
+		l := NewLink(profile, func([]byte) {})
+		defer l.Close()
+		l.Seed(seed)
+		sendNumbered(l, 500)
+		var delays []time.Duration
+		l.mutex.Lock()
+		for i := 0; i < 100; i++ {
+			delays = append(delays, l.delay(profile))
+		}
+		l.mutex.Unlock()
+		stats := l.Stats()
+		stats.Delivered, stats.QueueLength = 0, 0
+		return stats, delays
+	}
+	stats, delays := run(42)
+	againStats, againDelays := run(42)
+	if stats != againStats || !slices.Equal(delays, againDelays) {
+		t.Fatalf("same seed: %+v vs %+v", stats, againStats)
+	}
+	if otherStats, otherDelays := run(43); otherStats == stats && slices.Equal(otherDelays, delays) {
+		t.Fatalf("different seeds gave the same result")
+	}
+}
@@ -0,0 +1,114 @@
+package netsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GilbertElliott 是两状态的突发丢包模型：链路在好、坏两个状态之间按概率切换，
+// 每个状态有自己的丢包率。坏状态的平均持续包数为 1/BadToGood，
+// 处于坏状态的比例为 GoodToBad/(GoodToBad+BadToGood)。概率都是 0~1
+type GilbertElliott struct {
+	GoodToBad float64 // 每个数据包从好状态进入坏状态的概率，为0时不启用
+	BadToGood float64 // 每个数据包从坏状态回到好状态的概率
+	LossGood  float64 // 好状态的丢包率
+	LossBad   float64 // 坏状态的丢包率
+}
+
+// Enabled 返回是否启用
+func (g GilbertElliott) Enabled() bool {
+	return g.GoodToBad > 0
+}
+
+// Validate 检查参数范围
+func (g GilbertElliott) Validate() error {
+	for name, v := range map[string]float64{"good-to-bad": g.GoodToBad, "bad-to-good": g.BadToGood, "good loss": g.LossGood, "bad loss": g.LossBad} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("gilbert-elliott %s probability must be between 0 and 1, got %v", name, v)
+		}
+	}
+	if g.Enabled() && g.BadToGood == 0 {
+		return fmt.Errorf("gilbert-elliott bad-to-good probability must be positive, the link would never recover")
+	}
+	return nil
+}
+
+// ParseGilbertElliott 解析命令行格式 "p,r[,坏状态丢包率[,好状态丢包率]]"，单位都是百分比，
+// 坏状态丢包率默认 100，好状态丢包率默认 0；空字符串表示不启用
+func ParseGilbertElliott(s string) (GilbertElliott, error) {
+	if s == "" {
+		return GilbertElliott{}, nil
+	}
+	fields := strings.Split(s, ",")
+	if len(fields) < 2 || len(fields) > 4 {
+		return GilbertElliott{}, fmt.Errorf("invalid burst loss %q, want p,r[,bad-loss[,good-loss]] in percent", s)
+	}
+	values := []float64{0, 0, 100, 0}
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return GilbertElliott{}, fmt.Errorf("invalid burst loss %q: %v", s, err)
+		}
+		values[i] = v
+	}
+	g := GilbertElliott{GoodToBad: values[0] / 100, BadToGood: values[1] / 100, LossBad: values[2] / 100, LossGood: values[3] / 100}
+	return g, g.Validate()
+}
+
+// Outage 是周期性的断网窗口：从链路创建起每隔 Every，断开 Duration，期间所有数据包都被丢弃
+// （Ordered 链路不丢弃，推迟到断网结束后发出）
+type Outage struct {
+	Every    time.Duration // 周期，为0时不启用
+	Duration time.Duration // 每次断开的时长
+}
+
+// Enabled 返回是否启用
+func (o Outage) Enabled() bool {
+	return o.Every > 0 && o.Duration > 0
+}
+
+// Validate 检查参数范围
+func (o Outage) Validate() error {
+	if o.Every < 0 || o.Duration < 0 {
+		return fmt.Errorf("outage period and duration must not be negative")
+	}
+	if o.Enabled() && o.Duration >= o.Every {
+		return fmt.Errorf("outage duration %v must be shorter than its period %v", o.Duration, o.Every)
+	}
+	return nil
+}
+
+// Active 返回链路创建后 elapsed 时刻是否处于断网窗口（第一次断网在一个周期之后）
+func (o Outage) Active(elapsed time.Duration) bool {
+	return o.Enabled() && elapsed >= o.Every && elapsed%o.Every < o.Duration
+}
+
+// Remaining 返回链路创建后 elapsed 时刻距离这次断网结束的时间，不在断网窗口时返回0
+func (o Outage) Remaining(elapsed time.Duration) time.Duration {
+	if !o.Active(elapsed) {
+		return 0
+	}
+	return o.Duration - elapsed%o.Every
+}
+
+// ParseOutage 解析命令行格式 "时长/周期"，例如 "2s/30s" 表示每 30 秒断网 2 秒；空字符串表示不启用
+func ParseOutage(s string) (Outage, error) {
+	if s == "" {
+		return Outage{}, nil
+	}
+	duration, every, found := strings.Cut(s, "/")
+	if !found {
+		return Outage{}, fmt.Errorf("invalid outage %q, want duration/period such as 2s/30s", s)
+	}
+	var o Outage
+	var err error
+	if o.Duration, err = time.ParseDuration(duration); err != nil {
+		return Outage{}, fmt.Errorf("invalid outage %q: %v", s, err)
+	}
+	if o.Every, err = time.ParseDuration(every); err != nil {
+		return Outage{}, fmt.Errorf("invalid outage %q: %v", s, err)
+	}
+	return o, o.Validate()
+}
@@ -0,0 +1,122 @@
+package netsim
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGilbertElliottBursts(t *testing.T) {
+	const packets = 100000
+	burst := GilbertElliott{GoodToBad: 0.02, BadToGood: 0.25, LossBad: 1}
+	l := &Link{rng: rand.New(rand.NewPCG(1, 2)), created: time.Now()}
+	p := Profile{Burst: burst}
+
+	var lost, bursts int
+	previous := false
+	for i := 0; i < packets; i++ {
+		dropped := l.lost(p, l.created)
+		if dropped {
+			lost++
+			if !previous {
+				bursts++
+			}
+		}
+		previous = dropped
+	}
+	// 坏状态占比 p/(p+r)，平均连续丢包 1/r
+	wantRate := burst.GoodToBad / (burst.GoodToBad + burst.BadToGood)
+	if rate := float64(lost) / packets; math.Abs(rate-wantRate) > 0.01 {
+		t.Fatalf("loss rate %.3f, want %.3f", rate, wantRate)
+	}
+	if mean := float64(lost) / float64(bursts); math.Abs(mean-1/burst.BadToGood) > 0.3 {
+		t.Fatalf("mean burst length %.2f, want %.2f", mean, 1/burst.BadToGood)
+	}
+	if l.stats.BurstLost != int64(lost) {
+		t.Fatalf("burst lost %d, want %d", l.stats.BurstLost, lost)
+	}
+}
+
+func TestOutageWindows(t *testing.T) {
+	o := Outage{Every: 30 * time.Second, Duration: 2 * time.Second}
+	for _, c := range []struct {
+		elapsed time.Duration
+		active  bool
+	}{
+		{0, false},
+		{time.Second, false},
+		{30 * time.Second, true},
+		{31500 * time.Millisecond, true},
+		{32 * time.Second, false},
+		{61 * time.Second, true},
+	} {
+		if got := o.Active(c.elapsed); got != c.active {
+			t.Fatalf("active at %v = %v, want %v", c.elapsed, got, c.active)
+		}
+	}
+
+	l, received := newTestLink(t, Profile{Outage: Outage{Every: 100 * time.Millisecond, Duration: 90 * time.Millisecond}})
+	sendNumbered(l, 1)
+	time.Sleep(120 * time.Millisecond)
+	if l.Send([]byte{0, 0, 0, 1}) {
+		t.Fatalf("packet sent during outage")
+	}
+	if stats := l.Stats(); stats.OutageLost != 1 || stats.Dropped != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	waitForPackets(t, received, 1)
+}
+
+func TestOrderedLinkHoldsDataDuringOutage(t *testing.T) {
+	o := Outage{Every: 30 * time.Second, Duration: 2 * time.Second}
+	if got := o.Remaining(31500 * time.Millisecond); got != 500*time.Millisecond {
+		t.Fatalf("remaining %v", got)
+	}
+	if got := o.Remaining(32 * time.Second); got != 0 {
+		t.Fatalf("remaining after the window %v", got)
+	}
+
+	// 字节流不丢包：Loss 和 Burst 被忽略，断网期间的数据在断网结束后按顺序发出
+	profile := Profile{Loss: 1, Burst: GilbertElliott{GoodToBad: 1, LossBad: 1}, Outage: Outage{Every: 200 * time.Millisecond, Duration: 180 * time.Millisecond}, Ordered: true}
+	l, received := newTestLink(t, profile)
+	sendNumbered(l, 1)
+	time.Sleep(220 * time.Millisecond)
+	start := time.Now()
+	if !l.Send([]byte{0, 0, 0, 1}) {
+		t.Fatalf("ordered link dropped a packet during outage")
+	}
+	got := waitForPackets(t, received, 2)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || !slices.IsSorted(got) {
+		t.Fatalf("held packet delivered after %v, order %v", elapsed, got)
+	}
+	if stats := l.Stats(); stats.Dropped != 0 || stats.OutageHeld != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestParseLossModels(t *testing.T) {
+	burst, err := ParseGilbertElliott("2, 25")
+	if err != nil || burst != (GilbertElliott{GoodToBad: 0.02, BadToGood: 0.25, LossBad: 1}) {
+		t.Fatalf("burst %+v, %v", burst, err)
+	}
+	burst, err = ParseGilbertElliott("1,10,80,0.5")
+	if err != nil || burst != (GilbertElliott{GoodToBad: 0.01, BadToGood: 0.1, LossBad: 0.8, LossGood: 0.005}) {
+		t.Fatalf("burst %+v, %v", burst, err)
+	}
+	outage, err := ParseOutage("2s/30s")
+	if err != nil || outage != (Outage{Every: 30 * time.Second, Duration: 2 * time.Second}) {
+		t.Fatalf("outage %+v, %v", outage, err)
+	}
+	for _, bad := range []string{"5", "5,0", "5,150", "x,1"} {
+		if _, err := ParseGilbertElliott(bad); err == nil {
+			t.Fatalf("burst %q accepted", bad)
+		}
+	}
+	for _, bad := range []string{"2s", "30s/2s", "2x/30s"} {
+		if _, err := ParseOutage(bad); err == nil {
+			t.Fatalf("outage %q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package netsim
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueuePolicy 是瓶颈队列满时的丢包策略
+type QueuePolicy string
+
+const (
+	TailDrop QueuePolicy = "taildrop" // 队列满时丢弃新到的数据包
+	RED      QueuePolicy = "red"      // Random Early Detection：平均队列长度超过阈值后按概率提前丢包
+)
+
+// 默认的令牌桶容量（字节，一个以太网 MTU）和瓶颈队列长度（数据包数）
+const (
+	DefaultBucketSize = 1500
+	DefaultQueueLimit = 100
+)
+
+// RED 参数：平均队列长度在队列上限的 1/4 到 3/4 之间时丢包概率从0线性增加到 redMaxP，
+// 超过 3/4 时全部丢弃；平均队列长度是指数移动平均
+const (
+	redMinFraction = 0.25
+	redMaxFraction = 0.75
+	redMaxP        = 0.1
+	redWeight      = 0.2
+)
+
+// ParseQueuePolicy 解析队列策略名称
+func ParseQueuePolicy(name string) (QueuePolicy, error) {
+	switch q := QueuePolicy(name); q {
+	case TailDrop, RED:
+		return q, nil
+	}
+	return "", fmt.Errorf("unknown queue policy %q (taildrop or red)", name)
+}
+
+// 瓶颈链路：令牌桶限速，数据包先进先出排队等待令牌
+type bottleneck struct {
+	tokens     float64     // 令牌（字节）
+	updated    time.Time   // tokens 对应的时间
+	departures []time.Time // 队列中数据包离开瓶颈的时间，按先后顺序
+	average    float64     // RED 的平均队列长度
+}
+
+// 当前队列中的数据包数（去掉已经离开的）
+func (b *bottleneck) length(now time.Time) int {
+	i := 0
+	for i < len(b.departures) && !b.departures[i].After(now) {
+		i++
+	}
+	b.departures = b.departures[i:]
+	return len(b.departures)
+}
+
+// 把数据包放进瓶颈队列，返回离开瓶颈的时间；被队列丢弃时返回 false（调用方持有锁）
+func (l *Link) enqueue(p Profile, now time.Time, size int) (time.Time, bool) {
+	if p.Bandwidth <= 0 {
+		return now, true
+	}
+	b := &l.bottleneck
+	queued := b.length(now)
+
+	// Ordered 链路（TCP）丢掉数据会破坏字节流，队列不设上限，只增加延迟
+	if !p.Ordered {
+		limit := p.QueueLimit
+		if limit <= 0 {
+			limit = DefaultQueueLimit
+		}
+		if queued >= limit || (p.QueuePolicy == RED && l.redDrop(queued, limit)) {
+			l.stats.QueueDropped++
+			return time.Time{}, false
+		}
+	}
+
+	// 从队尾数据包离开时开始等令牌
+	bucket := float64(p.BucketSize)
+	if bucket <= 0 {
+		bucket = DefaultBucketSize
+	}
+	start := now
+	if queued > 0 {
+		start = b.departures[queued-1]
+	}
+	rate := float64(p.Bandwidth) / 8 // 字节/秒
+	if b.updated.IsZero() {
+		b.tokens, b.updated = bucket, start
+	}
+	b.tokens = min(bucket, b.tokens+rate*start.Sub(b.updated).Seconds())
+	departure := start
+	if need := float64(size) - b.tokens; need > 0 {
+		departure = start.Add(time.Duration(need / rate * float64(time.Second)))
+		b.tokens = 0
+	} else {
+		b.tokens -= float64(size)
+	}
+	b.updated = departure
+	b.departures = append(b.departures, departure)
+
+	wait := departure.Sub(now)
+	l.stats.Queued++
+	l.stats.QueueDelayTotal += wait
+	l.stats.QueueDelayMax = max(l.stats.QueueDelayMax, wait)
+	return departure, true
+}
+
+// RED：更新平均队列长度并决定是否提前丢弃（调用方持有锁）
+func (l *Link) redDrop(queued, limit int) bool {
+	b := &l.bottleneck
+	b.average = (1-redWeight)*b.average + redWeight*float64(queued)
+	low, high := redMinFraction*float64(limit), redMaxFraction*float64(limit)
+	switch {
+	case b.average < low:
+		return false
+	case b.average >= high:
+		return true
+	}
+	return l.rng.Float64() < redMaxP*(b.average-low)/(high-low)
+}
@@ -0,0 +1,110 @@
+package netsim
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// 不启动发送 goroutine，直接测试瓶颈队列
+func newQueueTestLink() *Link {
+	return &Link{rng: rand.New(rand.NewPCG(1, 2)), created: time.Now()}
+}
+
+func TestTokenBucketPacing(t *testing.T) {
+	l := newQueueTestLink()
+	// 64kbps = 8000 字节/秒，1000 字节的包每个需要 125ms
+	p := Profile{Bandwidth: 64000, BucketSize: 1000}
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		departure, ok := l.enqueue(p, now, 1000)
+		if !ok {
+			t.Fatalf("packet %d dropped", i)
+		}
+		if want := time.Duration(i) * 125 * time.Millisecond; departure.Sub(now) != want {
+			t.Fatalf("packet %d leaves after %v, want %v", i, departure.Sub(now), want)
+		}
+	}
+	if l.stats.QueueDelayMax != 19*125*time.Millisecond || l.stats.Queued != 20 {
+		t.Fatalf("stats %+v", l.stats)
+	}
+	if mean := l.stats.QueueDelayMean(); mean != 19*125*time.Millisecond/2 {
+		t.Fatalf("mean queue delay %v", mean)
+	}
+
+	// 空闲后令牌恢复，但不超过桶容量
+	later := now.Add(10 * time.Second)
+	if departure, _ := l.enqueue(p, later, 1000); !departure.Equal(later) {
+		t.Fatalf("packet after idle waited %v", departure.Sub(later))
+	}
+	if departure, _ := l.enqueue(p, later, 1000); departure.Sub(later) != 125*time.Millisecond {
+		t.Fatalf("second packet after idle waited %v", departure.Sub(later))
+	}
+}
+
+func TestQueueTailDrop(t *testing.T) {
+	l := newQueueTestLink()
+	p := Profile{Bandwidth: 8000, BucketSize: 100, QueueLimit: 5}
+	now := time.Now()
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		if _, ok := l.enqueue(p, now, 100); ok {
+			accepted++
+		}
+	}
+	// 第一个包用桶里的令牌立即离开，不占队列
+	if accepted != 6 || l.stats.QueueDropped != 4 {
+		t.Fatalf("accepted %d, queue dropped %d", accepted, l.stats.QueueDropped)
+	}
+	if n := l.bottleneck.length(now); n != 5 {
+		t.Fatalf("queue length %d", n)
+	}
+
+	// Ordered 链路不在队列丢包
+	l = newQueueTestLink()
+	p.Ordered = true
+	for i := 0; i < 10; i++ {
+		if _, ok := l.enqueue(p, now, 100); !ok {
+			t.Fatalf("ordered link dropped packet %d", i)
+		}
+	}
+}
+
+func TestQueueRED(t *testing.T) {
+	l := newQueueTestLink()
+	p := Profile{Bandwidth: 8000, QueueLimit: 100, QueuePolicy: RED}
+	now := time.Now()
+	longest := 0
+	for i := 0; i < 300; i++ {
+		l.enqueue(p, now, 500)
+		longest = max(longest, l.bottleneck.length(now))
+	}
+	// 平均队列长度超过阈值后提前丢包，队列不会被填满
+	if l.stats.QueueDropped == 0 || longest >= p.QueueLimit {
+		t.Fatalf("queue dropped %d, longest queue %d", l.stats.QueueDropped, longest)
+	}
+	if longest < int(redMinFraction*float64(p.QueueLimit)) {
+		t.Fatalf("dropped before the minimum threshold, longest queue %d", longest)
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	// 80kbps = 10000 字节/秒：10 个 500 字节的包大约需要 0.45 秒
+	l, received := newTestLink(t, Profile{Bandwidth: 80000, BucketSize: 500})
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		data := make([]byte, 500)
+		data[3] = byte(i)
+		l.Send(data)
+	}
+	if stats := l.Stats(); stats.QueueLength != 9 {
+		t.Fatalf("queue length %d, want 9", stats.QueueLength)
+	}
+	waitForPackets(t, received, 10)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("10 packets delivered in %v", elapsed)
+	}
+	if err := (Profile{QueuePolicy: "fifo"}).Validate(); err == nil {
+		t.Fatalf("unknown queue policy accepted")
+	}
+}
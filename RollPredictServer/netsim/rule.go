@@ -0,0 +1,344 @@
+package netsim
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+// Rule 是按解码出的消息选择性丢包的规则，条件都满足时按概率丢弃包含这条消息的数据包。
+// 文本形式是消息类型加上条件，例如：
+//
+//	SERVER_FRAME down player=3 prob=50%   丢弃发给玩家3的服务器帧的一半
+//	FRAME_NEED once                       每个补帧回复第一次发送时丢弃，客户端重新请求后收到
+//	FRAME_DATA up client=127.0.0.1 frame=100-120
+//
+// 消息类型可以带或不带 MESSAGE_ 前缀，* 表示任意类型
+type Rule struct {
+	Type        myproto.MessageType // MESSAGE_UNKNOWN 表示任意类型
+	Port        string              // tcp、udp 或 kcp，为空时任意端口
+	Direction   string              // up、down，为空时两个方向
+	Client      string              // 客户端地址，可以只写 IP
+	Player      int32               // 客户端的玩家ID（MatchPlayer 为 true 时）
+	MatchPlayer bool
+	FirstFrame  int64 // 帧号范围（MatchFrame 为 true 时），只匹配带帧号的消息
+	LastFrame   int64
+	MatchFrame  bool
+	Probability float64 // 丢弃概率，为 0 时总是丢弃
+	Count       int     // 所有链路合计最多丢弃的数据包数，为 0 时不限
+	// 每条链路上相同的消息（类型和帧号相同，补帧回复按第一帧）只丢弃一次，再次发送时放行
+	Once bool
+}
+
+// Flow 描述数据包所在的链路，用于匹配规则
+type Flow struct {
+	Port   string
+	Client string // 客户端地址 ip:port
+	Up     bool   // 客户端->服务器
+	Player int32  // 客户端的玩家ID，还不知道时为 -1
+}
+
+// ParseRule 解析规则的文本形式：消息类型，然后是 up、down、once 或 key=value 条件，
+// 条件有 port、client、player、frame（N 或 A-B）、prob（百分比）、count
+func ParseRule(s string) (Rule, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Rule{}, fmt.Errorf("empty rule")
+	}
+	var r Rule
+	var err error
+	if r.Type, err = parseMessageType(fields[0]); err != nil {
+		return Rule{}, err
+	}
+	for _, field := range fields[1:] {
+		switch field {
+		case "up", "down":
+			r.Direction = field
+			continue
+		case "once":
+			r.Once = true
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("unknown condition %q in rule %q", field, s)
+		}
+		switch key {
+		case "port":
+			if value != "tcp" && value != "udp" && value != "kcp" {
+				err = fmt.Errorf("unknown port")
+			}
+			r.Port = value
+		case "client":
+			r.Client = value
+		case "player":
+			var player int64
+			player, err = strconv.ParseInt(value, 10, 32)
+			r.Player, r.MatchPlayer = int32(player), true
+		case "frame":
+			r.FirstFrame, r.LastFrame, err = parseFrameRange(value)
+			r.MatchFrame = true
+		case "prob":
+			r.Probability, err = parsePercent(value)
+			if err == nil && (r.Probability <= 0 || r.Probability > 1) {
+				err = fmt.Errorf("must be above 0%% and at most 100%%")
+			}
+			if r.Probability == 1 {
+				r.Probability = 0 // 和不写相同
+			}
+		case "count":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return Rule{}, fmt.Errorf("unknown condition %q in rule %q", key, s)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid %s %q: %v", key, value, err)
+		}
+	}
+	return r, nil
+}
+
+// 消息类型名称，不区分大小写
+func parseMessageType(s string) (myproto.MessageType, error) {
+	if s == "*" || s == "any" {
+		return myproto.MessageType_MESSAGE_UNKNOWN, nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "MESSAGE_") {
+		name = "MESSAGE_" + name
+	}
+	value, ok := myproto.MessageType_value[name]
+	if !ok || value == int32(myproto.MessageType_MESSAGE_UNKNOWN) {
+		return 0, fmt.Errorf("unknown message type %q", s)
+	}
+	return myproto.MessageType(value), nil
+}
+
+// N 或 A-B，A- 表示从 A 开始
+func parseFrameRange(s string) (int64, int64, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	a, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return a, a, nil
+	}
+	if last == "" {
+		return a, 1<<63 - 1, nil
+	}
+	b, err := strconv.ParseInt(last, 10, 64)
+	if err == nil && b < a {
+		err = fmt.Errorf("empty range")
+	}
+	return a, b, err
+}
+
+// String 返回规则的文本形式
+func (r Rule) String() string {
+	parts := []string{"*"}
+	if r.Type != myproto.MessageType_MESSAGE_UNKNOWN {
+		parts[0] = strings.TrimPrefix(r.Type.String(), "MESSAGE_")
+	}
+	if r.Direction != "" {
+		parts = append(parts, r.Direction)
+	}
+	if r.Port != "" {
+		parts = append(parts, "port="+r.Port)
+	}
+	if r.Client != "" {
+		parts = append(parts, "client="+r.Client)
+	}
+	if r.MatchPlayer {
+		parts = append(parts, fmt.Sprintf("player=%d", r.Player))
+	}
+	if r.MatchFrame {
+		switch {
+		case r.FirstFrame == r.LastFrame:
+			parts = append(parts, fmt.Sprintf("frame=%d", r.FirstFrame))
+		case r.LastFrame == 1<<63-1:
+			parts = append(parts, fmt.Sprintf("frame=%d-", r.FirstFrame))
+		default:
+			parts = append(parts, fmt.Sprintf("frame=%d-%d", r.FirstFrame, r.LastFrame))
+		}
+	}
+	if r.Probability > 0 && r.Probability < 1 {
+		parts = append(parts, fmt.Sprintf("prob=%g%%", r.Probability*100))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("count=%d", r.Count))
+	}
+	if r.Once {
+		parts = append(parts, "once")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Matches 返回消息是否满足规则的条件（不考虑概率和次数）
+func (r Rule) Matches(flow Flow, m Message) bool {
+	if r.Type != myproto.MessageType_MESSAGE_UNKNOWN && r.Type != m.Type {
+		return false
+	}
+	if r.Port != "" && r.Port != flow.Port {
+		return false
+	}
+	if r.Direction != "" && (r.Direction == "up") != flow.Up {
+		return false
+	}
+	if r.Client != "" && r.Client != flow.Client {
+		if host, _, err := net.SplitHostPort(flow.Client); err != nil || host != r.Client {
+			return false
+		}
+	}
+	if r.MatchPlayer && r.Player != flow.Player {
+		return false
+	}
+	if r.MatchFrame {
+		frame := m.FrameNumber()
+		if frame < r.FirstFrame || frame > r.LastFrame {
+			return false
+		}
+	}
+	return true
+}
+
+// RuleStats 是一条规则和它的计数
+type RuleStats struct {
+	Rule    Rule
+	Matched int64 // 满足条件的消息
+	Dropped int64 // 因此丢弃的数据包
+}
+
+// Rules 是按顺序检查的一组丢包规则，可以并发调用
+type Rules struct {
+	mutex sync.Mutex
+	rules []ruleState
+}
+
+type ruleState struct {
+	RuleStats
+	dropped map[onceLink]*onceSeen // Once 规则在每条链路上已经丢弃过的消息
+}
+
+// 每条链路最多记住的已丢弃消息数，超过后忘记最早的。
+// 重发通常在几秒之内，远小于这个窗口，长时间运行时内存不会一直增长
+const onceWindow = 1024
+
+// Once 规则按链路记录
+type onceLink struct {
+	port, client string
+	up           bool
+}
+
+// Once 规则区分消息的方式：类型和帧号相同的消息算同一条
+type onceMessage struct {
+	messageType myproto.MessageType
+	frame       int64
+}
+
+func newOnceMessage(m Message) onceMessage {
+	frame := m.FrameNumber()
+	// 补帧回复没有自己的帧号，重新请求同样的帧时第一帧相同
+	if body, ok := m.Body.(*myproto.SendAllFrame); ok && len(body.AllNeedFrame) > 0 {
+		frame = body.AllNeedFrame[0].FrameNumber
+	}
+	return onceMessage{messageType: m.Type, frame: frame}
+}
+
+// 一条链路上最近丢弃过的消息，按丢弃顺序循环覆盖
+type onceSeen struct {
+	seen  map[onceMessage]bool
+	order []onceMessage
+	next  int // order 满了之后下一个覆盖的位置
+}
+
+func (o *onceSeen) add(m onceMessage) {
+	if len(o.order) < onceWindow {
+		o.order = append(o.order, m)
+	} else {
+		delete(o.seen, o.order[o.next])
+		o.order[o.next] = m
+		o.next = (o.next + 1) % onceWindow
+	}
+	o.seen[m] = true
+}
+
+// NewRules 创建空的规则列表
+func NewRules() *Rules {
+	return &Rules{}
+}
+
+// Add 添加一条规则
+func (r *Rules) Add(rule Rule) {
+	r.mutex.Lock()
+	r.rules = append(r.rules, ruleState{RuleStats: RuleStats{Rule: rule}, dropped: make(map[onceLink]*onceSeen)})
+	r.mutex.Unlock()
+}
+
+// Clear 删除所有规则
+func (r *Rules) Clear() {
+	r.mutex.Lock()
+	r.rules = nil
+	r.mutex.Unlock()
+}
+
+// Stats 返回规则和计数的副本
+func (r *Rules) Stats() []RuleStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stats := make([]RuleStats, len(r.rules))
+	for i, state := range r.rules {
+		stats[i] = state.RuleStats
+	}
+	return stats
+}
+
+// Forget 忘记 Once 规则在这条链路上丢弃过的消息，在链路关闭时调用
+func (r *Rules) Forget(flow Flow) {
+	link := onceLink{port: flow.Port, client: flow.Client, up: flow.Up}
+	r.mutex.Lock()
+	for _, state := range r.rules {
+		delete(state.dropped, link)
+	}
+	r.mutex.Unlock()
+}
+
+// Drop 判断数据包是否因为其中的某条消息被规则丢弃，返回丢弃它的规则。
+// 概率由调用方的 rng 决定，每条链路使用自己的 rng 时结果不受其他链路的影响
+func (r *Rules) Drop(flow Flow, messages []Message, rng *rand.Rand) (Rule, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, m := range messages {
+		for i := range r.rules {
+			state := &r.rules[i]
+			if (state.Rule.Count > 0 && state.Dropped >= int64(state.Rule.Count)) || !state.Rule.Matches(flow, m) {
+				continue
+			}
+			link := onceLink{port: flow.Port, client: flow.Client, up: flow.Up}
+			message := newOnceMessage(m)
+			if state.Rule.Once && state.dropped[link] != nil && state.dropped[link].seen[message] {
+				continue
+			}
+			state.Matched++
+			if p := state.Rule.Probability; p == 0 || rng.Float64() < p {
+				state.Dropped++
+				if state.Rule.Once {
+					if state.dropped[link] == nil {
+						state.dropped[link] = &onceSeen{seen: make(map[onceMessage]bool)}
+					}
+					state.dropped[link].add(message)
+				}
+				return state.Rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
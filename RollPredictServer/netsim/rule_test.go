@@ -0,0 +1,137 @@
+package netsim
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, c := range []struct{ text, want string }{
+		{"SERVER_FRAME down player=3 prob=50%", "SERVER_FRAME down player=3 prob=50%"},
+		{"message_frame_need once", "FRAME_NEED once"},
+		{"FRAME_NEED once down count=1", "FRAME_NEED down count=1 once"},
+		{"* up port=udp client=127.0.0.1 frame=100-", "* up port=udp client=127.0.0.1 frame=100-"},
+		{"FRAME_DATA frame=7 count=3 prob=100", "FRAME_DATA frame=7 count=3"},
+	} {
+		rule, err := ParseRule(c.text)
+		if err != nil || rule.String() != c.want {
+			t.Fatalf("%q: got %q, %v", c.text, rule, err)
+		}
+		if again, err := ParseRule(rule.String()); err != nil || again != rule {
+			t.Fatalf("%q does not round-trip: %+v, %v", rule, again, err)
+		}
+	}
+	for _, bad := range []string{"", "UNKNOWN", "NO_SUCH_TYPE", "FRAME_DATA sideways", "FRAME_DATA color=red", "FRAME_DATA port=http",
+		"FRAME_DATA player=x", "FRAME_DATA frame=9-3", "FRAME_DATA prob=0", "FRAME_DATA prob=150%", "FRAME_DATA count=0"} {
+		if _, err := ParseRule(bad); err == nil {
+			t.Fatalf("%q accepted", bad)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	frame := func(n int64) Message {
+		return Message{Type: myproto.MessageType_MESSAGE_SERVER_FRAME, Body: &myproto.ServerFrame{FrameNumber: n}}
+	}
+	flow := Flow{Port: "udp", Client: "127.0.0.1:5000", Player: 3}
+	for _, c := range []struct {
+		rule  string
+		flow  Flow
+		m     Message
+		match bool
+	}{
+		{"SERVER_FRAME down player=3", flow, frame(1), true},
+		{"SERVER_FRAME down player=4", flow, frame(1), false},
+		{"SERVER_FRAME up", flow, frame(1), false},
+		{"FRAME_DATA", flow, frame(1), false},
+		{"* client=127.0.0.1 port=udp", flow, frame(1), true},
+		{"* client=127.0.0.1:5001", flow, frame(1), false},
+		{"* port=kcp", flow, frame(1), false},
+		{"* frame=10-20", flow, frame(20), true},
+		{"* frame=10-20", flow, frame(21), false},
+		{"* frame=0-", flow, Message{Type: myproto.MessageType_MESSAGE_PONG}, false},
+	} {
+		rule, err := ParseRule(c.rule)
+		if err != nil {
+			t.Fatalf("%q: %v", c.rule, err)
+		}
+		if got := rule.Matches(c.flow, c.m); got != c.match {
+			t.Fatalf("%q matches %v: %v, want %v", c.rule, c.m.Summary(), got, c.match)
+		}
+	}
+}
+
+func TestRulesDrop(t *testing.T) {
+	rules := NewRules()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, text := range []string{"FRAME_NEED once", "SERVER_FRAME prob=50%"} {
+		rule, err := ParseRule(text)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		rules.Add(rule)
+	}
+	flow := Flow{Port: "udp", Client: "127.0.0.1:5000", Player: -1}
+	other := Flow{Port: "udp", Client: "127.0.0.1:5001", Player: -1}
+	need := func(first int64) []Message {
+		return []Message{{Type: myproto.MessageType_MESSAGE_FRAME_NEED, Body: &myproto.SendAllFrame{
+			AllNeedFrame: []*myproto.ServerFrame{{FrameNumber: first}, {FrameNumber: first + 1}},
+		}}}
+	}
+	// once：每个补帧回复第一次发送时丢弃，重新发送同样的回复时放行；其他链路和其他帧单独计算
+	for _, c := range []struct {
+		flow    Flow
+		first   int64
+		dropped bool
+	}{
+		{flow, 5, true},
+		{flow, 5, false},
+		{other, 5, true},
+		{flow, 9, true},
+		{flow, 9, false},
+	} {
+		if rule, dropped := rules.Drop(c.flow, need(c.first), rng); dropped != c.dropped || (dropped && !rule.Once) {
+			t.Fatalf("FRAME_NEED from %d to %s: dropped %v, want %v", c.first, c.flow.Client, dropped, c.dropped)
+		}
+	}
+
+	// 一个数据包中有一条消息匹配就丢弃整个数据包
+	frames := []Message{{Type: myproto.MessageType_MESSAGE_PONG}, {Type: myproto.MessageType_MESSAGE_SERVER_FRAME}}
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := rules.Drop(flow, frames, rng); ok {
+			dropped++
+		}
+	}
+	if dropped < 450 || dropped > 550 {
+		t.Fatalf("dropped %d of 1000 with 50%%", dropped)
+	}
+	// 只记住每条链路最近的 onceWindow 条，链路关闭后全部忘记
+	for frame := int64(100); frame < 100+onceWindow; frame++ {
+		rules.Drop(flow, need(frame), rng)
+	}
+	if _, dropped := rules.Drop(flow, need(5), rng); !dropped {
+		t.Fatalf("FRAME_NEED outside the window not dropped again")
+	}
+	rules.Forget(other)
+	if _, dropped := rules.Drop(other, need(5), rng); !dropped {
+		t.Fatalf("FRAME_NEED not dropped again after the link closed")
+	}
+	rules.mutex.Lock()
+	remembered := len(rules.rules[0].dropped[onceLink{port: flow.Port, client: flow.Client}].seen)
+	rules.mutex.Unlock()
+	if remembered != onceWindow {
+		t.Fatalf("remembered %d messages, want %d", remembered, onceWindow)
+	}
+
+	stats := rules.Stats()
+	if stats[0].Matched != 5+onceWindow || stats[0].Dropped != 5+onceWindow || stats[1].Matched != 1000 || stats[1].Dropped != int64(dropped) {
+		t.Fatalf("stats %+v", stats)
+	}
+	rules.Clear()
+	if _, ok := rules.Drop(flow, frames, rng); ok || len(rules.Stats()) != 0 {
+		t.Fatalf("rules not cleared")
+	}
+}
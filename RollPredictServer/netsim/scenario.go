@@ -0,0 +1,65 @@
+package netsim
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Step 是场景中的一步：从场景开始经过 At 后执行 Command
+type Step struct {
+	At      time.Duration
+	Command Command
+}
+
+// ParseScenario 解析场景文件。每一步写成 "t=<时间> <命令>"，用换行或分号分隔，# 之后是注释：
+//
+//	t=10s set loss 20%
+//	t=20s blackout 3s; t=30s kcp set delay 200ms up
+//	t=60s end
+//
+// 返回的步骤按时间排序，时间相同时保持文件中的顺序
+func ParseScenario(r io.Reader) ([]Step, error) {
+	var steps []Step
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, item := range strings.Split(text, ";") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			step, err := parseStep(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			steps = append(steps, step)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(steps, func(a, b Step) int { return cmp.Compare(a.At, b.At) })
+	return steps, nil
+}
+
+func parseStep(s string) (Step, error) {
+	at, command, found := strings.Cut(s, " ")
+	value, isTime := strings.CutPrefix(at, "t=")
+	if !found || !isTime {
+		return Step{}, fmt.Errorf("want t=<time> <command>, got %q", s)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return Step{}, fmt.Errorf("invalid time %q", at)
+	}
+	c, err := ParseCommand(command)
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{At: d, Command: c}, nil
+}
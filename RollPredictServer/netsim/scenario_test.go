@@ -0,0 +1,124 @@
+package netsim
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestParseCommand(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want Command
+	}{
+		{"set loss 20%", Command{Action: ActionSet, Param: "loss", Value: "20%"}},
+		{"kcp set delay 200ms up", Command{Target: "kcp", Action: ActionSet, Param: "delay", Value: "200ms", Direction: "up"}},
+		{"blackout 3s down", Command{Action: ActionBlackout, Duration: 3 * time.Second, Direction: "down"}},
+		{"udp reset", Command{Target: "udp", Action: ActionReset}},
+		{"end", Command{Action: ActionEnd}},
+		{"drop clear", Command{Action: ActionDrop, Param: "clear"}},
+		{"udp drop SERVER_FRAME player=3 down", Command{Action: ActionDrop, Rule: Rule{
+			Type: myproto.MessageType_MESSAGE_SERVER_FRAME, Port: "udp", Direction: "down", Player: 3, MatchPlayer: true}}},
+	} {
+		got, err := ParseCommand(c.text)
+		if err != nil || got != c.want {
+			t.Fatalf("%q: got %+v, %v", c.text, got, err)
+		}
+	}
+	for _, bad := range []string{"", "kcp", "set loss", "set color red", "set loss 150", "blackout", "blackout -1s", "reset now", "kcp end", "jump", "up set loss 5", "drop", "drop once", "kcp drop clear"} {
+		if _, err := ParseCommand(bad); err == nil {
+			t.Fatalf("%q accepted", bad)
+		}
+	}
+
+	up := Command{Target: "kcp", Direction: "up"}
+	if !up.AppliesTo("kcp", true) || up.AppliesTo("kcp", false) || up.AppliesTo("udp", true) {
+		t.Fatalf("direction and target filtering")
+	}
+	if all := (Command{}); !all.AppliesTo("tcp", false) {
+		t.Fatalf("command without target and direction")
+	}
+}
+
+func TestSetParam(t *testing.T) {
+	p := Profile{Loss: 0.1}
+	steps := [][2]string{
+		{"delay", "80"}, {"jitter", "15ms"}, {"jitter-dist", "pareto"}, {"loss", "20%"}, {"reorder", "2"},
+		{"burst", "2,25"}, {"outage", "2s/30s"}, {"bandwidth", "256kbps"}, {"queue", "50"}, {"queue-policy", "red"},
+	}
+	var err error
+	for _, step := range steps {
+		if p, err = SetParam(p, step[0], step[1]); err != nil {
+			t.Fatalf("set %s %s: %v", step[0], step[1], err)
+		}
+	}
+	want := "delay=80ms jitter=15ms(pareto) loss=20% reorder=2% burst=2,25,100,0 outage=2s/30s bandwidth=256kbps"
+	if p.String() != want || p.QueueLimit != 50 || p.QueuePolicy != RED {
+		t.Fatalf("profile %q", p)
+	}
+	if p, err = SetParam(p, "burst", "off"); err != nil || p.Burst.Enabled() {
+		t.Fatalf("burst off: %+v, %v", p.Burst, err)
+	}
+	if _, err = SetParam(p, "jitter", "-5"); err == nil {
+		t.Fatalf("negative jitter accepted")
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	text := `
+# 先稳定10秒
+t=10s set loss 20%
+t=20s blackout 3s; t=15s kcp set delay 200ms up   # 乱序也可以
+t=20s reset
+t=60s end
+`
+	steps, err := ParseScenario(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var got []string
+	for _, step := range steps {
+		got = append(got, step.At.String()+" "+step.Command.String())
+	}
+	want := []string{"10s set loss 20%", "15s kcp set delay 200ms up", "20s blackout 3s", "20s reset", "1m0s end"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("steps %q", got)
+	}
+
+	for _, bad := range []string{"set loss 20%", "t=5 set loss 1", "t=-1s reset", "t=1s set loss x"} {
+		if _, err := ParseScenario(strings.NewReader("t=0s reset\n" + bad)); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Fatalf("%q: err %v", bad, err)
+		}
+	}
+}
+
+func TestLinkBlackout(t *testing.T) {
+	l, received := newTestLink(t, Profile{})
+	l.Blackout(time.Now().Add(50 * time.Millisecond))
+	if l.Send([]byte{0, 0, 0, 0}) {
+		t.Fatalf("packet sent during blackout")
+	}
+	time.Sleep(60 * time.Millisecond)
+	sendNumbered(l, 1)
+	waitForPackets(t, received, 1)
+	if stats := l.Stats(); stats.OutageLost != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestOrderedLinkBlackoutHoldsData(t *testing.T) {
+	l, received := newTestLink(t, Profile{Ordered: true})
+	start := time.Now()
+	l.Blackout(start.Add(50 * time.Millisecond))
+	sendNumbered(l, 3)
+	got := waitForPackets(t, received, 3)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || !slices.IsSorted(got) {
+		t.Fatalf("delivered %v after %v", got, elapsed)
+	}
+	if stats := l.Stats(); stats.Dropped != 0 || stats.OutageHeld != 3 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
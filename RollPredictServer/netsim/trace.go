@@ -0,0 +1,64 @@
+package netsim
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// TraceEvent 是 JSONL 追踪文件中的一行：链路收到的一个数据包和它的去向
+type TraceEvent struct {
+	Time        time.Time      `json:"time"`
+	Port        string         `json:"port"`      // tcp、udp 或 kcp
+	Client      string         `json:"client"`    // 客户端地址
+	Direction   string         `json:"direction"` // up：客户端->服务器，down：服务器->客户端
+	Size        int            `json:"size"`
+	Dropped     bool           `json:"dropped"`               // 被链路或丢包规则丢弃（否则已进入发送队列）
+	Rule        string         `json:"rule,omitempty"`        // 丢弃数据包的规则
+	Retransmits int            `json:"retransmits,omitempty"` // KCP重传的数据段
+	Messages    []TraceMessage `json:"messages,omitempty"`
+	Error       string         `json:"error,omitempty"` // 解码错误
+}
+
+// TraceMessage 是数据包中解码出的一条消息
+type TraceMessage struct {
+	Type  string          `json:"type"`
+	Frame *int64          `json:"frame,omitempty"`
+	Body  json.RawMessage `json:"body,omitempty"` // protobuf 的 JSON 形式
+}
+
+// NewTraceMessage 把解码出的消息转换为追踪记录
+func NewTraceMessage(m Message) TraceMessage {
+	t := TraceMessage{Type: strings.TrimPrefix(m.Type.String(), "MESSAGE_")}
+	if frame := m.FrameNumber(); frame >= 0 {
+		t.Frame = &frame
+	}
+	if m.Body != nil {
+		if body, err := protojson.Marshal(m.Body); err == nil {
+			t.Body = body
+		}
+	}
+	return t
+}
+
+// Trace 把事件逐行写成 JSON，可以并发调用
+type Trace struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewTrace 创建写到 w 的追踪
+func NewTrace(w io.Writer) *Trace {
+	return &Trace{encoder: json.NewEncoder(w)}
+}
+
+// Write 写入一个事件
+func (t *Trace) Write(event TraceEvent) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.encoder.Encode(event)
+}
@@ -0,0 +1,48 @@
+package netsim
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func TestTraceWritesJSONLines(t *testing.T) {
+	var buffer bytes.Buffer
+	trace := NewTrace(&buffer)
+	input := Message{Type: myproto.MessageType_MESSAGE_FRAME_DATA, Body: &myproto.FrameData{PlayerId: 2, FrameNumber: 8}}
+	events := []TraceEvent{
+		{Time: time.Now(), Port: "udp", Client: "127.0.0.1:5000", Direction: "up", Size: 12, Dropped: true, Messages: []TraceMessage{NewTraceMessage(input)}},
+		{Time: time.Now(), Port: "tcp", Client: "127.0.0.1:5001", Direction: "down", Size: 3, Error: "stream out of sync"},
+	}
+	for _, e := range events {
+		if err := trace.Write(e); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("%d lines:\n%s", len(lines), buffer.String())
+	}
+	var first struct {
+		Dropped  bool
+		Messages []struct {
+			Type  string
+			Frame int64
+			Body  struct{ PlayerId int32 }
+		}
+	}
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatalf("unmarshal %s: %v", lines[0], err)
+	}
+	if !first.Dropped || len(first.Messages) != 1 || first.Messages[0].Type != "FRAME_DATA" ||
+		first.Messages[0].Frame != 8 || first.Messages[0].Body.PlayerId != 2 {
+		t.Fatalf("first event %s", lines[0])
+	}
+	if bytes.Contains(lines[1], []byte(`"messages"`)) {
+		t.Fatalf("empty messages written: %s", lines[1])
+	}
+}
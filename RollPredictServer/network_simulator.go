@@ -1,13 +1,30 @@
+//go:build ignore
+
 package main
 
 import (
+	"cmp"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
-	"math/rand"
+	"math/rand/v2"
 	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/WjcHome/gohello/codec"
+	"github.com/WjcHome/gohello/netsim"
+	myproto "github.com/WjcHome/gohello/proto"
 )
 
 var (
@@ -15,100 +32,718 @@ var (
 	listenPort = flag.String("listen", "9999", "代理监听端口（客户端连接此端口）")
 	// 实际服务器地址（代理转发到这里）
 	targetHost = flag.String("target", "127.0.0.1:8888", "实际服务器地址（代理转发到此）")
-	delay      = flag.Int("delay", 0, "延迟（毫秒）")
-	loss       = flag.Float64("loss", 0, "丢包率（0-100）")
-	protocol   = flag.String("protocol", "udp", "协议类型：tcp 或 udp")
+	protocol   = flag.String("protocol", "udp", "协议类型：tcp、udp、kcp，或 all（同时代理服务器的TCP、UDP、KCP端口）")
+	// -protocol=all 时每个端口的监听地址、服务器地址和单独的网络参数（和服务器 StartAll 的三个端口对应）
+	tcpListen  = flag.String("tcp-listen", "9887", "all模式：TCP代理监听端口，为空时不代理TCP")
+	tcpTarget  = flag.String("tcp-target", "127.0.0.1"+TCP_PORT, "all模式：服务器TCP地址")
+	tcpProfile = flag.String("tcp-profile", "", "all模式：TCP端口单独的网络参数，格式和命令行相同，例如 \"-delay=50 -jitter=10\"")
+	udpListen  = flag.String("udp-listen", "9888", "all模式：UDP代理监听端口，为空时不代理UDP")
+	udpTarget  = flag.String("udp-target", "127.0.0.1"+UDP_PORT, "all模式：服务器UDP地址")
+	udpProfile = flag.String("udp-profile", "", "all模式：UDP端口单独的网络参数")
+	kcpListen  = flag.String("kcp-listen", "9889", "all模式：KCP代理监听端口，为空时不代理KCP")
+	kcpTarget  = flag.String("kcp-target", "127.0.0.1"+KCP_PORT, "all模式：服务器KCP地址")
+	kcpProfile = flag.String("kcp-profile", "", "all模式：KCP端口单独的网络参数")
+	// UDP会话在这段时间内没有数据时关闭
+	udpIdleTimeout = flag.Duration("udp-idle", time.Minute, "UDP/KCP会话空闲超时")
+	statsInterval  = flag.Duration("stats", 10*time.Second, "打印链路统计（包括队列延迟）的间隔，0 表示不打印")
+	// 运行时修改网络参数
+	controlAddr  = flag.String("control", "", "控制接口（HTTP）监听地址，如 127.0.0.1:9900，为空时不启动")
+	scenarioFile = flag.String("scenario", "", "场景文件：按时间线修改网络参数，如 \"t=10s set loss 20%; t=20s blackout 3s\"")
+	// 协议解码
+	decodeMessages = flag.Bool("decode", false, "解码帧同步协议消息，日志中记录消息类型、帧号、玩家和输入")
+	traceFile      = flag.String("trace", "", "把每个数据包的去向（发出或丢弃）和解码出的消息写到 JSONL 文件")
+	// 所有随机决定（丢包、抖动、乱序、重复、规则概率）的种子
+	seed = flag.Uint64("seed", 0, "随机种子，同样的种子和同样的流量得到同样的丢包和延迟，0 表示随机选择（启动时打印）")
+
+	// 打开 -trace 时的追踪文件
+	trace *netsim.Trace
+	// 按消息丢包的规则（-drop 和 drop 命令）
+	dropRules = netsim.NewRules()
+
+	// 网络参数，-protocol=all 时是每个端口的默认值
+	impairments = registerImpairmentFlags(flag.CommandLine)
 )
 
-func main() {
-	flag.Parse()
+func init() {
+	flag.Func("drop", "按消息丢包的规则，可以写多次，例如 \"SERVER_FRAME down player=3 prob=50%\"、\"FRAME_NEED once\"（每个补帧回复第一次发送时丢弃，只用于UDP/KCP）", func(s string) error {
+		rule, err := netsim.ParseRule(s)
+		if err != nil {
+			return err
+		}
+		dropRules.Add(rule)
+		return nil
+	})
+}
 
-	rand.Seed(time.Now().UnixNano())
+// 服务器端口（和 frame_sync_server.go 一致，这个文件单独编译）
+const (
+	TCP_PORT = ":8887"
+	UDP_PORT = ":8888"
+	KCP_PORT = ":8889"
+)
 
-	var listener net.Listener
-	var udpConn *net.UDPConn
+// 网络参数的命令行参数，每个代理端口可以用自己的 FlagSet 覆盖
+type impairmentFlags struct {
+	delay      *int
+	jitter     *int
+	jitterDist *string
+	loss       *float64
+	reorder    *float64
+	duplicate  *float64
+	// 突发丢包、断网和带宽，up 是客户端->服务器方向，down 是服务器->客户端方向，单独设置时覆盖两个方向共用的参数
+	upLoss        *float64
+	downLoss      *float64
+	burst         *string
+	upBurst       *string
+	downBurst     *string
+	outage        *string
+	upOutage      *string
+	downOutage    *string
+	bandwidth     *int
+	upBandwidth   *int
+	downBandwidth *int
+	bucketSize    *int
+	queueLimit    *int
+	queuePolicy   *string
+}
 
-	if *protocol == "udp" {
-		// UDP需要使用不同的监听方式
-		udpAddr, err := net.ResolveUDPAddr("udp", ":"+*listenPort)
-		if err != nil {
-			log.Fatal("解析UDP地址失败:", err)
+// 在 FlagSet 中注册网络参数
+func registerImpairmentFlags(fs *flag.FlagSet) *impairmentFlags {
+	return &impairmentFlags{
+		delay:      fs.Int("delay", 0, "延迟（毫秒）"),
+		jitter:     fs.Int("jitter", 0, "抖动（毫秒），含义见 -jitter-dist"),
+		jitterDist: fs.String("jitter-dist", "uniform", "抖动分布：uniform（延迟±抖动）、normal（标准差为抖动）或 pareto（长尾，平均增加抖动）"),
+		loss:       fs.Float64("loss", 0, "丢包率（0-100）"),
+		reorder:    fs.Float64("reorder", 0, "乱序率（0-100）：数据包不经过延迟立即发出（只用于UDP/KCP）"),
+		duplicate:  fs.Float64("duplicate", 0, "重复率（0-100）：数据包再发一份（只用于UDP/KCP）"),
+
+		upLoss:        fs.Float64("up-loss", -1, "客户端->服务器方向的丢包率（0-100），默认使用 -loss"),
+		downLoss:      fs.Float64("down-loss", -1, "服务器->客户端方向的丢包率（0-100），默认使用 -loss"),
+		burst:         fs.String("burst", "", "Gilbert-Elliott突发丢包 p,r[,坏状态丢包率[,好状态丢包率]]（百分比），例如 2,25"),
+		upBurst:       fs.String("up-burst", "", "客户端->服务器方向的突发丢包，默认使用 -burst"),
+		downBurst:     fs.String("down-burst", "", "服务器->客户端方向的突发丢包，默认使用 -burst"),
+		outage:        fs.String("outage", "", "周期性断网 时长/周期，例如 2s/30s 表示每30秒断网2秒"),
+		upOutage:      fs.String("up-outage", "", "客户端->服务器方向的断网，默认使用 -outage"),
+		downOutage:    fs.String("down-outage", "", "服务器->客户端方向的断网，默认使用 -outage"),
+		bandwidth:     fs.Int("bandwidth", 0, "带宽（kbps），0 表示不限速"),
+		upBandwidth:   fs.Int("up-bandwidth", -1, "客户端->服务器方向的带宽（kbps），默认使用 -bandwidth"),
+		downBandwidth: fs.Int("down-bandwidth", -1, "服务器->客户端方向的带宽（kbps），默认使用 -bandwidth"),
+		bucketSize:    fs.Int("bucket", 0, "令牌桶容量（字节），可以按线速突发的数据量，默认 1500"),
+		queueLimit:    fs.Int("queue", 0, "瓶颈队列长度（数据包数），默认 100；TCP不在队列丢包"),
+		queuePolicy:   fs.String("queue-policy", "taildrop", "队列满时的策略：taildrop（丢弃新数据包）或 red（提前随机丢包）"),
+	}
+}
+
+// 一个代理端口
+type proxyPort struct {
+	protocol string // tcp、udp 或 kcp
+	listen   string
+	target   string
+	initial  linkProfiles // 启动时的参数，reset 命令恢复到这里
+
+	mutex    sync.Mutex
+	profiles linkProfiles  // 当前参数，新建的链路使用
+	blackout linkBlackouts // blackout 命令设置的断网结束时间
+
+	peers atomic.Int64 // 已经建立的连接或会话数，用来给链路分配随机种子
+}
+
+// 两个方向的断网结束时间
+type linkBlackouts struct {
+	up   time.Time
+	down time.Time
+}
+
+// 一个方向的断网结束时间（调用方持有端口锁）
+func (p *proxyPort) blackoutUntil(up bool) time.Time {
+	if up {
+		return p.blackout.up
+	}
+	return p.blackout.down
+}
+
+func main() {
+	flag.Parse()
+
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+	ports, err := proxyPorts()
+	if err != nil {
+		log.Fatal("网络参数错误: ", err)
+	}
+	for _, stats := range dropRules.Stats() {
+		if err := checkRule(ports, stats.Rule); err != nil {
+			log.Fatal("丢包规则错误: ", err)
 		}
-		udpConn, err = net.ListenUDP("udp", udpAddr)
-		if err != nil {
-			log.Fatal("UDP监听失败:", err)
+	}
+	var scenario []netsim.Step
+	if *scenarioFile != "" {
+		if scenario, err = loadScenario(*scenarioFile, ports); err != nil {
+			log.Fatal("场景文件错误: ", err)
 		}
-	} else {
-		// TCP使用普通的Listen
-		var err error
-		listener, err = net.Listen("tcp", ":"+*listenPort)
+	}
+	if *traceFile != "" {
+		file, err := os.Create(*traceFile)
 		if err != nil {
-			log.Fatal("TCP监听失败:", err)
+			log.Fatal("创建追踪文件失败: ", err)
 		}
+		defer file.Close()
+		trace = netsim.NewTrace(file)
 	}
 
 	fmt.Printf("========================================\n")
 	fmt.Printf("网络模拟器代理启动 (%s)\n", *protocol)
 	fmt.Printf("========================================\n")
-	fmt.Printf("代理监听端口: %s (客户端连接这里)\n", *listenPort)
-	fmt.Printf("转发到服务器: %s (实际服务器地址)\n", *targetHost)
-	fmt.Printf("协议: %s\n", *protocol)
-	fmt.Printf("单向延迟: %dms (往返延迟: %dms)\n", *delay, *delay*2)
-	if *loss > 0 {
-		fmt.Printf("丢包率: %.2f%%\n", *loss)
+	for _, port := range ports {
+		fmt.Printf("[%s] 代理监听端口: %s (客户端连接这里) -> 服务器: %s\n", port.name(), port.listen, port.target)
+		printProfile(port.name()+" 客户端->服务器", port.profiles.up)
+		printProfile(port.name()+" 服务器->客户端", port.profiles.down)
 	}
+	fmt.Printf("随机种子: %d（用 -seed=%d 重现这次运行）\n", *seed, *seed)
 	fmt.Printf("========================================\n")
 	fmt.Printf("注意：如果客户端使用了预测回滚机制，\n")
 	fmt.Printf("延迟可能被掩盖，但实际延迟仍然存在！\n")
 	fmt.Printf("========================================\n")
 	fmt.Printf("使用说明：\n")
-	fmt.Printf("1. 先启动实际服务器在 %s\n", *targetHost)
+	fmt.Printf("1. 先启动实际服务器\n")
 	fmt.Printf("2. 然后启动此代理\n")
-	fmt.Printf("3. 客户端连接到 %s (代理端口)\n", *listenPort)
+	fmt.Printf("3. 客户端连接到上面的代理端口\n")
 	fmt.Printf("========================================\n")
-	fmt.Printf("UDP说明：UDP模式下，代理作为中间人转发数据包\n")
-	fmt.Printf("每个UDP数据包都会被单独处理和延迟\n")
+	fmt.Printf("UDP/KCP说明：代理作为中间人转发数据包\n")
+	fmt.Printf("每个客户端有独立的上游端口，两个方向分别转发，服务器推送的数据包也会转发\n")
+	fmt.Printf("KCP端口会解析KCP段，统计数据段、确认和重传\n")
+	if *decodeMessages {
+		fmt.Printf("协议解码：日志中记录每条消息的类型、帧号、玩家和输入\n")
+	}
+	if trace != nil {
+		fmt.Printf("追踪文件：%s（每行一个数据包，JSON）\n", *traceFile)
+	}
+	for _, stats := range dropRules.Stats() {
+		fmt.Printf("丢包规则：%s\n", stats.Rule)
+	}
 	fmt.Printf("========================================\n")
 	fmt.Printf("测试UDP延迟示例：\n")
 	fmt.Printf("./network_simulator -protocol=udp -listen=9999 -target=127.0.0.1:8888 -delay=100 -loss=5\n")
+	fmt.Printf("同时代理服务器的三个端口，KCP单独加丢包：\n")
+	fmt.Printf("./network_simulator -protocol=all -delay=50 -kcp-profile=\"-loss=10\"\n")
 	fmt.Printf("========================================\n")
 	fmt.Printf("按 Ctrl+C 停止\n\n")
 
-	if *protocol == "udp" {
-		// UDP直接处理连接（阻塞）
-		handleUDPConnection(udpConn)
+	// 先全部开始监听，任何一个端口失败就退出
+	serves := make([]func(), 0, len(ports))
+	for _, port := range ports {
+		serve, err := port.start()
+		if err != nil {
+			log.Fatalf("[%s] 监听失败: %v", port.name(), err)
+		}
+		serves = append(serves, serve)
+	}
+	if *statsInterval > 0 {
+		go reportLinkStats(*statsInterval)
+	}
+	if *controlAddr != "" {
+		ln, err := net.Listen("tcp", *controlAddr)
+		if err != nil {
+			log.Fatal("控制接口监听失败: ", err)
+		}
+		fmt.Printf("控制接口: http://%s\n", ln.Addr())
+		go func() {
+			log.Println("控制接口错误:", http.Serve(ln, controlHandler(ports)))
+		}()
+	}
+	if scenario != nil {
+		go runScenario(scenario, ports)
+	}
+	var wg sync.WaitGroup
+	for _, serve := range serves {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve()
+		}()
+	}
+	wg.Wait()
+}
+
+// 根据命令行参数生成要代理的端口
+func proxyPorts() ([]*proxyPort, error) {
+	if *protocol != "all" {
+		if *protocol != "tcp" && *protocol != "udp" && *protocol != "kcp" {
+			return nil, fmt.Errorf("unknown protocol %q (tcp, udp, kcp or all)", *protocol)
+		}
+		profiles, err := impairments.profiles(*protocol == "tcp")
+		if err != nil {
+			return nil, err
+		}
+		return []*proxyPort{newProxyPort(*protocol, *listenPort, *targetHost, profiles)}, nil
+	}
+
+	var ports []*proxyPort
+	for _, p := range []struct{ protocol, listen, target, profile string }{
+		{"tcp", *tcpListen, *tcpTarget, *tcpProfile},
+		{"udp", *udpListen, *udpTarget, *udpProfile},
+		{"kcp", *kcpListen, *kcpTarget, *kcpProfile},
+	} {
+		if p.listen == "" {
+			continue
+		}
+		profiles, err := portProfiles(p.protocol, p.profile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.protocol, err)
+		}
+		ports = append(ports, newProxyPort(p.protocol, p.listen, p.target, profiles))
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports to proxy")
+	}
+	return ports, nil
+}
+
+// 解析一个端口单独的网络参数：没有出现的参数使用命令行上的值
+func portProfiles(protocol, spec string) (linkProfiles, error) {
+	fs := flag.NewFlagSet(protocol+"-profile", flag.ContinueOnError)
+	port := registerImpairmentFlags(fs)
+	var err error
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) != nil && err == nil {
+			err = fs.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return linkProfiles{}, err
+	}
+	if err := fs.Parse(strings.Fields(spec)); err != nil {
+		return linkProfiles{}, err
+	}
+	if fs.NArg() > 0 {
+		return linkProfiles{}, fmt.Errorf("unexpected argument %q in profile", fs.Arg(0))
+	}
+	return port.profiles(protocol == "tcp")
+}
+
+func newProxyPort(protocol, listen, target string, profiles linkProfiles) *proxyPort {
+	return &proxyPort{protocol: protocol, listen: listen, target: target, initial: profiles, profiles: profiles}
+}
+
+// 协议名称（日志前缀）
+func (p *proxyPort) name() string {
+	return strings.ToUpper(p.protocol)
+}
+
+// 开始监听，返回处理连接的函数（阻塞）
+func (p *proxyPort) start() (func(), error) {
+	if p.protocol == "tcp" {
+		listener, err := net.Listen("tcp", ":"+p.listen)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			for {
+				clientConn, err := listener.Accept()
+				if err != nil {
+					log.Println("接受连接失败:", err)
+					continue
+				}
+				go handleConnection(clientConn, p, newPeer(p, clientConn.RemoteAddr().String()))
+			}
+		}, nil
+	}
+
+	// UDP和KCP都是数据报，KCP在转发的同时解析KCP段
+	udpAddr, err := net.ResolveUDPAddr("udp", ":"+p.listen)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return func() { handleUDPConnection(udpConn, p) }, nil
+}
+
+// 两个方向的链路参数
+type linkProfiles struct {
+	up   netsim.Profile // 客户端->服务器
+	down netsim.Profile // 服务器->客户端
+}
+
+// 一个方向的参数
+func (lp *linkProfiles) direction(up bool) *netsim.Profile {
+	if up {
+		return &lp.up
+	}
+	return &lp.down
+}
+
+// 根据参数生成两个方向的链路参数（百分比换算成概率）；ordered 用于TCP
+func (f *impairmentFlags) profiles(ordered bool) (linkProfiles, error) {
+	distribution, err := netsim.ParseDistribution(*f.jitterDist)
+	if err != nil {
+		return linkProfiles{}, err
+	}
+	policy, err := netsim.ParseQueuePolicy(*f.queuePolicy)
+	if err != nil {
+		return linkProfiles{}, err
+	}
+	base := netsim.Profile{
+		Delay:        time.Duration(*f.delay) * time.Millisecond,
+		Jitter:       time.Duration(*f.jitter) * time.Millisecond,
+		Distribution: distribution,
+		Reorder:      *f.reorder / 100,
+		Duplicate:    *f.duplicate / 100,
+		Ordered:      ordered,
+		BucketSize:   *f.bucketSize,
+		QueueLimit:   *f.queueLimit,
+		QueuePolicy:  policy,
+	}
+	up, err := f.directionProfile(base, *f.upLoss, *f.upBandwidth, *f.upBurst, *f.upOutage)
+	if err != nil {
+		return linkProfiles{}, fmt.Errorf("客户端->服务器: %w", err)
+	}
+	down, err := f.directionProfile(base, *f.downLoss, *f.downBandwidth, *f.downBurst, *f.downOutage)
+	if err != nil {
+		return linkProfiles{}, fmt.Errorf("服务器->客户端: %w", err)
+	}
+	return linkProfiles{up: up, down: down}, nil
+}
+
+// 在共用参数上应用一个方向的丢包和带宽参数，没有单独设置时使用共用的 -loss、-bandwidth、-burst、-outage
+func (f *impairmentFlags) directionProfile(profile netsim.Profile, lossPercent float64, kbps int, burstSpec, outageSpec string) (netsim.Profile, error) {
+	if lossPercent < 0 {
+		lossPercent = *f.loss
+	}
+	if kbps < 0 {
+		kbps = *f.bandwidth
+	}
+	profile.Bandwidth = int64(kbps) * 1000
+	if burstSpec == "" {
+		burstSpec = *f.burst
+	}
+	if outageSpec == "" {
+		outageSpec = *f.outage
+	}
+	var err error
+	profile.Loss = lossPercent / 100
+	if profile.Burst, err = netsim.ParseGilbertElliott(burstSpec); err != nil {
+		return profile, err
+	}
+	if profile.Outage, err = netsim.ParseOutage(outageSpec); err != nil {
+		return profile, err
+	}
+	return profile, profile.Validate()
+}
+
+// 打印一个方向的链路参数
+func printProfile(direction string, profile netsim.Profile) {
+	fmt.Printf("[%s] 单向延迟: %v", direction, profile.Delay)
+	if profile.Jitter > 0 {
+		fmt.Printf(", 抖动: %v (%s分布)", profile.Jitter, cmp.Or(profile.Distribution, netsim.Uniform))
+	}
+	fmt.Printf("\n")
+	if profile.Bandwidth > 0 {
+		fmt.Printf("[%s] 带宽: %dkbps (令牌桶 %d 字节, 队列 %d 包, %s)\n", direction, profile.Bandwidth/1000,
+			cmp.Or(profile.BucketSize, netsim.DefaultBucketSize), cmp.Or(profile.QueueLimit, netsim.DefaultQueueLimit), profile.QueuePolicy)
+	}
+	if profile.Ordered && (profile.Loss > 0 || profile.Burst.Enabled()) {
+		fmt.Printf("[%s] TCP是字节流，忽略丢包率和突发丢包\n", direction)
+	} else if profile.Loss > 0 {
+		fmt.Printf("[%s] 丢包率: %.2f%%\n", direction, profile.Loss*100)
+	}
+	if b := profile.Burst; b.Enabled() && !profile.Ordered {
+		fmt.Printf("[%s] 突发丢包: 进入坏状态 %.2f%%, 恢复 %.2f%% (平均连续 %.1f 个包), 坏/好状态丢包率 %.2f%%/%.2f%%\n",
+			direction, b.GoodToBad*100, b.BadToGood*100, 1/b.BadToGood, b.LossBad*100, b.LossGood*100)
+	}
+	if o := profile.Outage; o.Enabled() {
+		fmt.Printf("[%s] 断网: 每 %v 断开 %v\n", direction, o.Every, o.Duration)
+		if profile.Ordered {
+			fmt.Printf("[%s] TCP断网期间不丢数据，推迟到恢复后发出\n", direction)
+		}
+	}
+	if profile.Ordered {
+		if profile.Reorder > 0 || profile.Duplicate > 0 {
+			fmt.Printf("[%s] TCP是字节流，忽略乱序率和重复率，抖动只会推迟后面的数据\n", direction)
+		}
+		return
+	}
+	if profile.Reorder > 0 {
+		fmt.Printf("[%s] 乱序率: %.2f%%\n", direction, profile.Reorder*100)
+	}
+	if profile.Duplicate > 0 {
+		fmt.Printf("[%s] 重复率: %.2f%%\n", direction, profile.Duplicate*100)
+	}
+}
+
+// 客户端（一个TCP连接或UDP/KCP会话），两个方向的链路共用
+type peer struct {
+	addr   string
+	index  int64        // 端口上的第几个客户端（从0开始），链路的随机种子由它决定
+	player atomic.Int32 // 服务器在 CONNECT 回复中告诉客户端的玩家ID，还不知道时为 -1
+}
+
+// 按建立的顺序编号，在接受连接或创建会话的循环中调用
+func newPeer(port *proxyPort, addr string) *peer {
+	p := &peer{addr: addr, index: port.peers.Add(1) - 1}
+	p.player.Store(-1)
+	return p
+}
+
+// 链路的随机种子：由 -seed、端口、客户端编号、方向和用途决定，
+// 客户端按同样的顺序连接时每条链路得到同样的随机数序列，和链路之间的调度顺序无关
+func linkSeed(port *proxyPort, peer *peer, up bool, purpose string) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%d/%v/%s", *seed, port.protocol, peer.index, up, purpose)
+	return h.Sum64()
+}
+
+// 模拟链路和它的方向（日志前缀），KCP端口同时统计KCP段。
+// send 只在读取这个方向的 goroutine 中调用，解码器不需要加锁
+type simLink struct {
+	*netsim.Link
+	port        *proxyPort
+	up          bool // 客户端->服务器方向
+	peer        *peer
+	direction   string
+	kcp         *netsim.KCPCounter // 不是KCP端口时为 nil
+	decoder     *netsim.Decoder
+	rng         *rand.Rand   // 丢包规则的概率
+	ruleDropped atomic.Int64 // 丢包规则丢弃的数据包
+}
+
+// 当前打开的链路，用于定期打印统计
+var (
+	activeLinksMutex sync.Mutex
+	activeLinks      = make(map[*simLink]bool)
+)
+
+// 创建端口一个方向上的链路，使用端口当前的参数，发出数据包时记录日志
+func newSimLink(port *proxyPort, up bool, peer *peer, send func([]byte) error) *simLink {
+	l := &simLink{port: port, up: up, peer: peer}
+	codecDirection := codec.ClientToServer
+	if up {
+		l.direction = port.name() + "客户端->服务器 " + peer.addr
 	} else {
-		// TCP接受连接
-		for {
-			clientConn, err := listener.Accept()
-			if err != nil {
-				log.Println("接受连接失败:", err)
-				continue
+		l.direction = port.name() + "服务器->客户端 " + peer.addr
+		codecDirection = codec.ServerToClient
+	}
+	if port.protocol == "kcp" {
+		l.kcp = &netsim.KCPCounter{}
+	}
+	// 丢包规则可以在运行时添加，所以总是解码
+	l.decoder = netsim.NewDecoder(port.protocol, codecDirection)
+	l.rng = rand.New(rand.NewPCG(linkSeed(port, peer, up, "rules"), 0))
+	l.Link = netsim.NewLink(netsim.Profile{}, func(data []byte) {
+		if err := send(data); err != nil {
+			log.Printf("[%s] 发送错误: %v\n", l.direction, err)
+			return
+		}
+		log.Printf("[%s] 数据包: %d 字节%s\n", l.direction, len(data), l.describe(data))
+	})
+
+	// 持有端口锁直到登记完成，这期间执行的控制命令不会漏掉这条链路
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+	l.Seed(linkSeed(port, peer, up, "link"))
+	l.SetProfile(*port.profiles.direction(up))
+	l.Blackout(port.blackoutUntil(up))
+	activeLinksMutex.Lock()
+	activeLinks[l] = true
+	activeLinksMutex.Unlock()
+	return l
+}
+
+// KCP数据包的段摘要，用于日志
+func (l *simLink) describe(data []byte) string {
+	if l.kcp == nil {
+		return ""
+	}
+	segments, err := netsim.ParseKCP(data)
+	if err != nil || len(segments) == 0 {
+		return " (不是KCP数据包)"
+	}
+	var push, ack int
+	for _, segment := range segments {
+		switch segment.Cmd {
+		case netsim.KCPPush:
+			push++
+		case netsim.KCPAck:
+			ack++
+		}
+	}
+	return fmt.Sprintf(" (KCP conv=%d 数据段 %d, 确认 %d)", segments[0].Conv, push, ack)
+}
+
+// 把数据包放进链路（KCP端口先统计KCP段），被丢弃时记录日志。
+// 解码在施加损伤之前进行，丢包的日志和追踪中也能看到丢掉了哪些消息
+func (l *simLink) send(data []byte) {
+	var retransmits int
+	if l.kcp != nil {
+		var segments []netsim.KCPSegment
+		var err error
+		segments, retransmits, err = l.kcp.Observe(data)
+		if err != nil {
+			log.Printf("[%s] 解析KCP失败: %v\n", l.direction, err)
+		} else if retransmits > 0 {
+			log.Printf("[%s] KCP重传: conv=%d, %d 个数据段\n", l.direction, segments[0].Conv, retransmits)
+		}
+	}
+	messages, decodeErr := l.decoder.Feed(data)
+	if decodeErr != nil && *decodeMessages {
+		log.Printf("[%s] 解码失败: %v\n", l.direction, decodeErr)
+	}
+	if !l.up {
+		for _, m := range messages {
+			if connect, ok := m.Body.(*myproto.ConnectMessage); ok {
+				l.peer.player.Store(connect.PlayerId)
 			}
+		}
+	}
 
-			go handleConnection(clientConn)
+	// TCP是字节流，丢掉一部分数据会破坏后面所有消息，丢包规则只用于UDP/KCP
+	var sent bool
+	rule, ruleDropped := netsim.Rule{}, false
+	if l.port.protocol != "tcp" {
+		rule, ruleDropped = dropRules.Drop(l.flow(), messages, l.rng)
+	}
+	if ruleDropped {
+		l.ruleDropped.Add(1)
+		log.Printf("[%s] 规则丢包 [%s]: %d 字节%s\n", l.direction, rule, len(data), summarize(messages))
+	} else if sent = l.Send(data); !sent {
+		log.Printf("[%s] 丢包: %d 字节%s\n", l.direction, len(data), summarize(messages))
+	} else if *decodeMessages {
+		for _, m := range messages {
+			log.Printf("[%s] 消息: %s\n", l.direction, m.Summary())
+		}
+	}
+	if trace != nil {
+		event := l.traceEvent(len(data), retransmits, messages, decodeErr)
+		event.Dropped = !sent
+		if ruleDropped {
+			event.Rule = rule.String()
+		}
+		if err := trace.Write(event); err != nil {
+			log.Printf("写追踪文件失败: %v\n", err)
 		}
 	}
 }
 
-func handleConnection(clientConn net.Conn) {
-	defer clientConn.Close()
+// 匹配丢包规则用的链路信息
+func (l *simLink) flow() netsim.Flow {
+	return netsim.Flow{Port: l.port.protocol, Client: l.peer.addr, Up: l.up, Player: l.peer.player.Load()}
+}
 
-	if *protocol == "udp" {
-		handleUDPConnection(clientConn.(*net.UDPConn))
-		return
+// 丢包日志中列出数据包里的消息
+func summarize(messages []netsim.Message) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	summaries := make([]string, len(messages))
+	for i, m := range messages {
+		summaries[i] = m.Summary()
+	}
+	return " (" + strings.Join(summaries, "; ") + ")"
+}
+
+// 一个数据包的追踪记录
+func (l *simLink) traceEvent(size int, retransmits int, messages []netsim.Message, decodeErr error) netsim.TraceEvent {
+	event := netsim.TraceEvent{
+		Time:        time.Now(),
+		Port:        l.port.protocol,
+		Client:      l.peer.addr,
+		Direction:   "down",
+		Size:        size,
+		Retransmits: retransmits,
+	}
+	if l.up {
+		event.Direction = "up"
+	}
+	for _, m := range messages {
+		event.Messages = append(event.Messages, netsim.NewTraceMessage(m))
 	}
+	if decodeErr != nil {
+		event.Error = decodeErr.Error()
+	}
+	return event
+}
 
-	// TCP处理（原有逻辑）
+// 关闭链路并打印最终统计；drain 为 true 时先发完队列中的数据包
+func (l *simLink) close(drain bool) {
+	if drain {
+		l.CloseWhenEmpty()
+	} else {
+		l.Close()
+	}
+	activeLinksMutex.Lock()
+	delete(activeLinks, l)
+	activeLinksMutex.Unlock()
+	dropRules.Forget(l.flow())
+	l.printStats()
+}
+
+// 打印链路的统计
+func (l *simLink) printStats() {
+	stats := l.Stats()
+	line := fmt.Sprintf("[%s] 统计: 收到 %d, 发出 %d, 丢弃 %d (突发 %d, 断网 %d, 队列 %d), 乱序 %d, 重复 %d",
+		l.direction, stats.Sent, stats.Delivered, stats.Dropped, stats.BurstLost, stats.OutageLost, stats.QueueDropped,
+		stats.Reordered, stats.Duplicated)
+	if stats.OutageHeld > 0 {
+		line += fmt.Sprintf(", 断网推迟 %d", stats.OutageHeld)
+	}
+	if n := l.ruleDropped.Load(); n > 0 {
+		line += fmt.Sprintf(", 规则丢弃 %d", n)
+	}
+	if stats.Queued > 0 {
+		line += fmt.Sprintf(", 排队延迟 平均 %v 最大 %v, 当前队列 %d 包",
+			stats.QueueDelayMean().Round(time.Millisecond), stats.QueueDelayMax.Round(time.Millisecond), stats.QueueLength)
+	}
+	if l.kcp != nil {
+		kcpStats := l.kcp.Stats()
+		line += fmt.Sprintf(", KCP 数据段 %d (重传 %d), 确认 %d, 窗口 %d",
+			kcpStats.Push, kcpStats.Retransmit, kcpStats.Ack, kcpStats.Window)
+	}
+	log.Println(line)
+}
+
+// 定期打印所有打开的链路的统计
+func reportLinkStats(interval time.Duration) {
+	for range time.Tick(interval) {
+		activeLinksMutex.Lock()
+		links := make([]*simLink, 0, len(activeLinks))
+		for l := range activeLinks {
+			links = append(links, l)
+		}
+		activeLinksMutex.Unlock()
+
+		sort.Slice(links, func(i, j int) bool { return links[i].direction < links[j].direction })
+		for _, l := range links {
+			if l.Stats().Sent > 0 {
+				l.printStats()
+			}
+		}
+		printRuleStats()
+	}
+}
+
+// 打印丢包规则的计数
+func printRuleStats() {
+	for _, stats := range dropRules.Stats() {
+		log.Printf("[规则 %s] 匹配 %d, 丢弃 %d\n", stats.Rule, stats.Matched, stats.Dropped)
+	}
+}
+
+func handleConnection(clientConn net.Conn, port *proxyPort, peer *peer) {
+	defer clientConn.Close()
+
+	// TCP处理
 	// 连接到目标服务器
-	serverConn, err := net.Dial("tcp", *targetHost)
+	serverConn, err := net.Dial("tcp", port.target)
 	if err != nil {
-		log.Printf("连接目标服务器失败 (%s): %v\n", *targetHost, err)
+		log.Printf("连接目标服务器失败 (%s): %v\n", port.target, err)
 		return
 	}
 	defer serverConn.Close()
 
-	log.Printf("新TCP连接: %s -> %s (通过代理)\n", clientConn.RemoteAddr(), *targetHost)
+	log.Printf("新TCP连接 #%d: %s -> %s (通过代理)\n", peer.index, clientConn.RemoteAddr(), port.target)
 
 	// 双向转发数据
 	done := make(chan bool, 2)
@@ -116,145 +751,361 @@ func handleConnection(clientConn net.Conn) {
 	// 客户端 -> 服务器
 	go func() {
 		defer func() { done <- true }()
-		copyWithDelay(clientConn, serverConn, "客户端->服务器")
+		copyWithDelay(clientConn, newSimLink(port, true, peer, func(data []byte) error {
+			_, err := serverConn.Write(data)
+			return err
+		}))
 	}()
 
 	// 服务器 -> 客户端
 	go func() {
 		defer func() { done <- true }()
-		copyWithDelay(serverConn, clientConn, "服务器->客户端")
+		copyWithDelay(serverConn, newSimLink(port, false, peer, func(data []byte) error {
+			_, err := clientConn.Write(data)
+			return err
+		}))
 	}()
 
 	<-done
 	log.Printf("TCP连接关闭: %s\n", clientConn.RemoteAddr())
 }
 
-func handleUDPConnection(clientConn *net.UDPConn) {
+// UDP会话：每个客户端地址一个，使用自己的上游socket和服务器通信，
+// 这样服务器主动推送的数据包（如 ServerFrame）能回到正确的客户端
+type udpSession struct {
+	clientAddr *net.UDPAddr
+	upstream   *net.UDPConn // 连接服务器的socket（每个会话一个）
+	toServer   *simLink     // 客户端->服务器
+	toClient   *simLink     // 服务器->客户端
+	lastActive atomic.Int64 // 最后一次收发数据的时间（Unix纳秒）
+}
+
+// UDP和KCP端口的转发循环：按客户端地址创建会话
+func handleUDPConnection(clientConn *net.UDPConn, port *proxyPort) {
 	// 解析目标服务器地址
-	serverAddr, err := net.ResolveUDPAddr("udp", *targetHost)
+	serverAddr, err := net.ResolveUDPAddr("udp", port.target)
 	if err != nil {
-		log.Printf("解析目标服务器地址失败 (%s): %v\n", *targetHost, err)
+		log.Printf("解析目标服务器地址失败 (%s): %v\n", port.target, err)
 		return
 	}
 
-	log.Printf("UDP代理启动: %s <-> %s\n", clientConn.LocalAddr(), *targetHost)
+	log.Printf("%s代理启动: %s <-> %s\n", port.name(), clientConn.LocalAddr(), port.target)
 
-	buffer := make([]byte, 4096)
+	var mutex sync.Mutex
+	sessions := make(map[string]*udpSession)
+	buffer := make([]byte, 65536)
 
 	for {
 		// 从客户端接收数据
 		n, clientAddr, err := clientConn.ReadFromUDP(buffer)
 		if err != nil {
-			log.Printf("UDP读取客户端数据错误: %v\n", err)
+			log.Printf("%s读取客户端数据错误: %v\n", port.name(), err)
 			return
 		}
 
-		if n == 0 {
-			continue
-		}
-
-		// 检查是否丢包
-		if *loss > 0 {
-			if rand.Float64()*100 < *loss {
-				log.Printf("[UDP客户端->服务器] 丢包: %d 字节 from %s\n", n, clientAddr.String())
+		key := clientAddr.String()
+		mutex.Lock()
+		session, exists := sessions[key]
+		if !exists {
+			session, err = newUDPSession(clientConn, clientAddr, serverAddr, port, func() {
+				mutex.Lock()
+				delete(sessions, key)
+				mutex.Unlock()
+			})
+			if err != nil {
+				mutex.Unlock()
+				log.Printf("创建%s会话失败 (%s): %v\n", port.name(), key, err)
 				continue
 			}
+			sessions[key] = session
+			log.Printf("新%s会话 #%d: %s -> %s (上游端口 %s, 当前 %d 个会话)\n", port.name(), session.toServer.peer.index, key, port.target, session.upstream.LocalAddr(), len(sessions))
 		}
+		mutex.Unlock()
 
-		// 应用延迟
-		if *delay > 0 {
-			before := time.Now()
-			time.Sleep(time.Duration(*delay) * time.Millisecond)
-			actualDelay := time.Since(before)
-			log.Printf("[UDP客户端->服务器] 数据包: %d 字节 from %s, 应用延迟: %v (目标: %dms)\n",
-				n, clientAddr.String(), actualDelay, *delay)
-		} else {
-			log.Printf("[UDP客户端->服务器] 数据包: %d 字节 from %s (无延迟)\n", n, clientAddr.String())
+		session.lastActive.Store(time.Now().UnixNano())
+		session.toServer.send(buffer[:n])
+	}
+}
+
+// 创建UDP会话并启动服务器->客户端方向的读取循环；会话空闲超时后关闭并调用 onClose
+func newUDPSession(clientConn *net.UDPConn, clientAddr, serverAddr *net.UDPAddr, port *proxyPort, onClose func()) (*udpSession, error) {
+	upstream, err := net.DialUDP("udp", nil, serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	session := &udpSession{clientAddr: clientAddr, upstream: upstream}
+	session.lastActive.Store(time.Now().UnixNano())
+	peer := newPeer(port, clientAddr.String())
+	session.toServer = newSimLink(port, true, peer, func(data []byte) error {
+		_, err := upstream.Write(data)
+		return err
+	})
+	session.toClient = newSimLink(port, false, peer, func(data []byte) error {
+		_, err := clientConn.WriteToUDP(data, clientAddr)
+		return err
+	})
+
+	// 服务器->客户端：独立读取上游socket，服务器可以随时推送数据
+	go func() {
+		defer func() {
+			session.toServer.close(false)
+			session.toClient.close(false)
+			upstream.Close()
+			onClose()
+			log.Printf("%s会话关闭: %s\n", port.name(), clientAddr)
+		}()
+		buffer := make([]byte, 65536)
+		for {
+			upstream.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := upstream.Read(buffer)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					if time.Since(time.Unix(0, session.lastActive.Load())) > *udpIdleTimeout {
+						return
+					}
+					continue
+				}
+				log.Printf("%s读取服务器数据错误 (%s): %v\n", port.name(), clientAddr, err)
+				return
+			}
+			session.lastActive.Store(time.Now().UnixNano())
+			session.toClient.send(buffer[:n])
 		}
+	}()
+	return session, nil
+}
+
+// TCP单向转发：读取到的数据放进保持顺序的链路，读取方不会因为延迟阻塞；
+// 连接关闭时先把链路中的数据发完
+func copyWithDelay(src net.Conn, link *simLink) {
+	defer link.close(true)
 
-		// 转发到服务器
-		_, err = clientConn.WriteToUDP(buffer[:n], serverAddr)
+	buffer := make([]byte, 4096)
+	for {
+		n, err := src.Read(buffer)
 		if err != nil {
-			log.Printf("UDP转发到服务器错误: %v\n", err)
+			if err != io.EOF {
+				log.Printf("[%s] 读取错误: %v\n", link.direction, err)
+			}
 			return
 		}
+		if n == 0 {
+			continue
+		}
+		link.send(buffer[:n])
+	}
+}
 
-		// 尝试接收服务器响应并转发回客户端
-		clientConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-		n, _, err = clientConn.ReadFromUDP(buffer)
-		if err != nil {
-			// 超时是正常的，继续等待下一个客户端请求
+// 执行一条控制命令：修改匹配端口的参数，并应用到这些端口已经打开的链路上
+func applyCommand(ports []*proxyPort, c netsim.Command) error {
+	if c.Action == netsim.ActionEnd {
+		return fmt.Errorf("end is only allowed in scenarios")
+	}
+	if err := checkCommand(ports, c); err != nil {
+		return err
+	}
+	if c.Action == netsim.ActionDrop {
+		if c.Param == "clear" {
+			dropRules.Clear()
+		} else {
+			dropRules.Add(c.Rule)
+		}
+		return nil
+	}
+	for _, port := range ports {
+		if c.Target != "" && c.Target != port.protocol {
 			continue
 		}
 
-		// 检查是否丢包（服务器->客户端）
-		if *loss > 0 {
-			if rand.Float64()*100 < *loss {
-				log.Printf("[UDP服务器->客户端] 丢包: %d 字节\n", n)
+		// 先算出新参数，两个方向都合法时才修改
+		port.mutex.Lock()
+		next := port.profiles
+		for _, up := range []bool{true, false} {
+			if !c.AppliesTo(port.protocol, up) {
 				continue
 			}
+			switch c.Action {
+			case netsim.ActionSet:
+				profile, err := netsim.SetParam(*next.direction(up), c.Param, c.Value)
+				if err != nil {
+					port.mutex.Unlock()
+					return fmt.Errorf("%s: %w", port.protocol, err)
+				}
+				*next.direction(up) = profile
+			case netsim.ActionReset:
+				*next.direction(up) = *port.initial.direction(up)
+			case netsim.ActionBlackout:
+				until := time.Now().Add(c.Duration)
+				if up {
+					port.blackout.up = until
+				} else {
+					port.blackout.down = until
+				}
+			}
 		}
+		port.profiles = next
 
-		// 应用延迟（服务器->客户端）
-		if *delay > 0 {
-			before := time.Now()
-			time.Sleep(time.Duration(*delay) * time.Millisecond)
-			actualDelay := time.Since(before)
-			log.Printf("[UDP服务器->客户端] 数据包: %d 字节, 应用延迟: %v (目标: %dms)\n",
-				n, actualDelay, *delay)
-		} else {
-			log.Printf("[UDP服务器->客户端] 数据包: %d 字节 (无延迟)\n", n)
+		activeLinksMutex.Lock()
+		for l := range activeLinks {
+			if l.port != port || !c.AppliesTo(port.protocol, l.up) {
+				continue
+			}
+			if c.Action == netsim.ActionBlackout {
+				l.Blackout(port.blackoutUntil(l.up))
+			} else {
+				l.SetProfile(*next.direction(l.up))
+			}
 		}
+		activeLinksMutex.Unlock()
+		port.mutex.Unlock()
+	}
+	return nil
+}
 
-		// 转发回客户端
-		_, err = clientConn.WriteToUDP(buffer[:n], clientAddr)
+// 控制接口（HTTP）：
+//
+//	GET  /profiles    各端口两个方向的当前参数
+//	GET  /rules       丢包规则和计数
+//	POST /command     执行请求体中的命令（写法同场景文件，不带 t=，多条用分号或换行分隔），返回修改后的参数
+//
+// 例如 curl -d "kcp set loss 20%" http://127.0.0.1:9900/command
+func controlHandler(ports []*proxyPort) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /profiles", func(w http.ResponseWriter, r *http.Request) {
+		writeProfiles(w, ports)
+	})
+	mux.HandleFunc("GET /rules", func(w http.ResponseWriter, r *http.Request) {
+		writeRules(w)
+	})
+	mux.HandleFunc("POST /command", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
 		if err != nil {
-			log.Printf("UDP转发到客户端错误: %v\n", err)
+			writeControlError(w, err)
 			return
 		}
+		var commands []netsim.Command
+		for _, line := range strings.FieldsFunc(string(body), func(r rune) bool { return r == ';' || r == '\n' }) {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			c, err := netsim.ParseCommand(line)
+			if err == nil {
+				err = checkCommand(ports, c)
+			}
+			if err != nil {
+				writeControlError(w, err)
+				return
+			}
+			commands = append(commands, c)
+		}
+		for _, c := range commands {
+			if err := applyCommand(ports, c); err != nil {
+				writeControlError(w, err)
+				return
+			}
+			log.Printf("[控制接口] %s\n", c)
+		}
+		writeProfiles(w, ports)
+	})
+	return mux
+}
+
+// 返回各端口当前的参数：{"udp": {"up": "delay=50ms loss=20%", "down": "..."}}
+func writeProfiles(w http.ResponseWriter, ports []*proxyPort) {
+	result := make(map[string]map[string]string)
+	for _, port := range ports {
+		port.mutex.Lock()
+		result[port.protocol] = map[string]string{"up": port.profiles.up.String(), "down": port.profiles.down.String()}
+		port.mutex.Unlock()
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
-func copyWithDelay(src, dst net.Conn, direction string) {
-	buffer := make([]byte, 4096)
+// 返回丢包规则和计数：[{"rule": "FRAME_NEED count=1", "matched": 1, "dropped": 1}]
+func writeRules(w http.ResponseWriter) {
+	type ruleJSON struct {
+		Rule    string `json:"rule"`
+		Matched int64  `json:"matched"`
+		Dropped int64  `json:"dropped"`
+	}
+	result := []ruleJSON{}
+	for _, stats := range dropRules.Stats() {
+		result = append(result, ruleJSON{stats.Rule.String(), stats.Matched, stats.Dropped})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-	for {
-		n, err := src.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("[%s] 读取错误: %v\n", direction, err)
-			}
-			return
-		}
+func writeControlError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
 
-		if n == 0 {
-			continue
+// 读取场景文件，检查命令中的端口都存在
+func loadScenario(path string, ports []*proxyPort) ([]netsim.Step, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	steps, err := netsim.ParseScenario(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if err := checkCommand(ports, step.Command); err != nil {
+			return nil, fmt.Errorf("t=%v: %w", step.At, err)
 		}
+	}
+	return steps, nil
+}
 
-		// 检查是否丢包
-		if *loss > 0 {
-			if rand.Float64()*100 < *loss {
-				log.Printf("[%s] 丢包: %d 字节\n", direction, n)
-				continue
-			}
-		}
+// 检查命令的目标端口和丢包规则
+func checkCommand(ports []*proxyPort, c netsim.Command) error {
+	if c.Action == netsim.ActionDrop && c.Param != "clear" {
+		return checkRule(ports, c.Rule)
+	}
+	return checkTarget(ports, c.Target)
+}
 
-		// 应用延迟
-		if *delay > 0 {
-			before := time.Now()
-			time.Sleep(time.Duration(*delay) * time.Millisecond)
-			actualDelay := time.Since(before)
-			log.Printf("[%s] 数据包: %d 字节, 应用延迟: %v (目标: %dms)\n",
-				direction, n, actualDelay, *delay)
-		} else {
-			log.Printf("[%s] 数据包: %d 字节 (无延迟)\n", direction, n)
-		}
+// 检查规则的端口存在并且不是TCP
+func checkRule(ports []*proxyPort, rule netsim.Rule) error {
+	if rule.Port == "tcp" {
+		return fmt.Errorf("drop rules do not apply to tcp (byte stream)")
+	}
+	return checkTarget(ports, rule.Port)
+}
 
-		// 写入数据
-		_, err = dst.Write(buffer[:n])
-		if err != nil {
-			log.Printf("[%s] 写入错误: %v\n", direction, err)
-			return
+// 检查命令的目标端口存在（为空表示全部端口）
+func checkTarget(ports []*proxyPort, target string) error {
+	if target != "" && !slices.ContainsFunc(ports, func(p *proxyPort) bool { return p.protocol == target }) {
+		return fmt.Errorf("no port %q", target)
+	}
+	return nil
+}
+
+// 按时间线执行场景，时间从代理开始监听时算起；遇到 end 时打印统计并退出
+func runScenario(steps []netsim.Step, ports []*proxyPort) {
+	start := time.Now()
+	for _, step := range steps {
+		time.Sleep(time.Until(start.Add(step.At)))
+		log.Printf("[场景] t=%v %s\n", step.At, step.Command)
+		if step.Command.Action == netsim.ActionEnd {
+			activeLinksMutex.Lock()
+			for l := range activeLinks {
+				l.printStats()
+			}
+			activeLinksMutex.Unlock()
+			printRuleStats()
+			log.Println("[场景] 结束")
+			os.Exit(0)
+		}
+		if err := applyCommand(ports, step.Command); err != nil {
+			log.Printf("[场景] t=%v 执行失败: %v\n", step.At, err)
 		}
 	}
+	log.Println("[场景] 所有步骤已执行")
 }
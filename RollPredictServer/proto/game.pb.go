@@ -25,40 +25,91 @@ const (
 type MessageType int32
 
 const (
-	MessageType_MESSAGE_UNKNOWN      MessageType = 0
-	MessageType_MESSAGE_CONNECT      MessageType = 1 // 客户端连接
-	MessageType_MESSAGE_FRAME_DATA   MessageType = 2 // 帧数据（8个方向）
-	MessageType_MESSAGE_SERVER_FRAME MessageType = 3 // 服务器帧同步数据
-	MessageType_MESSAGE_DISCONNECT   MessageType = 4 // 断开连接
-	MessageType_MESSAGE_GAME_START   MessageType = 5 // 游戏开始
-	MessageType_MESSAGE_FRAME_LOSS   MessageType = 6 // 缺失帧
-	MessageType_MESSAGE_FRAME_NEED   MessageType = 7 // 补发帧
-	MessageType_MESSAGE_HEARTBEAT    MessageType = 8 // 心跳（C->S）
+	MessageType_MESSAGE_UNKNOWN       MessageType = 0
+	MessageType_MESSAGE_CONNECT       MessageType = 1  // 客户端连接
+	MessageType_MESSAGE_FRAME_DATA    MessageType = 2  // 帧数据（8个方向）
+	MessageType_MESSAGE_SERVER_FRAME  MessageType = 3  // 服务器帧同步数据
+	MessageType_MESSAGE_DISCONNECT    MessageType = 4  // 断开连接
+	MessageType_MESSAGE_GAME_START    MessageType = 5  // 游戏开始
+	MessageType_MESSAGE_FRAME_LOSS    MessageType = 6  // 缺失帧
+	MessageType_MESSAGE_FRAME_NEED    MessageType = 7  // 补发帧
+	MessageType_MESSAGE_HEARTBEAT     MessageType = 8  // 心跳（C->S）
+	MessageType_MESSAGE_TIME_SCALE    MessageType = 9  // 时间缩放（房主C->S请求，S->C广播）
+	MessageType_MESSAGE_PING          MessageType = 10 // 测时请求（C->S）
+	MessageType_MESSAGE_PONG          MessageType = 11 // 测时回复（S->C）
+	MessageType_MESSAGE_INPUT_DELAY   MessageType = 12 // 输入延迟变更（S->C）
+	MessageType_MESSAGE_PAUSE         MessageType = 13 // 暂停/继续（C->S请求，S->C状态通知）
+	MessageType_MESSAGE_MATCH_END     MessageType = 14 // 比赛结束（房主C->S请求，S->C广播结果）
+	MessageType_MESSAGE_POST_MATCH    MessageType = 15 // 赛后选择：再来一局或返回大厅（C->S选择，S->C广播）
+	MessageType_MESSAGE_MATCH_RESULT  MessageType = 16 // 比赛结果（C->S提交，S->C广播核对结论）
+	MessageType_MESSAGE_MATCH_HISTORY MessageType = 17 // 比赛历史（C->S查询，S->C回复）
+	MessageType_MESSAGE_QUEUE         MessageType = 18 // 匹配队列（C->S加入/离开，S->C排队状态）
+	MessageType_MESSAGE_MATCH_FOUND   MessageType = 19 // 匹配成功（S->C等待确认，C->S确认或拒绝）
+	MessageType_MESSAGE_TEAM_ASSIGN   MessageType = 20 // 分队（房主C->S修改，S->C广播）
+	MessageType_MESSAGE_ROOM_SETTINGS MessageType = 21 // 游戏设置（房主C->S修改，S->C广播）
+	MessageType_MESSAGE_CREATE_ROOM   MessageType = 22 // 创建房间（C->S）
+	MessageType_MESSAGE_JOIN_ROOM     MessageType = 23 // 用邀请码加入房间（C->S）
+	MessageType_MESSAGE_ROOM_INFO     MessageType = 24 // 房间信息（S->C：创建或加入的结果，房间成员或房主变化时发给房间内所有玩家）
+	MessageType_MESSAGE_HOST_COMMAND  MessageType = 25 // 房主命令（房主C->S，S->C广播执行的命令）
 )
 
 // Enum value maps for MessageType.
 var (
 	MessageType_name = map[int32]string{
-		0: "MESSAGE_UNKNOWN",
-		1: "MESSAGE_CONNECT",
-		2: "MESSAGE_FRAME_DATA",
-		3: "MESSAGE_SERVER_FRAME",
-		4: "MESSAGE_DISCONNECT",
-		5: "MESSAGE_GAME_START",
-		6: "MESSAGE_FRAME_LOSS",
-		7: "MESSAGE_FRAME_NEED",
-		8: "MESSAGE_HEARTBEAT",
+		0:  "MESSAGE_UNKNOWN",
+		1:  "MESSAGE_CONNECT",
+		2:  "MESSAGE_FRAME_DATA",
+		3:  "MESSAGE_SERVER_FRAME",
+		4:  "MESSAGE_DISCONNECT",
+		5:  "MESSAGE_GAME_START",
+		6:  "MESSAGE_FRAME_LOSS",
+		7:  "MESSAGE_FRAME_NEED",
+		8:  "MESSAGE_HEARTBEAT",
+		9:  "MESSAGE_TIME_SCALE",
+		10: "MESSAGE_PING",
+		11: "MESSAGE_PONG",
+		12: "MESSAGE_INPUT_DELAY",
+		13: "MESSAGE_PAUSE",
+		14: "MESSAGE_MATCH_END",
+		15: "MESSAGE_POST_MATCH",
+		16: "MESSAGE_MATCH_RESULT",
+		17: "MESSAGE_MATCH_HISTORY",
+		18: "MESSAGE_QUEUE",
+		19: "MESSAGE_MATCH_FOUND",
+		20: "MESSAGE_TEAM_ASSIGN",
+		21: "MESSAGE_ROOM_SETTINGS",
+		22: "MESSAGE_CREATE_ROOM",
+		23: "MESSAGE_JOIN_ROOM",
+		24: "MESSAGE_ROOM_INFO",
+		25: "MESSAGE_HOST_COMMAND",
 	}
 	MessageType_value = map[string]int32{
-		"MESSAGE_UNKNOWN":      0,
-		"MESSAGE_CONNECT":      1,
-		"MESSAGE_FRAME_DATA":   2,
-		"MESSAGE_SERVER_FRAME": 3,
-		"MESSAGE_DISCONNECT":   4,
-		"MESSAGE_GAME_START":   5,
-		"MESSAGE_FRAME_LOSS":   6,
-		"MESSAGE_FRAME_NEED":   7,
-		"MESSAGE_HEARTBEAT":    8,
+		"MESSAGE_UNKNOWN":       0,
+		"MESSAGE_CONNECT":       1,
+		"MESSAGE_FRAME_DATA":    2,
+		"MESSAGE_SERVER_FRAME":  3,
+		"MESSAGE_DISCONNECT":    4,
+		"MESSAGE_GAME_START":    5,
+		"MESSAGE_FRAME_LOSS":    6,
+		"MESSAGE_FRAME_NEED":    7,
+		"MESSAGE_HEARTBEAT":     8,
+		"MESSAGE_TIME_SCALE":    9,
+		"MESSAGE_PING":          10,
+		"MESSAGE_PONG":          11,
+		"MESSAGE_INPUT_DELAY":   12,
+		"MESSAGE_PAUSE":         13,
+		"MESSAGE_MATCH_END":     14,
+		"MESSAGE_POST_MATCH":    15,
+		"MESSAGE_MATCH_RESULT":  16,
+		"MESSAGE_MATCH_HISTORY": 17,
+		"MESSAGE_QUEUE":         18,
+		"MESSAGE_MATCH_FOUND":   19,
+		"MESSAGE_TEAM_ASSIGN":   20,
+		"MESSAGE_ROOM_SETTINGS": 21,
+		"MESSAGE_CREATE_ROOM":   22,
+		"MESSAGE_JOIN_ROOM":     23,
+		"MESSAGE_ROOM_INFO":     24,
+		"MESSAGE_HOST_COMMAND":  25,
 	}
 )
 
@@ -157,6 +208,65 @@ func (InputDirection) EnumDescriptor() ([]byte, []int) {
 	return file_proto_game_proto_rawDescGZIP(), []int{1}
 }
 
+// 房主命令
+type HostAction int32
+
+const (
+	HostAction_HOST_ACTION_UNKNOWN         HostAction = 0
+	HostAction_HOST_ACTION_KICK            HostAction = 1 // 把 target_id 踢出房间（不能再加入这个房间）
+	HostAction_HOST_ACTION_TRANSFER_HOST   HostAction = 2 // 把房主转给 target_id
+	HostAction_HOST_ACTION_LOCK            HostAction = 3 // 锁定房间
+	HostAction_HOST_ACTION_UNLOCK          HostAction = 4 // 解锁房间
+	HostAction_HOST_ACTION_SET_MAX_PLAYERS HostAction = 5 // 修改人数上限为 max_players（只能在游戏开始前，达到上限时开局）
+)
+
+// Enum value maps for HostAction.
+var (
+	HostAction_name = map[int32]string{
+		0: "HOST_ACTION_UNKNOWN",
+		1: "HOST_ACTION_KICK",
+		2: "HOST_ACTION_TRANSFER_HOST",
+		3: "HOST_ACTION_LOCK",
+		4: "HOST_ACTION_UNLOCK",
+		5: "HOST_ACTION_SET_MAX_PLAYERS",
+	}
+	HostAction_value = map[string]int32{
+		"HOST_ACTION_UNKNOWN":         0,
+		"HOST_ACTION_KICK":            1,
+		"HOST_ACTION_TRANSFER_HOST":   2,
+		"HOST_ACTION_LOCK":            3,
+		"HOST_ACTION_UNLOCK":          4,
+		"HOST_ACTION_SET_MAX_PLAYERS": 5,
+	}
+)
+
+func (x HostAction) Enum() *HostAction {
+	p := new(HostAction)
+	*p = x
+	return p
+}
+
+func (x HostAction) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (HostAction) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_game_proto_enumTypes[2].Descriptor()
+}
+
+func (HostAction) Type() protoreflect.EnumType {
+	return &file_proto_game_proto_enumTypes[2]
+}
+
+func (x HostAction) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use HostAction.Descriptor instead.
+func (HostAction) EnumDescriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{2}
+}
+
 // 客户端帧数据（包含8个方向）
 type FrameData struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -312,10 +422,14 @@ func (x *ServerFrame) GetFrameDatas() []*FrameData {
 }
 
 // 连接消息
+// S->C：连接成功时只有 player_id（本次连接的玩家ID）；登录后带上账号信息。
+// C->S：player_name 或 token 不为空时为登录请求，token 为空表示创建新账号。
 type ConnectMessage struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	PlayerId      int32                  `protobuf:"varint,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
 	PlayerName    string                 `protobuf:"bytes,2,opt,name=player_name,json=playerName,proto3" json:"player_name,omitempty"`
+	Token         string                 `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`                           // 登录令牌，客户端保存后用于之后的登录
+	AccountId     int64                  `protobuf:"varint,4,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"` // S->C：稳定的账号ID（0表示未登录或登录失败）
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -364,6 +478,20 @@ func (x *ConnectMessage) GetPlayerName() string {
 	return ""
 }
 
+func (x *ConnectMessage) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *ConnectMessage) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
 // 断开连接消息
 type DisconnectMessage struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -414,7 +542,14 @@ type GameStart struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`                  // 房间ID
 	RandomSeed    int64                  `protobuf:"varint,2,opt,name=random_seed,json=randomSeed,proto3" json:"random_seed,omitempty"`     // 随机种子
-	PlayerIds     []int32                `protobuf:"varint,3,rep,packed,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"` // 玩家ID列表
+	PlayerIds     []int32                `protobuf:"varint,3,rep,packed,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"` // 玩家ID列表（与 roster 顺序相同）
+	FrameRate     int32                  `protobuf:"varint,4,opt,name=frame_rate,json=frameRate,proto3" json:"frame_rate,omitempty"`        // 帧率（每秒逻辑帧数，如15、20、30、60）
+	TimeScale     float64                `protobuf:"fixed64,5,opt,name=time_scale,json=timeScale,proto3" json:"time_scale,omitempty"`       // 时间缩放（1为正常速度，<1慢放，>1快进）
+	StartTime     int64                  `protobuf:"varint,6,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`        // 第0帧的服务器时间（Unix纳秒），第N帧的计划时间为 start_time + N * 帧间隔
+	InputDelay    int32                  `protobuf:"varint,7,opt,name=input_delay,json=inputDelay,proto3" json:"input_delay,omitempty"`     // 初始输入延迟（帧），见 InputDelayChange
+	Roster        []*RosterEntry         `protobuf:"bytes,8,rep,name=roster,proto3" json:"roster,omitempty"`                                // 玩家名单，按队伍、槽位排序，所有客户端按这个顺序初始化
+	TeamCount     int32                  `protobuf:"varint,9,opt,name=team_count,json=teamCount,proto3" json:"team_count,omitempty"`        // 队伍数（0表示不分队）
+	Settings      *GameSettings          `protobuf:"bytes,10,opt,name=settings,proto3" json:"settings,omitempty"`                           // 本局的游戏设置（参数表完整，客户端不使用本地的默认值）
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -470,27 +605,81 @@ func (x *GameStart) GetPlayerIds() []int32 {
 	return nil
 }
 
-type GetLossFrame struct {
-	state           protoimpl.MessageState `protogen:"open.v1"`
-	LastFrameNumber int64                  `protobuf:"varint,1,opt,name=last_frame_number,json=lastFrameNumber,proto3" json:"last_frame_number,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+func (x *GameStart) GetFrameRate() int32 {
+	if x != nil {
+		return x.FrameRate
+	}
+	return 0
 }
 
-func (x *GetLossFrame) Reset() {
-	*x = GetLossFrame{}
+func (x *GameStart) GetTimeScale() float64 {
+	if x != nil {
+		return x.TimeScale
+	}
+	return 0
+}
+
+func (x *GameStart) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *GameStart) GetInputDelay() int32 {
+	if x != nil {
+		return x.InputDelay
+	}
+	return 0
+}
+
+func (x *GameStart) GetRoster() []*RosterEntry {
+	if x != nil {
+		return x.Roster
+	}
+	return nil
+}
+
+func (x *GameStart) GetTeamCount() int32 {
+	if x != nil {
+		return x.TeamCount
+	}
+	return 0
+}
+
+func (x *GameStart) GetSettings() *GameSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+// 名单中的一名玩家
+type RosterEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId      int32                  `protobuf:"varint,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Team          int32                  `protobuf:"varint,2,opt,name=team,proto3" json:"team,omitempty"`                            // 队伍（从1开始；不分队的房间为0）
+	Slot          int32                  `protobuf:"varint,3,opt,name=slot,proto3" json:"slot,omitempty"`                            // 队伍内的出生点槽位（从0开始）
+	Name          string                 `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`                             // S->C：显示名称（未登录为空）
+	AccountId     int64                  `protobuf:"varint,5,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"` // S->C：账号ID（未登录为0）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RosterEntry) Reset() {
+	*x = RosterEntry{}
 	mi := &file_proto_game_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetLossFrame) String() string {
+func (x *RosterEntry) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetLossFrame) ProtoMessage() {}
+func (*RosterEntry) ProtoMessage() {}
 
-func (x *GetLossFrame) ProtoReflect() protoreflect.Message {
+func (x *RosterEntry) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_game_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -502,39 +691,70 @@ func (x *GetLossFrame) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetLossFrame.ProtoReflect.Descriptor instead.
-func (*GetLossFrame) Descriptor() ([]byte, []int) {
+// Deprecated: Use RosterEntry.ProtoReflect.Descriptor instead.
+func (*RosterEntry) Descriptor() ([]byte, []int) {
 	return file_proto_game_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *GetLossFrame) GetLastFrameNumber() int64 {
+func (x *RosterEntry) GetPlayerId() int32 {
 	if x != nil {
-		return x.LastFrameNumber
+		return x.PlayerId
 	}
 	return 0
 }
 
-type SendAllFrame struct {
+func (x *RosterEntry) GetTeam() int32 {
+	if x != nil {
+		return x.Team
+	}
+	return 0
+}
+
+func (x *RosterEntry) GetSlot() int32 {
+	if x != nil {
+		return x.Slot
+	}
+	return 0
+}
+
+func (x *RosterEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RosterEntry) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+// 分队
+// C->S：房主修改部分或全部玩家的队伍和槽位（只能在游戏开始前）
+// S->C：修改后的完整名单
+type TeamAssignment struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	AllNeedFrame  []*ServerFrame         `protobuf:"bytes,1,rep,name=all_need_frame,json=allNeedFrame,proto3" json:"all_need_frame,omitempty"`
+	Roster        []*RosterEntry         `protobuf:"bytes,1,rep,name=roster,proto3" json:"roster,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SendAllFrame) Reset() {
-	*x = SendAllFrame{}
+func (x *TeamAssignment) Reset() {
+	*x = TeamAssignment{}
 	mi := &file_proto_game_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SendAllFrame) String() string {
+func (x *TeamAssignment) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SendAllFrame) ProtoMessage() {}
+func (*TeamAssignment) ProtoMessage() {}
 
-func (x *SendAllFrame) ProtoReflect() protoreflect.Message {
+func (x *TeamAssignment) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_game_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -546,39 +766,43 @@ func (x *SendAllFrame) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SendAllFrame.ProtoReflect.Descriptor instead.
-func (*SendAllFrame) Descriptor() ([]byte, []int) {
+// Deprecated: Use TeamAssignment.ProtoReflect.Descriptor instead.
+func (*TeamAssignment) Descriptor() ([]byte, []int) {
 	return file_proto_game_proto_rawDescGZIP(), []int{6}
 }
 
-func (x *SendAllFrame) GetAllNeedFrame() []*ServerFrame {
+func (x *TeamAssignment) GetRoster() []*RosterEntry {
 	if x != nil {
-		return x.AllNeedFrame
+		return x.Roster
 	}
 	return nil
 }
 
-// 心跳消息（空消息体）
-type Heartbeat struct {
+// 游戏设置：地图、规则预设和可调参数
+// 参数都是整数，小数按约定的单位表示（如 _ms 为毫秒，_milli 为千分之一）
+type GameSettings struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	MapId         string                 `protobuf:"bytes,1,opt,name=map_id,json=mapId,proto3" json:"map_id,omitempty"`                                                                     // 地图ID（为空表示默认地图）
+	Preset        string                 `protobuf:"bytes,2,opt,name=preset,proto3" json:"preset,omitempty"`                                                                                // 规则预设（为空表示默认预设）
+	Tunables      map[string]int64       `protobuf:"bytes,3,rep,name=tunables,proto3" json:"tunables,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"` // 参数名 -> 值；C->S 只需要包含和预设不同的参数
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Heartbeat) Reset() {
-	*x = Heartbeat{}
+func (x *GameSettings) Reset() {
+	*x = GameSettings{}
 	mi := &file_proto_game_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Heartbeat) String() string {
+func (x *GameSettings) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Heartbeat) ProtoMessage() {}
+func (*GameSettings) ProtoMessage() {}
 
-func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+func (x *GameSettings) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_game_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -590,68 +814,2185 @@ func (x *Heartbeat) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
-func (*Heartbeat) Descriptor() ([]byte, []int) {
+// Deprecated: Use GameSettings.ProtoReflect.Descriptor instead.
+func (*GameSettings) Descriptor() ([]byte, []int) {
 	return file_proto_game_proto_rawDescGZIP(), []int{7}
 }
 
-var File_proto_game_proto protoreflect.FileDescriptor
+func (x *GameSettings) GetMapId() string {
+	if x != nil {
+		return x.MapId
+	}
+	return ""
+}
 
-const file_proto_game_proto_rawDesc = "" +
-	"\n" +
-	"\x10proto/game.proto\x12\x05proto\"\x84\x02\n" +
-	"\tFrameData\x12\x1b\n" +
-	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x123\n" +
-	"\tdirection\x18\x02 \x01(\x0e2\x15.proto.InputDirectionR\tdirection\x12!\n" +
-	"\fframe_number\x18\x03 \x01(\x03R\vframeNumber\x12\x17\n" +
-	"\ais_fire\x18\x04 \x01(\bR\x06isFire\x12\x1a\n" +
-	"\x06fire_x\x18\x05 \x01(\x03H\x00R\x05fireX\x88\x01\x01\x12\x1a\n" +
-	"\x06fire_y\x18\x06 \x01(\x03H\x01R\x05fireY\x88\x01\x01\x12\x1b\n" +
-	"\tis_toggle\x18\a \x01(\bR\bisToggleB\t\n" +
-	"\a_fire_xB\t\n" +
-	"\a_fire_y\"\x81\x01\n" +
-	"\vServerFrame\x12!\n" +
-	"\fframe_number\x18\x01 \x01(\x03R\vframeNumber\x12\x1c\n" +
-	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x121\n" +
-	"\vframe_datas\x18\x03 \x03(\v2\x10.proto.FrameDataR\n" +
-	"frameDatas\"N\n" +
-	"\x0eConnectMessage\x12\x1b\n" +
-	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x12\x1f\n" +
-	"\vplayer_name\x18\x02 \x01(\tR\n" +
-	"playerName\"0\n" +
-	"\x11DisconnectMessage\x12\x1b\n" +
-	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\"d\n" +
-	"\tGameStart\x12\x17\n" +
-	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x1f\n" +
-	"\vrandom_seed\x18\x02 \x01(\x03R\n" +
-	"randomSeed\x12\x1d\n" +
-	"\n" +
-	"player_ids\x18\x03 \x03(\x05R\tplayerIds\":\n" +
-	"\fGetLossFrame\x12*\n" +
-	"\x11last_frame_number\x18\x01 \x01(\x03R\x0flastFrameNumber\"H\n" +
-	"\fSendAllFrame\x128\n" +
-	"\x0eall_need_frame\x18\x01 \x03(\v2\x12.proto.ServerFrameR\fallNeedFrame\"\v\n" +
-	"\tHeartbeat*\xe0\x01\n" +
-	"\vMessageType\x12\x13\n" +
-	"\x0fMESSAGE_UNKNOWN\x10\x00\x12\x13\n" +
-	"\x0fMESSAGE_CONNECT\x10\x01\x12\x16\n" +
-	"\x12MESSAGE_FRAME_DATA\x10\x02\x12\x18\n" +
-	"\x14MESSAGE_SERVER_FRAME\x10\x03\x12\x16\n" +
-	"\x12MESSAGE_DISCONNECT\x10\x04\x12\x16\n" +
-	"\x12MESSAGE_GAME_START\x10\x05\x12\x16\n" +
-	"\x12MESSAGE_FRAME_LOSS\x10\x06\x12\x16\n" +
-	"\x12MESSAGE_FRAME_NEED\x10\a\x12\x15\n" +
-	"\x11MESSAGE_HEARTBEAT\x10\b*\xd5\x01\n" +
-	"\x0eInputDirection\x12\x12\n" +
-	"\x0eDIRECTION_NONE\x10\x00\x12\x10\n" +
-	"\fDIRECTION_UP\x10\x01\x12\x12\n" +
-	"\x0eDIRECTION_DOWN\x10\x02\x12\x12\n" +
-	"\x0eDIRECTION_LEFT\x10\x03\x12\x13\n" +
-	"\x0fDIRECTION_RIGHT\x10\x04\x12\x15\n" +
-	"\x11DIRECTION_UP_LEFT\x10\x05\x12\x16\n" +
-	"\x12DIRECTION_UP_RIGHT\x10\x06\x12\x17\n" +
-	"\x13DIRECTION_DOWN_LEFT\x10\a\x12\x18\n" +
-	"\x14DIRECTION_DOWN_RIGHT\x10\bB\"Z github.com/WjcHome/gohello/protob\x06proto3"
+func (x *GameSettings) GetPreset() string {
+	if x != nil {
+		return x.Preset
+	}
+	return ""
+}
+
+func (x *GameSettings) GetTunables() map[string]int64 {
+	if x != nil {
+		return x.Tunables
+	}
+	return nil
+}
+
+// 房间的游戏设置
+// C->S：房主选择新的设置（只能在游戏开始前），没有列出的参数使用预设的值
+// S->C：修改后生效的完整设置；请求不合法时只回复房主 error
+type RoomSettings struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Settings      *GameSettings          `protobuf:"bytes,1,opt,name=settings,proto3" json:"settings,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"` // S->C：修改失败的原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomSettings) Reset() {
+	*x = RoomSettings{}
+	mi := &file_proto_game_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomSettings) ProtoMessage() {}
+
+func (x *RoomSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomSettings.ProtoReflect.Descriptor instead.
+func (*RoomSettings) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RoomSettings) GetSettings() *GameSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *RoomSettings) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// 输入延迟变更：服务器发出第N帧之后收到的输入放入第 N+1+input_delay 帧
+type InputDelayChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InputDelay    int32                  `protobuf:"varint,1,opt,name=input_delay,json=inputDelay,proto3" json:"input_delay,omitempty"`    // 新的输入延迟（帧）
+	FrameNumber   int64                  `protobuf:"varint,2,opt,name=frame_number,json=frameNumber,proto3" json:"frame_number,omitempty"` // 从这一帧开始使用新的输入延迟（发出第 frame_number-1 帧之后收到的输入）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InputDelayChange) Reset() {
+	*x = InputDelayChange{}
+	mi := &file_proto_game_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InputDelayChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InputDelayChange) ProtoMessage() {}
+
+func (x *InputDelayChange) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InputDelayChange.ProtoReflect.Descriptor instead.
+func (*InputDelayChange) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *InputDelayChange) GetInputDelay() int32 {
+	if x != nil {
+		return x.InputDelay
+	}
+	return 0
+}
+
+func (x *InputDelayChange) GetFrameNumber() int64 {
+	if x != nil {
+		return x.FrameNumber
+	}
+	return 0
+}
+
+// 时间缩放（只改变服务器发帧的快慢，不影响每帧的逻辑步长）
+type TimeScaleChange struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	TimeScale       float64                `protobuf:"fixed64,1,opt,name=time_scale,json=timeScale,proto3" json:"time_scale,omitempty"`                    // 新的时间缩放
+	FrameNumber     int64                  `protobuf:"varint,2,opt,name=frame_number,json=frameNumber,proto3" json:"frame_number,omitempty"`               // 第一个按新速度发送的帧号（S->C）
+	FrameIntervalNs int64                  `protobuf:"varint,3,opt,name=frame_interval_ns,json=frameIntervalNs,proto3" json:"frame_interval_ns,omitempty"` // 新的实际帧间隔（纳秒，S->C）
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *TimeScaleChange) Reset() {
+	*x = TimeScaleChange{}
+	mi := &file_proto_game_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimeScaleChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimeScaleChange) ProtoMessage() {}
+
+func (x *TimeScaleChange) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimeScaleChange.ProtoReflect.Descriptor instead.
+func (*TimeScaleChange) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TimeScaleChange) GetTimeScale() float64 {
+	if x != nil {
+		return x.TimeScale
+	}
+	return 0
+}
+
+func (x *TimeScaleChange) GetFrameNumber() int64 {
+	if x != nil {
+		return x.FrameNumber
+	}
+	return 0
+}
+
+func (x *TimeScaleChange) GetFrameIntervalNs() int64 {
+	if x != nil {
+		return x.FrameIntervalNs
+	}
+	return 0
+}
+
+type GetLossFrame struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	LastFrameNumber int64                  `protobuf:"varint,1,opt,name=last_frame_number,json=lastFrameNumber,proto3" json:"last_frame_number,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetLossFrame) Reset() {
+	*x = GetLossFrame{}
+	mi := &file_proto_game_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLossFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLossFrame) ProtoMessage() {}
+
+func (x *GetLossFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLossFrame.ProtoReflect.Descriptor instead.
+func (*GetLossFrame) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetLossFrame) GetLastFrameNumber() int64 {
+	if x != nil {
+		return x.LastFrameNumber
+	}
+	return 0
+}
+
+type SendAllFrame struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AllNeedFrame  []*ServerFrame         `protobuf:"bytes,1,rep,name=all_need_frame,json=allNeedFrame,proto3" json:"all_need_frame,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendAllFrame) Reset() {
+	*x = SendAllFrame{}
+	mi := &file_proto_game_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendAllFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendAllFrame) ProtoMessage() {}
+
+func (x *SendAllFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendAllFrame.ProtoReflect.Descriptor instead.
+func (*SendAllFrame) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SendAllFrame) GetAllNeedFrame() []*ServerFrame {
+	if x != nil {
+		return x.AllNeedFrame
+	}
+	return nil
+}
+
+// 心跳消息（空消息体）
+type Heartbeat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_proto_game_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{13}
+}
+
+// 测时请求（NTP式时钟同步，客户端定期发送，可代替心跳）
+type Ping struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Sequence           int64                  `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`                                                   // 序号，Pong中原样返回
+	ClientSendTime     int64                  `protobuf:"varint,2,opt,name=client_send_time,json=clientSendTime,proto3" json:"client_send_time,omitempty"`               // 客户端发送时间（客户端时钟，Unix纳秒）
+	EchoServerSendTime int64                  `protobuf:"varint,3,opt,name=echo_server_send_time,json=echoServerSendTime,proto3" json:"echo_server_send_time,omitempty"` // 上一个Pong的 server_send_time，服务器用来测量RTT（0表示没有）
+	EchoHoldNs         int64                  `protobuf:"varint,4,opt,name=echo_hold_ns,json=echoHoldNs,proto3" json:"echo_hold_ns,omitempty"`                           // 客户端从收到上一个Pong到发送本Ping经过的时间（纳秒）
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Ping) Reset() {
+	*x = Ping{}
+	mi := &file_proto_game_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ping) ProtoMessage() {}
+
+func (x *Ping) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ping.ProtoReflect.Descriptor instead.
+func (*Ping) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Ping) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Ping) GetClientSendTime() int64 {
+	if x != nil {
+		return x.ClientSendTime
+	}
+	return 0
+}
+
+func (x *Ping) GetEchoServerSendTime() int64 {
+	if x != nil {
+		return x.EchoServerSendTime
+	}
+	return 0
+}
+
+func (x *Ping) GetEchoHoldNs() int64 {
+	if x != nil {
+		return x.EchoHoldNs
+	}
+	return 0
+}
+
+// 测时回复
+type Pong struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Sequence          int64                  `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`                                              // Ping的序号
+	ClientSendTime    int64                  `protobuf:"varint,2,opt,name=client_send_time,json=clientSendTime,proto3" json:"client_send_time,omitempty"`          // Ping的 client_send_time，原样返回
+	ServerReceiveTime int64                  `protobuf:"varint,3,opt,name=server_receive_time,json=serverReceiveTime,proto3" json:"server_receive_time,omitempty"` // 服务器收到Ping的时间（服务器时钟，Unix纳秒）
+	ServerSendTime    int64                  `protobuf:"varint,4,opt,name=server_send_time,json=serverSendTime,proto3" json:"server_send_time,omitempty"`          // 服务器发送Pong的时间（服务器时钟，Unix纳秒）
+	RttNs             int64                  `protobuf:"varint,5,opt,name=rtt_ns,json=rttNs,proto3" json:"rtt_ns,omitempty"`                                       // 服务器测得的平滑RTT（纳秒，0表示尚未测得）
+	FrameAnchorTime   int64                  `protobuf:"varint,6,opt,name=frame_anchor_time,json=frameAnchorTime,proto3" json:"frame_anchor_time,omitempty"`       // 帧时钟锚点时间（服务器时钟，Unix纳秒，游戏未开始时为0）
+	FrameAnchorNumber int64                  `protobuf:"varint,7,opt,name=frame_anchor_number,json=frameAnchorNumber,proto3" json:"frame_anchor_number,omitempty"` // 锚点时已发出的帧数，第N帧的计划时间 = anchor_time + (N - anchor_number) * interval
+	FrameIntervalNs   int64                  `protobuf:"varint,8,opt,name=frame_interval_ns,json=frameIntervalNs,proto3" json:"frame_interval_ns,omitempty"`       // 当前实际帧间隔（纳秒）
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Pong) Reset() {
+	*x = Pong{}
+	mi := &file_proto_game_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pong) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pong) ProtoMessage() {}
+
+func (x *Pong) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pong.ProtoReflect.Descriptor instead.
+func (*Pong) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Pong) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Pong) GetClientSendTime() int64 {
+	if x != nil {
+		return x.ClientSendTime
+	}
+	return 0
+}
+
+func (x *Pong) GetServerReceiveTime() int64 {
+	if x != nil {
+		return x.ServerReceiveTime
+	}
+	return 0
+}
+
+func (x *Pong) GetServerSendTime() int64 {
+	if x != nil {
+		return x.ServerSendTime
+	}
+	return 0
+}
+
+func (x *Pong) GetRttNs() int64 {
+	if x != nil {
+		return x.RttNs
+	}
+	return 0
+}
+
+func (x *Pong) GetFrameAnchorTime() int64 {
+	if x != nil {
+		return x.FrameAnchorTime
+	}
+	return 0
+}
+
+func (x *Pong) GetFrameAnchorNumber() int64 {
+	if x != nil {
+		return x.FrameAnchorNumber
+	}
+	return 0
+}
+
+func (x *Pong) GetFrameIntervalNs() int64 {
+	if x != nil {
+		return x.FrameIntervalNs
+	}
+	return 0
+}
+
+// 暂停/继续
+type PauseMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Paused        bool                   `protobuf:"varint,1,opt,name=paused,proto3" json:"paused,omitempty"`                              // C->S：请求暂停(true)或继续(false)；S->C：房间当前是否暂停
+	FrameNumber   int64                  `protobuf:"varint,2,opt,name=frame_number,json=frameNumber,proto3" json:"frame_number,omitempty"` // S->C：暂停前最后发出的帧号
+	PlayerId      int32                  `protobuf:"varint,3,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`          // S->C：发起请求或投票的玩家
+	Votes         int32                  `protobuf:"varint,4,opt,name=votes,proto3" json:"votes,omitempty"`                                // S->C：投票模式下赞成的票数
+	VotesNeeded   int32                  `protobuf:"varint,5,opt,name=votes_needed,json=votesNeeded,proto3" json:"votes_needed,omitempty"` // S->C：改变状态需要的票数
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseMessage) Reset() {
+	*x = PauseMessage{}
+	mi := &file_proto_game_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseMessage) ProtoMessage() {}
+
+func (x *PauseMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseMessage.ProtoReflect.Descriptor instead.
+func (*PauseMessage) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PauseMessage) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+func (x *PauseMessage) GetFrameNumber() int64 {
+	if x != nil {
+		return x.FrameNumber
+	}
+	return 0
+}
+
+func (x *PauseMessage) GetPlayerId() int32 {
+	if x != nil {
+		return x.PlayerId
+	}
+	return 0
+}
+
+func (x *PauseMessage) GetVotes() int32 {
+	if x != nil {
+		return x.Votes
+	}
+	return 0
+}
+
+func (x *PauseMessage) GetVotesNeeded() int32 {
+	if x != nil {
+		return x.VotesNeeded
+	}
+	return 0
+}
+
+// 玩家的比赛结果
+type PlayerResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId      int32                  `protobuf:"varint,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"` // 玩家ID
+	Score         int64                  `protobuf:"varint,2,opt,name=score,proto3" json:"score,omitempty"`                       // 得分
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerResult) Reset() {
+	*x = PlayerResult{}
+	mi := &file_proto_game_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerResult) ProtoMessage() {}
+
+func (x *PlayerResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerResult.ProtoReflect.Descriptor instead.
+func (*PlayerResult) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PlayerResult) GetPlayerId() int32 {
+	if x != nil {
+		return x.PlayerId
+	}
+	return 0
+}
+
+func (x *PlayerResult) GetScore() int64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+// 比赛结束
+type MatchEnd struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FrameNumber   int64                  `protobuf:"varint,1,opt,name=frame_number,json=frameNumber,proto3" json:"frame_number,omitempty"` // 最后一帧（S->C）
+	WinnerId      *int32                 `protobuf:"varint,2,opt,name=winner_id,json=winnerId,proto3,oneof" json:"winner_id,omitempty"`    // 获胜玩家ID（不设置表示平局）
+	Results       []*PlayerResult        `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`                             // 每个玩家的结果
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`                               // 结束原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchEnd) Reset() {
+	*x = MatchEnd{}
+	mi := &file_proto_game_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchEnd) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchEnd) ProtoMessage() {}
+
+func (x *MatchEnd) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchEnd.ProtoReflect.Descriptor instead.
+func (*MatchEnd) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *MatchEnd) GetFrameNumber() int64 {
+	if x != nil {
+		return x.FrameNumber
+	}
+	return 0
+}
+
+func (x *MatchEnd) GetWinnerId() int32 {
+	if x != nil && x.WinnerId != nil {
+		return *x.WinnerId
+	}
+	return 0
+}
+
+func (x *MatchEnd) GetResults() []*PlayerResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *MatchEnd) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// 赛后选择
+type PostMatchChoice struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rematch       bool                   `protobuf:"varint,1,opt,name=rematch,proto3" json:"rematch,omitempty"`                   // true：再来一局；false：返回大厅
+	PlayerId      int32                  `protobuf:"varint,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"` // S->C：做出选择的玩家
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostMatchChoice) Reset() {
+	*x = PostMatchChoice{}
+	mi := &file_proto_game_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostMatchChoice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostMatchChoice) ProtoMessage() {}
+
+func (x *PostMatchChoice) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostMatchChoice.ProtoReflect.Descriptor instead.
+func (*PostMatchChoice) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *PostMatchChoice) GetRematch() bool {
+	if x != nil {
+		return x.Rematch
+	}
+	return false
+}
+
+func (x *PostMatchChoice) GetPlayerId() int32 {
+	if x != nil {
+		return x.PlayerId
+	}
+	return 0
+}
+
+// 比赛结果：比赛结束后每个玩家提交自己计算的结果（C->S），服务器核对后广播结论（S->C）
+type MatchResult struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	FinalFrame     int64                  `protobuf:"varint,1,opt,name=final_frame,json=finalFrame,proto3" json:"final_frame,omitempty"`                    // 最后一帧
+	WinnerId       *int32                 `protobuf:"varint,2,opt,name=winner_id,json=winnerId,proto3,oneof" json:"winner_id,omitempty"`                    // 获胜玩家ID（不设置表示平局）
+	Results        []*PlayerResult        `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`                                             // 每个玩家的结果
+	StateHash      []byte                 `protobuf:"bytes,4,opt,name=state_hash,json=stateHash,proto3" json:"state_hash,omitempty"`                        // 最后一帧的状态哈希
+	Agreed         bool                   `protobuf:"varint,5,opt,name=agreed,proto3" json:"agreed,omitempty"`                                              // S->C：过半玩家提交了相同的结果
+	DisagreeingIds []int32                `protobuf:"varint,6,rep,packed,name=disagreeing_ids,json=disagreeingIds,proto3" json:"disagreeing_ids,omitempty"` // S->C：提交的结果与共识不一致的玩家
+	MissingIds     []int32                `protobuf:"varint,7,rep,packed,name=missing_ids,json=missingIds,proto3" json:"missing_ids,omitempty"`             // S->C：没有按时提交结果的玩家
+	MatchId        string                 `protobuf:"bytes,8,opt,name=match_id,json=matchId,proto3" json:"match_id,omitempty"`                              // S->C：比赛记录ID
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MatchResult) Reset() {
+	*x = MatchResult{}
+	mi := &file_proto_game_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchResult) ProtoMessage() {}
+
+func (x *MatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchResult.ProtoReflect.Descriptor instead.
+func (*MatchResult) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *MatchResult) GetFinalFrame() int64 {
+	if x != nil {
+		return x.FinalFrame
+	}
+	return 0
+}
+
+func (x *MatchResult) GetWinnerId() int32 {
+	if x != nil && x.WinnerId != nil {
+		return *x.WinnerId
+	}
+	return 0
+}
+
+func (x *MatchResult) GetResults() []*PlayerResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *MatchResult) GetStateHash() []byte {
+	if x != nil {
+		return x.StateHash
+	}
+	return nil
+}
+
+func (x *MatchResult) GetAgreed() bool {
+	if x != nil {
+		return x.Agreed
+	}
+	return false
+}
+
+func (x *MatchResult) GetDisagreeingIds() []int32 {
+	if x != nil {
+		return x.DisagreeingIds
+	}
+	return nil
+}
+
+func (x *MatchResult) GetMissingIds() []int32 {
+	if x != nil {
+		return x.MissingIds
+	}
+	return nil
+}
+
+func (x *MatchResult) GetMatchId() string {
+	if x != nil {
+		return x.MatchId
+	}
+	return ""
+}
+
+// 比赛记录（保存在服务器数据目录，不在网络上传输）
+type MatchRecord struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MatchId       string                 `protobuf:"bytes,1,opt,name=match_id,json=matchId,proto3" json:"match_id,omitempty"`
+	RoomId        string                 `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Round         int32                  `protobuf:"varint,3,opt,name=round,proto3" json:"round,omitempty"`                                                                                       // 房间内第几局
+	StartTime     int64                  `protobuf:"varint,4,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`                                                              // 开始时间（Unix纳秒）
+	EndTime       int64                  `protobuf:"varint,5,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`                                                                    // 结束时间（Unix纳秒）
+	GameStart     *GameStart             `protobuf:"bytes,6,opt,name=game_start,json=gameStart,proto3" json:"game_start,omitempty"`                                                               // 开局信息
+	Verdict       *MatchResult           `protobuf:"bytes,7,opt,name=verdict,proto3" json:"verdict,omitempty"`                                                                                    // 核对结论
+	Submissions   map[int32]*MatchResult `protobuf:"bytes,8,rep,name=submissions,proto3" json:"submissions,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 每个玩家提交的原始结果
+	ReplayFile    string                 `protobuf:"bytes,9,opt,name=replay_file,json=replayFile,proto3" json:"replay_file,omitempty"`                                                            // 回放文件名
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchRecord) Reset() {
+	*x = MatchRecord{}
+	mi := &file_proto_game_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchRecord) ProtoMessage() {}
+
+func (x *MatchRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchRecord.ProtoReflect.Descriptor instead.
+func (*MatchRecord) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *MatchRecord) GetMatchId() string {
+	if x != nil {
+		return x.MatchId
+	}
+	return ""
+}
+
+func (x *MatchRecord) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *MatchRecord) GetRound() int32 {
+	if x != nil {
+		return x.Round
+	}
+	return 0
+}
+
+func (x *MatchRecord) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *MatchRecord) GetEndTime() int64 {
+	if x != nil {
+		return x.EndTime
+	}
+	return 0
+}
+
+func (x *MatchRecord) GetGameStart() *GameStart {
+	if x != nil {
+		return x.GameStart
+	}
+	return nil
+}
+
+func (x *MatchRecord) GetVerdict() *MatchResult {
+	if x != nil {
+		return x.Verdict
+	}
+	return nil
+}
+
+func (x *MatchRecord) GetSubmissions() map[int32]*MatchResult {
+	if x != nil {
+		return x.Submissions
+	}
+	return nil
+}
+
+func (x *MatchRecord) GetReplayFile() string {
+	if x != nil {
+		return x.ReplayFile
+	}
+	return ""
+}
+
+// 回放：开局信息和全部服务器帧，可用来重新模拟整局比赛
+type Replay struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MatchId       string                 `protobuf:"bytes,1,opt,name=match_id,json=matchId,proto3" json:"match_id,omitempty"`
+	GameStart     *GameStart             `protobuf:"bytes,2,opt,name=game_start,json=gameStart,proto3" json:"game_start,omitempty"`
+	Frames        []*ServerFrame         `protobuf:"bytes,3,rep,name=frames,proto3" json:"frames,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Replay) Reset() {
+	*x = Replay{}
+	mi := &file_proto_game_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Replay) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Replay) ProtoMessage() {}
+
+func (x *Replay) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Replay.ProtoReflect.Descriptor instead.
+func (*Replay) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *Replay) GetMatchId() string {
+	if x != nil {
+		return x.MatchId
+	}
+	return ""
+}
+
+func (x *Replay) GetGameStart() *GameStart {
+	if x != nil {
+		return x.GameStart
+	}
+	return nil
+}
+
+func (x *Replay) GetFrames() []*ServerFrame {
+	if x != nil {
+		return x.Frames
+	}
+	return nil
+}
+
+// 玩家账号（保存在服务器的玩家数据库中）
+type PlayerAccount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                                         // 显示名称
+	CreatedAt     int64                  `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`             // 创建时间（Unix纳秒）
+	LastSeen      int64                  `protobuf:"varint,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`                // 最后登录时间（Unix纳秒）
+	MatchesPlayed int32                  `protobuf:"varint,5,opt,name=matches_played,json=matchesPlayed,proto3" json:"matches_played,omitempty"` // 参加的比赛数
+	Wins          int32                  `protobuf:"varint,6,opt,name=wins,proto3" json:"wins,omitempty"`                                        // 获胜的比赛数
+	Rating        int32                  `protobuf:"varint,7,opt,name=rating,proto3" json:"rating,omitempty"`                                    // 匹配分数（Elo）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerAccount) Reset() {
+	*x = PlayerAccount{}
+	mi := &file_proto_game_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerAccount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerAccount) ProtoMessage() {}
+
+func (x *PlayerAccount) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerAccount.ProtoReflect.Descriptor instead.
+func (*PlayerAccount) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *PlayerAccount) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+func (x *PlayerAccount) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PlayerAccount) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *PlayerAccount) GetLastSeen() int64 {
+	if x != nil {
+		return x.LastSeen
+	}
+	return 0
+}
+
+func (x *PlayerAccount) GetMatchesPlayed() int32 {
+	if x != nil {
+		return x.MatchesPlayed
+	}
+	return 0
+}
+
+func (x *PlayerAccount) GetWins() int32 {
+	if x != nil {
+		return x.Wins
+	}
+	return 0
+}
+
+func (x *PlayerAccount) GetRating() int32 {
+	if x != nil {
+		return x.Rating
+	}
+	return 0
+}
+
+// 比赛中的一名玩家
+type MatchParticipant struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"` // 账号ID（0表示未登录的玩家）
+	PlayerId      int32                  `protobuf:"varint,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`    // 本次连接的玩家ID
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Score         int64                  `protobuf:"varint,4,opt,name=score,proto3" json:"score,omitempty"`
+	Winner        bool                   `protobuf:"varint,5,opt,name=winner,proto3" json:"winner,omitempty"`
+	RatingChange  int32                  `protobuf:"varint,6,opt,name=rating_change,json=ratingChange,proto3" json:"rating_change,omitempty"` // 本场比赛的匹配分数变化
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchParticipant) Reset() {
+	*x = MatchParticipant{}
+	mi := &file_proto_game_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchParticipant) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchParticipant) ProtoMessage() {}
+
+func (x *MatchParticipant) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchParticipant.ProtoReflect.Descriptor instead.
+func (*MatchParticipant) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *MatchParticipant) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+func (x *MatchParticipant) GetPlayerId() int32 {
+	if x != nil {
+		return x.PlayerId
+	}
+	return 0
+}
+
+func (x *MatchParticipant) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MatchParticipant) GetScore() int64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *MatchParticipant) GetWinner() bool {
+	if x != nil {
+		return x.Winner
+	}
+	return false
+}
+
+func (x *MatchParticipant) GetRatingChange() int32 {
+	if x != nil {
+		return x.RatingChange
+	}
+	return 0
+}
+
+// 比赛历史中的一条记录
+type MatchSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MatchId       string                 `protobuf:"bytes,1,opt,name=match_id,json=matchId,proto3" json:"match_id,omitempty"`
+	RoomId        string                 `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	StartTime     int64                  `protobuf:"varint,3,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`    // 开始时间（Unix纳秒）
+	EndTime       int64                  `protobuf:"varint,4,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`          // 结束时间（Unix纳秒）
+	DurationMs    int64                  `protobuf:"varint,5,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"` // 比赛时长（毫秒）
+	FinalFrame    int64                  `protobuf:"varint,6,opt,name=final_frame,json=finalFrame,proto3" json:"final_frame,omitempty"` // 最后一帧
+	Participants  []*MatchParticipant    `protobuf:"bytes,7,rep,name=participants,proto3" json:"participants,omitempty"`
+	Agreed        bool                   `protobuf:"varint,8,opt,name=agreed,proto3" json:"agreed,omitempty"` // 结果是否由过半玩家核对一致（否则为房主宣布的结果）
+	Reason        string                 `protobuf:"bytes,9,opt,name=reason,proto3" json:"reason,omitempty"`  // 结束原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchSummary) Reset() {
+	*x = MatchSummary{}
+	mi := &file_proto_game_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchSummary) ProtoMessage() {}
+
+func (x *MatchSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchSummary.ProtoReflect.Descriptor instead.
+func (*MatchSummary) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *MatchSummary) GetMatchId() string {
+	if x != nil {
+		return x.MatchId
+	}
+	return ""
+}
+
+func (x *MatchSummary) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *MatchSummary) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *MatchSummary) GetEndTime() int64 {
+	if x != nil {
+		return x.EndTime
+	}
+	return 0
+}
+
+func (x *MatchSummary) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *MatchSummary) GetFinalFrame() int64 {
+	if x != nil {
+		return x.FinalFrame
+	}
+	return 0
+}
+
+func (x *MatchSummary) GetParticipants() []*MatchParticipant {
+	if x != nil {
+		return x.Participants
+	}
+	return nil
+}
+
+func (x *MatchSummary) GetAgreed() bool {
+	if x != nil {
+		return x.Agreed
+	}
+	return false
+}
+
+func (x *MatchSummary) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// 比赛历史查询和回复
+type MatchHistory struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     int64                  `protobuf:"varint,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"` // 查询的账号，C->S 为0时查询自己
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`                          // C->S：最多返回的记录数
+	Matches       []*MatchSummary        `protobuf:"bytes,3,rep,name=matches,proto3" json:"matches,omitempty"`                       // S->C：按结束时间从新到旧
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchHistory) Reset() {
+	*x = MatchHistory{}
+	mi := &file_proto_game_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchHistory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchHistory) ProtoMessage() {}
+
+func (x *MatchHistory) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchHistory.ProtoReflect.Descriptor instead.
+func (*MatchHistory) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *MatchHistory) GetAccountId() int64 {
+	if x != nil {
+		return x.AccountId
+	}
+	return 0
+}
+
+func (x *MatchHistory) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *MatchHistory) GetMatches() []*MatchSummary {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+// 匹配队列
+// C->S：queued 为true时加入队列，为false时离开队列
+// S->C：当前的排队状态
+type MatchQueue struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Mode           string                 `protobuf:"bytes,1,opt,name=mode,proto3" json:"mode,omitempty"`                          // 模式：versus（对战）、coop（合作）
+	TeamSize       int32                  `protobuf:"varint,2,opt,name=team_size,json=teamSize,proto3" json:"team_size,omitempty"` // 每队人数
+	Queued         bool                   `protobuf:"varint,3,opt,name=queued,proto3" json:"queued,omitempty"`
+	Rating         int32                  `protobuf:"varint,4,opt,name=rating,proto3" json:"rating,omitempty"`                                       // S->C：匹配使用的分数
+	RatingRange    int32                  `protobuf:"varint,5,opt,name=rating_range,json=ratingRange,proto3" json:"rating_range,omitempty"`          // S->C：当前接受的分数差
+	PlayersWaiting int32                  `protobuf:"varint,6,opt,name=players_waiting,json=playersWaiting,proto3" json:"players_waiting,omitempty"` // S->C：同一队列中等待的玩家数
+	Error          string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`                                          // S->C：加入失败的原因
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MatchQueue) Reset() {
+	*x = MatchQueue{}
+	mi := &file_proto_game_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchQueue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchQueue) ProtoMessage() {}
+
+func (x *MatchQueue) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchQueue.ProtoReflect.Descriptor instead.
+func (*MatchQueue) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *MatchQueue) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *MatchQueue) GetTeamSize() int32 {
+	if x != nil {
+		return x.TeamSize
+	}
+	return 0
+}
+
+func (x *MatchQueue) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+func (x *MatchQueue) GetRating() int32 {
+	if x != nil {
+		return x.Rating
+	}
+	return 0
+}
+
+func (x *MatchQueue) GetRatingRange() int32 {
+	if x != nil {
+		return x.RatingRange
+	}
+	return 0
+}
+
+func (x *MatchQueue) GetPlayersWaiting() int32 {
+	if x != nil {
+		return x.PlayersWaiting
+	}
+	return 0
+}
+
+func (x *MatchQueue) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// 匹配成功，等待所有玩家确认
+// S->C：找到对局、确认进度（accepted_ids）或取消（cancelled）
+// C->S：proposal_id + accept 确认或拒绝
+type MatchFound struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProposalId    uint64                 `protobuf:"varint,1,opt,name=proposal_id,json=proposalId,proto3" json:"proposal_id,omitempty"`
+	Mode          string                 `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	TeamSize      int32                  `protobuf:"varint,3,opt,name=team_size,json=teamSize,proto3" json:"team_size,omitempty"`
+	PlayerIds     []int32                `protobuf:"varint,4,rep,packed,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"`
+	Deadline      int64                  `protobuf:"varint,5,opt,name=deadline,proto3" json:"deadline,omitempty"`                                 // 确认截止时间（Unix纳秒）
+	Accept        bool                   `protobuf:"varint,6,opt,name=accept,proto3" json:"accept,omitempty"`                                     // C->S：确认（true）或拒绝（false）
+	AcceptedIds   []int32                `protobuf:"varint,7,rep,packed,name=accepted_ids,json=acceptedIds,proto3" json:"accepted_ids,omitempty"` // S->C：已确认的玩家
+	Cancelled     bool                   `protobuf:"varint,8,opt,name=cancelled,proto3" json:"cancelled,omitempty"`                               // S->C：有人拒绝或超时，没有拒绝的玩家回到队列
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchFound) Reset() {
+	*x = MatchFound{}
+	mi := &file_proto_game_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchFound) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchFound) ProtoMessage() {}
+
+func (x *MatchFound) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchFound.ProtoReflect.Descriptor instead.
+func (*MatchFound) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *MatchFound) GetProposalId() uint64 {
+	if x != nil {
+		return x.ProposalId
+	}
+	return 0
+}
+
+func (x *MatchFound) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *MatchFound) GetTeamSize() int32 {
+	if x != nil {
+		return x.TeamSize
+	}
+	return 0
+}
+
+func (x *MatchFound) GetPlayerIds() []int32 {
+	if x != nil {
+		return x.PlayerIds
+	}
+	return nil
+}
+
+func (x *MatchFound) GetDeadline() int64 {
+	if x != nil {
+		return x.Deadline
+	}
+	return 0
+}
+
+func (x *MatchFound) GetAccept() bool {
+	if x != nil {
+		return x.Accept
+	}
+	return false
+}
+
+func (x *MatchFound) GetAcceptedIds() []int32 {
+	if x != nil {
+		return x.AcceptedIds
+	}
+	return nil
+}
+
+func (x *MatchFound) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+// 创建房间，创建者离开当前房间和匹配队列并成为房主
+type CreateRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	MaxPlayers    int32                  `protobuf:"varint,2,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"` // 0表示服务器默认人数
+	FrameRate     int32                  `protobuf:"varint,3,opt,name=frame_rate,json=frameRate,proto3" json:"frame_rate,omitempty"`    // 0表示服务器默认帧率
+	TeamCount     int32                  `protobuf:"varint,4,opt,name=team_count,json=teamCount,proto3" json:"team_count,omitempty"`    // 队伍数（0表示不分队）
+	Private       bool                   `protobuf:"varint,5,opt,name=private,proto3" json:"private,omitempty"`                         // 私人房间不参与自动分配，只能用邀请码加入
+	Password      string                 `protobuf:"bytes,6,opt,name=password,proto3" json:"password,omitempty"`                        // 为空表示不需要密码
+	Settings      *GameSettings          `protobuf:"bytes,7,opt,name=settings,proto3" json:"settings,omitempty"`                        // 为空表示默认设置
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRoomRequest) Reset() {
+	*x = CreateRoomRequest{}
+	mi := &file_proto_game_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRoomRequest) ProtoMessage() {}
+
+func (x *CreateRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRoomRequest.ProtoReflect.Descriptor instead.
+func (*CreateRoomRequest) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *CreateRoomRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateRoomRequest) GetMaxPlayers() int32 {
+	if x != nil {
+		return x.MaxPlayers
+	}
+	return 0
+}
+
+func (x *CreateRoomRequest) GetFrameRate() int32 {
+	if x != nil {
+		return x.FrameRate
+	}
+	return 0
+}
+
+func (x *CreateRoomRequest) GetTeamCount() int32 {
+	if x != nil {
+		return x.TeamCount
+	}
+	return 0
+}
+
+func (x *CreateRoomRequest) GetPrivate() bool {
+	if x != nil {
+		return x.Private
+	}
+	return false
+}
+
+func (x *CreateRoomRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *CreateRoomRequest) GetSettings() *GameSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+// 用邀请码加入房间
+type JoinRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"` // 邀请码（不区分大小写）
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JoinRoomRequest) Reset() {
+	*x = JoinRoomRequest{}
+	mi := &file_proto_game_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JoinRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JoinRoomRequest) ProtoMessage() {}
+
+func (x *JoinRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JoinRoomRequest.ProtoReflect.Descriptor instead.
+func (*JoinRoomRequest) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *JoinRoomRequest) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *JoinRoomRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+// 房间信息
+type RoomInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"` // 邀请码
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	HostId        int32                  `protobuf:"varint,3,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`
+	PlayerIds     []int32                `protobuf:"varint,4,rep,packed,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"`
+	MaxPlayers    int32                  `protobuf:"varint,5,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
+	Private       bool                   `protobuf:"varint,6,opt,name=private,proto3" json:"private,omitempty"`
+	HasPassword   bool                   `protobuf:"varint,7,opt,name=has_password,json=hasPassword,proto3" json:"has_password,omitempty"`
+	Error         string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`    // 创建或加入失败的原因（其他字段为空）
+	Locked        bool                   `protobuf:"varint,9,opt,name=locked,proto3" json:"locked,omitempty"` // 房主锁定了房间，不能再加入
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomInfo) Reset() {
+	*x = RoomInfo{}
+	mi := &file_proto_game_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomInfo) ProtoMessage() {}
+
+func (x *RoomInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomInfo.ProtoReflect.Descriptor instead.
+func (*RoomInfo) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *RoomInfo) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *RoomInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RoomInfo) GetHostId() int32 {
+	if x != nil {
+		return x.HostId
+	}
+	return 0
+}
+
+func (x *RoomInfo) GetPlayerIds() []int32 {
+	if x != nil {
+		return x.PlayerIds
+	}
+	return nil
+}
+
+func (x *RoomInfo) GetMaxPlayers() int32 {
+	if x != nil {
+		return x.MaxPlayers
+	}
+	return 0
+}
+
+func (x *RoomInfo) GetPrivate() bool {
+	if x != nil {
+		return x.Private
+	}
+	return false
+}
+
+func (x *RoomInfo) GetHasPassword() bool {
+	if x != nil {
+		return x.HasPassword
+	}
+	return false
+}
+
+func (x *RoomInfo) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RoomInfo) GetLocked() bool {
+	if x != nil {
+		return x.Locked
+	}
+	return false
+}
+
+// 房主命令（游戏设置用 RoomSettings 修改）
+// C->S：房主执行命令
+// S->C：执行成功后发给房间内所有玩家（包括被踢出的玩家），随后广播新的 RoomInfo；失败时只回复房主 error
+type HostCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Action        HostAction             `protobuf:"varint,1,opt,name=action,proto3,enum=proto.HostAction" json:"action,omitempty"`
+	TargetId      int32                  `protobuf:"varint,2,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	MaxPlayers    int32                  `protobuf:"varint,3,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
+	HostId        int32                  `protobuf:"varint,4,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"` // S->C：执行命令的房主
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`                  // S->C：执行失败的原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HostCommand) Reset() {
+	*x = HostCommand{}
+	mi := &file_proto_game_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HostCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HostCommand) ProtoMessage() {}
+
+func (x *HostCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_game_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HostCommand.ProtoReflect.Descriptor instead.
+func (*HostCommand) Descriptor() ([]byte, []int) {
+	return file_proto_game_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *HostCommand) GetAction() HostAction {
+	if x != nil {
+		return x.Action
+	}
+	return HostAction_HOST_ACTION_UNKNOWN
+}
+
+func (x *HostCommand) GetTargetId() int32 {
+	if x != nil {
+		return x.TargetId
+	}
+	return 0
+}
+
+func (x *HostCommand) GetMaxPlayers() int32 {
+	if x != nil {
+		return x.MaxPlayers
+	}
+	return 0
+}
+
+func (x *HostCommand) GetHostId() int32 {
+	if x != nil {
+		return x.HostId
+	}
+	return 0
+}
+
+func (x *HostCommand) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_proto_game_proto protoreflect.FileDescriptor
+
+const file_proto_game_proto_rawDesc = "" +
+	"\n" +
+	"\x10proto/game.proto\x12\x05proto\"\x84\x02\n" +
+	"\tFrameData\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x123\n" +
+	"\tdirection\x18\x02 \x01(\x0e2\x15.proto.InputDirectionR\tdirection\x12!\n" +
+	"\fframe_number\x18\x03 \x01(\x03R\vframeNumber\x12\x17\n" +
+	"\ais_fire\x18\x04 \x01(\bR\x06isFire\x12\x1a\n" +
+	"\x06fire_x\x18\x05 \x01(\x03H\x00R\x05fireX\x88\x01\x01\x12\x1a\n" +
+	"\x06fire_y\x18\x06 \x01(\x03H\x01R\x05fireY\x88\x01\x01\x12\x1b\n" +
+	"\tis_toggle\x18\a \x01(\bR\bisToggleB\t\n" +
+	"\a_fire_xB\t\n" +
+	"\a_fire_y\"\x81\x01\n" +
+	"\vServerFrame\x12!\n" +
+	"\fframe_number\x18\x01 \x01(\x03R\vframeNumber\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x121\n" +
+	"\vframe_datas\x18\x03 \x03(\v2\x10.proto.FrameDataR\n" +
+	"frameDatas\"\x83\x01\n" +
+	"\x0eConnectMessage\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x12\x1f\n" +
+	"\vplayer_name\x18\x02 \x01(\tR\n" +
+	"playerName\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x04 \x01(\x03R\taccountId\"0\n" +
+	"\x11DisconnectMessage\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\"\xde\x02\n" +
+	"\tGameStart\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x1f\n" +
+	"\vrandom_seed\x18\x02 \x01(\x03R\n" +
+	"randomSeed\x12\x1d\n" +
+	"\n" +
+	"player_ids\x18\x03 \x03(\x05R\tplayerIds\x12\x1d\n" +
+	"\n" +
+	"frame_rate\x18\x04 \x01(\x05R\tframeRate\x12\x1d\n" +
+	"\n" +
+	"time_scale\x18\x05 \x01(\x01R\ttimeScale\x12\x1d\n" +
+	"\n" +
+	"start_time\x18\x06 \x01(\x03R\tstartTime\x12\x1f\n" +
+	"\vinput_delay\x18\a \x01(\x05R\n" +
+	"inputDelay\x12*\n" +
+	"\x06roster\x18\b \x03(\v2\x12.proto.RosterEntryR\x06roster\x12\x1d\n" +
+	"\n" +
+	"team_count\x18\t \x01(\x05R\tteamCount\x12/\n" +
+	"\bsettings\x18\n" +
+	" \x01(\v2\x13.proto.GameSettingsR\bsettings\"\x85\x01\n" +
+	"\vRosterEntry\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x12\x12\n" +
+	"\x04team\x18\x02 \x01(\x05R\x04team\x12\x12\n" +
+	"\x04slot\x18\x03 \x01(\x05R\x04slot\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x05 \x01(\x03R\taccountId\"<\n" +
+	"\x0eTeamAssignment\x12*\n" +
+	"\x06roster\x18\x01 \x03(\v2\x12.proto.RosterEntryR\x06roster\"\xb9\x01\n" +
+	"\fGameSettings\x12\x15\n" +
+	"\x06map_id\x18\x01 \x01(\tR\x05mapId\x12\x16\n" +
+	"\x06preset\x18\x02 \x01(\tR\x06preset\x12=\n" +
+	"\btunables\x18\x03 \x03(\v2!.proto.GameSettings.TunablesEntryR\btunables\x1a;\n" +
+	"\rTunablesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"U\n" +
+	"\fRoomSettings\x12/\n" +
+	"\bsettings\x18\x01 \x01(\v2\x13.proto.GameSettingsR\bsettings\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"V\n" +
+	"\x10InputDelayChange\x12\x1f\n" +
+	"\vinput_delay\x18\x01 \x01(\x05R\n" +
+	"inputDelay\x12!\n" +
+	"\fframe_number\x18\x02 \x01(\x03R\vframeNumber\"\x7f\n" +
+	"\x0fTimeScaleChange\x12\x1d\n" +
+	"\n" +
+	"time_scale\x18\x01 \x01(\x01R\ttimeScale\x12!\n" +
+	"\fframe_number\x18\x02 \x01(\x03R\vframeNumber\x12*\n" +
+	"\x11frame_interval_ns\x18\x03 \x01(\x03R\x0fframeIntervalNs\":\n" +
+	"\fGetLossFrame\x12*\n" +
+	"\x11last_frame_number\x18\x01 \x01(\x03R\x0flastFrameNumber\"H\n" +
+	"\fSendAllFrame\x128\n" +
+	"\x0eall_need_frame\x18\x01 \x03(\v2\x12.proto.ServerFrameR\fallNeedFrame\"\v\n" +
+	"\tHeartbeat\"\xa1\x01\n" +
+	"\x04Ping\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x03R\bsequence\x12(\n" +
+	"\x10client_send_time\x18\x02 \x01(\x03R\x0eclientSendTime\x121\n" +
+	"\x15echo_server_send_time\x18\x03 \x01(\x03R\x12echoServerSendTime\x12 \n" +
+	"\fecho_hold_ns\x18\x04 \x01(\x03R\n" +
+	"echoHoldNs\"\xc5\x02\n" +
+	"\x04Pong\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x03R\bsequence\x12(\n" +
+	"\x10client_send_time\x18\x02 \x01(\x03R\x0eclientSendTime\x12.\n" +
+	"\x13server_receive_time\x18\x03 \x01(\x03R\x11serverReceiveTime\x12(\n" +
+	"\x10server_send_time\x18\x04 \x01(\x03R\x0eserverSendTime\x12\x15\n" +
+	"\x06rtt_ns\x18\x05 \x01(\x03R\x05rttNs\x12*\n" +
+	"\x11frame_anchor_time\x18\x06 \x01(\x03R\x0fframeAnchorTime\x12.\n" +
+	"\x13frame_anchor_number\x18\a \x01(\x03R\x11frameAnchorNumber\x12*\n" +
+	"\x11frame_interval_ns\x18\b \x01(\x03R\x0fframeIntervalNs\"\x9f\x01\n" +
+	"\fPauseMessage\x12\x16\n" +
+	"\x06paused\x18\x01 \x01(\bR\x06paused\x12!\n" +
+	"\fframe_number\x18\x02 \x01(\x03R\vframeNumber\x12\x1b\n" +
+	"\tplayer_id\x18\x03 \x01(\x05R\bplayerId\x12\x14\n" +
+	"\x05votes\x18\x04 \x01(\x05R\x05votes\x12!\n" +
+	"\fvotes_needed\x18\x05 \x01(\x05R\vvotesNeeded\"A\n" +
+	"\fPlayerResult\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x05R\bplayerId\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x03R\x05score\"\xa4\x01\n" +
+	"\bMatchEnd\x12!\n" +
+	"\fframe_number\x18\x01 \x01(\x03R\vframeNumber\x12 \n" +
+	"\twinner_id\x18\x02 \x01(\x05H\x00R\bwinnerId\x88\x01\x01\x12-\n" +
+	"\aresults\x18\x03 \x03(\v2\x13.proto.PlayerResultR\aresults\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reasonB\f\n" +
+	"\n" +
+	"_winner_id\"H\n" +
+	"\x0fPostMatchChoice\x12\x18\n" +
+	"\arematch\x18\x01 \x01(\bR\arematch\x12\x1b\n" +
+	"\tplayer_id\x18\x02 \x01(\x05R\bplayerId\"\xa9\x02\n" +
+	"\vMatchResult\x12\x1f\n" +
+	"\vfinal_frame\x18\x01 \x01(\x03R\n" +
+	"finalFrame\x12 \n" +
+	"\twinner_id\x18\x02 \x01(\x05H\x00R\bwinnerId\x88\x01\x01\x12-\n" +
+	"\aresults\x18\x03 \x03(\v2\x13.proto.PlayerResultR\aresults\x12\x1d\n" +
+	"\n" +
+	"state_hash\x18\x04 \x01(\fR\tstateHash\x12\x16\n" +
+	"\x06agreed\x18\x05 \x01(\bR\x06agreed\x12'\n" +
+	"\x0fdisagreeing_ids\x18\x06 \x03(\x05R\x0edisagreeingIds\x12\x1f\n" +
+	"\vmissing_ids\x18\a \x03(\x05R\n" +
+	"missingIds\x12\x19\n" +
+	"\bmatch_id\x18\b \x01(\tR\amatchIdB\f\n" +
+	"\n" +
+	"_winner_id\"\xac\x03\n" +
+	"\vMatchRecord\x12\x19\n" +
+	"\bmatch_id\x18\x01 \x01(\tR\amatchId\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\tR\x06roomId\x12\x14\n" +
+	"\x05round\x18\x03 \x01(\x05R\x05round\x12\x1d\n" +
+	"\n" +
+	"start_time\x18\x04 \x01(\x03R\tstartTime\x12\x19\n" +
+	"\bend_time\x18\x05 \x01(\x03R\aendTime\x12/\n" +
+	"\n" +
+	"game_start\x18\x06 \x01(\v2\x10.proto.GameStartR\tgameStart\x12,\n" +
+	"\averdict\x18\a \x01(\v2\x12.proto.MatchResultR\averdict\x12E\n" +
+	"\vsubmissions\x18\b \x03(\v2#.proto.MatchRecord.SubmissionsEntryR\vsubmissions\x12\x1f\n" +
+	"\vreplay_file\x18\t \x01(\tR\n" +
+	"replayFile\x1aR\n" +
+	"\x10SubmissionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.proto.MatchResultR\x05value:\x028\x01\"\x80\x01\n" +
+	"\x06Replay\x12\x19\n" +
+	"\bmatch_id\x18\x01 \x01(\tR\amatchId\x12/\n" +
+	"\n" +
+	"game_start\x18\x02 \x01(\v2\x10.proto.GameStartR\tgameStart\x12*\n" +
+	"\x06frames\x18\x03 \x03(\v2\x12.proto.ServerFrameR\x06frames\"\xd1\x01\n" +
+	"\rPlayerAccount\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x03 \x01(\x03R\tcreatedAt\x12\x1b\n" +
+	"\tlast_seen\x18\x04 \x01(\x03R\blastSeen\x12%\n" +
+	"\x0ematches_played\x18\x05 \x01(\x05R\rmatchesPlayed\x12\x12\n" +
+	"\x04wins\x18\x06 \x01(\x05R\x04wins\x12\x16\n" +
+	"\x06rating\x18\a \x01(\x05R\x06rating\"\xb5\x01\n" +
+	"\x10MatchParticipant\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\x12\x1b\n" +
+	"\tplayer_id\x18\x02 \x01(\x05R\bplayerId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x14\n" +
+	"\x05score\x18\x04 \x01(\x03R\x05score\x12\x16\n" +
+	"\x06winner\x18\x05 \x01(\bR\x06winner\x12#\n" +
+	"\rrating_change\x18\x06 \x01(\x05R\fratingChange\"\xab\x02\n" +
+	"\fMatchSummary\x12\x19\n" +
+	"\bmatch_id\x18\x01 \x01(\tR\amatchId\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\tR\x06roomId\x12\x1d\n" +
+	"\n" +
+	"start_time\x18\x03 \x01(\x03R\tstartTime\x12\x19\n" +
+	"\bend_time\x18\x04 \x01(\x03R\aendTime\x12\x1f\n" +
+	"\vduration_ms\x18\x05 \x01(\x03R\n" +
+	"durationMs\x12\x1f\n" +
+	"\vfinal_frame\x18\x06 \x01(\x03R\n" +
+	"finalFrame\x12;\n" +
+	"\fparticipants\x18\a \x03(\v2\x17.proto.MatchParticipantR\fparticipants\x12\x16\n" +
+	"\x06agreed\x18\b \x01(\bR\x06agreed\x12\x16\n" +
+	"\x06reason\x18\t \x01(\tR\x06reason\"r\n" +
+	"\fMatchHistory\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\x03R\taccountId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12-\n" +
+	"\amatches\x18\x03 \x03(\v2\x13.proto.MatchSummaryR\amatches\"\xcf\x01\n" +
+	"\n" +
+	"MatchQueue\x12\x12\n" +
+	"\x04mode\x18\x01 \x01(\tR\x04mode\x12\x1b\n" +
+	"\tteam_size\x18\x02 \x01(\x05R\bteamSize\x12\x16\n" +
+	"\x06queued\x18\x03 \x01(\bR\x06queued\x12\x16\n" +
+	"\x06rating\x18\x04 \x01(\x05R\x06rating\x12!\n" +
+	"\frating_range\x18\x05 \x01(\x05R\vratingRange\x12'\n" +
+	"\x0fplayers_waiting\x18\x06 \x01(\x05R\x0eplayersWaiting\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\"\xf2\x01\n" +
+	"\n" +
+	"MatchFound\x12\x1f\n" +
+	"\vproposal_id\x18\x01 \x01(\x04R\n" +
+	"proposalId\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\x12\x1b\n" +
+	"\tteam_size\x18\x03 \x01(\x05R\bteamSize\x12\x1d\n" +
+	"\n" +
+	"player_ids\x18\x04 \x03(\x05R\tplayerIds\x12\x1a\n" +
+	"\bdeadline\x18\x05 \x01(\x03R\bdeadline\x12\x16\n" +
+	"\x06accept\x18\x06 \x01(\bR\x06accept\x12!\n" +
+	"\faccepted_ids\x18\a \x03(\x05R\vacceptedIds\x12\x1c\n" +
+	"\tcancelled\x18\b \x01(\bR\tcancelled\"\xed\x01\n" +
+	"\x11CreateRoomRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1f\n" +
+	"\vmax_players\x18\x02 \x01(\x05R\n" +
+	"maxPlayers\x12\x1d\n" +
+	"\n" +
+	"frame_rate\x18\x03 \x01(\x05R\tframeRate\x12\x1d\n" +
+	"\n" +
+	"team_count\x18\x04 \x01(\x05R\tteamCount\x12\x18\n" +
+	"\aprivate\x18\x05 \x01(\bR\aprivate\x12\x1a\n" +
+	"\bpassword\x18\x06 \x01(\tR\bpassword\x12/\n" +
+	"\bsettings\x18\a \x01(\v2\x13.proto.GameSettingsR\bsettings\"F\n" +
+	"\x0fJoinRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"\xfb\x01\n" +
+	"\bRoomInfo\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x17\n" +
+	"\ahost_id\x18\x03 \x01(\x05R\x06hostId\x12\x1d\n" +
+	"\n" +
+	"player_ids\x18\x04 \x03(\x05R\tplayerIds\x12\x1f\n" +
+	"\vmax_players\x18\x05 \x01(\x05R\n" +
+	"maxPlayers\x12\x18\n" +
+	"\aprivate\x18\x06 \x01(\bR\aprivate\x12!\n" +
+	"\fhas_password\x18\a \x01(\bR\vhasPassword\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error\x12\x16\n" +
+	"\x06locked\x18\t \x01(\bR\x06locked\"\xa5\x01\n" +
+	"\vHostCommand\x12)\n" +
+	"\x06action\x18\x01 \x01(\x0e2\x11.proto.HostActionR\x06action\x12\x1b\n" +
+	"\ttarget_id\x18\x02 \x01(\x05R\btargetId\x12\x1f\n" +
+	"\vmax_players\x18\x03 \x01(\x05R\n" +
+	"maxPlayers\x12\x17\n" +
+	"\ahost_id\x18\x04 \x01(\x05R\x06hostId\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error*\xed\x04\n" +
+	"\vMessageType\x12\x13\n" +
+	"\x0fMESSAGE_UNKNOWN\x10\x00\x12\x13\n" +
+	"\x0fMESSAGE_CONNECT\x10\x01\x12\x16\n" +
+	"\x12MESSAGE_FRAME_DATA\x10\x02\x12\x18\n" +
+	"\x14MESSAGE_SERVER_FRAME\x10\x03\x12\x16\n" +
+	"\x12MESSAGE_DISCONNECT\x10\x04\x12\x16\n" +
+	"\x12MESSAGE_GAME_START\x10\x05\x12\x16\n" +
+	"\x12MESSAGE_FRAME_LOSS\x10\x06\x12\x16\n" +
+	"\x12MESSAGE_FRAME_NEED\x10\a\x12\x15\n" +
+	"\x11MESSAGE_HEARTBEAT\x10\b\x12\x16\n" +
+	"\x12MESSAGE_TIME_SCALE\x10\t\x12\x10\n" +
+	"\fMESSAGE_PING\x10\n" +
+	"\x12\x10\n" +
+	"\fMESSAGE_PONG\x10\v\x12\x17\n" +
+	"\x13MESSAGE_INPUT_DELAY\x10\f\x12\x11\n" +
+	"\rMESSAGE_PAUSE\x10\r\x12\x15\n" +
+	"\x11MESSAGE_MATCH_END\x10\x0e\x12\x16\n" +
+	"\x12MESSAGE_POST_MATCH\x10\x0f\x12\x18\n" +
+	"\x14MESSAGE_MATCH_RESULT\x10\x10\x12\x19\n" +
+	"\x15MESSAGE_MATCH_HISTORY\x10\x11\x12\x11\n" +
+	"\rMESSAGE_QUEUE\x10\x12\x12\x17\n" +
+	"\x13MESSAGE_MATCH_FOUND\x10\x13\x12\x17\n" +
+	"\x13MESSAGE_TEAM_ASSIGN\x10\x14\x12\x19\n" +
+	"\x15MESSAGE_ROOM_SETTINGS\x10\x15\x12\x17\n" +
+	"\x13MESSAGE_CREATE_ROOM\x10\x16\x12\x15\n" +
+	"\x11MESSAGE_JOIN_ROOM\x10\x17\x12\x15\n" +
+	"\x11MESSAGE_ROOM_INFO\x10\x18\x12\x18\n" +
+	"\x14MESSAGE_HOST_COMMAND\x10\x19*\xd5\x01\n" +
+	"\x0eInputDirection\x12\x12\n" +
+	"\x0eDIRECTION_NONE\x10\x00\x12\x10\n" +
+	"\fDIRECTION_UP\x10\x01\x12\x12\n" +
+	"\x0eDIRECTION_DOWN\x10\x02\x12\x12\n" +
+	"\x0eDIRECTION_LEFT\x10\x03\x12\x13\n" +
+	"\x0fDIRECTION_RIGHT\x10\x04\x12\x15\n" +
+	"\x11DIRECTION_UP_LEFT\x10\x05\x12\x16\n" +
+	"\x12DIRECTION_UP_RIGHT\x10\x06\x12\x17\n" +
+	"\x13DIRECTION_DOWN_LEFT\x10\a\x12\x18\n" +
+	"\x14DIRECTION_DOWN_RIGHT\x10\b*\xa9\x01\n" +
+	"\n" +
+	"HostAction\x12\x17\n" +
+	"\x13HOST_ACTION_UNKNOWN\x10\x00\x12\x14\n" +
+	"\x10HOST_ACTION_KICK\x10\x01\x12\x1d\n" +
+	"\x19HOST_ACTION_TRANSFER_HOST\x10\x02\x12\x14\n" +
+	"\x10HOST_ACTION_LOCK\x10\x03\x12\x16\n" +
+	"\x12HOST_ACTION_UNLOCK\x10\x04\x12\x1f\n" +
+	"\x1bHOST_ACTION_SET_MAX_PLAYERS\x10\x05B\"Z github.com/WjcHome/gohello/protob\x06proto3"
 
 var (
 	file_proto_game_proto_rawDescOnce sync.Once
@@ -665,29 +3006,74 @@ func file_proto_game_proto_rawDescGZIP() []byte {
 	return file_proto_game_proto_rawDescData
 }
 
-var file_proto_game_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_proto_game_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_game_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_proto_game_proto_msgTypes = make([]protoimpl.MessageInfo, 35)
 var file_proto_game_proto_goTypes = []any{
 	(MessageType)(0),          // 0: proto.MessageType
 	(InputDirection)(0),       // 1: proto.InputDirection
-	(*FrameData)(nil),         // 2: proto.FrameData
-	(*ServerFrame)(nil),       // 3: proto.ServerFrame
-	(*ConnectMessage)(nil),    // 4: proto.ConnectMessage
-	(*DisconnectMessage)(nil), // 5: proto.DisconnectMessage
-	(*GameStart)(nil),         // 6: proto.GameStart
-	(*GetLossFrame)(nil),      // 7: proto.GetLossFrame
-	(*SendAllFrame)(nil),      // 8: proto.SendAllFrame
-	(*Heartbeat)(nil),         // 9: proto.Heartbeat
+	(HostAction)(0),           // 2: proto.HostAction
+	(*FrameData)(nil),         // 3: proto.FrameData
+	(*ServerFrame)(nil),       // 4: proto.ServerFrame
+	(*ConnectMessage)(nil),    // 5: proto.ConnectMessage
+	(*DisconnectMessage)(nil), // 6: proto.DisconnectMessage
+	(*GameStart)(nil),         // 7: proto.GameStart
+	(*RosterEntry)(nil),       // 8: proto.RosterEntry
+	(*TeamAssignment)(nil),    // 9: proto.TeamAssignment
+	(*GameSettings)(nil),      // 10: proto.GameSettings
+	(*RoomSettings)(nil),      // 11: proto.RoomSettings
+	(*InputDelayChange)(nil),  // 12: proto.InputDelayChange
+	(*TimeScaleChange)(nil),   // 13: proto.TimeScaleChange
+	(*GetLossFrame)(nil),      // 14: proto.GetLossFrame
+	(*SendAllFrame)(nil),      // 15: proto.SendAllFrame
+	(*Heartbeat)(nil),         // 16: proto.Heartbeat
+	(*Ping)(nil),              // 17: proto.Ping
+	(*Pong)(nil),              // 18: proto.Pong
+	(*PauseMessage)(nil),      // 19: proto.PauseMessage
+	(*PlayerResult)(nil),      // 20: proto.PlayerResult
+	(*MatchEnd)(nil),          // 21: proto.MatchEnd
+	(*PostMatchChoice)(nil),   // 22: proto.PostMatchChoice
+	(*MatchResult)(nil),       // 23: proto.MatchResult
+	(*MatchRecord)(nil),       // 24: proto.MatchRecord
+	(*Replay)(nil),            // 25: proto.Replay
+	(*PlayerAccount)(nil),     // 26: proto.PlayerAccount
+	(*MatchParticipant)(nil),  // 27: proto.MatchParticipant
+	(*MatchSummary)(nil),      // 28: proto.MatchSummary
+	(*MatchHistory)(nil),      // 29: proto.MatchHistory
+	(*MatchQueue)(nil),        // 30: proto.MatchQueue
+	(*MatchFound)(nil),        // 31: proto.MatchFound
+	(*CreateRoomRequest)(nil), // 32: proto.CreateRoomRequest
+	(*JoinRoomRequest)(nil),   // 33: proto.JoinRoomRequest
+	(*RoomInfo)(nil),          // 34: proto.RoomInfo
+	(*HostCommand)(nil),       // 35: proto.HostCommand
+	nil,                       // 36: proto.GameSettings.TunablesEntry
+	nil,                       // 37: proto.MatchRecord.SubmissionsEntry
 }
 var file_proto_game_proto_depIdxs = []int32{
-	1, // 0: proto.FrameData.direction:type_name -> proto.InputDirection
-	2, // 1: proto.ServerFrame.frame_datas:type_name -> proto.FrameData
-	3, // 2: proto.SendAllFrame.all_need_frame:type_name -> proto.ServerFrame
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	1,  // 0: proto.FrameData.direction:type_name -> proto.InputDirection
+	3,  // 1: proto.ServerFrame.frame_datas:type_name -> proto.FrameData
+	8,  // 2: proto.GameStart.roster:type_name -> proto.RosterEntry
+	10, // 3: proto.GameStart.settings:type_name -> proto.GameSettings
+	8,  // 4: proto.TeamAssignment.roster:type_name -> proto.RosterEntry
+	36, // 5: proto.GameSettings.tunables:type_name -> proto.GameSettings.TunablesEntry
+	10, // 6: proto.RoomSettings.settings:type_name -> proto.GameSettings
+	4,  // 7: proto.SendAllFrame.all_need_frame:type_name -> proto.ServerFrame
+	20, // 8: proto.MatchEnd.results:type_name -> proto.PlayerResult
+	20, // 9: proto.MatchResult.results:type_name -> proto.PlayerResult
+	7,  // 10: proto.MatchRecord.game_start:type_name -> proto.GameStart
+	23, // 11: proto.MatchRecord.verdict:type_name -> proto.MatchResult
+	37, // 12: proto.MatchRecord.submissions:type_name -> proto.MatchRecord.SubmissionsEntry
+	7,  // 13: proto.Replay.game_start:type_name -> proto.GameStart
+	4,  // 14: proto.Replay.frames:type_name -> proto.ServerFrame
+	27, // 15: proto.MatchSummary.participants:type_name -> proto.MatchParticipant
+	28, // 16: proto.MatchHistory.matches:type_name -> proto.MatchSummary
+	10, // 17: proto.CreateRoomRequest.settings:type_name -> proto.GameSettings
+	2,  // 18: proto.HostCommand.action:type_name -> proto.HostAction
+	23, // 19: proto.MatchRecord.SubmissionsEntry.value:type_name -> proto.MatchResult
+	20, // [20:20] is the sub-list for method output_type
+	20, // [20:20] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
 }
 
 func init() { file_proto_game_proto_init() }
@@ -696,13 +3082,15 @@ func file_proto_game_proto_init() {
 		return
 	}
 	file_proto_game_proto_msgTypes[0].OneofWrappers = []any{}
+	file_proto_game_proto_msgTypes[18].OneofWrappers = []any{}
+	file_proto_game_proto_msgTypes[20].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_game_proto_rawDesc), len(file_proto_game_proto_rawDesc)),
-			NumEnums:      2,
-			NumMessages:   8,
+			NumEnums:      3,
+			NumMessages:   35,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
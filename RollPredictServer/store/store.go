@@ -0,0 +1,326 @@
+// Package store 是服务器的本地持久化层：玩家账号和比赛历史。
+//
+// 数据保存在一个 bbolt 嵌入式数据库文件中，值使用 protobuf 编码：
+//
+//	accounts        账号ID(8字节大端) -> PlayerAccount
+//	tokens          登录令牌 -> 账号ID
+//	matches         比赛ID -> MatchSummary
+//	player_matches  账号ID + 结束时间 + 比赛ID -> 空（按玩家查询比赛历史的索引）
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	myproto "github.com/WjcHome/gohello/proto"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MaxNameLength = 32   // 显示名称最大长度（字符数）
+	DefaultRating = 1500 // 新账号的匹配分数
+	tokenBytes    = 16   // 登录令牌的随机字节数
+)
+
+var (
+	ErrUnknownToken = errors.New("store: unknown token")
+	ErrInvalidName  = errors.New("store: invalid player name")
+	ErrNotFound     = errors.New("store: not found")
+)
+
+var (
+	accountsBucket      = []byte("accounts")
+	tokensBucket        = []byte("tokens")
+	matchesBucket       = []byte("matches")
+	playerMatchesBucket = []byte("player_matches")
+)
+
+// Store 是玩家账号和比赛历史的数据库，可以并发使用
+type Store struct {
+	db *bolt.DB
+}
+
+// Open 打开（不存在时创建）数据库文件
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// 另一个进程占用数据库时不要一直等待
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("store: open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{accountsBucket, tokensBucket, matchesBucket, playerMatchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close 关闭数据库
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+// ValidateName 去掉首尾空白并检查名称长度和字符
+func ValidateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > MaxNameLength {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f {
+			return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+	}
+	return name, nil
+}
+
+// Login 用令牌登录已有账号，令牌为空时创建新账号。
+// name 不为空时更新显示名称。返回账号和登录令牌。
+func (st *Store) Login(token, name string) (*myproto.PlayerAccount, string, error) {
+	name, err := ValidateName(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var account *myproto.PlayerAccount
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		accounts := tx.Bucket(accountsBucket)
+		tokens := tx.Bucket(tokensBucket)
+		now := time.Now().UnixNano()
+
+		if token == "" {
+			id, err := accounts.NextSequence()
+			if err != nil {
+				return err
+			}
+			token, err = newToken()
+			if err != nil {
+				return err
+			}
+			account = &myproto.PlayerAccount{AccountId: int64(id), CreatedAt: now, Rating: DefaultRating}
+			if name == "" {
+				name = fmt.Sprintf("Player %d", id)
+			}
+			if err := tokens.Put([]byte(token), accountKey(account.AccountId)); err != nil {
+				return err
+			}
+		} else {
+			key := tokens.Get([]byte(token))
+			if key == nil {
+				return ErrUnknownToken
+			}
+			account = &myproto.PlayerAccount{}
+			if err := getProto(accounts, key, account); err != nil {
+				return err
+			}
+		}
+
+		if name != "" {
+			account.Name = name
+		}
+		account.LastSeen = now
+		return putProto(accounts, accountKey(account.AccountId), account)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return account, token, nil
+}
+
+// Account 查询一个账号
+func (st *Store) Account(accountID int64) (*myproto.PlayerAccount, error) {
+	account := &myproto.PlayerAccount{}
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return getProto(tx.Bucket(accountsBucket), accountKey(accountID), account)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Accounts 按账号ID顺序返回所有账号
+func (st *Store) Accounts() ([]*myproto.PlayerAccount, error) {
+	var accounts []*myproto.PlayerAccount
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(accountsBucket).ForEach(func(_, value []byte) error {
+			account := &myproto.PlayerAccount{}
+			if err := proto.Unmarshal(value, account); err != nil {
+				return err
+			}
+			accounts = append(accounts, account)
+			return nil
+		})
+	})
+	return accounts, err
+}
+
+// Rating 返回账号的匹配分数，没有分数的旧账号使用默认分数
+func Rating(account *myproto.PlayerAccount) int32 {
+	if account == nil || account.Rating == 0 {
+		return DefaultRating
+	}
+	return account.Rating
+}
+
+// UpdateRatings 在一个事务中给多个账号加上分数变化，返回新的分数
+func (st *Store) UpdateRatings(changes map[int64]int32) (map[int64]int32, error) {
+	ratings := make(map[int64]int32, len(changes))
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		accounts := tx.Bucket(accountsBucket)
+		for id, change := range changes {
+			account := &myproto.PlayerAccount{}
+			if err := getProto(accounts, accountKey(id), account); err != nil {
+				return fmt.Errorf("account %d: %w", id, err)
+			}
+			// 分数不低于1，0表示没有分数
+			account.Rating = max(Rating(account)+change, 1)
+			if err := putProto(accounts, accountKey(id), account); err != nil {
+				return err
+			}
+			ratings[id] = account.Rating
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// RecordMatch 保存一场比赛，并更新参赛账号的比赛数和胜场。
+// 同一个比赛ID只记录一次。
+func (st *Store) RecordMatch(match *myproto.MatchSummary) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		matches := tx.Bucket(matchesBucket)
+		if matches.Get([]byte(match.MatchId)) != nil {
+			return nil
+		}
+		if err := putProto(matches, []byte(match.MatchId), match); err != nil {
+			return err
+		}
+
+		accounts := tx.Bucket(accountsBucket)
+		index := tx.Bucket(playerMatchesBucket)
+		for _, p := range match.Participants {
+			if p.AccountId == 0 {
+				continue
+			}
+			account := &myproto.PlayerAccount{}
+			if err := getProto(accounts, accountKey(p.AccountId), account); err != nil {
+				return err
+			}
+			account.MatchesPlayed++
+			if p.Winner {
+				account.Wins++
+			}
+			if err := putProto(accounts, accountKey(p.AccountId), account); err != nil {
+				return err
+			}
+			if err := index.Put(historyKey(p.AccountId, match.EndTime, match.MatchId), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MatchHistory 返回一个账号最近的比赛，按结束时间从新到旧
+func (st *Store) MatchHistory(accountID int64, limit int) ([]*myproto.MatchSummary, error) {
+	var history []*myproto.MatchSummary
+	err := st.db.View(func(tx *bolt.Tx) error {
+		matches := tx.Bucket(matchesBucket)
+		prefix := accountKey(accountID)
+		// 从下一个账号的第一个键往回遍历
+		cursor := tx.Bucket(playerMatchesBucket).Cursor()
+		key, _ := cursor.Seek(accountKey(accountID + 1))
+		if key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix) && len(history) < limit; key, _ = cursor.Prev() {
+			match := &myproto.MatchSummary{}
+			if err := getProto(matches, key[16:], match); err != nil {
+				return err
+			}
+			history = append(history, match)
+		}
+		return nil
+	})
+	return history, err
+}
+
+// RecentMatches 返回最近的比赛（比赛ID以开始时间开头，按ID从新到旧）
+func (st *Store) RecentMatches(limit int) ([]*myproto.MatchSummary, error) {
+	var recent []*myproto.MatchSummary
+	err := st.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(matchesBucket).Cursor()
+		for key, value := cursor.Last(); key != nil && len(recent) < limit; key, value = cursor.Prev() {
+			match := &myproto.MatchSummary{}
+			if err := proto.Unmarshal(value, match); err != nil {
+				return err
+			}
+			recent = append(recent, match)
+		}
+		return nil
+	})
+	return recent, err
+}
+
+// 生成随机登录令牌
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 账号键：大端编码，按ID顺序遍历
+func accountKey(accountID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(accountID))
+}
+
+// 比赛历史索引键：账号ID + 结束时间 + 比赛ID
+func historyKey(accountID, endTime int64, matchID string) []byte {
+	key := accountKey(accountID)
+	key = binary.BigEndian.AppendUint64(key, uint64(endTime))
+	return append(key, matchID...)
+}
+
+func getProto(bucket *bolt.Bucket, key []byte, msg proto.Message) error {
+	value := bucket.Get(key)
+	if value == nil {
+		return ErrNotFound
+	}
+	return proto.Unmarshal(value, msg)
+}
+
+func putProto(bucket *bolt.Bucket, key []byte, msg proto.Message) error {
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
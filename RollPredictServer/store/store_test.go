@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	myproto "github.com/WjcHome/gohello/proto"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "players.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st, path
+}
+
+func TestLoginCreatesAndRestoresAccounts(t *testing.T) {
+	st, path := openTestStore(t)
+
+	alice, token, err := st.Login("", "  alice ")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if alice.AccountId == 0 || alice.Name != "alice" || len(token) != 2*tokenBytes {
+		t.Fatalf("new account %v, token %q", alice, token)
+	}
+	guest, guestToken, err := st.Login("", "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if guest.AccountId == alice.AccountId || guestToken == token || !strings.HasPrefix(guest.Name, "Player ") {
+		t.Fatalf("second account %v", guest)
+	}
+
+	// 重新打开数据库后用令牌登录，得到同一个账号，空名称不覆盖原名称
+	st.Close()
+	st, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer st.Close()
+	again, againToken, err := st.Login(token, "")
+	if err != nil {
+		t.Fatalf("login with token: %v", err)
+	}
+	if again.AccountId != alice.AccountId || again.Name != "alice" || againToken != token {
+		t.Fatalf("restored account %v", again)
+	}
+	renamed, _, err := st.Login(token, "Alice")
+	if err != nil || renamed.Name != "Alice" {
+		t.Fatalf("rename: %v %v", renamed, err)
+	}
+
+	if _, _, err := st.Login("not-a-token", ""); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("unknown token error = %v", err)
+	}
+	for _, name := range []string{strings.Repeat("x", MaxNameLength+1), "bad\nname", "\xff"} {
+		if _, _, err := st.Login("", name); !errors.Is(err, ErrInvalidName) {
+			t.Fatalf("name %q accepted: %v", name, err)
+		}
+	}
+	accounts, err := st.Accounts()
+	if err != nil || len(accounts) != 2 {
+		t.Fatalf("accounts = %v, %v", accounts, err)
+	}
+}
+
+func TestUpdateRatings(t *testing.T) {
+	st, _ := openTestStore(t)
+	alice, _, _ := st.Login("", "alice")
+	bob, _, _ := st.Login("", "bob")
+	if Rating(alice) != DefaultRating || Rating(&myproto.PlayerAccount{}) != DefaultRating {
+		t.Fatalf("new account rating %d", alice.Rating)
+	}
+
+	ratings, err := st.UpdateRatings(map[int64]int32{alice.AccountId: 16, bob.AccountId: -DefaultRating})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if ratings[alice.AccountId] != DefaultRating+16 || ratings[bob.AccountId] != 1 {
+		t.Fatalf("ratings = %v", ratings)
+	}
+	if alice, _ = st.Account(alice.AccountId); alice.Rating != DefaultRating+16 {
+		t.Fatalf("stored rating %d", alice.Rating)
+	}
+	// 任何一个账号不存在时整个事务不生效
+	if _, err := st.UpdateRatings(map[int64]int32{alice.AccountId: 10, 12345: 10}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown account error = %v", err)
+	}
+	if alice, _ = st.Account(alice.AccountId); alice.Rating != DefaultRating+16 {
+		t.Fatalf("rating changed by failed update: %d", alice.Rating)
+	}
+}
+
+func TestMatchHistory(t *testing.T) {
+	st, _ := openTestStore(t)
+	alice, _, _ := st.Login("", "alice")
+	bob, _, _ := st.Login("", "bob")
+
+	match := func(id string, endTime int64, winner int64) *myproto.MatchSummary {
+		return &myproto.MatchSummary{
+			MatchId: id,
+			EndTime: endTime,
+			Participants: []*myproto.MatchParticipant{
+				{AccountId: alice.AccountId, Winner: winner == alice.AccountId},
+				{AccountId: bob.AccountId, Winner: winner == bob.AccountId},
+				{PlayerId: 9}, // 未登录的玩家不建索引
+			},
+		}
+	}
+	for _, m := range []*myproto.MatchSummary{
+		match("m1", 100, alice.AccountId),
+		match("m2", 200, bob.AccountId),
+		match("m3", 300, alice.AccountId),
+	} {
+		if err := st.RecordMatch(m); err != nil {
+			t.Fatalf("record %s: %v", m.MatchId, err)
+		}
+	}
+	// 重复记录同一场比赛不会重复计数
+	if err := st.RecordMatch(match("m3", 300, alice.AccountId)); err != nil {
+		t.Fatalf("record again: %v", err)
+	}
+
+	history, err := st.MatchHistory(alice.AccountId, 10)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	var ids []string
+	for _, m := range history {
+		ids = append(ids, m.MatchId)
+	}
+	if strings.Join(ids, ",") != "m3,m2,m1" {
+		t.Fatalf("history = %v, want newest first", ids)
+	}
+	if history, _ := st.MatchHistory(bob.AccountId, 1); len(history) != 1 || history[0].MatchId != "m3" {
+		t.Fatalf("limited history = %v", history)
+	}
+	if history, _ := st.MatchHistory(bob.AccountId+1, 10); len(history) != 0 {
+		t.Fatalf("unknown account has history %v", history)
+	}
+
+	alice, _ = st.Account(alice.AccountId)
+	bob, _ = st.Account(bob.AccountId)
+	if alice.MatchesPlayed != 3 || alice.Wins != 2 || bob.MatchesPlayed != 3 || bob.Wins != 1 {
+		t.Fatalf("stats alice %v, bob %v", alice, bob)
+	}
+	if recent, _ := st.RecentMatches(2); len(recent) != 2 || recent[0].MatchId != "m3" {
+		t.Fatalf("recent = %v", recent)
+	}
+	if _, err := st.Account(12345); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing account error = %v", err)
+	}
+}
@@ -11,7 +11,8 @@ if [ $? -eq 0 ]; then
     echo "TCP服务器监听: :8089"
     echo "KCP服务器监听: :8088"
     echo ""
-    ./frame_sync_server
+    # Unity客户端连接后等待开局，需要服务器自动分配房间
+    ./frame_sync_server -auto-assign
 else
     echo "编译失败！"
     exit 1